@@ -1,12 +1,59 @@
 package cmd
 
 import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
 	"go-ai-agent-v2/go-cli/pkg/server"
+	"go-ai-agent-v2/go-cli/pkg/services"
+
 	"github.com/spf13/cobra"
 )
 
 // runAgentCmd will start the agent server.
 func runAgentCmd(rootCmd *cobra.Command, cmd *cobra.Command, args []string) {
-	srv := server.NewServer(chatService, SessionService)
+	// Every session gets its own chat service and executor.
+	sessions := server.NewSessionManager(func() (*services.ChatService, error) {
+		return createChatService(Cfg, SettingsService, SessionService, ContextService)
+	}, agentIntSetting("maxSessions"), time.Duration(agentIntSetting("sessionIdleTimeout"))*time.Second)
+
+	jobStore, err := newJobStore()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error initializing task store: %v\n", err)
+		os.Exit(1)
+	}
+
+	srv := server.NewServer(sessions, SessionService, server.TaskQueueOptions{
+		Store:        jobStore,
+		Workers:      agentIntSetting("taskWorkers"),
+		MaxAttempts:  agentIntSetting("taskMaxAttempts"),
+		RetryBackoff: time.Duration(agentIntSetting("taskRetryBackoff")) * time.Second,
+	})
+	srv.Auth = server.NewAuthenticator(SettingsService.GetServerAuthSettings())
+	if !srv.Auth.Enabled() {
+		log.Printf("Warning: serverAuth has no tokens or webhook secret; the agent server accepts unauthenticated requests")
+	}
 	srv.Start(":8080")
 }
+
+// newJobStore keeps queued tasks next to the sessions: in Redis, sharing the
+// session store's connection, or in the .goaiagent/tasks directory.
+func newJobStore() (services.JobStore, error) {
+	if redisStore, ok := SessionService.Store().(*services.RedisSessionStore); ok {
+		return services.NewRedisJobStore(redisStore.Client()), nil
+	}
+	projectRoot, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+	return services.NewFileJobStore(filepath.Join(projectRoot, ".goaiagent", "tasks"))
+}
+
+// agentIntSetting returns a numeric setting, or 0 when it is unset or invalid.
+func agentIntSetting(key string) int {
+	n, _ := services.IntSetting(SettingsService, key)
+	return n
+}
@@ -30,6 +30,7 @@ func init() {
 	chatCmd.Flags().String("session-id", "", "Specify an existing session ID to resume or create a new one with this ID")
 	chatCmd.Flags().Bool("new-session", false, "Force creation of a new session (generates a new ID)")
 	chatCmd.Flags().Bool("list-sessions", false, "List all available sessions and exit")
+	chatCmd.Flags().String("filter", "", "Filter and sort --list-sessions, e.g. \"model:gpt-4o since:7d sort:cost refactor\"")
 	chatCmd.Flags().String("delete-session", "", "Delete a specific session by ID and exit")
 	chatCmd.Flags().Bool("latest", false, "Resume the latest session")
 }
@@ -45,7 +46,13 @@ func runChatCmd(rootCmd *cobra.Command, cmd *cobra.Command, args []string, setti
 
 	// Handle --list-sessions
 	if listSessions {
-		sessions, err := SessionService.ListSessions()
+		filter, _ := cmd.Flags().GetString("filter")
+		options, err := services.ParseSessionListOptions(strings.Fields(filter))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error parsing --filter: %v\n", err)
+			os.Exit(1)
+		}
+		sessions, err := SessionService.ListSessionMetadata(options)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "Error listing sessions: %v\n", err)
 			os.Exit(1)
@@ -54,9 +61,10 @@ func runChatCmd(rootCmd *cobra.Command, cmd *cobra.Command, args []string, setti
 			fmt.Println("No chat sessions found.")
 			os.Exit(0)
 		}
-		fmt.Println("Available chat sessions (newest first):")
-		for i, id := range sessions {
-			fmt.Printf("  %d: %s\n", i+1, id)
+		fmt.Println("Available chat sessions:")
+		for i, session := range sessions {
+			fmt.Printf("  %d: %s  %s\n", i+1, session.ID, session.Title)
+			fmt.Printf("     %s\n", sessionSummary(session))
 		}
 		os.Exit(0)
 	}
@@ -145,9 +153,30 @@ func runChatCmd(rootCmd *cobra.Command, cmd *cobra.Command, args []string, setti
 		if len(tokenUsage) > 0 {
 			fmt.Println("Token Usage:")
 			for model, usage := range tokenUsage {
-				fmt.Printf("  - %s: Input: %d, Output: %d\n", model, usage.InputTokens, usage.OutputTokens)
+				fmt.Printf("  - %s: Input: %d, Output: %d, Cost: $%.4f\n", model, usage.InputTokens, usage.OutputTokens, usage.CostUSD)
 			}
 		}
+		if sessionCost, dailyCost := m.GetCosts(); sessionCost > 0 || dailyCost > 0 {
+			fmt.Printf("Session cost: $%.4f (today: $%.2f)\n", sessionCost, dailyCost)
+		}
 		fmt.Printf("\nGood Bye!\n\n")
 	}
 }
+
+// sessionSummary describes the metadata of a session on one line.
+func sessionSummary(session *services.SessionMetadata) string {
+	summary := fmt.Sprintf("updated %s, %d messages", session.UpdatedAt.Format("2006-01-02 15:04"), session.MessageCount)
+	if session.Model != "" {
+		summary += fmt.Sprintf(", %s/%s", session.Executor, session.Model)
+	}
+	if tokens := session.InputTokens + session.OutputTokens; tokens > 0 {
+		summary += fmt.Sprintf(", %d tokens, $%.4f", tokens, session.CostUSD)
+	}
+	if session.WorkspaceDir != "" {
+		summary += ", in " + session.WorkspaceDir
+	}
+	if session.ParentID != "" {
+		summary += fmt.Sprintf(", fork of %s at message %d", session.ParentID, session.ForkIndex)
+	}
+	return summary
+}
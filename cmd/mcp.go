@@ -38,7 +38,10 @@ var mcpListCmd = &cobra.Command{
 			fmt.Fprintf(os.Stderr, "Error: Tool registry in config is not of expected type.\n")
 			return
 		}
-		manager := mcp.NewMcpClientManager(toolRegistry)
+		manager := McpManager
+		if manager == nil {
+			manager = mcp.NewMcpClientManager(toolRegistry)
+		}
 		servers := manager.ListServers(Cfg)
 
 		if len(servers) == 0 {
@@ -12,6 +12,7 @@ import (
 	"go-ai-agent-v2/go-cli/pkg/prompts"
 
 	"go-ai-agent-v2/go-cli/pkg/extension"
+	"go-ai-agent-v2/go-cli/pkg/mcp"
 
 	"go-ai-agent-v2/go-cli/pkg/services"
 
@@ -38,6 +39,7 @@ var ExtensionManager *extension.Manager         // Declare package-level extensi
 var ContextService *services.ContextService     // Declare package-level contextService
 var SettingsService types.SettingsServiceIface  // Declare package-level settingsService as interface
 var SessionService *services.SessionService     // Declare package-level sessionService
+var McpManager *mcp.McpClientManager            // Declare package-level MCP client manager
 
 var FSService services.FileSystemService             // Declare package-level FileSystemService
 var ShellService services.ShellExecutionService      // Declare package-level ShellExecutionService
@@ -85,6 +87,19 @@ func initServices(projectRoot string) (
 			fmt.Fprintf(os.Stderr, "Error initializing Redis session store: %v\n", err)
 			os.Exit(1)
 		}
+	case "sqlite":
+		dbPath := viper.GetString("sessionStore.sqlite.path")
+		if dbPath == "" {
+			dbPath = filepath.Join(".goaiagent", "sessions.db")
+		}
+		if !filepath.IsAbs(dbPath) {
+			dbPath = filepath.Join(projectRoot, dbPath)
+		}
+		sessionStore, err = services.NewSQLiteSessionStore(dbPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error initializing SQLite session store: %v\n", err)
+			os.Exit(1)
+		}
 	default:
 		sessionsPath := filepath.Join(projectRoot, ".goaiagent", "sessions")
 		sessionStore, err = services.NewFileSessionStore(sessionsPath)
@@ -133,6 +148,11 @@ func createChatService(appConfig types.Config, settingsService types.SettingsSer
 	if err != nil {
 		return nil, fmt.Errorf("error creating executor: %w", err)
 	}
+	if cassetteVal, ok := settingsService.Get("recordCassette"); ok {
+		if cassettePath, _ := cassetteVal.(string); cassettePath != "" {
+			executor = core.NewRecordingExecutor(executor, cassettePath)
+		}
+	}
 
 	chatService, err := services.NewChatService(executor, toolRegistry, sessionService, settingsService, contextService, appConfig, generationConfig, nil)
 	if err != nil {
@@ -169,14 +189,28 @@ func initConfig(
 		modelName = config.DEFAULT_GEMINI_MODEL // Fallback
 	}
 
+	mockScenarioVal, _ := settingsService.Get("mockScenario")
+	mockScenario, _ := mockScenarioVal.(string)
+
+	var mcpServers map[string]types.MCPServerConfig
+	if err := viper.UnmarshalKey("mcpServers", &mcpServers); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: could not parse mcpServers settings: %v\n", err)
+	}
+
 	params := &config.ConfigParameters{
 		DebugMode:    debugMode,
 		ModelName:    modelName,
+		McpServers:   mcpServers,
 		Telemetry:    telemetrySettings,
 		ToolRegistry: toolRegistry,
 		AgentRegistry: agentRegistry,
 		CodebaseInvestigator: codebaseInvestigatorSettings,
 		TestWriterSettings:   testWriterSettings,
+		OpenAISettings:       settingsService.GetOpenAISettings(),
+		AnthropicSettings:    settingsService.GetAnthropicSettings(),
+		OllamaSettings:       settingsService.GetOllamaSettings(),
+		MockScenario:         mockScenario,
+		RoutingSettings:      settingsService.GetRoutingSettings(),
 		RunMode:      runMode,
 	}
 
@@ -287,6 +321,13 @@ func init() {
 		Cfg.ToolRegistry = toolRegistry
 
 		telemetry.InitGlobalLogger(Cfg.Telemetry, Cfg.RunMode)
+
+		// 7. Connect to configured MCP servers and register their tools
+		McpManager = mcp.NewMcpClientManager(toolRegistry)
+		if err := McpManager.DiscoverAllMcpTools(Cfg); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: MCP tool discovery failed: %v\n", err)
+		}
+
 		extensionsCliCommand = commands.NewExtensionsCommand(ExtensionManager, SettingsService)
 
 		chatService, err = createChatService(Cfg, SettingsService, SessionService, ContextService)
@@ -295,6 +336,13 @@ func init() {
 			os.Exit(1)
 		}
 	}
+	RootCmd.PersistentPostRun = func(cmd *cobra.Command, args []string) {
+		if McpManager != nil {
+			if err := McpManager.Stop(); err != nil {
+				telemetry.LogErrorf("Error stopping MCP clients: %v", err)
+			}
+		}
+	}
 	RootCmd.Run = func(cmd *cobra.Command, args []string) {
 		runMode, _ := SettingsService.Get("runMode")
 		switch runMode {
@@ -1,4 +1,4 @@
-import { WebSocketMessage } from '../types';
+import { ClientMessage, ToolConfirmationOutcome, WebSocketMessage } from '../types';
 
 type MessageHandler = (message: WebSocketMessage) => void;
 type ConnectionHandler = (isConnected: boolean) => void;
@@ -10,6 +10,9 @@ class WebSocketService {
   private connectionHandlers: Set<ConnectionHandler> = new Set();
   private reconnectTimeout: ReturnType<typeof setTimeout> | null = null;
   private isExplicitlyDisconnected: boolean = false;
+  private sessionId: string | null = null;
+  private lastSeq: number = 0;
+  private token: string | null = null;
 
   constructor() {
     // Bind methods
@@ -22,6 +25,11 @@ class WebSocketService {
     this.url = url;
   }
 
+  // Sets the bearer token sent with the connection when the server requires authentication.
+  public setToken(token: string | null) {
+    this.token = token;
+  }
+
   public connect() {
     if (this.socket?.readyState === WebSocket.OPEN || this.socket?.readyState === WebSocket.CONNECTING) {
       return;
@@ -30,11 +38,16 @@ class WebSocketService {
     this.isExplicitlyDisconnected = false;
 
     try {
-      this.socket = new WebSocket(this.url);
+      const url = this.token ? `${this.url}${this.url.includes('?') ? '&' : '?'}token=${encodeURIComponent(this.token)}` : this.url;
+      this.socket = new WebSocket(url);
 
       this.socket.onopen = () => {
         console.log('WS Connected');
         this.notifyConnection(true);
+        // Replay what was missed while disconnected.
+        if (this.sessionId) {
+          this.sendMessage({ type: 'resume', sessionId: this.sessionId, lastSeq: this.lastSeq });
+        }
       };
 
       this.socket.onclose = () => {
@@ -54,6 +67,16 @@ class WebSocketService {
       this.socket.onmessage = (event) => {
         try {
           const data = JSON.parse(event.data) as WebSocketMessage;
+          if (data.sessionId && data.sessionId !== this.sessionId) {
+            this.sessionId = data.sessionId;
+            this.lastSeq = 0;
+          }
+          if (data.seq) {
+            if (data.seq <= this.lastSeq) {
+              return; // Already seen before reconnecting
+            }
+            this.lastSeq = data.seq;
+          }
           this.notifyMessage(data);
         } catch (e) {
           console.error('Failed to parse WS message', e);
@@ -76,8 +99,24 @@ class WebSocketService {
   }
 
   public send(prompt: string) {
+    this.sendMessage({ type: 'prompt', sessionId: this.sessionId ?? undefined, prompt });
+  }
+
+  public cancel() {
+    if (this.sessionId) {
+      this.sendMessage({ type: 'cancel', sessionId: this.sessionId });
+    }
+  }
+
+  public confirmTool(outcome: ToolConfirmationOutcome, toolCallId?: string, modifiedArgs?: Record<string, unknown>) {
+    if (this.sessionId) {
+      this.sendMessage({ type: 'tool_confirmation', sessionId: this.sessionId, toolCallId, outcome, modifiedArgs });
+    }
+  }
+
+  private sendMessage(message: ClientMessage) {
     if (this.socket && this.socket.readyState === WebSocket.OPEN) {
-      this.socket.send(JSON.stringify({ prompt }));
+      this.socket.send(JSON.stringify(message));
     } else {
       console.warn('Cannot send message, socket not open');
     }
@@ -8,13 +8,32 @@ export type EventType =
   | 'chunk'
   | 'final_response'
   | 'error'
-  | 'token_count';
+  | 'token_count'
+  | 'session'
+  | 'resumed'
+  | 'run_finished';
 
 export interface BaseMessage {
   type: EventType;
   sessionId: string;
+  seq?: number; // Increases per session; absent on replies to a single client
 }
 
+// Messages sent by the client
+export type ClientMessage =
+  | { type: 'prompt'; sessionId?: string; prompt: string }
+  | { type: 'resume'; sessionId: string; lastSeq: number }
+  | { type: 'cancel'; sessionId: string }
+  | {
+      type: 'tool_confirmation';
+      sessionId: string;
+      toolCallId?: string;
+      outcome: ToolConfirmationOutcome;
+      modifiedArgs?: Record<string, unknown>; // Required when outcome is MODIFY
+    };
+
+export type ToolConfirmationOutcome = 'PROCEED_ONCE' | 'PROCEED_ALWAYS' | 'CANCEL' | 'MODIFY';
+
 export interface StreamingStartedMessage extends BaseMessage {
   type: 'streaming_started';
   payload: Record<string, never>; // Empty object
@@ -0,0 +1,169 @@
+package analysis
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/tools/go/packages"
+)
+
+// loadMode is what symbol analysis needs from go/packages: parsed and
+// type-checked sources. Dependencies are type-checked from source too, which
+// unlike export data works with whichever Go toolchain is installed.
+const loadMode = packages.NeedName | packages.NeedFiles | packages.NeedCompiledGoFiles |
+	packages.NeedImports | packages.NeedDeps | packages.NeedSyntax | packages.NeedTypes | packages.NeedTypesInfo
+
+// workspace holds the type-checked packages of the module a file belongs to.
+type workspace struct {
+	root     string
+	fset     *token.FileSet
+	packages []*packages.Package
+	lines    map[string][]string
+}
+
+// loadWorkspace loads every package, including tests, of the Go module containing filePath.
+func loadWorkspace(filePath string) (*workspace, error) {
+	absPath, err := filepath.Abs(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve path %s: %w", filePath, err)
+	}
+	if _, err := os.Stat(absPath); err != nil {
+		return nil, fmt.Errorf("failed to access %s: %w", filePath, err)
+	}
+
+	root := findModuleRoot(filepath.Dir(absPath))
+	fset := token.NewFileSet()
+	cfg := &packages.Config{
+		Mode:      loadMode,
+		Dir:       root,
+		Fset:      fset,
+		Tests:     true,
+		ParseFile: parseFileFunc(root),
+	}
+	pkgs, err := packages.Load(cfg, "./...")
+	if err != nil {
+		return nil, fmt.Errorf("failed to load Go packages in %s: %w", root, err)
+	}
+	return &workspace{root: root, fset: fset, packages: pkgs, lines: make(map[string][]string)}, nil
+}
+
+// parseFileFunc parses the files of the module completely, and only the
+// declarations of files outside it, since dependencies are needed for their
+// types alone. Dropping function bodies makes type-checking them much cheaper.
+func parseFileFunc(root string) func(fset *token.FileSet, filename string, src []byte) (*ast.File, error) {
+	prefix := root + string(filepath.Separator)
+	return func(fset *token.FileSet, filename string, src []byte) (*ast.File, error) {
+		file, err := parser.ParseFile(fset, filename, src, parser.AllErrors|parser.ParseComments)
+		if file == nil || strings.HasPrefix(filename, prefix) {
+			return file, err
+		}
+		for _, decl := range file.Decls {
+			if fn, ok := decl.(*ast.FuncDecl); ok {
+				fn.Body = nil
+			}
+		}
+		return file, err
+	}
+}
+
+// findModuleRoot returns the closest directory above dir that contains a go.mod
+// file, or dir itself when the file is not part of a module.
+func findModuleRoot(dir string) string {
+	for current := dir; ; {
+		if _, err := os.Stat(filepath.Join(current, "go.mod")); err == nil {
+			return current
+		}
+		parent := filepath.Dir(current)
+		if parent == current {
+			return dir
+		}
+		current = parent
+	}
+}
+
+// objectAt returns the object denoted by the identifier at the given 1-indexed
+// line and column of filePath.
+func (w *workspace) objectAt(filePath string, line, column int) (types.Object, error) {
+	absPath, err := filepath.Abs(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	foundFile := false
+	for _, pkg := range w.packages {
+		if pkg.TypesInfo == nil {
+			continue
+		}
+		for _, file := range pkg.Syntax {
+			if w.fset.File(file.Pos()).Name() != absPath {
+				continue
+			}
+			foundFile = true
+			if ident := w.identAt(file, line, column); ident != nil {
+				if obj := identObject(pkg.TypesInfo, ident); obj != nil {
+					return obj, nil
+				}
+			}
+		}
+	}
+	if !foundFile {
+		return nil, fmt.Errorf("%s is not part of any Go package in %s", filePath, w.root)
+	}
+	return nil, fmt.Errorf("no symbol found at %s:%d:%d", filePath, line, column)
+}
+
+// identAt finds the identifier spanning the given position in file.
+func (w *workspace) identAt(file *ast.File, line, column int) *ast.Ident {
+	var found *ast.Ident
+	ast.Inspect(file, func(n ast.Node) bool {
+		if found != nil || n == nil {
+			return false
+		}
+		start, end := w.fset.Position(n.Pos()), w.fset.Position(n.End())
+		if line < start.Line || line > end.Line {
+			return false
+		}
+		if ident, ok := n.(*ast.Ident); ok && start.Line == line && column >= start.Column && column < end.Column {
+			found = ident
+		}
+		return true
+	})
+	return found
+}
+
+// identObject returns the object an identifier defines or refers to. For an
+// embedded field the referenced type name wins over the implicit field.
+func identObject(info *types.Info, ident *ast.Ident) types.Object {
+	if obj := info.Uses[ident]; obj != nil {
+		return obj
+	}
+	return info.Defs[ident]
+}
+
+// objectKey identifies an object by its declaration position, which is stable
+// across the separately type-checked test and non-test variants of a package.
+func (w *workspace) objectKey(obj types.Object) string {
+	pos := w.fset.Position(obj.Pos())
+	return fmt.Sprintf("%s:%d:%d:%s", pos.Filename, pos.Line, pos.Column, obj.Name())
+}
+
+// sourceLine returns the trimmed text of a 1-indexed line of a file.
+func (w *workspace) sourceLine(filename string, line int) string {
+	lines, ok := w.lines[filename]
+	if !ok {
+		if data, err := os.ReadFile(filename); err == nil {
+			lines = strings.Split(string(data), "\n")
+		}
+		w.lines[filename] = lines
+	}
+	if line < 1 || line > len(lines) {
+		return ""
+	}
+	return strings.TrimSpace(lines[line-1])
+}
@@ -3,48 +3,188 @@ package analysis
 import (
 	"fmt"
 	"go/ast"
-	"go/parser"
 	"go/token"
+	"go/types"
+	"sort"
+
+	"golang.org/x/tools/go/packages"
+)
+
+// ReferenceKind describes how a symbol is used at a reference site.
+type ReferenceKind string
+
+const (
+	ReferenceKindDefinition ReferenceKind = "definition"
+	ReferenceKindRead       ReferenceKind = "read"
+	ReferenceKindWrite      ReferenceKind = "write"
+	ReferenceKindCall       ReferenceKind = "call"
 )
 
+// SymbolReference is a single occurrence of a symbol in the source code.
+type SymbolReference struct {
+	FilePath string        `json:"filePath"`
+	Line     int           `json:"line"`
+	Column   int           `json:"column"`
+	Kind     ReferenceKind `json:"kind"`
+	Snippet  string        `json:"snippet"`
+}
+
+// String formats the reference as "file:line:column [kind] snippet".
+func (r SymbolReference) String() string {
+	return fmt.Sprintf("%s:%d:%d [%s] %s", r.FilePath, r.Line, r.Column, r.Kind, r.Snippet)
+}
+
 // FindSymbolReferencesFunc is a variable that holds the actual implementation of FindSymbolReferences.
 // It can be replaced during testing.
-var FindSymbolReferencesFunc = func(filePath string, line, column int) ([]string, error) {
-	fset := token.NewFileSet()
-	node, err := parser.ParseFile(fset, filePath, nil, parser.ParseComments)
+var FindSymbolReferencesFunc = func(filePath string, line, column int) ([]SymbolReference, error) {
+	ws, err := loadWorkspace(filePath)
+	if err != nil {
+		return nil, err
+	}
+	target, err := ws.objectAt(filePath, line, column)
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse file: %w", err)
+		return nil, err
+	}
+	if !target.Pos().IsValid() {
+		return nil, fmt.Errorf("'%s' is predeclared and has no references in the source", target.Name())
 	}
+	return ws.references(target), nil
+}
 
-	var references []string
+// FindSymbolReferences finds all usages of a specific symbol in the codebase,
+// type-checking the whole module the file belongs to.
+func FindSymbolReferences(filePath string, line, column int) ([]SymbolReference, error) {
+	return FindSymbolReferencesFunc(filePath, line, column)
+}
 
-	// For now, just print the AST structure. This will be replaced with actual reference finding logic.
-	ast.Inspect(node, func(n ast.Node) bool {
-		if n == nil {
-			return false
+// references returns every occurrence of target in the workspace, sorted by position.
+func (w *workspace) references(target types.Object) []SymbolReference {
+	var refs []SymbolReference
+	w.forEachReference(map[string]bool{w.objectKey(target): true}, func(pkg *packages.Package, ident *ast.Ident, kind ReferenceKind) {
+		pos := w.fset.Position(ident.Pos())
+		refs = append(refs, SymbolReference{
+			FilePath: pos.Filename,
+			Line:     pos.Line,
+			Column:   pos.Column,
+			Kind:     kind,
+			Snippet:  w.sourceLine(pos.Filename, pos.Line),
+		})
+	})
+
+	sort.Slice(refs, func(i, j int) bool {
+		if refs[i].FilePath != refs[j].FilePath {
+			return refs[i].FilePath < refs[j].FilePath
 		}
-		pos := fset.Position(n.Pos())
-		fmt.Printf("Node: %T, Pos: %s, Value: %v\n", n, pos, n)
-		return true
+		if refs[i].Line != refs[j].Line {
+			return refs[i].Line < refs[j].Line
+		}
+		return refs[i].Column < refs[j].Column
 	})
+	return refs
+}
 
-	return references, nil
+// forEachReference calls fn once for every identifier that refers to one of the
+// objects identified by keys. Files shared by several package variants are
+// only reported once.
+func (w *workspace) forEachReference(keys map[string]bool, fn func(pkg *packages.Package, ident *ast.Ident, kind ReferenceKind)) {
+	seen := make(map[token.Position]bool)
+	for _, pkg := range w.packages {
+		if pkg.TypesInfo == nil {
+			continue
+		}
+		for _, file := range pkg.Syntax {
+			w.inspectIdents(file, func(ident *ast.Ident, parents []ast.Node) {
+				kind, ok := w.referenceKind(pkg.TypesInfo, ident, parents, keys)
+				if !ok {
+					return
+				}
+				pos := w.fset.Position(ident.Pos())
+				if seen[pos] {
+					return
+				}
+				seen[pos] = true
+				fn(pkg, ident, kind)
+			})
+		}
+	}
 }
 
-// RenameSymbolFunc is a variable that holds the actual implementation of RenameSymbol.
-// It can be replaced during testing.
-var RenameSymbolFunc = func(filePath string, line, column int, newName string) error {
-	// For now, this is a placeholder. Real implementation would involve AST manipulation.
-	fmt.Printf("Simulating rename of symbol at %s:%d:%d to %s\n", filePath, line, column, newName)
-	return nil
+// referenceKind reports whether ident refers to one of the objects identified by keys and how.
+func (w *workspace) referenceKind(info *types.Info, ident *ast.Ident, parents []ast.Node, keys map[string]bool) (ReferenceKind, bool) {
+	if obj := info.Uses[ident]; obj != nil && keys[w.objectKey(obj)] {
+		return classifyUse(ident, obj, parents), true
+	}
+	if obj := info.Defs[ident]; obj != nil && keys[w.objectKey(obj)] {
+		return ReferenceKindDefinition, true
+	}
+	return "", false
 }
 
-// RenameSymbol safely renames a symbol across all its usages in the codebase.
-func RenameSymbol(filePath string, line, column int, newName string) error {
-	return RenameSymbolFunc(filePath, line, column, newName)
+// inspectIdents calls fn for every identifier in file together with its ancestors,
+// the closest one last.
+func (w *workspace) inspectIdents(file *ast.File, fn func(ident *ast.Ident, parents []ast.Node)) {
+	var stack []ast.Node
+	ast.Inspect(file, func(n ast.Node) bool {
+		if n == nil {
+			stack = stack[:len(stack)-1]
+			return false
+		}
+		if ident, ok := n.(*ast.Ident); ok {
+			fn(ident, stack)
+		}
+		stack = append(stack, n)
+		return true
+	})
 }
 
-// FindSymbolReferences finds all usages of a specific symbol in the codebase.
-func FindSymbolReferences(filePath string, line, column int) ([]string, error) {
-	return FindSymbolReferencesFunc(filePath, line, column)
+// classifyUse tells whether a use of an identifier calls, writes or reads the symbol.
+func classifyUse(ident *ast.Ident, obj types.Object, parents []ast.Node) ReferenceKind {
+	var expr ast.Node = ident
+	i := len(parents) - 1
+	if i >= 0 {
+		if sel, ok := parents[i].(*ast.SelectorExpr); ok && sel.Sel == ident {
+			expr = sel
+			i--
+		}
+	}
+	for i >= 0 {
+		paren, ok := parents[i].(*ast.ParenExpr)
+		if !ok {
+			break
+		}
+		expr = paren
+		i--
+	}
+	if i < 0 {
+		return ReferenceKindRead
+	}
+
+	switch parent := parents[i].(type) {
+	case *ast.CallExpr:
+		if parent.Fun == expr {
+			return ReferenceKindCall
+		}
+	case *ast.AssignStmt:
+		for _, lhs := range parent.Lhs {
+			if lhs == expr {
+				return ReferenceKindWrite
+			}
+		}
+	case *ast.IncDecStmt:
+		if parent.X == expr {
+			return ReferenceKindWrite
+		}
+	case *ast.RangeStmt:
+		if parent.Key == expr || parent.Value == expr {
+			return ReferenceKindWrite
+		}
+	case *ast.KeyValueExpr:
+		// A field key in a struct literal initialises the field.
+		if field, ok := obj.(*types.Var); ok && field.IsField() && parent.Key == expr && i > 0 {
+			if _, ok := parents[i-1].(*ast.CompositeLit); ok {
+				return ReferenceKindWrite
+			}
+		}
+	}
+	return ReferenceKindRead
 }
@@ -0,0 +1,136 @@
+package analysis
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeTestModule creates a Go module from a map of relative paths to contents.
+func writeTestModule(t *testing.T, files map[string]string) string {
+	root := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(root, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	}
+	return root
+}
+
+// position returns the 1-indexed line and column of the first occurrence of
+// marker in a file of the module, plus offset bytes.
+func position(t *testing.T, root, name, marker string, offset int) (int, int) {
+	data, err := os.ReadFile(filepath.Join(root, name))
+	require.NoError(t, err)
+	index := strings.Index(string(data), marker)
+	require.GreaterOrEqual(t, index, 0, "marker %q not found in %s", marker, name)
+	before := string(data[:index+offset])
+	line := strings.Count(before, "\n") + 1
+	column := len(before) - strings.LastIndex(before, "\n")
+	return line, column
+}
+
+var testModuleFiles = map[string]string{
+	"go.mod": "module example.com/refs\n\ngo 1.21\n",
+	"store/store.go": `package store
+
+// Counter counts things.
+type Counter struct {
+	Total int
+}
+
+// Add increments the counter.
+func (c *Counter) Add(n int) {
+	c.Total += n
+}
+
+// New creates a counter.
+func New() *Counter {
+	return &Counter{Total: 0}
+}
+`,
+	"app/app.go": `package app
+
+import "example.com/refs/store"
+
+func Run() int {
+	c := store.New()
+	c.Add(2)
+	c.Total = 5
+	return c.Total
+}
+`,
+	"store/store_test.go": `package store
+
+import "testing"
+
+func TestAdd(t *testing.T) {
+	c := New()
+	c.Add(1)
+	if c.Total != 1 {
+		t.Fatal(c.Total)
+	}
+}
+`,
+}
+
+func TestFindSymbolReferences(t *testing.T) {
+	root := writeTestModule(t, testModuleFiles)
+	storeFile := filepath.Join(root, "store", "store.go")
+
+	t.Run("method across packages and tests", func(t *testing.T) {
+		line, column := position(t, root, "store/store.go", "Add(n int)", 0)
+		refs, err := FindSymbolReferences(storeFile, line, column)
+		require.NoError(t, err)
+
+		require.Len(t, refs, 3)
+		assert.Equal(t, filepath.Join(root, "app", "app.go"), refs[0].FilePath)
+		assert.Equal(t, 7, refs[0].Line)
+		assert.Equal(t, 4, refs[0].Column)
+		assert.Equal(t, ReferenceKindCall, refs[0].Kind)
+		assert.Equal(t, "c.Add(2)", refs[0].Snippet)
+
+		assert.Equal(t, storeFile, refs[1].FilePath)
+		assert.Equal(t, ReferenceKindDefinition, refs[1].Kind)
+		assert.Equal(t, "func (c *Counter) Add(n int) {", refs[1].Snippet)
+
+		assert.Equal(t, filepath.Join(root, "store", "store_test.go"), refs[2].FilePath)
+		assert.Equal(t, ReferenceKindCall, refs[2].Kind)
+	})
+
+	t.Run("field reads and writes from a use site", func(t *testing.T) {
+		line, column := position(t, root, "app/app.go", "c.Total = 5", 2)
+		refs, err := FindSymbolReferences(filepath.Join(root, "app", "app.go"), line, column)
+		require.NoError(t, err)
+
+		var kinds []string
+		for _, ref := range refs {
+			rel, err := filepath.Rel(root, ref.FilePath)
+			require.NoError(t, err)
+			kinds = append(kinds, filepath.ToSlash(rel)+" "+string(ref.Kind))
+		}
+		assert.Equal(t, []string{
+			"app/app.go write",
+			"app/app.go read",
+			"store/store.go definition",
+			"store/store.go write",
+			"store/store.go write",
+			"store/store_test.go read",
+			"store/store_test.go read",
+		}, kinds)
+	})
+
+	t.Run("no symbol at position", func(t *testing.T) {
+		_, err := FindSymbolReferences(storeFile, 1, 1)
+		assert.Error(t, err)
+	})
+
+	t.Run("file outside the module packages", func(t *testing.T) {
+		_, err := FindSymbolReferences(filepath.Join(root, "go.mod"), 1, 1)
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,613 @@
+package analysis
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/pmezard/go-difflib/difflib"
+	"golang.org/x/tools/go/packages"
+)
+
+// RenameOptions controls how RenameSymbol rewrites the code.
+type RenameOptions struct {
+	// DryRun computes the diff without writing any file.
+	DryRun bool
+	// UpdateTags also renames struct tag values (e.g. `json:"oldName"`) that
+	// match the name of a renamed field.
+	UpdateTags bool
+}
+
+// RenameResult describes the changes made, or planned in a dry run, by RenameSymbol.
+type RenameResult struct {
+	OldName      string   `json:"oldName"`
+	NewName      string   `json:"newName"`
+	ChangedFiles []string `json:"changedFiles"`
+	Edits        int      `json:"edits"`
+	Diff         string   `json:"diff"`
+	Applied      bool     `json:"applied"`
+}
+
+// RenameSymbolFunc is a variable that holds the actual implementation of RenameSymbol.
+// It can be replaced during testing.
+var RenameSymbolFunc = func(filePath string, line, column int, newName string, opts RenameOptions) (*RenameResult, error) {
+	ws, err := loadWorkspace(filePath)
+	if err != nil {
+		return nil, err
+	}
+	target, err := ws.objectAt(filePath, line, column)
+	if err != nil {
+		return nil, err
+	}
+	r := &renamer{workspace: ws, target: target, from: target.Name(), to: newName, opts: opts}
+	return r.rename()
+}
+
+// RenameSymbol safely renames a symbol across all its usages in the codebase.
+// The rename is refused when it would not compile or would change which
+// declaration an identifier refers to.
+func RenameSymbol(filePath string, line, column int, newName string, opts RenameOptions) (*RenameResult, error) {
+	return RenameSymbolFunc(filePath, line, column, newName, opts)
+}
+
+// renamer carries the state of a single rename.
+type renamer struct {
+	*workspace
+	target   types.Object
+	from, to string
+	opts     RenameOptions
+	keys     map[string]bool
+}
+
+// textEdit replaces the bytes [start, end) of a file.
+type textEdit struct {
+	start, end int
+	text       string
+}
+
+func (r *renamer) rename() (*RenameResult, error) {
+	if err := r.checkTarget(); err != nil {
+		return nil, err
+	}
+	r.keys = map[string]bool{r.objectKey(r.target): true}
+	if err := r.addEmbeddedFields(); err != nil {
+		return nil, err
+	}
+	if err := r.addSatisfiedMethods(); err != nil {
+		return nil, err
+	}
+	if err := r.checkConflicts(); err != nil {
+		return nil, err
+	}
+
+	edits := make(map[string][]textEdit)
+	r.forEachReference(r.keys, func(pkg *packages.Package, ident *ast.Ident, kind ReferenceKind) {
+		pos := r.fset.Position(ident.Pos())
+		edits[pos.Filename] = append(edits[pos.Filename], textEdit{start: pos.Offset, end: pos.Offset + len(ident.Name), text: r.to})
+	})
+	if r.opts.UpdateTags {
+		r.addTagEdits(edits)
+	}
+	return r.apply(edits)
+}
+
+// checkTarget rejects objects and names that cannot be renamed.
+func (r *renamer) checkTarget() error {
+	if r.from == r.to {
+		return fmt.Errorf("'%s' already has that name", r.from)
+	}
+	if !token.IsIdentifier(r.to) || r.to == "_" {
+		return fmt.Errorf("'%s' is not a valid Go identifier", r.to)
+	}
+	if !r.target.Pos().IsValid() || r.target.Pkg() == nil {
+		return fmt.Errorf("'%s' is predeclared and cannot be renamed", r.from)
+	}
+	if !r.inWorkspace(r.target) {
+		return fmt.Errorf("'%s' is declared outside the workspace in %s", r.from, r.target.Pkg().Path())
+	}
+	switch obj := r.target.(type) {
+	case *types.PkgName, *types.Label:
+		return fmt.Errorf("renaming %s '%s' is not supported", objectKind(obj), r.from)
+	case *types.Var:
+		if obj.Embedded() {
+			return fmt.Errorf("'%s' is an embedded field; rename the embedded type instead", r.from)
+		}
+	case *types.Func:
+		if obj.Parent() == obj.Pkg().Scope() && (r.from == "main" || r.from == "init") {
+			return fmt.Errorf("'%s' is a special function and cannot be renamed", r.from)
+		}
+	}
+	if isPackageLevel(r.target) && (r.to == "init" || r.to == "main") {
+		return fmt.Errorf("'%s' is reserved at package level", r.to)
+	}
+	return nil
+}
+
+// addEmbeddedFields renames the implicit field of every struct that embeds a renamed type.
+func (r *renamer) addEmbeddedFields() error {
+	if _, ok := r.target.(*types.TypeName); !ok {
+		return nil
+	}
+	for _, pkg := range r.packages {
+		if pkg.TypesInfo == nil {
+			continue
+		}
+		for ident, obj := range pkg.TypesInfo.Defs {
+			if field, ok := obj.(*types.Var); ok && field.Embedded() {
+				if used := pkg.TypesInfo.Uses[ident]; used != nil && r.keys[r.objectKey(used)] {
+					r.keys[r.objectKey(field)] = true
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// addSatisfiedMethods extends the rename of a method to the interface methods it
+// satisfies and to the methods of the other types satisfying those interfaces,
+// so that every implementation relationship survives the rename.
+func (r *renamer) addSatisfiedMethods() error {
+	fn, ok := r.target.(*types.Func)
+	if !ok || fn.Type().(*types.Signature).Recv() == nil {
+		return nil
+	}
+
+	for changed := true; changed; {
+		changed = false
+		for _, pkg := range r.packages {
+			if pkg.Types == nil {
+				continue
+			}
+			named := visibleNamedTypes(pkg.Types)
+			for _, iface := range named {
+				if !types.IsInterface(iface) {
+					continue
+				}
+				imethod := methodNamed(iface, pkg.Types, r.from)
+				if imethod == nil {
+					continue
+				}
+				for _, concrete := range named {
+					if types.IsInterface(concrete) || !implements(concrete, iface) {
+						continue
+					}
+					cmethod := methodNamed(concrete, pkg.Types, r.from)
+					if cmethod == nil {
+						continue
+					}
+					ikey, ckey := r.objectKey(imethod), r.objectKey(cmethod)
+					if r.keys[ikey] == r.keys[ckey] {
+						continue
+					}
+					// One side of a satisfied interface is being renamed, so both must be.
+					for _, m := range []*types.Func{imethod, cmethod} {
+						if !r.inWorkspace(m) {
+							return fmt.Errorf("renaming '%s' would break %s satisfying %s, whose method is declared outside the workspace",
+								r.from, concrete.Obj().Name(), iface.Obj().Name())
+						}
+					}
+					r.keys[ikey], r.keys[ckey] = true, true
+					changed = true
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// checkConflicts refuses renames that would collide with or be shadowed by
+// another declaration, or that would hide a symbol used from another package.
+func (r *renamer) checkConflicts() error {
+	exportedChange := token.IsExported(r.from) && !token.IsExported(r.to)
+	targetPkg := r.target.Pkg().Path()
+	var conflict error
+
+	for _, pkg := range r.packages {
+		if pkg.TypesInfo == nil || conflict != nil {
+			continue
+		}
+		for _, obj := range pkg.TypesInfo.Defs {
+			if obj != nil && r.keys[r.objectKey(obj)] {
+				if err := r.checkDeclaration(pkg, obj); err != nil {
+					conflict = err
+					break
+				}
+			}
+		}
+		for ident, obj := range pkg.TypesInfo.Uses {
+			if conflict != nil {
+				break
+			}
+			switch {
+			case r.keys[r.objectKey(obj)]:
+				if exportedChange && pkg.Types.Path() != targetPkg {
+					conflict = fmt.Errorf("'%s' is used from package %s at %s and cannot become unexported", r.from, pkg.Types.Path(), r.fset.Position(ident.Pos()))
+				} else if err := r.checkShadowed(pkg, ident, obj); err != nil {
+					conflict = err
+				}
+			case ident.Name == r.to:
+				conflict = r.checkCaptured(pkg, ident, obj)
+			}
+		}
+	}
+	return conflict
+}
+
+// checkDeclaration looks for an existing declaration of the new name next to obj.
+func (r *renamer) checkDeclaration(pkg *packages.Package, obj types.Object) error {
+	switch o := obj.(type) {
+	case *types.Func:
+		if recv := o.Type().(*types.Signature).Recv(); recv != nil {
+			if existing, _, _ := types.LookupFieldOrMethod(recv.Type(), true, o.Pkg(), r.to); existing != nil {
+				return r.collision(existing)
+			}
+			return nil
+		}
+	case *types.Var:
+		if o.IsField() {
+			return r.checkFieldDeclaration(pkg, o)
+		}
+	}
+
+	scope := obj.Parent()
+	if scope == nil {
+		return nil
+	}
+	if existing := scope.Lookup(r.to); existing != nil {
+		return r.collision(existing)
+	}
+	if scope == obj.Pkg().Scope() {
+		// Imports live in the file scopes between the package and its declarations.
+		for _, file := range pkg.Syntax {
+			if fileScope := pkg.TypesInfo.Scopes[file]; fileScope != nil {
+				if existing := fileScope.Lookup(r.to); existing != nil {
+					return r.collision(existing)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// checkFieldDeclaration looks for fields and methods named like the new name in
+// the struct declaring field, including the methods of named types based on it.
+func (r *renamer) checkFieldDeclaration(pkg *packages.Package, field *types.Var) error {
+	for _, file := range pkg.Syntax {
+		var conflict error
+		ast.Inspect(file, func(n ast.Node) bool {
+			expr, ok := n.(*ast.StructType)
+			if !ok || conflict != nil {
+				return conflict == nil
+			}
+			st, ok := pkg.TypesInfo.TypeOf(expr).(*types.Struct)
+			if !ok || !structHasField(st, field) {
+				return true
+			}
+			for i := 0; i < st.NumFields(); i++ {
+				if st.Field(i).Name() == r.to {
+					conflict = r.collision(st.Field(i))
+					return false
+				}
+			}
+			if existing, _, _ := types.LookupFieldOrMethod(st, false, field.Pkg(), r.to); existing != nil {
+				conflict = r.collision(existing)
+				return false
+			}
+			for _, named := range visibleNamedTypes(pkg.Types) {
+				if named.Underlying() == st {
+					if existing, _, _ := types.LookupFieldOrMethod(named, true, field.Pkg(), r.to); existing != nil {
+						conflict = r.collision(existing)
+						return false
+					}
+				}
+			}
+			return true
+		})
+		if conflict != nil {
+			return conflict
+		}
+	}
+	return nil
+}
+
+// checkShadowed reports whether a reference to obj would resolve to another
+// declaration of the new name that sits between the reference and obj.
+func (r *renamer) checkShadowed(pkg *packages.Package, ident *ast.Ident, obj types.Object) error {
+	declScope := obj.Parent()
+	if declScope == nil || obj.Pkg() != pkg.Types {
+		// Fields, methods and symbols of other packages are selected, not looked up lexically.
+		return nil
+	}
+	for scope := pkg.Types.Scope().Innermost(ident.Pos()); scope != nil && scope != declScope; scope = scope.Parent() {
+		if existing := scope.Lookup(r.to); existing != nil && existing.Pos() < ident.Pos() {
+			return fmt.Errorf("renaming '%s' to '%s' at %s would make it refer to the %s declared at %s",
+				r.from, r.to, r.fset.Position(ident.Pos()), objectKind(existing), r.fset.Position(existing.Pos()))
+		}
+	}
+	return nil
+}
+
+// checkCaptured reports whether an existing use of the new name would start to
+// refer to the renamed object because it is declared in a closer scope.
+func (r *renamer) checkCaptured(pkg *packages.Package, ident *ast.Ident, used types.Object) error {
+	if v, ok := used.(*types.Var); ok && v.IsField() {
+		return nil
+	}
+	if fn, ok := used.(*types.Func); ok && fn.Type().(*types.Signature).Recv() != nil {
+		return nil
+	}
+	for scope := pkg.Types.Scope().Innermost(ident.Pos()); scope != nil; scope = scope.Parent() {
+		if scope == used.Parent() {
+			return nil // the existing declaration is found first
+		}
+		if obj := scope.Lookup(r.from); obj != nil && r.keys[r.objectKey(obj)] && (isPackageLevel(obj) || obj.Pos() < ident.Pos()) {
+			return fmt.Errorf("renaming '%s' to '%s' would hide the %s '%s' used at %s",
+				r.from, r.to, objectKind(used), r.to, r.fset.Position(ident.Pos()))
+		}
+	}
+	return nil
+}
+
+func (r *renamer) collision(existing types.Object) error {
+	if existing.Pos().IsValid() {
+		return fmt.Errorf("renaming '%s' to '%s' conflicts with the %s declared at %s", r.from, r.to, objectKind(existing), r.fset.Position(existing.Pos()))
+	}
+	return fmt.Errorf("renaming '%s' to '%s' conflicts with the %s '%s'", r.from, r.to, objectKind(existing), r.to)
+}
+
+// addTagEdits rewrites struct tag values naming a renamed field. Both the exact
+// field name and its lowerCamelCase form are recognised.
+func (r *renamer) addTagEdits(edits map[string][]textEdit) {
+	done := make(map[token.Position]bool)
+	for _, pkg := range r.packages {
+		if pkg.TypesInfo == nil {
+			continue
+		}
+		for _, file := range pkg.Syntax {
+			ast.Inspect(file, func(n ast.Node) bool {
+				field, ok := n.(*ast.Field)
+				if !ok || field.Tag == nil {
+					return true
+				}
+				renamed := false
+				for _, name := range field.Names {
+					if obj := pkg.TypesInfo.Defs[name]; obj != nil && r.keys[r.objectKey(obj)] {
+						renamed = true
+					}
+				}
+				pos := r.fset.Position(field.Tag.Pos())
+				if !renamed || done[pos] {
+					return true
+				}
+				done[pos] = true
+				if tag, ok := renameTag(field.Tag.Value, r.from, r.to); ok {
+					edits[pos.Filename] = append(edits[pos.Filename], textEdit{start: pos.Offset, end: pos.Offset + len(field.Tag.Value), text: tag})
+				}
+				return true
+			})
+		}
+	}
+}
+
+// renameTag rewrites the names in a struct tag literal, keeping its quoting.
+func renameTag(literal, from, to string) (string, bool) {
+	tag, err := strconv.Unquote(literal)
+	if err != nil {
+		return "", false
+	}
+	replacements := map[string]string{from: to, lowerFirst(from): lowerFirst(to)}
+
+	var out strings.Builder
+	changed := false
+	for tag != "" {
+		// Tags are a space separated list of key:"value" pairs, see reflect.StructTag.
+		trimmed := strings.TrimLeft(tag, " ")
+		out.WriteString(tag[:len(tag)-len(trimmed)])
+		tag = trimmed
+		colon := strings.Index(tag, ":\"")
+		if colon < 0 {
+			out.WriteString(tag)
+			break
+		}
+		end := colon + 2
+		for end < len(tag) && tag[end] != '"' {
+			if tag[end] == '\\' {
+				end++
+			}
+			end++
+		}
+		if end >= len(tag) {
+			out.WriteString(tag)
+			break
+		}
+		value := tag[colon+2 : end]
+		name, rest, hasOptions := strings.Cut(value, ",")
+		if replacement, ok := replacements[name]; ok {
+			value = replacement
+			if hasOptions {
+				value += "," + rest
+			}
+			changed = true
+		}
+		out.WriteString(tag[:colon+2] + value + "\"")
+		tag = tag[end+1:]
+	}
+	if !changed {
+		return "", false
+	}
+	if strings.HasPrefix(literal, "`") && !strings.Contains(out.String(), "`") {
+		return "`" + out.String() + "`", true
+	}
+	return strconv.Quote(out.String()), true
+}
+
+// apply computes the new file contents and their unified diff, and writes the
+// files unless this is a dry run.
+func (r *renamer) apply(edits map[string][]textEdit) (*RenameResult, error) {
+	result := &RenameResult{OldName: r.from, NewName: r.to}
+	filenames := make([]string, 0, len(edits))
+	for filename := range edits {
+		filenames = append(filenames, filename)
+	}
+	sort.Strings(filenames)
+
+	contents := make(map[string][]byte, len(filenames))
+	var diff strings.Builder
+	for _, filename := range filenames {
+		original, err := os.ReadFile(filename)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", filename, err)
+		}
+		updated, err := applyEdits(original, edits[filename])
+		if err != nil {
+			return nil, fmt.Errorf("failed to rewrite %s: %w", filename, err)
+		}
+		contents[filename] = updated
+		result.Edits += len(edits[filename])
+
+		relPath, err := filepath.Rel(r.root, filename)
+		if err != nil {
+			relPath = filename
+		}
+		relPath = filepath.ToSlash(relPath)
+		result.ChangedFiles = append(result.ChangedFiles, relPath)
+		fileDiff, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+			A:        difflib.SplitLines(string(original)),
+			B:        difflib.SplitLines(string(updated)),
+			FromFile: "a/" + relPath,
+			ToFile:   "b/" + relPath,
+			Context:  3,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to diff %s: %w", filename, err)
+		}
+		diff.WriteString(fileDiff)
+	}
+	result.Diff = diff.String()
+
+	if r.opts.DryRun {
+		return result, nil
+	}
+	for _, filename := range filenames {
+		info, err := os.Stat(filename)
+		if err != nil {
+			return nil, fmt.Errorf("failed to stat %s: %w", filename, err)
+		}
+		if err := os.WriteFile(filename, contents[filename], info.Mode().Perm()); err != nil {
+			return nil, fmt.Errorf("failed to write %s: %w", filename, err)
+		}
+	}
+	result.Applied = true
+	return result, nil
+}
+
+// applyEdits applies non-overlapping edits to src.
+func applyEdits(src []byte, edits []textEdit) ([]byte, error) {
+	sort.Slice(edits, func(i, j int) bool { return edits[i].start < edits[j].start })
+	var out []byte
+	last := 0
+	for _, edit := range edits {
+		if edit.start < last || edit.end > len(src) {
+			return nil, fmt.Errorf("overlapping or out of range edit at offset %d", edit.start)
+		}
+		out = append(out, src[last:edit.start]...)
+		out = append(out, edit.text...)
+		last = edit.end
+	}
+	return append(out, src[last:]...), nil
+}
+
+// inWorkspace reports whether obj is declared in a file of the loaded module.
+func (w *workspace) inWorkspace(obj types.Object) bool {
+	return strings.HasPrefix(w.fset.Position(obj.Pos()).Filename, w.root+string(filepath.Separator))
+}
+
+// visibleNamedTypes returns the non-generic named types declared in pkg and in
+// the packages it imports directly.
+func visibleNamedTypes(pkg *types.Package) []*types.Named {
+	var named []*types.Named
+	for _, p := range append([]*types.Package{pkg}, pkg.Imports()...) {
+		scope := p.Scope()
+		for _, name := range scope.Names() {
+			tn, ok := scope.Lookup(name).(*types.TypeName)
+			if !ok || tn.IsAlias() {
+				continue
+			}
+			if n, ok := tn.Type().(*types.Named); ok && n.TypeParams().Len() == 0 {
+				named = append(named, n)
+			}
+		}
+	}
+	return named
+}
+
+// methodNamed returns the method of t with the given name, if any.
+func methodNamed(t *types.Named, pkg *types.Package, name string) *types.Func {
+	obj, _, _ := types.LookupFieldOrMethod(t, true, pkg, name)
+	fn, _ := obj.(*types.Func)
+	return fn
+}
+
+// implements reports whether t or *t implements iface.
+func implements(t, iface *types.Named) bool {
+	i, ok := iface.Underlying().(*types.Interface)
+	if !ok || i.Empty() {
+		return false
+	}
+	return types.Implements(t, i) || types.Implements(types.NewPointer(t), i)
+}
+
+func structHasField(st *types.Struct, field *types.Var) bool {
+	for i := 0; i < st.NumFields(); i++ {
+		if st.Field(i) == field {
+			return true
+		}
+	}
+	return false
+}
+
+func isPackageLevel(obj types.Object) bool {
+	return obj.Pkg() != nil && obj.Parent() == obj.Pkg().Scope()
+}
+
+// objectKind describes an object for error messages.
+func objectKind(obj types.Object) string {
+	switch o := obj.(type) {
+	case *types.PkgName:
+		return "import"
+	case *types.Const:
+		return "constant"
+	case *types.TypeName:
+		return "type"
+	case *types.Var:
+		if o.IsField() {
+			return "field"
+		}
+		return "variable"
+	case *types.Func:
+		if o.Type().(*types.Signature).Recv() != nil {
+			return "method"
+		}
+		return "function"
+	case *types.Label:
+		return "label"
+	case *types.Builtin:
+		return "built-in"
+	case *types.Nil:
+		return "nil"
+	}
+	return "symbol"
+}
+
+func lowerFirst(s string) string {
+	r, size := utf8.DecodeRuneInString(s)
+	return string(unicode.ToLower(r)) + s[size:]
+}
@@ -0,0 +1,151 @@
+package analysis
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var renameModuleFiles = map[string]string{
+	"go.mod": "module example.com/rename\n\ngo 1.21\n",
+	"shape/shape.go": `package shape
+
+import "fmt"
+
+// Shape has an area.
+type Shape interface {
+	Area() float64
+}
+
+type Square struct {
+	Side  float64 ` + "`json:\"side\" yaml:\"side,omitempty\"`" + `
+	Label string
+}
+
+func (s Square) Area() float64 { return s.Side * s.Side }
+
+type Circle struct{ R float64 }
+
+func (c *Circle) Area() float64 { return 3 * c.R * c.R }
+
+func Describe(s Shape) string {
+	total := s.Area()
+	return fmt.Sprint(total)
+}
+
+func scale(v float64) float64 {
+	factor := 2.0
+	{
+		double := 4.0
+		_ = double
+		return v * factor
+	}
+}
+`,
+	"app/app.go": `package app
+
+import "example.com/rename/shape"
+
+func Run() string {
+	sq := shape.Square{Side: 2}
+	return shape.Describe(sq)
+}
+`,
+}
+
+func TestRenameSymbol(t *testing.T) {
+	t.Run("interface method across implementations with dry run", func(t *testing.T) {
+		root := writeTestModule(t, renameModuleFiles)
+		shapeFile := filepath.Join(root, "shape", "shape.go")
+		line, column := position(t, root, "shape/shape.go", "Area() float64\n}", 0)
+
+		result, err := RenameSymbol(shapeFile, line, column, "Surface", RenameOptions{DryRun: true})
+		require.NoError(t, err)
+		assert.False(t, result.Applied)
+		assert.Equal(t, []string{"shape/shape.go"}, result.ChangedFiles)
+		assert.Equal(t, 4, result.Edits)
+		assert.Contains(t, result.Diff, "--- a/shape/shape.go")
+		assert.Contains(t, result.Diff, "+	Surface() float64")
+		assert.Contains(t, result.Diff, "+func (s Square) Surface() float64 { return s.Side * s.Side }")
+		assert.Contains(t, result.Diff, "+func (c *Circle) Surface() float64 { return 3 * c.R * c.R }")
+		assert.Contains(t, result.Diff, "+	total := s.Surface()")
+
+		data, err := os.ReadFile(shapeFile)
+		require.NoError(t, err)
+		assert.Equal(t, renameModuleFiles["shape/shape.go"], string(data), "a dry run must not write files")
+	})
+
+	t.Run("exported field across packages with tags", func(t *testing.T) {
+		root := writeTestModule(t, renameModuleFiles)
+		line, column := position(t, root, "shape/shape.go", "Side  float64", 0)
+
+		result, err := RenameSymbol(filepath.Join(root, "shape", "shape.go"), line, column, "Length", RenameOptions{UpdateTags: true})
+		require.NoError(t, err)
+		assert.True(t, result.Applied)
+		assert.Equal(t, []string{"app/app.go", "shape/shape.go"}, result.ChangedFiles)
+
+		app, err := os.ReadFile(filepath.Join(root, "app", "app.go"))
+		require.NoError(t, err)
+		assert.Contains(t, string(app), "shape.Square{Length: 2}")
+
+		shapeSrc, err := os.ReadFile(filepath.Join(root, "shape", "shape.go"))
+		require.NoError(t, err)
+		assert.Contains(t, string(shapeSrc), "Length  float64 `json:\"length\" yaml:\"length,omitempty\"`")
+		assert.Contains(t, string(shapeSrc), "return s.Length * s.Length")
+	})
+
+	t.Run("refused renames", func(t *testing.T) {
+		root := writeTestModule(t, renameModuleFiles)
+		shapeFile := filepath.Join(root, "shape", "shape.go")
+
+		tests := []struct {
+			name    string
+			marker  string
+			newName string
+			errText string
+		}{
+			{"collides with a field", "Side  float64", "Label", "conflicts with the field"},
+			{"collides with a package-level declaration", "func Describe", "Circle", "conflicts with the type"},
+			{"collides with an import", "func Describe", "fmt", "conflicts with the import"},
+			{"shadowed by an inner declaration", "factor := 2.0", "double", "would make it refer to"},
+			{"captures an outer symbol", "total := s.Area()", "fmt", "would hide the import"},
+			{"unexports a symbol used elsewhere", "func Describe", "describe", "cannot become unexported"},
+			{"invalid identifier", "func Describe", "func", "not a valid Go identifier"},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				line, column := position(t, root, "shape/shape.go", tt.marker, 0)
+				if tt.marker == "func Describe" {
+					column += len("func ")
+				}
+				_, err := RenameSymbol(shapeFile, line, column, tt.newName, RenameOptions{DryRun: true})
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.errText)
+			})
+		}
+
+		data, err := os.ReadFile(shapeFile)
+		require.NoError(t, err)
+		assert.Equal(t, renameModuleFiles["shape/shape.go"], string(data))
+	})
+
+	t.Run("method of a type from outside the workspace", func(t *testing.T) {
+		root := writeTestModule(t, renameModuleFiles)
+		line, column := position(t, root, "shape/shape.go", "fmt.Sprint", 4)
+		_, err := RenameSymbol(filepath.Join(root, "shape", "shape.go"), line, column, "Print", RenameOptions{DryRun: true})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "outside the workspace")
+	})
+}
+
+func TestRenameTag(t *testing.T) {
+	tag, ok := renameTag("`json:\"userName,omitempty\" db:\"UserName\" xml:\"other\"`", "UserName", "Login")
+	assert.True(t, ok)
+	assert.Equal(t, "`json:\"login,omitempty\" db:\"Login\" xml:\"other\"`", tag)
+
+	_, ok = renameTag("`json:\"other\"`", "UserName", "Login")
+	assert.False(t, ok)
+}
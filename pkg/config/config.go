@@ -43,6 +43,11 @@ type ConfigParameters struct {
 	Output               *OutputSettings
 	CodebaseInvestigator *types.CodebaseInvestigatorSettings
 	TestWriterSettings   *types.TestWriterSettings
+	OpenAISettings       *types.OpenAISettings
+	AnthropicSettings    *types.AnthropicSettings
+	OllamaSettings       *types.OllamaSettings
+	MockScenario         string
+	RoutingSettings      *types.RoutingSettings
 	ToolRegistry         types.ToolRegistryInterface
 	ToolDiscoveryCommand string
 	AgentRegistry        types.AgentRegistryInterface
@@ -63,6 +68,11 @@ type Config struct {
 	output                       *OutputSettings
 	codebaseInvestigatorSettings *types.CodebaseInvestigatorSettings
 	testWriterSettings           *types.TestWriterSettings
+	openAISettings               *types.OpenAISettings
+	anthropicSettings            *types.AnthropicSettings
+	ollamaSettings               *types.OllamaSettings
+	mockScenario                 string
+	routingSettings              *types.RoutingSettings
 	ToolRegistry                 types.ToolRegistryInterface // Changed to interface
 	AgentRegistry                types.AgentRegistryInterface
 	toolDiscoveryCommand         string
@@ -87,6 +97,11 @@ func NewConfig(params *ConfigParameters) *Config {
 		output:                       params.Output,
 		codebaseInvestigatorSettings: params.CodebaseInvestigator,
 		testWriterSettings:           params.TestWriterSettings,
+		openAISettings:               params.OpenAISettings,
+		anthropicSettings:            params.AnthropicSettings,
+		ollamaSettings:               params.OllamaSettings,
+		mockScenario:                 params.MockScenario,
+		routingSettings:              params.RoutingSettings,
 		ToolRegistry:                 params.ToolRegistry, // This will need to be cast to types.ToolRegistryInterface
 		AgentRegistry:                params.AgentRegistry,
 		toolDiscoveryCommand:         params.ToolDiscoveryCommand,
@@ -136,6 +151,8 @@ func (c *Config) Get(key string) (interface{}, bool) {
 			return c.Telemetry.Enabled, true
 		}
 		return false, true // Default to false if telemetry settings are nil
+	case "mcpServers":
+		return c.mcpServers, c.mcpServers != nil
 	case "toolRegistry":
 		return c.ToolRegistry, true
 	case "agentRegistry":
@@ -144,6 +161,16 @@ func (c *Config) Get(key string) (interface{}, bool) {
 		return c.codebaseInvestigatorSettings, c.codebaseInvestigatorSettings != nil
 	case "testWriterSettings":
 		return c.testWriterSettings, c.testWriterSettings != nil
+	case "openAISettings":
+		return c.openAISettings, c.openAISettings != nil
+	case "anthropicSettings":
+		return c.anthropicSettings, c.anthropicSettings != nil
+	case "ollamaSettings":
+		return c.ollamaSettings, c.ollamaSettings != nil
+	case "mockScenario":
+		return c.mockScenario, c.mockScenario != ""
+	case "routingSettings":
+		return c.routingSettings, c.routingSettings != nil
 	// Add more cases for other settings as needed
 	default:
 		return nil, false
@@ -0,0 +1,775 @@
+package core
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"go-ai-agent-v2/go-cli/pkg/prompts"
+	"go-ai-agent-v2/go-cli/pkg/telemetry"
+	"go-ai-agent-v2/go-cli/pkg/types"
+)
+
+// anthropicVersion is the version of the Messages API the executor speaks.
+const anthropicVersion = "2023-06-01"
+
+// maxAnthropicEventSize bounds a single server-sent event of a stream.
+const maxAnthropicEventSize = 4 << 20
+
+// AnthropicError is an error returned by the Anthropic API, either as an HTTP
+// error response or as an error event in the middle of a stream.
+type AnthropicError struct {
+	StatusCode int
+	Type       string
+	Message    string
+	RetryAfter time.Duration // From the Retry-After header, if any
+}
+
+func (e *AnthropicError) Error() string {
+	return fmt.Sprintf("anthropic API error (status %d, %s): %s", e.StatusCode, e.Type, e.Message)
+}
+
+// anthropicErrorStatus returns the HTTP status of an error type, for errors
+// reported by an event of a stream that already returned 200.
+func anthropicErrorStatus(errorType string) int {
+	switch errorType {
+	case "invalid_request_error":
+		return http.StatusBadRequest
+	case "authentication_error":
+		return http.StatusUnauthorized
+	case "permission_error":
+		return http.StatusForbidden
+	case "not_found_error":
+		return http.StatusNotFound
+	case "rate_limit_error":
+		return http.StatusTooManyRequests
+	case "overloaded_error":
+		return 529
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// anthropicRequest is the body of a Messages API request.
+type anthropicRequest struct {
+	Model       string             `json:"model"`
+	MaxTokens   int                `json:"max_tokens"`
+	System      string             `json:"system,omitempty"`
+	Messages    []anthropicMessage `json:"messages"`
+	Tools       []anthropicTool    `json:"tools,omitempty"`
+	Stream      bool               `json:"stream,omitempty"`
+	Temperature *float32           `json:"temperature,omitempty"`
+	Thinking    *anthropicThinking `json:"thinking,omitempty"`
+}
+
+type anthropicThinking struct {
+	Type         string `json:"type"`
+	BudgetTokens int    `json:"budget_tokens"`
+}
+
+type anthropicMessage struct {
+	Role    string           `json:"role"`
+	Content []anthropicBlock `json:"content"`
+}
+
+// anthropicBlock is a content block of any type: text, thinking, tool_use or tool_result.
+type anthropicBlock struct {
+	Type      string          `json:"type"`
+	Text      string          `json:"text,omitempty"`
+	Thinking  string          `json:"thinking,omitempty"`
+	Signature string          `json:"signature,omitempty"`
+	ID        string          `json:"id,omitempty"`
+	Name      string          `json:"name,omitempty"`
+	Input     json.RawMessage `json:"input,omitempty"`
+	ToolUseID string          `json:"tool_use_id,omitempty"`
+	Content   string          `json:"content,omitempty"`
+}
+
+type anthropicTool struct {
+	Name        string                  `json:"name"`
+	Description string                  `json:"description,omitempty"`
+	InputSchema *types.JsonSchemaObject `json:"input_schema"`
+}
+
+type anthropicUsage struct {
+	InputTokens              int `json:"input_tokens"`
+	OutputTokens             int `json:"output_tokens"`
+	CacheCreationInputTokens int `json:"cache_creation_input_tokens"`
+	CacheReadInputTokens     int `json:"cache_read_input_tokens"`
+}
+
+// totalInputTokens counts cached prompt tokens as input, like the other executors do.
+func (u anthropicUsage) totalInputTokens() int {
+	return u.InputTokens + u.CacheCreationInputTokens + u.CacheReadInputTokens
+}
+
+// anthropicResponse is the body of a non-streaming response, and the message
+// of a message_start event.
+type anthropicResponse struct {
+	Content    []anthropicBlock `json:"content"`
+	StopReason string           `json:"stop_reason"`
+	Usage      anthropicUsage   `json:"usage"`
+}
+
+type anthropicErrorBody struct {
+	Type    string `json:"type"`
+	Message string `json:"message"`
+}
+
+// anthropicStreamEvent is the data of a server-sent event of a stream.
+type anthropicStreamEvent struct {
+	Type         string              `json:"type"`
+	Index        int                 `json:"index"`
+	Message      *anthropicResponse  `json:"message,omitempty"`
+	ContentBlock *anthropicBlock     `json:"content_block,omitempty"`
+	Delta        *anthropicDelta     `json:"delta,omitempty"`
+	Usage        *anthropicUsage     `json:"usage,omitempty"`
+	Error        *anthropicErrorBody `json:"error,omitempty"`
+}
+
+type anthropicDelta struct {
+	Type        string `json:"type"`
+	Text        string `json:"text,omitempty"`
+	PartialJSON string `json:"partial_json,omitempty"`
+	Thinking    string `json:"thinking,omitempty"`
+	Signature   string `json:"signature,omitempty"`
+	StopReason  string `json:"stop_reason,omitempty"`
+}
+
+// toAnthropicMessages converts generic contents to Messages API messages.
+// System contents become the system prompt; tool responses become tool_result
+// blocks of a user message. Consecutive contents of the same role are merged,
+// as the API expects user and assistant turns to alternate.
+func toAnthropicMessages(contents []*types.Content, logger telemetry.TelemetryLogger) (string, []anthropicMessage, error) {
+	var system []string
+	var messages []anthropicMessage
+	// IDs of the tool calls of the last assistant turn, for tool responses that carry none.
+	var lastToolUseIDs []string
+
+	for i, content := range contents {
+		var role string
+		switch content.Role {
+		case "system":
+			for _, part := range content.Parts {
+				if part.Text != "" {
+					system = append(system, part.Text)
+				}
+			}
+			continue
+		case "model", "assistant":
+			role = "assistant"
+			lastToolUseIDs = nil
+		case "user", "tool", "function":
+			role = "user"
+		default:
+			logger.LogWarnf("toAnthropicMessages: Unknown content role '%s', mapping to user role as fallback.", content.Role)
+			role = "user"
+		}
+
+		var blocks []anthropicBlock
+		toolResults := 0
+		for j, part := range content.Parts {
+			switch {
+			case part.FunctionCall != nil:
+				input, err := json.Marshal(part.FunctionCall.Args)
+				if err != nil {
+					return "", nil, fmt.Errorf("failed to marshal function call arguments: %w", err)
+				}
+				if part.FunctionCall.Args == nil {
+					input = []byte("{}")
+				}
+				id := part.FunctionCall.ID
+				if id == "" {
+					id = fmt.Sprintf("toolu_%d_%d", i, j)
+				}
+				lastToolUseIDs = append(lastToolUseIDs, id)
+				blocks = append(blocks, anthropicBlock{Type: "tool_use", ID: id, Name: part.FunctionCall.Name, Input: input})
+			case part.FunctionResponse != nil:
+				response, err := json.Marshal(part.FunctionResponse.Response)
+				if err != nil {
+					return "", nil, fmt.Errorf("failed to marshal function response: %w", err)
+				}
+				id := part.FunctionResponse.ID
+				if id == "" && toolResults < len(lastToolUseIDs) {
+					id = lastToolUseIDs[toolResults]
+				}
+				toolResults++
+				blocks = append(blocks, anthropicBlock{Type: "tool_result", ToolUseID: id, Content: string(response)})
+			case part.Thought != "" || part.ThoughtSignature != "":
+				// Thinking can only be sent back verbatim, with the signature it came with.
+				if role == "assistant" && part.ThoughtSignature != "" {
+					blocks = append(blocks, anthropicBlock{Type: "thinking", Thinking: part.Thought, Signature: part.ThoughtSignature})
+				}
+			case part.Text != "":
+				blocks = append(blocks, anthropicBlock{Type: "text", Text: part.Text})
+			}
+		}
+		if len(blocks) == 0 {
+			continue
+		}
+
+		if n := len(messages); n > 0 && messages[n-1].Role == role {
+			messages[n-1].Content = append(messages[n-1].Content, blocks...)
+		} else {
+			messages = append(messages, anthropicMessage{Role: role, Content: blocks})
+		}
+	}
+	return strings.Join(system, "\n\n"), messages, nil
+}
+
+// fromAnthropicBlocks converts the content blocks of a response to a generic content.
+func fromAnthropicBlocks(blocks []anthropicBlock) (*types.Content, error) {
+	content := &types.Content{Role: "model"}
+	for _, block := range blocks {
+		switch block.Type {
+		case "text":
+			content.Parts = append(content.Parts, types.Part{Text: block.Text})
+		case "thinking":
+			content.Parts = append(content.Parts, types.Part{Thought: block.Thinking, ThoughtSignature: block.Signature})
+		case "tool_use":
+			args, err := parseToolInput(block.Input)
+			if err != nil {
+				return nil, fmt.Errorf("failed to unmarshal tool call arguments from response: %w", err)
+			}
+			content.Parts = append(content.Parts, types.Part{FunctionCall: &types.FunctionCall{ID: block.ID, Name: block.Name, Args: args}})
+		}
+	}
+	return content, nil
+}
+
+func parseToolInput(input []byte) (map[string]any, error) {
+	args := map[string]any{}
+	if len(bytes.TrimSpace(input)) == 0 {
+		return args, nil
+	}
+	if err := json.Unmarshal(input, &args); err != nil {
+		return nil, err
+	}
+	return args, nil
+}
+
+// toAnthropicTools converts tools to their Messages API definitions.
+func toAnthropicTools(tools []types.Tool) []anthropicTool {
+	anthropicTools := make([]anthropicTool, 0, len(tools))
+	for _, t := range tools {
+		anthropicTools = append(anthropicTools, newAnthropicTool(t.Name(), t.Description(), t.Parameters()))
+	}
+	return anthropicTools
+}
+
+func newAnthropicTool(name, description string, parameters *types.JsonSchemaObject) anthropicTool {
+	if parameters == nil {
+		parameters = types.NewJsonSchemaObject()
+	}
+	return anthropicTool{Name: name, Description: description, InputSchema: parameters}
+}
+
+// AnthropicChat is a chat client for the Anthropic Messages API.
+type AnthropicChat struct {
+	httpClient           *http.Client
+	baseURL              string
+	apiKey               string
+	modelName            string
+	maxTokens            int
+	thinkingBudget       int
+	models               []string // Models offered by ListModels; queried from the server when empty
+	generationConfig     types.GenerateContentConfig
+	startHistory         []*types.Content
+	toolRegistry         types.ToolRegistryInterface
+	ToolConfirmationChan chan types.ToolConfirmationOutcome
+	logger               telemetry.TelemetryLogger
+}
+
+// NewAnthropicChat creates a new AnthropicChat instance from the anthropic settings in cfg.
+func NewAnthropicChat(cfg types.Config, generationConfig types.GenerateContentConfig, startHistory []*types.Content, logger telemetry.TelemetryLogger) (Executor, error) {
+	logger.LogDebugf("NewAnthropicChat: Initializing...")
+	settings := &types.AnthropicSettings{}
+	if settingsVal, ok := cfg.Get("anthropicSettings"); ok {
+		if s, ok := settingsVal.(*types.AnthropicSettings); ok && s != nil {
+			settings = s
+		}
+	}
+	baseURL := settings.BaseURL
+	if baseURL == "" {
+		baseURL = types.DefaultAnthropicBaseURL
+	}
+	apiKeyEnv := settings.APIKeyEnv
+	if apiKeyEnv == "" {
+		apiKeyEnv = types.DefaultAnthropicAPIKeyEnv
+	}
+	apiKey := os.Getenv(apiKeyEnv)
+	if apiKey == "" {
+		logger.LogErrorf("NewAnthropicChat: %s environment variable not set", apiKeyEnv)
+		return nil, fmt.Errorf("%s environment variable not set", apiKeyEnv)
+	}
+	maxTokens := settings.MaxTokens
+	if maxTokens <= 0 {
+		maxTokens = types.DefaultAnthropicMaxTokens
+	}
+
+	modelVal, ok := cfg.Get("model")
+	if !ok {
+		return nil, fmt.Errorf("model not found in config")
+	}
+	modelName, ok := modelVal.(string)
+	if !ok {
+		return nil, fmt.Errorf("model in config is not a string")
+	}
+
+	var toolRegistry types.ToolRegistryInterface
+	if toolRegistryVal, ok := cfg.Get("toolRegistry"); ok && toolRegistryVal != nil {
+		if tr, toolRegistryOk := toolRegistryVal.(types.ToolRegistryInterface); toolRegistryOk {
+			toolRegistry = tr
+		}
+	}
+
+	// A thinking budget in the generation config, as set by sub-agents, takes precedence.
+	thinkingBudget := settings.ThinkingBudget
+	if generationConfig.ThinkingConfig != nil && generationConfig.ThinkingConfig.ThinkingBudget > 0 {
+		thinkingBudget = generationConfig.ThinkingConfig.ThinkingBudget
+	}
+
+	logger.LogDebugf("NewAnthropicChat: Initialization complete for model '%s'.", modelName)
+	return &AnthropicChat{
+		httpClient:           &http.Client{},
+		baseURL:              strings.TrimSuffix(baseURL, "/"),
+		apiKey:               apiKey,
+		modelName:            modelName,
+		maxTokens:            maxTokens,
+		thinkingBudget:       thinkingBudget,
+		models:               settings.Models,
+		generationConfig:     generationConfig,
+		startHistory:         startHistory,
+		toolRegistry:         toolRegistry,
+		ToolConfirmationChan: make(chan types.ToolConfirmationOutcome, 1),
+		logger:               logger,
+	}, nil
+}
+
+// newRequest builds a Messages API request for the given contents.
+func (ac *AnthropicChat) newRequest(modelName string, contents []*types.Content, tools []anthropicTool) (*anthropicRequest, error) {
+	system, messages, err := toAnthropicMessages(contents, ac.logger)
+	if err != nil {
+		return nil, err
+	}
+	if ac.generationConfig.SystemInstruction != "" {
+		system = strings.TrimSpace(ac.generationConfig.SystemInstruction + "\n\n" + system)
+	}
+
+	req := &anthropicRequest{
+		Model:     modelName,
+		MaxTokens: ac.maxTokens,
+		System:    system,
+		Messages:  messages,
+		Tools:     tools,
+	}
+	if ac.thinkingBudget > 0 {
+		req.Thinking = &anthropicThinking{Type: "enabled", BudgetTokens: ac.thinkingBudget}
+		if req.MaxTokens <= ac.thinkingBudget {
+			req.MaxTokens = ac.thinkingBudget + types.DefaultAnthropicMaxTokens
+		}
+	} else if ac.generationConfig.Temperature > 0 {
+		// The API rejects a temperature when thinking is enabled.
+		temperature := ac.generationConfig.Temperature
+		req.Temperature = &temperature
+	}
+	return req, nil
+}
+
+// post sends a request to an endpoint of the API and returns the body of a
+// successful response; error responses are returned as an *AnthropicError.
+func (ac *AnthropicChat) post(ctx context.Context, path string, body any) (io.ReadCloser, error) {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal anthropic request: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, ac.baseURL+path, bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create anthropic request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return ac.do(req)
+}
+
+func (ac *AnthropicChat) do(req *http.Request) (io.ReadCloser, error) {
+	req.Header.Set("x-api-key", ac.apiKey)
+	req.Header.Set("anthropic-version", anthropicVersion)
+	resp, err := ac.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send anthropic request: %w", err)
+	}
+	if resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		apiErr := &AnthropicError{StatusCode: resp.StatusCode, Type: "api_error", Message: resp.Status, RetryAfter: ParseRetryAfter(resp.Header.Get("Retry-After"))}
+		var errResp struct {
+			Error *anthropicErrorBody `json:"error"`
+		}
+		if data, readErr := io.ReadAll(io.LimitReader(resp.Body, 1<<20)); readErr == nil && json.Unmarshal(data, &errResp) == nil && errResp.Error != nil {
+			apiErr.Type, apiErr.Message = errResp.Error.Type, errResp.Error.Message
+		}
+		return nil, apiErr
+	}
+	return resp.Body, nil
+}
+
+// createMessage sends a non-streaming request.
+func (ac *AnthropicChat) createMessage(ctx context.Context, req *anthropicRequest) (*anthropicResponse, error) {
+	body, err := ac.post(ctx, "/v1/messages", req)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	var resp anthropicResponse
+	if err := json.NewDecoder(body).Decode(&resp); err != nil {
+		return nil, fmt.Errorf("failed to decode anthropic response: %w", err)
+	}
+	return &resp, nil
+}
+
+// anthropicCountTokensRequest is the body of a count_tokens request: the
+// prompt of a Messages API request, without its generation parameters.
+type anthropicCountTokensRequest struct {
+	Model    string             `json:"model"`
+	System   string             `json:"system,omitempty"`
+	Messages []anthropicMessage `json:"messages"`
+	Tools    []anthropicTool    `json:"tools,omitempty"`
+	Thinking *anthropicThinking `json:"thinking,omitempty"`
+}
+
+// CountTokens counts the prompt tokens of a request with the count_tokens
+// endpoint of the API.
+func (ac *AnthropicChat) CountTokens(ctx context.Context, contents []*types.Content, tools []types.Tool) (int, error) {
+	req, err := ac.newRequest(ac.modelName, contents, toAnthropicTools(tools))
+	if err != nil {
+		return 0, err
+	}
+	body, err := ac.post(ctx, "/v1/messages/count_tokens", &anthropicCountTokensRequest{
+		Model:    req.Model,
+		System:   req.System,
+		Messages: req.Messages,
+		Tools:    req.Tools,
+		Thinking: req.Thinking,
+	})
+	if err != nil {
+		return 0, err
+	}
+	defer body.Close()
+	var resp struct {
+		InputTokens int `json:"input_tokens"`
+	}
+	if err := json.NewDecoder(body).Decode(&resp); err != nil {
+		return 0, fmt.Errorf("failed to decode anthropic token count: %w", err)
+	}
+	return resp.InputTokens, nil
+}
+
+// stream sends a streaming request and returns its events: text, thought and
+// function call parts, a TokenCountEvent at the end, or an ErrorEvent.
+func (ac *AnthropicChat) stream(ctx context.Context, req *anthropicRequest) (<-chan any, error) {
+	req.Stream = true
+	body, err := ac.post(ctx, "/v1/messages", req)
+	if err != nil {
+		ac.logger.LogErrorf("AnthropicExecutor: Failed to create stream: %v", err)
+		return nil, err
+	}
+
+	eventChan := make(chan any)
+	go func() {
+		defer close(eventChan)
+		defer body.Close()
+		if err := ac.readStream(body, eventChan); err != nil {
+			ac.logger.LogErrorf("AnthropicExecutor: Error receiving from stream: %v", err)
+			eventChan <- types.ErrorEvent{Err: err}
+		}
+	}()
+	return eventChan, nil
+}
+
+// streamBlock accumulates a content block of a stream until it is complete.
+type streamBlock struct {
+	blockType string
+	id        string
+	name      string
+	input     strings.Builder
+	thinking  strings.Builder
+	signature string
+}
+
+// readStream parses the server-sent events of a stream. Text is forwarded as
+// it arrives; tool calls and thoughts once their block is complete.
+func (ac *AnthropicChat) readStream(body io.Reader, eventChan chan<- any) error {
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxAnthropicEventSize)
+
+	blocks := make(map[int]*streamBlock)
+	var usage anthropicUsage
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "data:") {
+			continue // Event names, comments and the blank lines between events
+		}
+		var event anthropicStreamEvent
+		if err := json.Unmarshal([]byte(strings.TrimSpace(strings.TrimPrefix(line, "data:"))), &event); err != nil {
+			return fmt.Errorf("failed to decode anthropic stream event: %w", err)
+		}
+
+		switch event.Type {
+		case "message_start":
+			if event.Message != nil {
+				usage = event.Message.Usage
+			}
+		case "content_block_start":
+			if event.ContentBlock == nil {
+				continue
+			}
+			block := &streamBlock{blockType: event.ContentBlock.Type, id: event.ContentBlock.ID, name: event.ContentBlock.Name}
+			block.thinking.WriteString(event.ContentBlock.Thinking)
+			blocks[event.Index] = block
+			if event.ContentBlock.Type == "text" && event.ContentBlock.Text != "" {
+				eventChan <- types.Part{Text: event.ContentBlock.Text}
+			}
+		case "content_block_delta":
+			block, ok := blocks[event.Index]
+			if !ok || event.Delta == nil {
+				continue
+			}
+			switch event.Delta.Type {
+			case "text_delta":
+				eventChan <- types.Part{Text: event.Delta.Text}
+			case "input_json_delta":
+				block.input.WriteString(event.Delta.PartialJSON)
+			case "thinking_delta":
+				block.thinking.WriteString(event.Delta.Thinking)
+			case "signature_delta":
+				block.signature = event.Delta.Signature
+			}
+		case "content_block_stop":
+			block, ok := blocks[event.Index]
+			if !ok {
+				continue
+			}
+			delete(blocks, event.Index)
+			switch block.blockType {
+			case "tool_use":
+				args, err := parseToolInput([]byte(block.input.String()))
+				if err != nil {
+					return fmt.Errorf("failed to unmarshal tool arguments for %s: %w, args: '%s'", block.id, err, block.input.String())
+				}
+				eventChan <- types.Part{FunctionCall: &types.FunctionCall{ID: block.id, Name: block.name, Args: args}}
+			case "thinking":
+				eventChan <- types.Part{Thought: block.thinking.String(), ThoughtSignature: block.signature}
+			}
+		case "message_delta":
+			if event.Usage != nil {
+				// The output tokens of message_delta are cumulative.
+				usage.OutputTokens = event.Usage.OutputTokens
+			}
+		case "message_stop":
+			eventChan <- types.TokenCountEvent{InputTokens: usage.totalInputTokens(), OutputTokens: usage.OutputTokens}
+			return nil
+		case "error":
+			if event.Error == nil {
+				return &AnthropicError{StatusCode: http.StatusInternalServerError, Type: "api_error", Message: "unknown stream error"}
+			}
+			return &AnthropicError{StatusCode: anthropicErrorStatus(event.Error.Type), Type: event.Error.Type, Message: event.Error.Message}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("error receiving anthropic stream: %w", err)
+	}
+	return fmt.Errorf("anthropic stream ended without message_stop")
+}
+
+func (ac *AnthropicChat) StreamContent(ctx context.Context, contents []*types.Content, tools []types.Tool) (<-chan any, error) {
+	req, err := ac.newRequest(ac.modelName, contents, toAnthropicTools(tools))
+	if err != nil {
+		return nil, err
+	}
+	return ac.stream(ctx, req)
+}
+
+func (ac *AnthropicChat) SendMessageStream(modelName string, messageParams types.MessageParams, promptId string) (<-chan types.StreamResponse, error) {
+	ac.logger.LogDebugf("AnthropicExecutor: SendMessageStream started for promptId: %s.", promptId)
+	contents := append(append([]*types.Content{}, ac.startHistory...), &types.Content{Role: "user", Parts: messageParams.Message})
+
+	var tools []anthropicTool
+	for _, toolDef := range messageParams.Tools {
+		for _, fd := range toolDef.FunctionDeclarations {
+			tools = append(tools, newAnthropicTool(fd.Name, fd.Description, fd.Parameters))
+		}
+	}
+	req, err := ac.newRequest(modelName, contents, tools)
+	if err != nil {
+		return nil, err
+	}
+	ctx := messageParams.AbortSignal
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	events, err := ac.stream(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	responseChan := make(chan types.StreamResponse)
+	go func() {
+		defer close(responseChan)
+		for event := range events {
+			switch e := event.(type) {
+			case types.Part:
+				responseChan <- types.StreamResponse{Type: types.StreamEventTypeChunk, Value: &types.GenerateContentResponse{
+					Candidates: []*types.Candidate{{Content: &types.Content{Role: "model", Parts: []types.Part{e}}}},
+				}}
+			case types.TokenCountEvent:
+				responseChan <- types.StreamResponse{Type: types.StreamEventTypeTokenCount, Value: e}
+			case types.ErrorEvent:
+				responseChan <- types.StreamResponse{Type: types.StreamEventTypeError, Error: e.Err}
+			}
+		}
+	}()
+	return responseChan, nil
+}
+
+func (ac *AnthropicChat) SetHistory(history []*types.Content) error {
+	ac.startHistory = history
+	return nil
+}
+
+func (ac *AnthropicChat) GetHistory() ([]*types.Content, error) {
+	return ac.startHistory, nil
+}
+
+func (ac *AnthropicChat) GenerateContent(contents ...*types.Content) (*types.GenerateContentResponse, error) {
+	history := append(append([]*types.Content{}, ac.startHistory...), contents...)
+	var tools []anthropicTool
+	if ac.toolRegistry != nil {
+		tools = toAnthropicTools(ac.toolRegistry.GetAllTools())
+	}
+	return ac.generate(context.Background(), history, tools)
+}
+
+func (ac *AnthropicChat) GenerateContentWithTools(ctx context.Context, history []*types.Content, tools []types.Tool) (*types.GenerateContentResponse, error) {
+	return ac.generate(ctx, history, toAnthropicTools(tools))
+}
+
+func (ac *AnthropicChat) generate(ctx context.Context, history []*types.Content, tools []anthropicTool) (*types.GenerateContentResponse, error) {
+	req, err := ac.newRequest(ac.modelName, history, tools)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := ac.createMessage(ctx, req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create anthropic message: %w", err)
+	}
+	content, err := fromAnthropicBlocks(resp.Content)
+	if err != nil {
+		return nil, err
+	}
+	return &types.GenerateContentResponse{
+		Candidates: []*types.Candidate{{Content: content}},
+	}, nil
+}
+
+func (ac *AnthropicChat) ExecuteTool(ctx context.Context, fc *types.FunctionCall) (types.ToolResult, error) {
+	if ac.toolRegistry == nil {
+		return types.ToolResult{}, fmt.Errorf("tool registry not initialized")
+	}
+	tool, err := ac.toolRegistry.GetTool(fc.Name)
+	if err != nil {
+		return types.ToolResult{}, fmt.Errorf("tool %s not found: %w", fc.Name, err)
+	}
+	return tool.Execute(ctx, fc.Args)
+}
+
+func (ac *AnthropicChat) ListModels() ([]string, error) {
+	if len(ac.models) > 0 {
+		return ac.models, nil
+	}
+	req, err := http.NewRequest(http.MethodGet, ac.baseURL+"/v1/models", nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create anthropic request: %w", err)
+	}
+	body, err := ac.do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list models: %w", err)
+	}
+	defer body.Close()
+	var modelsList struct {
+		Data []struct {
+			ID string `json:"id"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(body).Decode(&modelsList); err != nil {
+		return nil, fmt.Errorf("failed to decode anthropic models: %w", err)
+	}
+	models := make([]string, 0, len(modelsList.Data))
+	for _, model := range modelsList.Data {
+		models = append(models, model.ID)
+	}
+	return models, nil
+}
+
+func (ac *AnthropicChat) CompressChat(history []*types.Content, promptId string) (*types.ChatCompressionResult, error) {
+	summarizePrompt, ok := prompts.GetPrompt("compression")
+	if !ok {
+		return nil, fmt.Errorf("chat compression prompt not found")
+	}
+
+	var historyText strings.Builder
+	for _, content := range history {
+		for _, part := range content.Parts {
+			historyText.WriteString(fmt.Sprintf("%s: %s\n", content.Role, part.Text))
+		}
+	}
+
+	req := &anthropicRequest{
+		Model:     ac.modelName,
+		MaxTokens: ac.maxTokens,
+		System:    summarizePrompt,
+		Messages:  []anthropicMessage{{Role: "user", Content: []anthropicBlock{{Type: "text", Text: historyText.String()}}}},
+	}
+	resp, err := ac.createMessage(context.Background(), req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate summary: %w", err)
+	}
+	var summary strings.Builder
+	for _, block := range resp.Content {
+		if block.Type == "text" {
+			summary.WriteString(block.Text)
+		}
+	}
+	if summary.Len() == 0 {
+		return nil, fmt.Errorf("received an empty summary response")
+	}
+
+	return &types.ChatCompressionResult{
+		Summary:            summary.String(),
+		OriginalTokenCount: resp.Usage.totalInputTokens(),
+		NewTokenCount:      resp.Usage.OutputTokens,
+		InputTokens:        resp.Usage.totalInputTokens(),
+		OutputTokens:       resp.Usage.OutputTokens,
+		CompressionStatus:  "OK",
+	}, nil
+}
+
+// SetUserConfirmationChannel is a no-op for AnthropicChat.
+func (ac *AnthropicChat) SetUserConfirmationChannel(ch chan bool) {
+	// No-op
+}
+
+// SetToolConfirmationChannel sets the channel for tool confirmation.
+func (ac *AnthropicChat) SetToolConfirmationChannel(ch chan types.ToolConfirmationOutcome) {
+	ac.ToolConfirmationChan = ch
+}
+
+// Name returns the name of the executor (the model name).
+func (ac *AnthropicChat) Name() string {
+	return ac.modelName
+}
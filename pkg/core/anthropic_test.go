@@ -0,0 +1,176 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"go-ai-agent-v2/go-cli/pkg/config"
+	"go-ai-agent-v2/go-cli/pkg/types"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newAnthropicFixtureServer replays a recorded response from testdata and
+// captures the body of the last request.
+func newAnthropicFixtureServer(t *testing.T, fixture string, status int) (*httptest.Server, *anthropicRequest) {
+	data, err := os.ReadFile(filepath.Join("testdata", fixture))
+	require.NoError(t, err)
+
+	var captured anthropicRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/messages", r.URL.Path)
+		assert.Equal(t, "test-key", r.Header.Get("x-api-key"))
+		assert.Equal(t, anthropicVersion, r.Header.Get("anthropic-version"))
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&captured))
+
+		if filepath.Ext(fixture) == ".sse" {
+			w.Header().Set("Content-Type", "text/event-stream")
+		} else {
+			w.Header().Set("Content-Type", "application/json")
+		}
+		w.WriteHeader(status)
+		w.Write(data)
+	}))
+	t.Cleanup(server.Close)
+	return server, &captured
+}
+
+func newTestAnthropicChat(t *testing.T, baseURL string, generationConfig types.GenerateContentConfig) *AnthropicChat {
+	t.Setenv("ANTHROPIC_API_KEY", "test-key")
+	cfg := config.NewConfig(&config.ConfigParameters{
+		ModelName:         "claude-sonnet-4-5",
+		AnthropicSettings: &types.AnthropicSettings{BaseURL: baseURL, ThinkingBudget: 2048},
+	})
+	factory, err := NewExecutorFactory(types.ExecutorTypeAnthropic, cfg)
+	require.NoError(t, err)
+	executor, err := factory.NewExecutor(cfg, generationConfig, nil)
+	require.NoError(t, err)
+	return executor.(*AnthropicChat)
+}
+
+func collectEvents(t *testing.T, eventChan <-chan any) []any {
+	var events []any
+	for event := range eventChan {
+		events = append(events, event)
+	}
+	return events
+}
+
+func TestAnthropicChat_StreamToolUse(t *testing.T) {
+	server, captured := newAnthropicFixtureServer(t, "anthropic_tool_use.sse", http.StatusOK)
+	chat := newTestAnthropicChat(t, server.URL, types.GenerateContentConfig{SystemInstruction: "You are a coding agent."})
+
+	tool := &TestTool{types.NewBaseDeclarativeTool("list_directory", "list_directory", "Lists a directory.", types.KindRead, types.NewJsonSchemaObject(), false, false, nil)}
+	eventChan, err := chat.StreamContent(context.Background(), []*types.Content{
+		{Role: "user", Parts: []types.Part{{Text: "What is here?"}}},
+	}, []types.Tool{tool})
+	require.NoError(t, err)
+	events := collectEvents(t, eventChan)
+
+	require.Len(t, events, 5)
+	assert.Equal(t, types.Part{Thought: "The user wants to know what is in the current directory.", ThoughtSignature: "EqQBCgIYAhIM1gbcDa9GJwZA2b3hGgxBdjrkzLoky3dl1pkiMOYds"}, events[0])
+	assert.Equal(t, types.Part{Text: "Let me look"}, events[1])
+	assert.Equal(t, types.Part{Text: " at the directory."}, events[2])
+	assert.Equal(t, types.Part{FunctionCall: &types.FunctionCall{ID: "toolu_01T1x1fJ34qAmk2tNTrN7Up6", Name: "list_directory", Args: map[string]any{"path": "."}}}, events[3])
+	assert.Equal(t, types.TokenCountEvent{InputTokens: 572, OutputTokens: 89}, events[4])
+
+	assert.True(t, captured.Stream)
+	assert.Equal(t, "claude-sonnet-4-5", captured.Model)
+	assert.Equal(t, "You are a coding agent.", captured.System)
+	assert.Equal(t, &anthropicThinking{Type: "enabled", BudgetTokens: 2048}, captured.Thinking)
+	require.Len(t, captured.Tools, 1)
+	assert.Equal(t, "list_directory", captured.Tools[0].Name)
+}
+
+func TestAnthropicChat_SendsToolResultsAndThinkingBack(t *testing.T) {
+	server, captured := newAnthropicFixtureServer(t, "anthropic_message.json", http.StatusOK)
+	chat := newTestAnthropicChat(t, server.URL, types.GenerateContentConfig{})
+
+	history := []*types.Content{
+		{Role: "system", Parts: []types.Part{{Text: "Be brief."}}},
+		{Role: "user", Parts: []types.Part{{Text: "What is here?"}}},
+		{Role: "model", Parts: []types.Part{
+			{Thought: "Listing.", ThoughtSignature: "sig"},
+			{FunctionCall: &types.FunctionCall{ID: "toolu_1", Name: "list_directory", Args: map[string]any{"path": "."}}},
+			{FunctionCall: &types.FunctionCall{Name: "read_file", Args: map[string]any{"path": "main.go"}}},
+		}},
+		{Role: "tool", Parts: []types.Part{
+			{FunctionResponse: &types.FunctionResponse{ID: "toolu_1", Name: "list_directory", Response: map[string]any{"result": "main.go"}}},
+			{FunctionResponse: &types.FunctionResponse{Name: "read_file", Response: map[string]any{"result": "package main"}}},
+		}},
+	}
+	resp, err := chat.GenerateContentWithTools(context.Background(), history, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "The directory contains main.go.", resp.Candidates[0].Content.Parts[0].Text)
+
+	assert.False(t, captured.Stream)
+	assert.Equal(t, "Be brief.", captured.System)
+	require.Len(t, captured.Messages, 3)
+	assistant := captured.Messages[1]
+	assert.Equal(t, "assistant", assistant.Role)
+	require.Len(t, assistant.Content, 3)
+	assert.Equal(t, anthropicBlock{Type: "thinking", Thinking: "Listing.", Signature: "sig"}, assistant.Content[0])
+	assert.Equal(t, "toolu_1", assistant.Content[1].ID)
+	assert.JSONEq(t, `{"path": "."}`, string(assistant.Content[1].Input))
+	generatedID := assistant.Content[2].ID
+	assert.NotEmpty(t, generatedID)
+
+	results := captured.Messages[2]
+	assert.Equal(t, "user", results.Role)
+	require.Len(t, results.Content, 2)
+	assert.Equal(t, anthropicBlock{Type: "tool_result", ToolUseID: "toolu_1", Content: `{"result":"main.go"}`}, results.Content[0])
+	assert.Equal(t, generatedID, results.Content[1].ToolUseID, "a response without ID answers the call in the same position")
+}
+
+func TestAnthropicChat_Errors(t *testing.T) {
+	server, _ := newAnthropicFixtureServer(t, "anthropic_overloaded.sse", http.StatusOK)
+	chat := newTestAnthropicChat(t, server.URL, types.GenerateContentConfig{})
+
+	eventChan, err := chat.StreamContent(context.Background(), []*types.Content{{Role: "user", Parts: []types.Part{{Text: "Hi"}}}}, nil)
+	require.NoError(t, err)
+	events := collectEvents(t, eventChan)
+	require.Len(t, events, 2)
+	assert.Equal(t, types.Part{Text: "Hel"}, events[0])
+	errEvent, ok := events[1].(types.ErrorEvent)
+	require.True(t, ok)
+	var apiErr *AnthropicError
+	require.ErrorAs(t, errEvent.Err, &apiErr)
+	assert.Equal(t, 529, apiErr.StatusCode)
+	assert.Equal(t, "overloaded_error", apiErr.Type)
+
+	errorServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTooManyRequests)
+		w.Write([]byte(`{"type":"error","error":{"type":"rate_limit_error","message":"Number of request tokens has exceeded your per-minute rate limit"}}`))
+	}))
+	defer errorServer.Close()
+	chat = newTestAnthropicChat(t, errorServer.URL, types.GenerateContentConfig{})
+	_, err = chat.StreamContent(context.Background(), []*types.Content{{Role: "user", Parts: []types.Part{{Text: "Hi"}}}}, nil)
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, http.StatusTooManyRequests, apiErr.StatusCode)
+	assert.Equal(t, "rate_limit_error", apiErr.Type)
+}
+
+func TestAnthropicChat_CountTokens(t *testing.T) {
+	var captured map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/messages/count_tokens", r.URL.Path)
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&captured))
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"input_tokens":2095}`))
+	}))
+	defer server.Close()
+	chat := newTestAnthropicChat(t, server.URL, types.GenerateContentConfig{SystemInstruction: "You are a coding agent."})
+
+	count, err := chat.CountTokens(context.Background(), []*types.Content{{Role: "user", Parts: []types.Part{{Text: "Hi"}}}}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 2095, count)
+	assert.Equal(t, "claude-sonnet-4-5", captured["model"])
+	assert.Equal(t, "You are a coding agent.", captured["system"])
+	assert.NotContains(t, captured, "max_tokens", "count_tokens rejects generation parameters")
+}
@@ -0,0 +1,323 @@
+package core
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"go-ai-agent-v2/go-cli/pkg/telemetry"
+	"go-ai-agent-v2/go-cli/pkg/types"
+)
+
+// cassetteVersion is the version of the cassette file format.
+const cassetteVersion = 1
+
+// ErrNoRecordedInteraction is returned by a ReplayExecutor for a request that
+// is not in its cassette, or whose recordings have all been served.
+var ErrNoRecordedInteraction = errors.New("no recorded interaction for request")
+
+// Cassette is a recording of StreamContent requests and the events they
+// produced, stored as JSON.
+type Cassette struct {
+	Version      int                   `json:"version"`
+	Model        string                `json:"model"`
+	Interactions []CassetteInteraction `json:"interactions"`
+}
+
+// CassetteInteraction is a single recorded StreamContent call.
+type CassetteInteraction struct {
+	RequestHash string           `json:"requestHash"`
+	Contents    []*types.Content `json:"contents"`
+	Tools       []string         `json:"tools,omitempty"`
+	Events      []CassetteEvent  `json:"events"`
+}
+
+// CassetteEvent is a recorded stream event. Exactly one field is set.
+type CassetteEvent struct {
+	Part       *types.Part                  `json:"part,omitempty"`
+	TokenCount *types.TokenCountEvent       `json:"tokenCount,omitempty"`
+	Activity   *types.SubagentActivityEvent `json:"activity,omitempty"`
+	Error      string                       `json:"error,omitempty"`
+}
+
+// LoadCassette reads a cassette from a file.
+func LoadCassette(path string) (*Cassette, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cassette: %w", err)
+	}
+	var cassette Cassette
+	if err := json.Unmarshal(data, &cassette); err != nil {
+		return nil, fmt.Errorf("failed to parse cassette %s: %w", path, err)
+	}
+	if cassette.Version != cassetteVersion {
+		return nil, fmt.Errorf("unsupported cassette version %d in %s", cassette.Version, path)
+	}
+	return &cassette, nil
+}
+
+// Save writes the cassette to a file, replacing it atomically.
+func (c *Cassette) Save(path string) error {
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal cassette: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create cassette directory: %w", err)
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write cassette: %w", err)
+	}
+	return os.Rename(tmp, path)
+}
+
+// RequestHash identifies a StreamContent request by its contents and the
+// names of the offered tools. Tool call IDs are left out, since some
+// providers generate them randomly.
+func RequestHash(contents []*types.Content, toolNames []string) string {
+	normalized := make([]types.Content, 0, len(contents))
+	for _, content := range contents {
+		c := types.Content{Role: content.Role, Parts: make([]types.Part, len(content.Parts))}
+		for i, part := range content.Parts {
+			if part.FunctionCall != nil {
+				fc := *part.FunctionCall
+				fc.ID = ""
+				part.FunctionCall = &fc
+			}
+			if part.FunctionResponse != nil {
+				fr := *part.FunctionResponse
+				fr.ID = ""
+				part.FunctionResponse = &fr
+			}
+			c.Parts[i] = part
+		}
+		normalized = append(normalized, c)
+	}
+	data, _ := json.Marshal(struct {
+		Contents []types.Content `json:"contents"`
+		Tools    []string        `json:"tools"`
+	}{normalized, toolNames})
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func sortedToolNames(tools []types.Tool) []string {
+	names := make([]string, 0, len(tools))
+	for _, t := range tools {
+		names = append(names, t.Name())
+	}
+	sort.Strings(names)
+	return names
+}
+
+// toCassetteEvent converts a stream event for recording. Events that are not
+// produced by executors are not recorded.
+func toCassetteEvent(event any) (CassetteEvent, bool) {
+	switch e := event.(type) {
+	case types.Part:
+		return CassetteEvent{Part: &e}, true
+	case types.TokenCountEvent:
+		return CassetteEvent{TokenCount: &e}, true
+	case types.SubagentActivityEvent:
+		return CassetteEvent{Activity: &e}, true
+	case types.ErrorEvent:
+		return CassetteEvent{Error: e.Err.Error()}, true
+	default:
+		return CassetteEvent{}, false
+	}
+}
+
+func (e CassetteEvent) event() any {
+	switch {
+	case e.Part != nil:
+		return *e.Part
+	case e.TokenCount != nil:
+		return *e.TokenCount
+	case e.Activity != nil:
+		return *e.Activity
+	default:
+		return types.ErrorEvent{Err: errors.New(e.Error)}
+	}
+}
+
+// RecordingExecutor wraps an executor and records every StreamContent
+// request and its events to a cassette file, which is saved after each
+// completed stream. All other calls go to the wrapped executor.
+type RecordingExecutor struct {
+	Executor
+	path     string
+	mu       sync.Mutex
+	cassette *Cassette
+}
+
+// NewRecordingExecutor creates a RecordingExecutor that writes to path,
+// replacing any existing cassette there.
+func NewRecordingExecutor(executor Executor, path string) *RecordingExecutor {
+	return &RecordingExecutor{
+		Executor: executor,
+		path:     path,
+		cassette: &Cassette{Version: cassetteVersion, Model: executor.Name()},
+	}
+}
+
+// CountTokens counts the prompt tokens of a request with the wrapped executor.
+func (r *RecordingExecutor) CountTokens(ctx context.Context, contents []*types.Content, tools []types.Tool) (int, error) {
+	return CountTokens(ctx, r.Executor, contents, tools), nil
+}
+
+// StreamContent forwards the request to the wrapped executor and records the
+// events as they are passed on.
+func (r *RecordingExecutor) StreamContent(ctx context.Context, contents []*types.Content, tools []types.Tool) (<-chan any, error) {
+	toolNames := sortedToolNames(tools)
+	interaction := CassetteInteraction{
+		RequestHash: RequestHash(contents, toolNames),
+		Tools:       toolNames,
+	}
+	// Copy the contents now; the caller appends to them while streaming.
+	snapshot, err := json.Marshal(contents)
+	if err != nil {
+		return nil, fmt.Errorf("failed to record request: %w", err)
+	}
+	if err := json.Unmarshal(snapshot, &interaction.Contents); err != nil {
+		return nil, fmt.Errorf("failed to record request: %w", err)
+	}
+
+	stream, err := r.Executor.StreamContent(ctx, contents, tools)
+	if err != nil {
+		return nil, err
+	}
+
+	eventChan := make(chan any)
+	go func() {
+		defer close(eventChan)
+		for event := range stream {
+			if recorded, ok := toCassetteEvent(event); ok {
+				interaction.Events = append(interaction.Events, recorded)
+			}
+			eventChan <- event
+		}
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		r.cassette.Interactions = append(r.cassette.Interactions, interaction)
+		if err := r.cassette.Save(r.path); err != nil {
+			telemetry.LogWarnf("RecordingExecutor: %v", err)
+		}
+	}()
+	return eventChan, nil
+}
+
+// ReplayExecutor serves StreamContent requests from a cassette, matching them
+// by their request hash. Identical requests are answered in recorded order.
+// It makes no network calls; the other generation methods are not supported.
+type ReplayExecutor struct {
+	cassette             *Cassette
+	path                 string
+	mu                   sync.Mutex
+	served               map[string]int
+	history              []*types.Content
+	UserConfirmationChan chan bool
+	ToolConfirmationChan chan types.ToolConfirmationOutcome
+}
+
+// NewReplayExecutor creates a ReplayExecutor for the cassette at path.
+func NewReplayExecutor(path string) (*ReplayExecutor, error) {
+	cassette, err := LoadCassette(path)
+	if err != nil {
+		return nil, err
+	}
+	return &ReplayExecutor{cassette: cassette, path: path, served: make(map[string]int)}, nil
+}
+
+// StreamContent replays the events recorded for the request.
+func (r *ReplayExecutor) StreamContent(ctx context.Context, contents []*types.Content, tools []types.Tool) (<-chan any, error) {
+	hash := RequestHash(contents, sortedToolNames(tools))
+
+	r.mu.Lock()
+	var interaction *CassetteInteraction
+	skip := r.served[hash]
+	for i := range r.cassette.Interactions {
+		if r.cassette.Interactions[i].RequestHash != hash {
+			continue
+		}
+		if skip == 0 {
+			interaction = &r.cassette.Interactions[i]
+			break
+		}
+		skip--
+	}
+	if interaction != nil {
+		r.served[hash]++
+	}
+	r.mu.Unlock()
+	if interaction == nil {
+		return nil, fmt.Errorf("%w %s in %s", ErrNoRecordedInteraction, hash[:12], r.path)
+	}
+
+	eventChan := make(chan any)
+	go func() {
+		defer close(eventChan)
+		for _, recorded := range interaction.Events {
+			select {
+			case eventChan <- recorded.event():
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return eventChan, nil
+}
+
+func (r *ReplayExecutor) GenerateContent(contents ...*types.Content) (*types.GenerateContentResponse, error) {
+	return nil, fmt.Errorf("GenerateContent is not supported when replaying a cassette")
+}
+
+func (r *ReplayExecutor) GenerateContentWithTools(ctx context.Context, history []*types.Content, tools []types.Tool) (*types.GenerateContentResponse, error) {
+	return nil, fmt.Errorf("GenerateContentWithTools is not supported when replaying a cassette")
+}
+
+func (r *ReplayExecutor) ExecuteTool(ctx context.Context, fc *types.FunctionCall) (types.ToolResult, error) {
+	return types.ToolResult{}, fmt.Errorf("ExecuteTool is not supported when replaying a cassette")
+}
+
+func (r *ReplayExecutor) SendMessageStream(modelName string, messageParams types.MessageParams, promptId string) (<-chan types.StreamResponse, error) {
+	return nil, fmt.Errorf("SendMessageStream is not supported when replaying a cassette")
+}
+
+func (r *ReplayExecutor) CompressChat(history []*types.Content, promptId string) (*types.ChatCompressionResult, error) {
+	return nil, fmt.Errorf("CompressChat is not supported when replaying a cassette")
+}
+
+// ListModels returns the model the cassette was recorded with.
+func (r *ReplayExecutor) ListModels() ([]string, error) {
+	return []string{r.cassette.Model}, nil
+}
+
+func (r *ReplayExecutor) GetHistory() ([]*types.Content, error) {
+	return r.history, nil
+}
+
+func (r *ReplayExecutor) SetHistory(history []*types.Content) error {
+	r.history = history
+	return nil
+}
+
+func (r *ReplayExecutor) SetUserConfirmationChannel(ch chan bool) {
+	r.UserConfirmationChan = ch
+}
+
+func (r *ReplayExecutor) SetToolConfirmationChannel(ch chan types.ToolConfirmationOutcome) {
+	r.ToolConfirmationChan = ch
+}
+
+// Name returns the model the cassette was recorded with.
+func (r *ReplayExecutor) Name() string {
+	return r.cassette.Model
+}
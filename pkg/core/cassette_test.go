@@ -0,0 +1,66 @@
+package core
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"go-ai-agent-v2/go-cli/pkg/types"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecordingAndReplayExecutor(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cassettes", "chat.json")
+	calls := 0
+	inner := &MockExecutor{StreamContentFunc: func(ctx context.Context, contents ...*types.Content) (<-chan any, error) {
+		calls++
+		eventChan := make(chan any, 3)
+		eventChan <- types.Part{Text: "Answer"}
+		eventChan <- types.Part{FunctionCall: &types.FunctionCall{ID: "call_random", Name: "read_file", Args: map[string]any{"path": "a.txt", "limit": 10}}}
+		eventChan <- types.TokenCountEvent{InputTokens: len(contents), OutputTokens: calls}
+		close(eventChan)
+		return eventChan, nil
+	}}
+	tool := &TestTool{types.NewBaseDeclarativeTool("read_file", "read_file", "Reads a file.", types.KindRead, types.NewJsonSchemaObject(), false, false, nil)}
+	request := []*types.Content{{Role: "user", Parts: []types.Part{{Text: "Read a.txt"}}}}
+
+	recorder := NewRecordingExecutor(inner, path)
+	var recorded [][]any
+	for i := 0; i < 2; i++ {
+		eventChan, err := recorder.StreamContent(context.Background(), request, []types.Tool{tool})
+		require.NoError(t, err)
+		recorded = append(recorded, collectEvents(t, eventChan))
+	}
+
+	replayer, err := NewReplayExecutor(path)
+	require.NoError(t, err)
+	assert.Equal(t, "mock", replayer.Name())
+	for i := 0; i < 2; i++ {
+		eventChan, err := replayer.StreamContent(context.Background(), request, []types.Tool{tool})
+		require.NoError(t, err)
+		events := collectEvents(t, eventChan)
+		require.Len(t, events, 3)
+		assert.Equal(t, recorded[i][0], events[0])
+		assert.Equal(t, types.Part{FunctionCall: &types.FunctionCall{ID: "call_random", Name: "read_file", Args: map[string]any{"path": "a.txt", "limit": float64(10)}}}, events[1])
+		assert.Equal(t, recorded[i][2], events[2], "identical requests are answered in recorded order")
+	}
+
+	_, err = replayer.StreamContent(context.Background(), request, []types.Tool{tool})
+	assert.ErrorIs(t, err, ErrNoRecordedInteraction)
+	_, err = replayer.StreamContent(context.Background(), request, nil)
+	assert.ErrorIs(t, err, ErrNoRecordedInteraction, "the offered tools are part of the request")
+}
+
+func TestRequestHash_IgnoresToolCallIDs(t *testing.T) {
+	history := func(id string) []*types.Content {
+		return []*types.Content{
+			{Role: "user", Parts: []types.Part{{Text: "List files"}}},
+			{Role: "model", Parts: []types.Part{{FunctionCall: &types.FunctionCall{ID: id, Name: "ls", Args: map[string]any{"path": "."}}}}},
+			{Role: "tool", Parts: []types.Part{{FunctionResponse: &types.FunctionResponse{ID: id, Name: "ls", Response: map[string]any{"result": "a.txt"}}}}},
+		}
+	}
+	assert.Equal(t, RequestHash(history("call_1"), nil), RequestHash(history("call_2"), nil))
+	assert.NotEqual(t, RequestHash(history("call_1"), nil), RequestHash(history("call_1")[:1], nil))
+}
@@ -3,6 +3,10 @@ package core
 import (
 	"context"
 	"go-ai-agent-v2/go-cli/pkg/types"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
 )
 
 // Executor interface abstracts the behavior of different AI executors.
@@ -20,3 +24,21 @@ type Executor interface {
 	SetUserConfirmationChannel(chan bool)                          // New method for user confirmation
 	SetToolConfirmationChannel(chan types.ToolConfirmationOutcome) // New method for rich tool confirmation
 }
+
+// ParseRetryAfter parses a Retry-After header, given in seconds or as an HTTP
+// date, and returns 0 when it is absent or invalid.
+func ParseRetryAfter(value string) time.Duration {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		if delay := time.Until(date); delay > 0 {
+			return delay
+		}
+	}
+	return 0
+}
@@ -20,14 +20,9 @@ type GeminiExecutorFactory struct {
 
 // NewExecutor creates a new executor.
 func (f *GeminiExecutorFactory) NewExecutor(cfg types.Config, generationConfig types.GenerateContentConfig, startHistory []*types.Content) (Executor, error) {
-	// For now, we'll create a simple context. This will need to be updated
-	// to use the actual chat history and user request.
-	routingCtx := &routing.RoutingContext{
-		History:      []string{},
-		Request:      "dummy request",
-		Signal:       context.Background(),
-		ExecutorType: types.ExecutorTypeGemini,
-	}
+	// With the "auto" model, this picks the model of the last request of the
+	// start history; the chat service routes each new turn again.
+	routingCtx := routing.ContextFromHistory(context.Background(), types.ExecutorTypeGemini, startHistory)
 
 	decision, err := f.Router.Route(routingCtx, cfg)
 	if err != nil {
@@ -58,6 +53,15 @@ func (f *MockExecutorFactory) NewExecutor(cfg types.Config, generationConfig typ
 	if !ok {
 		return nil, fmt.Errorf("tool registry in config is not of expected type")
 	}
+	if scenarioVal, ok := cfg.Get("mockScenario"); ok {
+		if scenarioPath, _ := scenarioVal.(string); scenarioPath != "" {
+			scenario, err := LoadScenario(scenarioPath)
+			if err != nil {
+				return nil, err
+			}
+			return NewScenarioMockExecutor(scenario, toolRegistry), nil
+		}
+	}
 	return NewRealisticMockExecutor(toolRegistry), nil
 }
 
@@ -69,6 +73,30 @@ func (f *QwenExecutorFactory) NewExecutor(cfg types.Config, generationConfig typ
 	return NewQwenChat(cfg, generationConfig, startHistory, telemetry.GlobalLogger)
 }
 
+// OpenAIExecutorFactory is an ExecutorFactory that creates OpenAIChat instances.
+type OpenAIExecutorFactory struct{}
+
+// NewExecutor creates a new OpenAIChat executor.
+func (f *OpenAIExecutorFactory) NewExecutor(cfg types.Config, generationConfig types.GenerateContentConfig, startHistory []*types.Content) (Executor, error) {
+	return NewOpenAIChat(cfg, generationConfig, startHistory, telemetry.GlobalLogger)
+}
+
+// AnthropicExecutorFactory is an ExecutorFactory that creates AnthropicChat instances.
+type AnthropicExecutorFactory struct{}
+
+// NewExecutor creates a new AnthropicChat executor.
+func (f *AnthropicExecutorFactory) NewExecutor(cfg types.Config, generationConfig types.GenerateContentConfig, startHistory []*types.Content) (Executor, error) {
+	return NewAnthropicChat(cfg, generationConfig, startHistory, telemetry.GlobalLogger)
+}
+
+// OllamaExecutorFactory is an ExecutorFactory that creates OllamaChat instances.
+type OllamaExecutorFactory struct{}
+
+// NewExecutor creates a new OllamaChat executor.
+func (f *OllamaExecutorFactory) NewExecutor(cfg types.Config, generationConfig types.GenerateContentConfig, startHistory []*types.Content) (Executor, error) {
+	return NewOllamaChat(cfg, generationConfig, startHistory, telemetry.GlobalLogger)
+}
+
 // NewExecutorFactory creates an ExecutorFactory based on the provided type.
 func NewExecutorFactory(executorType string, cfg types.Config) (ExecutorFactory, error) {
 	switch executorType {
@@ -78,6 +106,12 @@ func NewExecutorFactory(executorType string, cfg types.Config) (ExecutorFactory,
 		}, nil
 	case types.ExecutorTypeQwen:
 		return &QwenExecutorFactory{}, nil
+	case types.ExecutorTypeOpenAI:
+		return &OpenAIExecutorFactory{}, nil
+	case types.ExecutorTypeAnthropic:
+		return &AnthropicExecutorFactory{}, nil
+	case types.ExecutorTypeOllama:
+		return &OllamaExecutorFactory{}, nil
 	case types.ExecutorTypeMock:
 		return &MockExecutorFactory{}, nil
 	default:
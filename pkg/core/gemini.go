@@ -11,7 +11,6 @@ import (
 	"go-ai-agent-v2/go-cli/pkg/types"
 
 	"github.com/google/generative-ai-go/genai"
-	"github.com/pkoukk/tiktoken-go"
 	"google.golang.org/api/iterator"
 	"google.golang.org/api/option"
 )
@@ -238,12 +237,7 @@ func (gc *GeminiChat) StreamContent(ctx context.Context, history []*types.Conten
 					inputText.WriteString(part.Text)
 				}
 			}
-			tke, err := tiktoken.GetEncoding("cl100k_base")
-			if err != nil {
-				eventChan <- types.ErrorEvent{Err: fmt.Errorf("failed to get tiktoken encoding: %w", err)}
-				return
-			}
-			inputTokens := len(tke.Encode(inputText.String(), nil, nil))
+			inputTokens := TextTokens(inputText.String())
 	
 			var lastParts []genai.Part
 			if len(history) > 0 {
@@ -284,7 +278,7 @@ func (gc *GeminiChat) StreamContent(ctx context.Context, history []*types.Conten
 					}
 				}
 			}
-			outputTokens := len(tke.Encode(outputText.String(), nil, nil))
+			outputTokens := TextTokens(outputText.String())
 			eventChan <- types.TokenCountEvent{InputTokens: inputTokens, OutputTokens: outputTokens}
 			gc.logger.LogDebugf("GeminiExecutor: Finished processing Gemini stream.")
 		}()
@@ -322,6 +316,33 @@ func (gc *GeminiChat) GenerateContentWithTools(ctx context.Context, history []*t
 	return nil, fmt.Errorf("not implemented")
 }
 
+// CountTokens counts the prompt tokens of a request with the countTokens
+// endpoint of the API. The endpoint counts a single message, so the history
+// is sent as one, with function calls and responses rendered as text; the
+// system instruction and tools of the model are counted too.
+func (gc *GeminiChat) CountTokens(ctx context.Context, history []*types.Content, tools []types.Tool) (int, error) {
+	// A copy of the model, so that requests streamed at the same time do not
+	// see its tools change.
+	model := *gc.model
+	if gc.toolRegistry != nil {
+		model.Tools = buildGeminiTools(gc.toolRegistry, gc.logger)
+	}
+	var parts []genai.Part
+	for _, content := range history {
+		if text := promptText(content.Parts); text != "" {
+			parts = append(parts, genai.Text(text))
+		}
+	}
+	if len(parts) == 0 {
+		return 0, nil
+	}
+	resp, err := model.CountTokens(ctx, parts...)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count tokens: %w", err)
+	}
+	return int(resp.TotalTokens), nil
+}
+
 // CompressChat summarizes the chat history.
 func (gc *GeminiChat) CompressChat(history []*types.Content, promptID string) (*types.ChatCompressionResult, error) {
 	// 1. Get the summarization prompt
@@ -0,0 +1,199 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"go-ai-agent-v2/go-cli/pkg/types"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Scenario is a scripted conversation for the mock executor, loaded from a
+// YAML file. Each call to StreamContent plays the next turn.
+//
+//	name: create a file
+//	turns:
+//	  - chunks: ["I'll create it."]
+//	    functionCalls:
+//	      - name: write_file
+//	        args: {file_path: hello.txt, content: Hello}
+//	        expectResult: Successfully wrote
+//	  - error: {status: 429, message: Resource exhausted}
+//	  - chunks: ["Done."]
+//	    usage: {input: 120, output: 8}
+type Scenario struct {
+	Name  string         `yaml:"name"`
+	Turns []ScenarioTurn `yaml:"turns"`
+}
+
+// ScenarioTurn is one model response of a scenario. Its events are streamed in
+// field order: thought, text chunks, function calls, usage, then the error.
+type ScenarioTurn struct {
+	Thought       string                 `yaml:"thought,omitempty"`
+	Chunks        []string               `yaml:"chunks,omitempty"`
+	FunctionCalls []ScenarioFunctionCall `yaml:"functionCalls,omitempty"`
+	Usage         *ScenarioUsage         `yaml:"usage,omitempty"`
+	Error         *ScenarioError         `yaml:"error,omitempty"`
+}
+
+// ScenarioFunctionCall is a function call made by the model. When
+// ExpectResult is set, the next turn fails unless the tool result sent back
+// for this call contains it.
+type ScenarioFunctionCall struct {
+	Name         string         `yaml:"name"`
+	Args         map[string]any `yaml:"args,omitempty"`
+	ExpectResult string         `yaml:"expectResult,omitempty"`
+}
+
+// ScenarioUsage is the token usage reported at the end of a turn.
+type ScenarioUsage struct {
+	Input  int `yaml:"input"`
+	Output int `yaml:"output"`
+}
+
+// ScenarioError is an API error injected into a turn, such as a 429.
+// RetryAfter is in seconds, like the Retry-After header.
+type ScenarioError struct {
+	StatusCode int    `yaml:"status"`
+	Message    string `yaml:"message"`
+	RetryAfter int    `yaml:"retryAfter,omitempty"`
+}
+
+func (e *ScenarioError) Error() string {
+	return fmt.Sprintf("scenario error (status %d): %s", e.StatusCode, e.Message)
+}
+
+// LoadScenario reads and validates a scenario file.
+func LoadScenario(path string) (*Scenario, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read scenario: %w", err)
+	}
+	var scenario Scenario
+	if err := yaml.Unmarshal(data, &scenario); err != nil {
+		return nil, fmt.Errorf("failed to parse scenario %s: %w", path, err)
+	}
+	if scenario.Name == "" {
+		scenario.Name = path
+	}
+	if len(scenario.Turns) == 0 {
+		return nil, fmt.Errorf("scenario %s has no turns", path)
+	}
+	for i, turn := range scenario.Turns {
+		if turn.Thought == "" && len(turn.Chunks) == 0 && len(turn.FunctionCalls) == 0 && turn.Error == nil {
+			return nil, fmt.Errorf("scenario %s: turn %d is empty", path, i+1)
+		}
+		for _, call := range turn.FunctionCalls {
+			if call.Name == "" {
+				return nil, fmt.Errorf("scenario %s: turn %d has a function call without a name", path, i+1)
+			}
+		}
+	}
+	return &scenario, nil
+}
+
+// NewScenarioMockExecutor creates a MockExecutor that plays a scenario. Tools
+// run for real through the registry, so that results can be checked.
+func NewScenarioMockExecutor(scenario *Scenario, toolRegistry types.ToolRegistryInterface) *MockExecutor {
+	mock := &MockExecutor{toolRegistry: toolRegistry}
+	var pending []pendingScenarioCall
+
+	mock.ExecuteToolFunc = func(ctx context.Context, fc *types.FunctionCall) (types.ToolResult, error) {
+		if mock.toolRegistry == nil {
+			return types.ToolResult{}, fmt.Errorf("tool registry not initialized")
+		}
+		tool, err := mock.toolRegistry.GetTool(fc.Name)
+		if err != nil {
+			return types.ToolResult{}, fmt.Errorf("tool %s not found: %w", fc.Name, err)
+		}
+		return tool.Execute(ctx, fc.Args)
+	}
+
+	mock.StreamContentFunc = func(ctx context.Context, contents ...*types.Content) (<-chan any, error) {
+		step := mock.MockStep
+		mock.MockStep++
+		if step >= len(scenario.Turns) {
+			return nil, fmt.Errorf("scenario %q has only %d turns, but turn %d was requested", scenario.Name, len(scenario.Turns), step+1)
+		}
+		if err := checkScenarioResults(pending, contents); err != nil {
+			return nil, fmt.Errorf("scenario %q turn %d: %w", scenario.Name, step+1, err)
+		}
+		turn := scenario.Turns[step]
+
+		var events []any
+		if turn.Thought != "" {
+			events = append(events, types.Part{Thought: turn.Thought})
+		}
+		for _, chunk := range turn.Chunks {
+			events = append(events, types.Part{Text: chunk})
+		}
+		pending = nil
+		for i, call := range turn.FunctionCalls {
+			id := fmt.Sprintf("scenario_%d_%d", step+1, i+1)
+			args := call.Args
+			if args == nil {
+				args = map[string]any{}
+			}
+			events = append(events, types.Part{FunctionCall: &types.FunctionCall{ID: id, Name: call.Name, Args: args}})
+			if call.ExpectResult != "" {
+				pending = append(pending, pendingScenarioCall{id: id, name: call.Name, expect: call.ExpectResult})
+			}
+		}
+		if turn.Usage != nil {
+			events = append(events, types.TokenCountEvent{InputTokens: turn.Usage.Input, OutputTokens: turn.Usage.Output})
+		}
+		if turn.Error != nil {
+			events = append(events, types.ErrorEvent{Err: turn.Error})
+		}
+
+		eventChan := make(chan any)
+		go func() {
+			defer close(eventChan)
+			for _, event := range events {
+				select {
+				case eventChan <- event:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+		return eventChan, nil
+	}
+	return mock
+}
+
+// pendingScenarioCall is a function call whose result is checked on the next turn.
+type pendingScenarioCall struct {
+	id     string
+	name   string
+	expect string
+}
+
+// checkScenarioResults finds the tool results sent back for the pending calls
+// in the latest request and checks that each contains the expected text.
+func checkScenarioResults(pending []pendingScenarioCall, contents []*types.Content) error {
+	if len(pending) == 0 {
+		return nil
+	}
+	results := make(map[string]string)
+	for _, content := range contents {
+		for _, part := range content.Parts {
+			if part.FunctionResponse != nil && part.FunctionResponse.ID != "" {
+				results[part.FunctionResponse.ID] = fmt.Sprint(part.FunctionResponse.Response["result"])
+			}
+		}
+	}
+	for _, call := range pending {
+		result, ok := results[call.id]
+		if !ok {
+			return fmt.Errorf("no result was sent back for %s", call.name)
+		}
+		if !strings.Contains(result, call.expect) {
+			return fmt.Errorf("result of %s does not contain %q: %s", call.name, call.expect, result)
+		}
+	}
+	return nil
+}
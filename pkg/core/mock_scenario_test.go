@@ -0,0 +1,74 @@
+package core
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"go-ai-agent-v2/go-cli/pkg/config"
+	"go-ai-agent-v2/go-cli/pkg/types"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScenarioMockExecutor(t *testing.T) {
+	cfg := config.NewConfig(&config.ConfigParameters{
+		ToolRegistry: types.NewToolRegistry(),
+		MockScenario: filepath.Join("testdata", "scenarios", "write_file.yaml"),
+	})
+	factory, err := NewExecutorFactory(types.ExecutorTypeMock, cfg)
+	require.NoError(t, err)
+	executor, err := factory.NewExecutor(cfg, types.GenerateContentConfig{}, nil)
+	require.NoError(t, err)
+
+	user := &types.Content{Role: "user", Parts: []types.Part{{Text: "Create hello.txt"}}}
+	eventChan, err := executor.StreamContent(context.Background(), []*types.Content{user}, nil)
+	require.NoError(t, err)
+	events := collectEvents(t, eventChan)
+	require.Len(t, events, 4)
+	assert.Equal(t, types.Part{Thought: "The user wants a greeting file."}, events[0])
+	assert.Equal(t, types.Part{Text: "I'll create "}, events[1])
+	assert.Equal(t, types.Part{Text: "hello.txt."}, events[2])
+	call := events[3].(types.Part).FunctionCall
+	assert.Equal(t, &types.FunctionCall{ID: "scenario_1_1", Name: "write_file", Args: map[string]any{"file_path": "hello.txt", "content": "Hello"}}, call)
+
+	history := []*types.Content{user, {Role: "model", Parts: []types.Part{{FunctionCall: call}}}, {Role: "tool", Parts: []types.Part{
+		{FunctionResponse: &types.FunctionResponse{ID: call.ID, Name: call.Name, Response: map[string]any{"result": "Successfully wrote to hello.txt"}}},
+	}}}
+	eventChan, err = executor.StreamContent(context.Background(), history, nil)
+	require.NoError(t, err)
+	events = collectEvents(t, eventChan)
+	require.Len(t, events, 1)
+	var scenarioErr *ScenarioError
+	require.ErrorAs(t, events[0].(types.ErrorEvent).Err, &scenarioErr)
+	assert.Equal(t, 429, scenarioErr.StatusCode)
+
+	eventChan, err = executor.StreamContent(context.Background(), history, nil)
+	require.NoError(t, err)
+	assert.Equal(t, []any{types.Part{Text: "Created hello.txt."}, types.TokenCountEvent{InputTokens: 120, OutputTokens: 8}}, collectEvents(t, eventChan))
+
+	_, err = executor.StreamContent(context.Background(), history, nil)
+	assert.ErrorContains(t, err, "has only 3 turns")
+}
+
+func TestScenarioMockExecutor_UnexpectedToolResult(t *testing.T) {
+	scenario, err := LoadScenario(filepath.Join("testdata", "scenarios", "write_file.yaml"))
+	require.NoError(t, err)
+	executor := NewScenarioMockExecutor(scenario, types.NewToolRegistry())
+
+	_, err = executor.StreamContent(context.Background(), nil, nil)
+	require.NoError(t, err)
+	_, err = executor.StreamContent(context.Background(), []*types.Content{{Role: "tool", Parts: []types.Part{
+		{FunctionResponse: &types.FunctionResponse{ID: "scenario_1_1", Name: "write_file", Response: map[string]any{"result": "Error: permission denied"}}},
+	}}}, nil)
+	assert.ErrorContains(t, err, `turn 2: result of write_file does not contain "Successfully wrote"`)
+}
+
+func TestLoadScenario_Invalid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "scenario.yaml")
+	require.NoError(t, os.WriteFile(path, []byte("turns:\n  - chunks: [Hi]\n  - usage: {input: 1, output: 1}\n"), 0644))
+	_, err := LoadScenario(path)
+	assert.ErrorContains(t, err, "turn 2 is empty")
+}
@@ -0,0 +1,605 @@
+package core
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"go-ai-agent-v2/go-cli/pkg/prompts"
+	"go-ai-agent-v2/go-cli/pkg/telemetry"
+	"go-ai-agent-v2/go-cli/pkg/types"
+)
+
+// maxOllamaLineSize bounds a single NDJSON line of a stream.
+const maxOllamaLineSize = 4 << 20
+
+// OllamaError is an error returned by an Ollama server.
+type OllamaError struct {
+	StatusCode int
+	Message    string
+	RetryAfter time.Duration // From the Retry-After header, if any
+}
+
+func (e *OllamaError) Error() string {
+	return fmt.Sprintf("ollama error (status %d): %s", e.StatusCode, e.Message)
+}
+
+// unsupportedFeature reports whether the error says the model cannot use a
+// feature of the request, such as "tools" or "thinking".
+func (e *OllamaError) unsupportedFeature(feature string) bool {
+	return e.StatusCode == http.StatusBadRequest && strings.Contains(e.Message, "does not support "+feature)
+}
+
+// ollamaChatRequest is the body of an /api/chat request.
+type ollamaChatRequest struct {
+	Model     string          `json:"model"`
+	Messages  []ollamaMessage `json:"messages"`
+	Tools     []ollamaTool    `json:"tools,omitempty"`
+	Stream    bool            `json:"stream"`
+	Think     bool            `json:"think,omitempty"`
+	KeepAlive string          `json:"keep_alive,omitempty"`
+	Options   map[string]any  `json:"options,omitempty"`
+}
+
+type ollamaMessage struct {
+	Role      string           `json:"role"`
+	Content   string           `json:"content"`
+	Thinking  string           `json:"thinking,omitempty"`
+	ToolCalls []ollamaToolCall `json:"tool_calls,omitempty"`
+	ToolName  string           `json:"tool_name,omitempty"`
+}
+
+type ollamaToolCall struct {
+	Function struct {
+		Name      string         `json:"name"`
+		Arguments map[string]any `json:"arguments"`
+	} `json:"function"`
+}
+
+type ollamaTool struct {
+	Type     string             `json:"type"`
+	Function ollamaToolFunction `json:"function"`
+}
+
+type ollamaToolFunction struct {
+	Name        string                  `json:"name"`
+	Description string                  `json:"description,omitempty"`
+	Parameters  *types.JsonSchemaObject `json:"parameters"`
+}
+
+// ollamaChatResponse is a line of a streamed /api/chat response, or the whole
+// response when not streaming.
+type ollamaChatResponse struct {
+	Message         ollamaMessage `json:"message"`
+	Done            bool          `json:"done"`
+	DoneReason      string        `json:"done_reason,omitempty"`
+	PromptEvalCount int           `json:"prompt_eval_count,omitempty"`
+	EvalCount       int           `json:"eval_count,omitempty"`
+	Error           string        `json:"error,omitempty"`
+}
+
+// toOllamaMessages converts generic contents to /api/chat messages. Each tool
+// response becomes a message of its own with the tool role.
+func toOllamaMessages(contents []*types.Content, logger telemetry.TelemetryLogger) ([]ollamaMessage, error) {
+	var messages []ollamaMessage
+	for _, content := range contents {
+		var role string
+		switch content.Role {
+		case "system":
+			role = "system"
+		case "model", "assistant":
+			role = "assistant"
+		case "user", "tool", "function":
+			role = "user"
+		default:
+			logger.LogWarnf("toOllamaMessages: Unknown content role '%s', mapping to user role as fallback.", content.Role)
+			role = "user"
+		}
+
+		message := ollamaMessage{Role: role}
+		var text, thinking []string
+		for _, part := range content.Parts {
+			switch {
+			case part.FunctionCall != nil:
+				var call ollamaToolCall
+				call.Function.Name = part.FunctionCall.Name
+				call.Function.Arguments = part.FunctionCall.Args
+				if call.Function.Arguments == nil {
+					call.Function.Arguments = map[string]any{}
+				}
+				message.ToolCalls = append(message.ToolCalls, call)
+			case part.FunctionResponse != nil:
+				response, err := json.Marshal(part.FunctionResponse.Response)
+				if err != nil {
+					return nil, fmt.Errorf("failed to marshal function response: %w", err)
+				}
+				messages = append(messages, ollamaMessage{Role: "tool", Content: string(response), ToolName: part.FunctionResponse.Name})
+			case part.Thought != "":
+				thinking = append(thinking, part.Thought)
+			case part.Text != "":
+				text = append(text, part.Text)
+			}
+		}
+		message.Content = strings.Join(text, "\n")
+		if role == "assistant" {
+			message.Thinking = strings.Join(thinking, "")
+		}
+		if message.Content != "" || message.Thinking != "" || len(message.ToolCalls) > 0 {
+			messages = append(messages, message)
+		}
+	}
+	return messages, nil
+}
+
+// toOllamaTools converts tools to their /api/chat definitions.
+func toOllamaTools(tools []types.Tool) []ollamaTool {
+	ollamaTools := make([]ollamaTool, 0, len(tools))
+	for _, t := range tools {
+		ollamaTools = append(ollamaTools, newOllamaTool(t.Name(), t.Description(), t.Parameters()))
+	}
+	return ollamaTools
+}
+
+func newOllamaTool(name, description string, parameters *types.JsonSchemaObject) ollamaTool {
+	if parameters == nil {
+		parameters = types.NewJsonSchemaObject()
+	}
+	return ollamaTool{Type: "function", Function: ollamaToolFunction{Name: name, Description: description, Parameters: parameters}}
+}
+
+// newOllamaToolCallID returns an ID for a tool call; Ollama does not assign any.
+func newOllamaToolCallID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return "call_" + hex.EncodeToString(b)
+}
+
+// fromOllamaMessage converts a response message to a generic content.
+func fromOllamaMessage(msg ollamaMessage) *types.Content {
+	content := &types.Content{Role: "model"}
+	if msg.Thinking != "" {
+		content.Parts = append(content.Parts, types.Part{Thought: msg.Thinking})
+	}
+	if msg.Content != "" {
+		content.Parts = append(content.Parts, types.Part{Text: msg.Content})
+	}
+	for _, call := range msg.ToolCalls {
+		content.Parts = append(content.Parts, types.Part{FunctionCall: &types.FunctionCall{ID: newOllamaToolCallID(), Name: call.Function.Name, Args: call.Function.Arguments}})
+	}
+	return content
+}
+
+// OllamaChat is a chat client for the native API of a local Ollama server.
+// It needs no network access beyond the server, not even to count tokens.
+type OllamaChat struct {
+	httpClient           *http.Client
+	baseURL              string
+	modelName            string
+	think                bool
+	keepAlive            string
+	generationConfig     types.GenerateContentConfig
+	startHistory         []*types.Content
+	toolRegistry         types.ToolRegistryInterface
+	ToolConfirmationChan chan types.ToolConfirmationOutcome
+	logger               telemetry.TelemetryLogger
+}
+
+// NewOllamaChat creates a new OllamaChat instance from the ollama settings in
+// cfg. Without a configured base URL, it uses OLLAMA_HOST or the default port.
+func NewOllamaChat(cfg types.Config, generationConfig types.GenerateContentConfig, startHistory []*types.Content, logger telemetry.TelemetryLogger) (Executor, error) {
+	logger.LogDebugf("NewOllamaChat: Initializing...")
+	settings := &types.OllamaSettings{}
+	if settingsVal, ok := cfg.Get("ollamaSettings"); ok {
+		if s, ok := settingsVal.(*types.OllamaSettings); ok && s != nil {
+			settings = s
+		}
+	}
+	baseURL := settings.BaseURL
+	if baseURL == "" {
+		baseURL = os.Getenv("OLLAMA_HOST")
+	}
+	if baseURL == "" {
+		baseURL = types.DefaultOllamaBaseURL
+	}
+	if !strings.Contains(baseURL, "://") {
+		baseURL = "http://" + baseURL // OLLAMA_HOST is often a bare host:port
+	}
+
+	modelVal, ok := cfg.Get("model")
+	if !ok {
+		return nil, fmt.Errorf("model not found in config")
+	}
+	modelName, ok := modelVal.(string)
+	if !ok {
+		return nil, fmt.Errorf("model in config is not a string")
+	}
+
+	var toolRegistry types.ToolRegistryInterface
+	if toolRegistryVal, ok := cfg.Get("toolRegistry"); ok && toolRegistryVal != nil {
+		if tr, toolRegistryOk := toolRegistryVal.(types.ToolRegistryInterface); toolRegistryOk {
+			toolRegistry = tr
+		}
+	}
+
+	think := settings.Think
+	if generationConfig.ThinkingConfig != nil && generationConfig.ThinkingConfig.IncludeThoughts {
+		think = true
+	}
+
+	logger.LogDebugf("NewOllamaChat: Initialization complete for model '%s' at %s.", modelName, baseURL)
+	return &OllamaChat{
+		httpClient:           &http.Client{},
+		baseURL:              strings.TrimSuffix(baseURL, "/"),
+		modelName:            modelName,
+		think:                think,
+		keepAlive:            settings.KeepAlive,
+		generationConfig:     generationConfig,
+		startHistory:         startHistory,
+		toolRegistry:         toolRegistry,
+		ToolConfirmationChan: make(chan types.ToolConfirmationOutcome, 1),
+		logger:               logger,
+	}, nil
+}
+
+// newRequest builds an /api/chat request for the given contents.
+func (oc *OllamaChat) newRequest(modelName string, contents []*types.Content, tools []ollamaTool, stream bool) (*ollamaChatRequest, error) {
+	messages, err := toOllamaMessages(contents, oc.logger)
+	if err != nil {
+		return nil, err
+	}
+	if oc.generationConfig.SystemInstruction != "" {
+		messages = append([]ollamaMessage{{Role: "system", Content: oc.generationConfig.SystemInstruction}}, messages...)
+	}
+
+	req := &ollamaChatRequest{
+		Model:     modelName,
+		Messages:  messages,
+		Tools:     tools,
+		Stream:    stream,
+		Think:     oc.think,
+		KeepAlive: oc.keepAlive,
+	}
+	options := map[string]any{}
+	if oc.generationConfig.Temperature > 0 {
+		options["temperature"] = oc.generationConfig.Temperature
+	}
+	if oc.generationConfig.TopP > 0 {
+		options["top_p"] = oc.generationConfig.TopP
+	}
+	if len(options) > 0 {
+		req.Options = options
+	}
+	return req, nil
+}
+
+// chat sends an /api/chat request and returns the body of a successful
+// response. When the model does not support tools or thinking, the request is
+// sent again without them, so that small local models still answer.
+func (oc *OllamaChat) chat(ctx context.Context, req *ollamaChatRequest) (io.ReadCloser, error) {
+	for {
+		body, err := oc.post(ctx, "/api/chat", req)
+		ollamaErr, ok := err.(*OllamaError)
+		switch {
+		case ok && len(req.Tools) > 0 && ollamaErr.unsupportedFeature("tools"):
+			oc.logger.LogWarnf("OllamaExecutor: Model %s does not support tools, retrying without them.", req.Model)
+			req.Tools = nil
+		case ok && req.Think && ollamaErr.unsupportedFeature("thinking"):
+			oc.logger.LogWarnf("OllamaExecutor: Model %s does not support thinking, retrying without it.", req.Model)
+			req.Think = false
+		default:
+			return body, err
+		}
+	}
+}
+
+func (oc *OllamaChat) post(ctx context.Context, path string, body any) (io.ReadCloser, error) {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal ollama request: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, oc.baseURL+path, bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create ollama request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return oc.do(req)
+}
+
+func (oc *OllamaChat) do(req *http.Request) (io.ReadCloser, error) {
+	resp, err := oc.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reach ollama at %s: %w", oc.baseURL, err)
+	}
+	if resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		ollamaErr := &OllamaError{StatusCode: resp.StatusCode, Message: resp.Status, RetryAfter: ParseRetryAfter(resp.Header.Get("Retry-After"))}
+		var errResp struct {
+			Error string `json:"error"`
+		}
+		if data, readErr := io.ReadAll(io.LimitReader(resp.Body, 1<<20)); readErr == nil && json.Unmarshal(data, &errResp) == nil && errResp.Error != "" {
+			ollamaErr.Message = errResp.Error
+		}
+		return nil, ollamaErr
+	}
+	return resp.Body, nil
+}
+
+// stream sends a streaming request and returns its events: text, thought and
+// function call parts, a TokenCountEvent at the end, or an ErrorEvent.
+func (oc *OllamaChat) stream(ctx context.Context, req *ollamaChatRequest) (<-chan any, error) {
+	body, err := oc.chat(ctx, req)
+	if err != nil {
+		oc.logger.LogErrorf("OllamaExecutor: Failed to create stream: %v", err)
+		return nil, err
+	}
+
+	eventChan := make(chan any)
+	go func() {
+		defer close(eventChan)
+		defer body.Close()
+		if err := oc.readStream(body, eventChan); err != nil {
+			oc.logger.LogErrorf("OllamaExecutor: Error receiving from stream: %v", err)
+			eventChan <- types.ErrorEvent{Err: err}
+		}
+	}()
+	return eventChan, nil
+}
+
+// readStream parses the NDJSON lines of a stream. Text and tool calls are
+// forwarded as they arrive; thinking is collected into a single thought part.
+func (oc *OllamaChat) readStream(body io.Reader, eventChan chan<- any) error {
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxOllamaLineSize)
+
+	var thinking strings.Builder
+	flushThinking := func() {
+		if thinking.Len() > 0 {
+			eventChan <- types.Part{Thought: thinking.String()}
+			thinking.Reset()
+		}
+	}
+
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var chunk ollamaChatResponse
+		if err := json.Unmarshal(line, &chunk); err != nil {
+			return fmt.Errorf("failed to decode ollama stream chunk: %w", err)
+		}
+		if chunk.Error != "" {
+			return &OllamaError{StatusCode: http.StatusInternalServerError, Message: chunk.Error}
+		}
+
+		thinking.WriteString(chunk.Message.Thinking)
+		if chunk.Message.Content != "" || len(chunk.Message.ToolCalls) > 0 {
+			flushThinking()
+		}
+		if chunk.Message.Content != "" {
+			eventChan <- types.Part{Text: chunk.Message.Content}
+		}
+		for _, call := range chunk.Message.ToolCalls {
+			args := call.Function.Arguments
+			if args == nil {
+				args = map[string]any{}
+			}
+			eventChan <- types.Part{FunctionCall: &types.FunctionCall{ID: newOllamaToolCallID(), Name: call.Function.Name, Args: args}}
+		}
+
+		if chunk.Done {
+			flushThinking()
+			eventChan <- types.TokenCountEvent{InputTokens: chunk.PromptEvalCount, OutputTokens: chunk.EvalCount}
+			return nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("error receiving ollama stream: %w", err)
+	}
+	return fmt.Errorf("ollama stream ended before done")
+}
+
+// generate sends a non-streaming request.
+func (oc *OllamaChat) generate(ctx context.Context, req *ollamaChatRequest) (*ollamaChatResponse, error) {
+	body, err := oc.chat(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	var resp ollamaChatResponse
+	if err := json.NewDecoder(body).Decode(&resp); err != nil {
+		return nil, fmt.Errorf("failed to decode ollama response: %w", err)
+	}
+	if resp.Error != "" {
+		return nil, &OllamaError{StatusCode: http.StatusInternalServerError, Message: resp.Error}
+	}
+	return &resp, nil
+}
+
+func (oc *OllamaChat) StreamContent(ctx context.Context, contents []*types.Content, tools []types.Tool) (<-chan any, error) {
+	req, err := oc.newRequest(oc.modelName, contents, toOllamaTools(tools), true)
+	if err != nil {
+		return nil, err
+	}
+	return oc.stream(ctx, req)
+}
+
+func (oc *OllamaChat) SendMessageStream(modelName string, messageParams types.MessageParams, promptId string) (<-chan types.StreamResponse, error) {
+	oc.logger.LogDebugf("OllamaExecutor: SendMessageStream started for promptId: %s.", promptId)
+	contents := append(append([]*types.Content{}, oc.startHistory...), &types.Content{Role: "user", Parts: messageParams.Message})
+
+	var tools []ollamaTool
+	for _, toolDef := range messageParams.Tools {
+		for _, fd := range toolDef.FunctionDeclarations {
+			tools = append(tools, newOllamaTool(fd.Name, fd.Description, fd.Parameters))
+		}
+	}
+	req, err := oc.newRequest(modelName, contents, tools, true)
+	if err != nil {
+		return nil, err
+	}
+	ctx := messageParams.AbortSignal
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	events, err := oc.stream(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	responseChan := make(chan types.StreamResponse)
+	go func() {
+		defer close(responseChan)
+		for event := range events {
+			switch e := event.(type) {
+			case types.Part:
+				responseChan <- types.StreamResponse{Type: types.StreamEventTypeChunk, Value: &types.GenerateContentResponse{
+					Candidates: []*types.Candidate{{Content: &types.Content{Role: "model", Parts: []types.Part{e}}}},
+				}}
+			case types.TokenCountEvent:
+				responseChan <- types.StreamResponse{Type: types.StreamEventTypeTokenCount, Value: e}
+			case types.ErrorEvent:
+				responseChan <- types.StreamResponse{Type: types.StreamEventTypeError, Error: e.Err}
+			}
+		}
+	}()
+	return responseChan, nil
+}
+
+func (oc *OllamaChat) SetHistory(history []*types.Content) error {
+	oc.startHistory = history
+	return nil
+}
+
+func (oc *OllamaChat) GetHistory() ([]*types.Content, error) {
+	return oc.startHistory, nil
+}
+
+func (oc *OllamaChat) GenerateContent(contents ...*types.Content) (*types.GenerateContentResponse, error) {
+	history := append(append([]*types.Content{}, oc.startHistory...), contents...)
+	var tools []ollamaTool
+	if oc.toolRegistry != nil {
+		tools = toOllamaTools(oc.toolRegistry.GetAllTools())
+	}
+	return oc.generateContent(context.Background(), history, tools)
+}
+
+func (oc *OllamaChat) GenerateContentWithTools(ctx context.Context, history []*types.Content, tools []types.Tool) (*types.GenerateContentResponse, error) {
+	return oc.generateContent(ctx, history, toOllamaTools(tools))
+}
+
+func (oc *OllamaChat) generateContent(ctx context.Context, history []*types.Content, tools []ollamaTool) (*types.GenerateContentResponse, error) {
+	req, err := oc.newRequest(oc.modelName, history, tools, false)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := oc.generate(ctx, req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create ollama chat completion: %w", err)
+	}
+	return &types.GenerateContentResponse{
+		Candidates: []*types.Candidate{{Content: fromOllamaMessage(resp.Message)}},
+	}, nil
+}
+
+func (oc *OllamaChat) ExecuteTool(ctx context.Context, fc *types.FunctionCall) (types.ToolResult, error) {
+	if oc.toolRegistry == nil {
+		return types.ToolResult{}, fmt.Errorf("tool registry not initialized")
+	}
+	tool, err := oc.toolRegistry.GetTool(fc.Name)
+	if err != nil {
+		return types.ToolResult{}, fmt.Errorf("tool %s not found: %w", fc.Name, err)
+	}
+	return tool.Execute(ctx, fc.Args)
+}
+
+// ListModels returns the models installed on the Ollama server.
+func (oc *OllamaChat) ListModels() ([]string, error) {
+	req, err := http.NewRequest(http.MethodGet, oc.baseURL+"/api/tags", nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create ollama request: %w", err)
+	}
+	body, err := oc.do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list models: %w", err)
+	}
+	defer body.Close()
+	var tags struct {
+		Models []struct {
+			Name string `json:"name"`
+		} `json:"models"`
+	}
+	if err := json.NewDecoder(body).Decode(&tags); err != nil {
+		return nil, fmt.Errorf("failed to decode ollama models: %w", err)
+	}
+	models := make([]string, 0, len(tags.Models))
+	for _, model := range tags.Models {
+		models = append(models, model.Name)
+	}
+	return models, nil
+}
+
+func (oc *OllamaChat) CompressChat(history []*types.Content, promptId string) (*types.ChatCompressionResult, error) {
+	summarizePrompt, ok := prompts.GetPrompt("compression")
+	if !ok {
+		return nil, fmt.Errorf("chat compression prompt not found")
+	}
+
+	var historyText strings.Builder
+	for _, content := range history {
+		for _, part := range content.Parts {
+			historyText.WriteString(fmt.Sprintf("%s: %s\n", content.Role, part.Text))
+		}
+	}
+
+	req := &ollamaChatRequest{
+		Model: oc.modelName,
+		Messages: []ollamaMessage{
+			{Role: "system", Content: summarizePrompt},
+			{Role: "user", Content: historyText.String()},
+		},
+		KeepAlive: oc.keepAlive,
+	}
+	resp, err := oc.generate(context.Background(), req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate summary: %w", err)
+	}
+	if resp.Message.Content == "" {
+		return nil, fmt.Errorf("received an empty summary response")
+	}
+
+	return &types.ChatCompressionResult{
+		Summary:            resp.Message.Content,
+		OriginalTokenCount: resp.PromptEvalCount,
+		NewTokenCount:      resp.EvalCount,
+		InputTokens:        resp.PromptEvalCount,
+		OutputTokens:       resp.EvalCount,
+		CompressionStatus:  "OK",
+	}, nil
+}
+
+// SetUserConfirmationChannel is a no-op for OllamaChat.
+func (oc *OllamaChat) SetUserConfirmationChannel(ch chan bool) {
+	// No-op
+}
+
+// SetToolConfirmationChannel sets the channel for tool confirmation.
+func (oc *OllamaChat) SetToolConfirmationChannel(ch chan types.ToolConfirmationOutcome) {
+	oc.ToolConfirmationChan = ch
+}
+
+// Name returns the name of the executor (the model name).
+func (oc *OllamaChat) Name() string {
+	return oc.modelName
+}
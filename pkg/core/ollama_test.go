@@ -0,0 +1,156 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go-ai-agent-v2/go-cli/pkg/config"
+	"go-ai-agent-v2/go-cli/pkg/types"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newOllamaFixtureServer serves /api/tags and replays a recorded /api/chat
+// response from testdata, capturing the chat requests it receives.
+func newOllamaFixtureServer(t *testing.T, fixture string) (*httptest.Server, *[]ollamaChatRequest) {
+	data, err := os.ReadFile(filepath.Join("testdata", fixture))
+	require.NoError(t, err)
+	tags, err := os.ReadFile(filepath.Join("testdata", "ollama_tags.json"))
+	require.NoError(t, err)
+
+	var captured []ollamaChatRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/tags":
+			w.Write(tags)
+		case "/api/chat":
+			var req ollamaChatRequest
+			assert.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+			captured = append(captured, req)
+			if len(req.Tools) > 0 && req.Model == "gemma:2b" {
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte(`{"error":"registry.ollama.ai/library/gemma:2b does not support tools"}`))
+				return
+			}
+			w.Header().Set("Content-Type", "application/x-ndjson")
+			w.Write(data)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server, &captured
+}
+
+func newTestOllamaChat(t *testing.T, baseURL, model string) *OllamaChat {
+	cfg := config.NewConfig(&config.ConfigParameters{
+		ModelName:      model,
+		OllamaSettings: &types.OllamaSettings{BaseURL: baseURL, Think: true, KeepAlive: "30m"},
+	})
+	factory, err := NewExecutorFactory(types.ExecutorTypeOllama, cfg)
+	require.NoError(t, err)
+	executor, err := factory.NewExecutor(cfg, types.GenerateContentConfig{SystemInstruction: "You are a coding agent."}, nil)
+	require.NoError(t, err)
+	return executor.(*OllamaChat)
+}
+
+func TestOllamaChat_StreamToolCall(t *testing.T) {
+	server, captured := newOllamaFixtureServer(t, "ollama_tool_call.ndjson")
+	chat := newTestOllamaChat(t, server.URL, "qwen3:8b")
+
+	tool := &TestTool{types.NewBaseDeclarativeTool("list_directory", "list_directory", "Lists a directory.", types.KindRead, types.NewJsonSchemaObject(), false, false, nil)}
+	eventChan, err := chat.StreamContent(context.Background(), []*types.Content{
+		{Role: "user", Parts: []types.Part{{Text: "What is here?"}}},
+		{Role: "model", Parts: []types.Part{{FunctionCall: &types.FunctionCall{ID: "call_1", Name: "list_directory", Args: map[string]any{"path": "src"}}}}},
+		{Role: "tool", Parts: []types.Part{{FunctionResponse: &types.FunctionResponse{ID: "call_1", Name: "list_directory", Response: map[string]any{"result": "main.go"}}}}},
+	}, []types.Tool{tool})
+	require.NoError(t, err)
+	events := collectEvents(t, eventChan)
+
+	require.Len(t, events, 4)
+	assert.Equal(t, types.Part{Thought: "The user wants the directory listing."}, events[0])
+	assert.Equal(t, types.Part{Text: "Let me look."}, events[1])
+	call := events[2].(types.Part).FunctionCall
+	require.NotNil(t, call)
+	assert.NotEmpty(t, call.ID)
+	assert.Equal(t, "list_directory", call.Name)
+	assert.Equal(t, map[string]any{"path": "."}, call.Args)
+	assert.Equal(t, types.TokenCountEvent{InputTokens: 312, OutputTokens: 41}, events[3])
+
+	require.Len(t, *captured, 1)
+	req := (*captured)[0]
+	assert.True(t, req.Stream)
+	assert.True(t, req.Think)
+	assert.Equal(t, "30m", req.KeepAlive)
+	require.Len(t, req.Tools, 1)
+	assert.Equal(t, "list_directory", req.Tools[0].Function.Name)
+	require.Len(t, req.Messages, 4)
+	assert.Equal(t, ollamaMessage{Role: "system", Content: "You are a coding agent."}, req.Messages[0])
+	assert.Equal(t, "assistant", req.Messages[2].Role)
+	require.Len(t, req.Messages[2].ToolCalls, 1)
+	assert.Equal(t, map[string]any{"path": "src"}, req.Messages[2].ToolCalls[0].Function.Arguments)
+	assert.Equal(t, ollamaMessage{Role: "tool", Content: `{"result":"main.go"}`, ToolName: "list_directory"}, req.Messages[3])
+}
+
+func TestOllamaChat_RetriesWithoutUnsupportedTools(t *testing.T) {
+	server, captured := newOllamaFixtureServer(t, "ollama_tool_call.ndjson")
+	chat := newTestOllamaChat(t, server.URL, "gemma:2b")
+
+	tool := &TestTool{types.NewBaseDeclarativeTool("list_directory", "list_directory", "Lists a directory.", types.KindRead, types.NewJsonSchemaObject(), false, false, nil)}
+	eventChan, err := chat.StreamContent(context.Background(), []*types.Content{{Role: "user", Parts: []types.Part{{Text: "Hi"}}}}, []types.Tool{tool})
+	require.NoError(t, err)
+	collectEvents(t, eventChan)
+
+	require.Len(t, *captured, 2)
+	assert.Len(t, (*captured)[0].Tools, 1)
+	assert.Empty(t, (*captured)[1].Tools)
+}
+
+func TestOllamaChat_ListModelsAndErrors(t *testing.T) {
+	server, _ := newOllamaFixtureServer(t, "ollama_tool_call.ndjson")
+	chat := newTestOllamaChat(t, server.URL, "qwen3:8b")
+
+	models, err := chat.ListModels()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"qwen3:8b", "llama3.2:3b"}, models)
+
+	errorServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"model":"qwen3:8b","message":{"role":"assistant","content":"Hel"},"done":false}` + "\n"))
+		w.Write([]byte(`{"error":"model runner has unexpectedly stopped"}` + "\n"))
+	}))
+	defer errorServer.Close()
+	chat = newTestOllamaChat(t, errorServer.URL, "qwen3:8b")
+	eventChan, err := chat.StreamContent(context.Background(), []*types.Content{{Role: "user", Parts: []types.Part{{Text: "Hi"}}}}, nil)
+	require.NoError(t, err)
+	events := collectEvents(t, eventChan)
+	require.Len(t, events, 2)
+	assert.Equal(t, types.Part{Text: "Hel"}, events[0])
+	errEvent, ok := events[1].(types.ErrorEvent)
+	require.True(t, ok)
+	var ollamaErr *OllamaError
+	require.ErrorAs(t, errEvent.Err, &ollamaErr)
+	assert.Equal(t, "model runner has unexpectedly stopped", ollamaErr.Message)
+}
+
+func TestOllamaChat_RetryAfter(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "3")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte(`{"error":"server busy, please try again"}`))
+	}))
+	defer server.Close()
+	chat := newTestOllamaChat(t, server.URL, "qwen3:8b")
+
+	_, err := chat.GenerateContentWithTools(context.Background(), []*types.Content{{Role: "user", Parts: []types.Part{{Text: "Hi"}}}}, nil)
+	var ollamaErr *OllamaError
+	require.ErrorAs(t, err, &ollamaErr)
+	assert.Equal(t, http.StatusServiceUnavailable, ollamaErr.StatusCode)
+	assert.Equal(t, 3*time.Second, ollamaErr.RetryAfter)
+}
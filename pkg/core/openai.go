@@ -0,0 +1,742 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"go-ai-agent-v2/go-cli/pkg/prompts"
+	"go-ai-agent-v2/go-cli/pkg/telemetry"
+	"go-ai-agent-v2/go-cli/pkg/types"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// toOpenAIMessages converts a slice of generic *types.Content to []openai.ChatCompletionMessage.
+func toOpenAIMessages(contents []*types.Content, logger telemetry.TelemetryLogger) ([]openai.ChatCompletionMessage, error) {
+	var messages []openai.ChatCompletionMessage
+	for _, content := range contents {
+		var chatMessage openai.ChatCompletionMessage
+		switch content.Role {
+		case "user":
+			chatMessage.Role = openai.ChatMessageRoleUser
+		case "model":
+			chatMessage.Role = openai.ChatMessageRoleAssistant
+		case "function", "tool": // Map both 'function' and 'tool' to openai.ChatMessageRoleTool
+			chatMessage.Role = openai.ChatMessageRoleTool
+		case "system":
+			chatMessage.Role = openai.ChatMessageRoleSystem
+		default:
+			// Fallback for unknown roles, log a warning or return an error if strict validation is needed
+			logger.LogWarnf("toOpenAIMessages: Unknown content role '%s', mapping to user role as fallback.", content.Role)
+			chatMessage.Role = openai.ChatMessageRoleUser
+		}
+
+		var contentParts []string
+		var toolCalls []openai.ToolCall
+
+		for _, part := range content.Parts {
+			if part.Text != "" {
+				contentParts = append(contentParts, part.Text)
+			} else if part.FunctionCall != nil {
+				argsBytes, err := json.Marshal(part.FunctionCall.Args)
+				if err != nil {
+					return nil, fmt.Errorf("failed to marshal function call arguments: %w", err)
+				}
+				toolCalls = append(toolCalls, openai.ToolCall{
+					ID:   part.FunctionCall.ID, // Assuming ID is populated
+					Type: openai.ToolTypeFunction,
+					Function: openai.FunctionCall{
+						Name:      part.FunctionCall.Name,
+						Arguments: string(argsBytes),
+					},
+				})
+			} else if part.FunctionResponse != nil {
+				responseBytes, err := json.Marshal(part.FunctionResponse.Response)
+				if err != nil {
+					return nil, fmt.Errorf("failed to marshal function response: %w", err)
+				}
+				contentParts = append(contentParts, fmt.Sprintf("Tool response for %s: %s", part.FunctionResponse.Name, string(responseBytes)))
+			}
+		}
+
+		if len(contentParts) > 0 {
+			chatMessage.Content = strings.Join(contentParts, "\n")
+		}
+		if len(toolCalls) > 0 {
+			chatMessage.ToolCalls = toolCalls
+		}
+		messages = append(messages, chatMessage)
+	}
+	return messages, nil
+}
+
+// fromOpenAIMessage converts an openai.ChatCompletionMessage to a generic *types.Content.
+func fromOpenAIMessage(msg openai.ChatCompletionMessage) (*types.Content, error) {
+	content := &types.Content{Role: msg.Role}
+	var parts []types.Part
+
+	if msg.Content != "" {
+		parts = append(parts, types.Part{Text: msg.Content})
+	}
+
+	for _, tc := range msg.ToolCalls {
+		var args map[string]interface{}
+		if err := json.Unmarshal([]byte(tc.Function.Arguments), &args); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal tool call arguments from response: %w", err)
+		}
+		parts = append(parts, types.Part{FunctionCall: &types.FunctionCall{
+			ID:   tc.ID,
+			Name: tc.Function.Name,
+			Args: args,
+		}})
+	}
+
+	content.Parts = parts
+	return content, nil
+}
+
+// toOpenAITools converts generic []*types.ToolDefinition to []openai.Tool.
+func toOpenAITools(toolRegistry types.ToolRegistryInterface, logger telemetry.TelemetryLogger) []openai.Tool {
+	if toolRegistry == nil {
+		return nil
+	}
+
+	allTools := toolRegistry.GetAllTools()
+	if allTools == nil {
+		return nil
+	}
+
+	openaiTools := make([]openai.Tool, 0, len(allTools)) // Pre-allocate capacity
+	for _, t := range allTools {
+		openaiTools = append(openaiTools, openai.Tool{
+			Type: openai.ToolTypeFunction,
+			Function: &openai.FunctionDefinition{
+				Name:        t.Name(),
+				Description: t.Description(),
+				Parameters:  t.Parameters(),
+			},
+		})
+	}
+	return openaiTools
+}
+
+// OpenAIChat is a chat client for any server that speaks the OpenAI
+// chat-completions API, such as OpenAI, DashScope, vLLM, Ollama or LM Studio.
+type OpenAIChat struct {
+	client               *openai.Client
+	modelName            string
+	models               []string                    // Models offered by ListModels; queried from the server when empty
+	generationConfig     types.GenerateContentConfig // New field
+	startHistory         []*types.Content
+	toolRegistry         types.ToolRegistryInterface
+	ToolConfirmationChan chan types.ToolConfirmationOutcome
+	logger               telemetry.TelemetryLogger // New field for telemetry logger
+}
+
+// NewOpenAIChat creates a new OpenAIChat instance from the openai settings in cfg.
+func NewOpenAIChat(cfg types.Config, generationConfig types.GenerateContentConfig, startHistory []*types.Content, logger telemetry.TelemetryLogger) (Executor, error) {
+	settings := &types.OpenAISettings{}
+	if settingsVal, ok := cfg.Get("openAISettings"); ok {
+		if s, ok := settingsVal.(*types.OpenAISettings); ok && s != nil {
+			settings = s
+		}
+	}
+	baseURL := settings.BaseURL
+	if baseURL == "" {
+		baseURL = types.DefaultOpenAIBaseURL
+	}
+	apiKeyEnv := settings.APIKeyEnv
+	if apiKeyEnv == "" {
+		apiKeyEnv = types.DefaultOpenAIAPIKeyEnv
+	}
+
+	apiKey := os.Getenv(apiKeyEnv)
+	if apiKey == "" {
+		// Local servers such as Ollama or LM Studio accept any key.
+		logger.LogWarnf("NewOpenAIChat: %s environment variable not set, sending requests to %s without an API key", apiKeyEnv, baseURL)
+	}
+	chat, err := newOpenAIChat(cfg, generationConfig, startHistory, logger, baseURL, apiKey, settings.Headers, settings.Models)
+	if err != nil {
+		// A nil *OpenAIChat would make a non-nil Executor.
+		return nil, err
+	}
+	return chat, nil
+}
+
+// newOpenAIChat creates an OpenAIChat that sends requests to baseURL with
+// apiKey and the extra HTTP headers.
+func newOpenAIChat(cfg types.Config, generationConfig types.GenerateContentConfig, startHistory []*types.Content, logger telemetry.TelemetryLogger, baseURL, apiKey string, headers map[string]string, models []string) (*OpenAIChat, error) {
+	logger.LogDebugf("NewOpenAIChat: Initializing for %s...", baseURL)
+
+	modelVal, ok := cfg.Get("model")
+	if !ok {
+		return nil, fmt.Errorf("model not found in config")
+	}
+	modelName, ok := modelVal.(string)
+	if !ok {
+		return nil, fmt.Errorf("model in config is not a string")
+	}
+
+	config := openai.DefaultConfig(apiKey)
+	config.BaseURL = baseURL
+	transport := http.DefaultTransport
+	if len(headers) > 0 {
+		transport = &headerTransport{headers: headers, base: transport}
+	}
+	config.HTTPClient = &http.Client{Transport: &retryAfterTransport{base: transport}}
+	client := openai.NewClientWithConfig(config)
+
+	toolRegistryVal, ok := cfg.Get("toolRegistry")
+	var toolRegistry types.ToolRegistryInterface
+	if ok && toolRegistryVal != nil {
+		if tr, toolRegistryOk := toolRegistryVal.(types.ToolRegistryInterface); toolRegistryOk {
+			toolRegistry = tr
+		}
+	}
+	logger.LogDebugf("NewOpenAIChat: Initialization complete for model '%s'.", modelName)
+	return &OpenAIChat{
+		client:               client,
+		modelName:            modelName,
+		models:               models,
+		generationConfig:     generationConfig, // Initialize new field
+		startHistory:         startHistory,
+		toolRegistry:         toolRegistry,
+		ToolConfirmationChan: make(chan types.ToolConfirmationOutcome, 1),
+		logger:               logger,
+	}, nil
+}
+
+// headerTransport adds fixed headers to every request.
+type headerTransport struct {
+	headers map[string]string
+	base    http.RoundTripper
+}
+
+func (t *headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	for key, value := range t.headers {
+		req.Header.Set(key, value)
+	}
+	return t.base.RoundTrip(req)
+}
+
+// OpenAIError is an error of an OpenAI-compatible API with the Retry-After
+// header of the response, which the go-openai errors do not keep.
+type OpenAIError struct {
+	Err        error
+	RetryAfter time.Duration
+}
+
+func (e *OpenAIError) Error() string { return e.Err.Error() }
+
+func (e *OpenAIError) Unwrap() error { return e.Err }
+
+type retryAfterKey struct{}
+
+// retryAfterTransport stores the Retry-After header of failed responses in
+// the request context set up by withRetryAfter.
+type retryAfterTransport struct {
+	base http.RoundTripper
+}
+
+func (t *retryAfterTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	if err == nil && resp.StatusCode >= 300 {
+		if retryAfter, ok := req.Context().Value(retryAfterKey{}).(*time.Duration); ok {
+			*retryAfter = ParseRetryAfter(resp.Header.Get("Retry-After"))
+		}
+	}
+	return resp, err
+}
+
+// withRetryAfter returns a context for one request of the OpenAI client and a
+// function that turns an error of that request into an OpenAIError carrying
+// the Retry-After of the response.
+func withRetryAfter(ctx context.Context) (context.Context, func(error) error) {
+	retryAfter := new(time.Duration)
+	return context.WithValue(ctx, retryAfterKey{}, retryAfter), func(err error) error {
+		if err == nil || *retryAfter == 0 {
+			return err
+		}
+		return &OpenAIError{Err: err, RetryAfter: *retryAfter}
+	}
+}
+
+func (oc *OpenAIChat) StreamContent(ctx context.Context, contents []*types.Content, tools []types.Tool) (<-chan any, error) {
+	messageParts := []types.Part{}
+	for _, content := range contents {
+		messageParts = append(messageParts, content.Parts...)
+	}
+
+	toolDefinitions := make([]*types.ToolDefinition, 0, len(tools))
+	for _, tool := range tools {
+		toolDefinitions = append(toolDefinitions, &types.ToolDefinition{
+			FunctionDeclarations: []*types.FunctionDeclaration{
+				{
+					Name:        tool.Name(),
+					Description: tool.Description(),
+					Parameters:  tool.Parameters(),
+				},
+			},
+		})
+	}
+
+	messageParams := types.MessageParams{
+		Message:     messageParts,
+		Tools:       toolDefinitions, // Pass the converted tool definitions
+		AbortSignal: ctx,
+	}
+
+	streamResponseChan, err := oc.SendMessageStream(oc.modelName, messageParams, "")
+	if err != nil {
+		return nil, err
+	}
+
+	// Convert <-chan types.StreamResponse to <-chan any
+	anyStreamChan := make(chan any)
+	go func() {
+		defer close(anyStreamChan)
+		for sr := range streamResponseChan {
+			if sr.Type == types.StreamEventTypeChunk {
+				if sr.Value != nil {
+					if genContent, ok := sr.Value.(*types.GenerateContentResponse); ok && len(genContent.Candidates) > 0 {
+						for _, part := range genContent.Candidates[0].Content.Parts {
+							if part.Text != "" {
+								anyStreamChan <- types.Part{Text: part.Text}
+							}
+							if part.FunctionCall != nil {
+								anyStreamChan <- types.Part{FunctionCall: part.FunctionCall}
+							}
+							// Handle TokenCountEvent from the "<!-- TokenCount: ... -->" format
+							if strings.HasPrefix(part.Text, "<!-- TokenCount:") {
+								var inputTokens, outputTokens int
+								fmt.Sscanf(part.Text, "<!-- TokenCount: %d input, %d output -->", &inputTokens, &outputTokens)
+								anyStreamChan <- types.TokenCountEvent{InputTokens: inputTokens, OutputTokens: outputTokens}
+							}
+						}
+					}
+				}
+			} else if sr.Type == types.StreamEventTypeError {
+				anyStreamChan <- types.ErrorEvent{Err: sr.Error}
+			} else if sr.Type == types.StreamEventTypeTokenCount {
+				if tokenEvent, ok := sr.Value.(types.TokenCountEvent); ok {
+					anyStreamChan <- tokenEvent
+				}
+			}
+		}
+	}()
+
+	return anyStreamChan, nil
+}
+
+func (oc *OpenAIChat) SendMessageStream(modelName string, messageParams types.MessageParams, promptId string) (<-chan types.StreamResponse, error) {
+	eventChan := make(chan types.StreamResponse)
+	go func() {
+		defer close(eventChan)
+		oc.logger.LogDebugf("OpenAIExecutor: SendMessageStream goroutine started for promptId: %s.", promptId)
+
+		messages := make([]openai.ChatCompletionMessage, 0)
+
+		// Start with oc.startHistory
+		historyMessages, err := toOpenAIMessages(oc.startHistory, oc.logger)
+		if err != nil {
+			oc.logger.LogErrorf("OpenAIExecutor: toOpenAIMessages failed for startHistory: %v", err)
+			eventChan <- types.StreamResponse{Type: types.StreamEventTypeError, Error: fmt.Errorf("failed to convert start history: %w", err)}
+			return
+		}
+		messages = append(messages, historyMessages...)
+
+		// Add messages from messageParams.Message (which represents current turn's user input or tool responses)
+		currentTurnContents := []*types.Content{{Parts: messageParams.Message, Role: "user"}} // Assuming messageParams.Message are user parts
+		currentTurnMessages, err := toOpenAIMessages(currentTurnContents, oc.logger)
+		if err != nil {
+			oc.logger.LogErrorf("OpenAIExecutor: toOpenAIMessages failed for messageParams.Message: %v", err)
+			eventChan <- types.StreamResponse{Type: types.StreamEventTypeError, Error: fmt.Errorf("failed to convert current message parts: %w", err)}
+			return
+		}
+		messages = append(messages, currentTurnMessages...)
+
+		oc.logger.LogDebugf("OpenAIExecutor: Converted %d messages for OpenAI API.", len(messages))
+
+		// Prepend system message if provided
+		if oc.generationConfig.SystemInstruction != "" {
+			systemMessage := openai.ChatCompletionMessage{
+				Role:    openai.ChatMessageRoleSystem,
+				Content: oc.generationConfig.SystemInstruction,
+			}
+			messages = append([]openai.ChatCompletionMessage{systemMessage}, messages...)
+			oc.logger.LogDebugf("OpenAIExecutor: Prepended system message.")
+		}
+
+		// Count input tokens
+		var inputText strings.Builder
+		for _, msg := range messages {
+			inputText.WriteString(msg.Content)
+			if msg.ToolCalls != nil {
+				for _, tc := range msg.ToolCalls {
+					inputText.WriteString(tc.Function.Arguments)
+				}
+			}
+		}
+		inputTokens := TextTokens(inputText.String())
+
+		var openaiTools []openai.Tool
+		if oc.toolRegistry != nil && messageParams.Tools != nil {
+			oc.logger.LogDebugf("OpenAIExecutor: Building OpenAI tools from messageParams...")
+			for _, toolDef := range messageParams.Tools {
+				for _, fd := range toolDef.FunctionDeclarations {
+					openaiTools = append(openaiTools, openai.Tool{
+						Type: openai.ToolTypeFunction,
+						Function: &openai.FunctionDefinition{
+							Name:        fd.Name,
+							Description: fd.Description,
+							Parameters:  fd.Parameters,
+						},
+					})
+				}
+			}
+			oc.logger.LogDebugf("OpenAIExecutor: Finished building %d tools.", len(openaiTools))
+		}
+
+		req := openai.ChatCompletionRequest{
+			Model:    modelName,
+			Messages: messages,
+			Stream:   true,
+			Tools:    openaiTools,
+		}
+
+		oc.logger.LogDebugf("OpenAIExecutor: Calling CreateChatCompletionStream...")
+		streamCtx, withRetryAfterOf := withRetryAfter(messageParams.AbortSignal)
+		stream, err := oc.client.CreateChatCompletionStream(streamCtx, req)
+		err = withRetryAfterOf(err)
+		if err != nil {
+			oc.logger.LogErrorf("OpenAIExecutor: CreateChatCompletionStream failed: %v", err)
+			eventChan <- types.StreamResponse{Type: types.StreamEventTypeError, Error: fmt.Errorf("failed to create chat completion stream: %w", err)}
+			return
+		}
+		defer stream.Close()
+		oc.logger.LogDebugf("OpenAIExecutor: Stream created. Waiting for response...")
+
+		var outputText strings.Builder
+		toolCallBuffers := make(map[string]strings.Builder)
+		toolCallNames := make(map[string]string)
+		var lastToolCallId string
+
+		for {
+			response, err := stream.Recv()
+			if errors.Is(err, io.EOF) {
+				oc.logger.LogDebugf("OpenAIExecutor: Stream finished (EOF).")
+				break
+			}
+			if err != nil {
+				oc.logger.LogErrorf("OpenAIExecutor: Error receiving from stream: %v", err)
+				eventChan <- types.StreamResponse{Type: types.StreamEventTypeError, Error: fmt.Errorf("error receiving chat completion stream: %w", err)}
+				return
+			}
+			oc.logger.LogDebugf("OpenAIExecutor: Received a response chunk.")
+
+			if len(response.Choices) > 0 {
+				delta := response.Choices[0].Delta
+				if delta.Content != "" {
+					outputText.WriteString(delta.Content)
+					eventChan <- types.StreamResponse{Type: types.StreamEventTypeChunk, Value: &types.GenerateContentResponse{
+						Candidates: []*types.Candidate{
+							{
+								Content: &types.Content{Parts: []types.Part{{Text: delta.Content}}},
+							},
+						},
+					}}
+				}
+				if delta.ToolCalls != nil {
+					for _, tc := range delta.ToolCalls {
+						currentID := tc.ID
+						currentName := tc.Function.Name
+						if currentID == "" {
+							if lastToolCallId != "" {
+								currentID = lastToolCallId
+							} else {
+								oc.logger.LogWarnf("OpenAIExecutor: Received ToolCall with empty ID and no lastToolCallId, arguments: '%s'", tc.Function.Arguments)
+								continue
+							}
+						}
+						builder := toolCallBuffers[currentID]
+						builder.WriteString(tc.Function.Arguments)
+						toolCallBuffers[currentID] = builder
+						if currentName != "" {
+							toolCallNames[currentID] = currentName
+						}
+						if tc.ID != "" {
+							lastToolCallId = tc.ID
+						}
+					}
+				}
+
+				if response.Choices[0].FinishReason == openai.FinishReasonToolCalls || response.Choices[0].FinishReason == openai.FinishReasonStop {
+					oc.logger.LogDebugf("OpenAIExecutor: Stream received finish reason: %s. Processing %d buffered tool calls.", response.Choices[0].FinishReason, len(toolCallBuffers))
+					for id, builder := range toolCallBuffers {
+						jsonArgs := builder.String()
+						var args map[string]any
+						if jsonArgs != "" {
+							if err := json.Unmarshal([]byte(jsonArgs), &args); err != nil {
+								oc.logger.LogErrorf("OpenAIExecutor: Failed to unmarshal tool arguments for ID %s: %v", id, err)
+								eventChan <- types.StreamResponse{Type: types.StreamEventTypeError, Error: fmt.Errorf("failed to unmarshal accumulated tool arguments for ID %s: %w, args: '%s'", id, err, jsonArgs)}
+								continue
+							}
+						}
+						name := toolCallNames[id]
+						oc.logger.LogDebugf("OpenAIExecutor: Sending complete tool call '%s' (ID: %s)", name, id)
+						eventChan <- types.StreamResponse{Type: types.StreamEventTypeChunk, Value: &types.GenerateContentResponse{
+							Candidates: []*types.Candidate{
+								{
+									Content: &types.Content{Parts: []types.Part{{FunctionCall: &types.FunctionCall{
+										ID:   id,
+										Name: name,
+										Args: args,
+									}}}},
+								},
+							},
+						}}
+						delete(toolCallBuffers, id)
+						delete(toolCallNames, id)
+					}
+				}
+			}
+		} // Closes `for { response, err := stream.Recv() ... }`
+		outputTokens := TextTokens(outputText.String())
+		eventChan <- types.StreamResponse{Type: types.StreamEventTypeTokenCount, Value: types.TokenCountEvent{InputTokens: inputTokens, OutputTokens: outputTokens}}
+		oc.logger.LogDebugf("OpenAIExecutor: Finished processing stream.")
+	}()
+
+	return eventChan, nil
+}
+
+func (oc *OpenAIChat) SetHistory(history []*types.Content) error {
+	oc.startHistory = history
+	return nil
+}
+
+func (oc *OpenAIChat) GenerateContent(contents ...*types.Content) (*types.GenerateContentResponse, error) {
+	historyMessages, err := toOpenAIMessages(oc.startHistory, oc.logger)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert history: %w", err)
+	}
+
+	requestMessages, err := toOpenAIMessages(contents, oc.logger)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert request contents: %w", err)
+	}
+
+	messages := append(historyMessages, requestMessages...)
+
+	req := openai.ChatCompletionRequest{
+		Model:    oc.modelName,
+		Messages: messages,
+	}
+
+	if oc.toolRegistry != nil {
+		req.Tools = toOpenAITools(oc.toolRegistry, oc.logger)
+	}
+
+	ctx, withRetryAfterOf := withRetryAfter(context.Background())
+	resp, err := oc.client.CreateChatCompletion(ctx, req)
+	if err = withRetryAfterOf(err); err != nil {
+		return nil, fmt.Errorf("failed to create chat completion: %w", err)
+	}
+
+	if len(resp.Choices) == 0 {
+		return nil, fmt.Errorf("no response from chat completion API")
+	}
+
+	genericContent, err := fromOpenAIMessage(resp.Choices[0].Message)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert openai message to generic content: %w", err)
+	}
+
+	return &types.GenerateContentResponse{
+		Candidates: []*types.Candidate{
+			{
+				Content: genericContent,
+			},
+		},
+	}, nil
+}
+
+func (oc *OpenAIChat) ExecuteTool(ctx context.Context, fc *types.FunctionCall) (types.ToolResult, error) {
+	if oc.toolRegistry == nil {
+		return types.ToolResult{}, fmt.Errorf("tool registry not initialized")
+	}
+
+	tool, err := oc.toolRegistry.GetTool(fc.Name)
+	if err != nil {
+		return types.ToolResult{}, fmt.Errorf("tool %s not found: %w", fc.Name, err)
+	}
+
+	return tool.Execute(ctx, fc.Args)
+}
+
+func (oc *OpenAIChat) ListModels() ([]string, error) {
+	if len(oc.models) > 0 {
+		return oc.models, nil
+	}
+	modelsList, err := oc.client.ListModels(context.Background())
+	if err != nil {
+		return nil, fmt.Errorf("failed to list models: %w", err)
+	}
+	models := make([]string, 0, len(modelsList.Models))
+	for _, model := range modelsList.Models {
+		models = append(models, model.ID)
+	}
+	return models, nil
+}
+
+func (oc *OpenAIChat) GetHistory() ([]*types.Content, error) {
+	return oc.startHistory, nil
+}
+
+func (oc *OpenAIChat) CompressChat(history []*types.Content, promptId string) (*types.ChatCompressionResult, error) {
+	// 1. Get the summarization prompt
+	summarizePrompt, ok := prompts.GetPrompt("compression")
+	if !ok {
+		return nil, fmt.Errorf("chat compression prompt not found")
+	}
+
+	// 2. Combine the prompt and the history
+	var historyText strings.Builder
+	for _, content := range history {
+		for _, part := range content.Parts {
+			historyText.WriteString(fmt.Sprintf("%s: %s\n", content.Role, part.Text))
+		}
+	}
+
+	fullPrompt := summarizePrompt + "\n\n--- CONVERSATION HISTORY ---\n" + historyText.String()
+
+	// 3. Count original tokens using tiktoken
+	inputTokens := TextTokens(fullPrompt)
+
+	// 4. Call the model to get the summary
+	req := openai.ChatCompletionRequest{
+		Model: oc.modelName,
+		Messages: []openai.ChatCompletionMessage{
+			{
+				Role:    openai.ChatMessageRoleSystem,
+				Content: summarizePrompt,
+			},
+			{
+				Role:    openai.ChatMessageRoleUser,
+				Content: historyText.String(),
+			},
+		},
+	}
+	resp, err := oc.client.CreateChatCompletion(context.Background(), req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate summary: %w", err)
+	}
+	if len(resp.Choices) == 0 {
+		return nil, fmt.Errorf("received an empty summary response")
+	}
+	summaryText := resp.Choices[0].Message.Content
+
+	// 5. Count new tokens
+	outputTokens := TextTokens(summaryText)
+
+	return &types.ChatCompressionResult{
+		Summary:            summaryText,
+		OriginalTokenCount: inputTokens,
+		NewTokenCount:      outputTokens,
+		InputTokens:        inputTokens,
+		OutputTokens:       outputTokens,
+		CompressionStatus:  "OK",
+	}, nil
+}
+
+// GenerateContentWithTools is a placeholder implementation for OpenAIChat.
+func (oc *OpenAIChat) GenerateContentWithTools(ctx context.Context, history []*types.Content, tools []types.Tool) (*types.GenerateContentResponse, error) {
+	// Convert history to OpenAI messages
+	messages, err := toOpenAIMessages(history, oc.logger)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert history for GenerateContentWithTools: %w", err)
+	}
+
+	// Convert types.Tool to openai.Tool
+	openaiTools := make([]openai.Tool, 0, len(tools))
+	for _, t := range tools {
+		openaiTools = append(openaiTools, openai.Tool{
+			Type: openai.ToolTypeFunction,
+			Function: &openai.FunctionDefinition{
+				Name:        t.Name(),
+				Description: t.Description(),
+				Parameters:  t.Parameters(),
+			},
+		})
+	}
+
+	// Add system instruction if present
+	if oc.generationConfig.SystemInstruction != "" {
+		systemMessage := openai.ChatCompletionMessage{
+			Role:    openai.ChatMessageRoleSystem,
+			Content: oc.generationConfig.SystemInstruction,
+		}
+		messages = append([]openai.ChatCompletionMessage{systemMessage}, messages...)
+	}
+
+	req := openai.ChatCompletionRequest{
+		Model:    oc.modelName,
+		Messages: messages,
+		Tools:    openaiTools,
+	}
+
+	ctx, withRetryAfterOf := withRetryAfter(ctx)
+	resp, err := oc.client.CreateChatCompletion(ctx, req)
+	if err = withRetryAfterOf(err); err != nil {
+		return nil, fmt.Errorf("failed to create chat completion with tools: %w", err)
+	}
+
+	if len(resp.Choices) == 0 {
+		return nil, fmt.Errorf("no response from chat completion API with tools")
+	}
+
+	genericContent, err := fromOpenAIMessage(resp.Choices[0].Message)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert openai message to generic content after tool call: %w", err)
+	}
+
+	return &types.GenerateContentResponse{
+		Candidates: []*types.Candidate{
+			{
+				Content: genericContent,
+			},
+		},
+	}, nil
+}
+
+// SetUserConfirmationChannel is a no-op for OpenAIChat.
+func (oc *OpenAIChat) SetUserConfirmationChannel(ch chan bool) {
+	// No-op
+}
+
+// SetToolConfirmationChannel sets the channel for tool confirmation.
+func (oc *OpenAIChat) SetToolConfirmationChannel(ch chan types.ToolConfirmationOutcome) {
+	oc.ToolConfirmationChan = ch
+}
+
+// CountTokens counts the prompt tokens of a request locally, with the BPE
+// encoding of the model and the system instruction included.
+func (oc *OpenAIChat) CountTokens(ctx context.Context, contents []*types.Content, tools []types.Tool) (int, error) {
+	if oc.generationConfig.SystemInstruction != "" {
+		system := &types.Content{Role: "system", Parts: []types.Part{{Text: oc.generationConfig.SystemInstruction}}}
+		contents = append([]*types.Content{system}, contents...)
+	}
+	return estimateTokens(encodingForModel(oc.modelName), contents, tools), nil
+}
+
+// Name returns the name of the executor (the model name).
+func (oc *OpenAIChat) Name() string {
+	return oc.modelName
+}
@@ -0,0 +1,91 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"go-ai-agent-v2/go-cli/pkg/config"
+	"go-ai-agent-v2/go-cli/pkg/telemetry"
+	"go-ai-agent-v2/go-cli/pkg/types"
+
+	"github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOpenAIChat_ConfigurableServer(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer local-key", r.Header.Get("Authorization"))
+		assert.Equal(t, "agent", r.Header.Get("X-Client"))
+		if r.URL.Path != "/v1/models" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprintln(w, `{"object":"list","data":[{"id":"llama3","object":"model"}]}`)
+	}))
+	defer server.Close()
+
+	os.Setenv("LOCAL_LLM_KEY", "local-key")
+	defer os.Unsetenv("LOCAL_LLM_KEY")
+
+	cfg := config.NewConfig(&config.ConfigParameters{
+		ModelName: "llama3",
+		OpenAISettings: &types.OpenAISettings{
+			BaseURL:   server.URL + "/v1",
+			APIKeyEnv: "LOCAL_LLM_KEY",
+			Headers:   map[string]string{"X-Client": "agent"},
+		},
+	})
+	factory, err := NewExecutorFactory(types.ExecutorTypeOpenAI, cfg)
+	require.NoError(t, err)
+	executor, err := factory.NewExecutor(cfg, types.GenerateContentConfig{}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "llama3", executor.Name())
+
+	models, err := executor.ListModels()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"llama3"}, models)
+}
+
+func TestOpenAIChat_ConfiguredModels(t *testing.T) {
+	cfg := config.NewConfig(&config.ConfigParameters{
+		ModelName:      "gpt-4o",
+		OpenAISettings: &types.OpenAISettings{Models: []string{"gpt-4o", "gpt-4o-mini"}},
+	})
+	executor, err := NewOpenAIChat(cfg, types.GenerateContentConfig{}, nil, telemetry.NewTelemetryLogger(nil, "cli"))
+	require.NoError(t, err)
+
+	models, err := executor.ListModels()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"gpt-4o", "gpt-4o-mini"}, models)
+}
+
+func TestOpenAIChat_RetryAfter(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Retry-After", "7")
+		w.WriteHeader(http.StatusTooManyRequests)
+		fmt.Fprintln(w, `{"error":{"message":"Rate limit reached","type":"requests","code":"rate_limit_exceeded"}}`)
+	}))
+	defer server.Close()
+
+	cfg := config.NewConfig(&config.ConfigParameters{
+		ModelName:      "gpt-4o",
+		OpenAISettings: &types.OpenAISettings{BaseURL: server.URL + "/v1"},
+	})
+	executor, err := NewOpenAIChat(cfg, types.GenerateContentConfig{}, nil, telemetry.NewTelemetryLogger(nil, "cli"))
+	require.NoError(t, err)
+
+	_, err = executor.GenerateContentWithTools(context.Background(), []*types.Content{{Role: "user", Parts: []types.Part{{Text: "Hi"}}}}, nil)
+	var openaiErr *OpenAIError
+	require.ErrorAs(t, err, &openaiErr)
+	assert.Equal(t, 7*time.Second, openaiErr.RetryAfter)
+	var apiErr *openai.APIError
+	require.ErrorAs(t, err, &apiErr, "the go-openai error should stay reachable")
+	assert.Equal(t, http.StatusTooManyRequests, apiErr.HTTPStatusCode)
+}
@@ -33,6 +33,20 @@ func TestNewQwenChat(t *testing.T) {
 	assert.Equal(t, "qwen-turbo", qwenChat.modelName)
 }
 
+func TestNewQwenChat_ErrorReturnsNilExecutor(t *testing.T) {
+	os.Setenv("QWEN_API_KEY", "test-key")
+	defer os.Unsetenv("QWEN_API_KEY")
+
+	executor, err := NewQwenChat(configWithoutModel{}, types.GenerateContentConfig{}, nil, telemetry.NewTelemetryLogger(nil, "cli"))
+	assert.Error(t, err)
+	assert.True(t, executor == nil, "the executor must be a nil interface, not a nil *QwenChat")
+}
+
+// configWithoutModel is a types.Config without any setting.
+type configWithoutModel struct{ types.Config }
+
+func (configWithoutModel) Get(key string) (interface{}, bool) { return nil, false }
+
 func TestGenerateStream(t *testing.T) {
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "text/event-stream")
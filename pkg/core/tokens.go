@@ -0,0 +1,234 @@
+package core
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"go-ai-agent-v2/go-cli/pkg/telemetry"
+	"go-ai-agent-v2/go-cli/pkg/types"
+
+	"github.com/pkoukk/tiktoken-go"
+)
+
+// TokenCounter is implemented by executors that can count the prompt tokens
+// of a request before sending it, with the count-tokens endpoint of their
+// provider or with the tokenizer of their model.
+type TokenCounter interface {
+	CountTokens(ctx context.Context, contents []*types.Content, tools []types.Tool) (int, error)
+}
+
+// CountTokens returns the prompt size of a request to an executor. Executors
+// that are TokenCounters count it themselves; for the others, or when
+// counting fails, it is estimated locally.
+func CountTokens(ctx context.Context, executor Executor, contents []*types.Content, tools []types.Tool) int {
+	if counter, ok := executor.(TokenCounter); ok {
+		count, err := counter.CountTokens(ctx, contents, tools)
+		if err == nil {
+			return count
+		}
+		telemetry.LogDebugf("Failed to count tokens with %s, estimating them locally: %v", executor.Name(), err)
+	}
+	return EstimateTokens(contents, tools)
+}
+
+// defaultEncoding is the BPE encoding of the local estimates when the model
+// has no known encoding.
+const defaultEncoding = "cl100k_base"
+
+// Tokens added by chat formats to each message, and characters per token of
+// the estimate used when no encoding can be loaded.
+const (
+	tokensPerMessage = 4
+	charsPerToken    = 4
+)
+
+var (
+	encodingsMu sync.Mutex
+	encodings   = map[string]*tiktoken.Tiktoken{} // Nil when the encoding could not be loaded
+)
+
+// EstimateTokens estimates the prompt tokens of a request with the default
+// BPE encoding.
+func EstimateTokens(contents []*types.Content, tools []types.Tool) int {
+	return estimateTokens(defaultEncoding, contents, tools)
+}
+
+// estimateTokens estimates the prompt tokens of a request with a BPE encoding.
+// Until the encoding is available locally, tokens are estimated from the
+// length of the text instead.
+func estimateTokens(encodingName string, contents []*types.Content, tools []types.Tool) int {
+	encoding := loadEncoding(encodingName)
+	count := func(text string) int { return countTokens(encoding, text) }
+
+	total := 0
+	for _, content := range contents {
+		if content != nil {
+			total += tokensPerMessage + count(content.Role) + count(promptText(content.Parts))
+		}
+	}
+	for _, tool := range tools {
+		declaration, _ := json.Marshal(map[string]any{"name": tool.Name(), "description": tool.Description(), "parameters": tool.Parameters()})
+		total += count(string(declaration))
+	}
+	return total
+}
+
+// TextTokens counts the tokens of a text with the default encoding, or
+// estimates them from its length until the encoding is available locally.
+func TextTokens(text string) int {
+	return countTokens(loadEncoding(defaultEncoding), text)
+}
+
+func countTokens(encoding *tiktoken.Tiktoken, text string) int {
+	if encoding != nil {
+		return len(encoding.EncodeOrdinary(text))
+	}
+	return (utf8.RuneCountInString(text) + charsPerToken - 1) / charsPerToken
+}
+
+// encodingFiles are the URLs of the BPE ranks of the encodings, which
+// tiktoken-go downloads on first use and caches under the same key.
+var encodingFiles = map[string]string{
+	tiktoken.MODEL_O200K_BASE:  "https://openaipublic.blob.core.windows.net/encodings/o200k_base.tiktoken",
+	tiktoken.MODEL_CL100K_BASE: "https://openaipublic.blob.core.windows.net/encodings/cl100k_base.tiktoken",
+	tiktoken.MODEL_P50K_BASE:   "https://openaipublic.blob.core.windows.net/encodings/p50k_base.tiktoken",
+	tiktoken.MODEL_P50K_EDIT:   "https://openaipublic.blob.core.windows.net/encodings/p50k_base.tiktoken",
+	tiktoken.MODEL_R50K_BASE:   "https://openaipublic.blob.core.windows.net/encodings/r50k_base.tiktoken",
+}
+
+// loadEncoding returns a BPE encoding, or nil when its ranks are not in the
+// tiktoken cache. It never waits for the network: a missing encoding is
+// downloaded in the background and used once it is there.
+func loadEncoding(name string) *tiktoken.Tiktoken {
+	encodingsMu.Lock()
+	defer encodingsMu.Unlock()
+	if encoding, ok := encodings[name]; ok {
+		return encoding
+	}
+	encodings[name] = nil
+	if !encodingCached(name) {
+		telemetry.LogDebugf("The %s encoding is not cached, estimating tokens from text length while it downloads", name)
+		go downloadEncoding(name)
+		return nil
+	}
+	encoding, err := tiktoken.GetEncoding(name)
+	if err != nil {
+		telemetry.LogDebugf("Failed to load the %s encoding, estimating tokens from text length: %v", name, err)
+		return nil
+	}
+	encodings[name] = encoding
+	return encoding
+}
+
+// downloadEncoding loads an encoding that is not cached yet and makes it
+// available to loadEncoding.
+func downloadEncoding(name string) {
+	encoding, err := tiktoken.GetEncoding(name)
+	if err != nil {
+		telemetry.LogDebugf("Failed to download the %s encoding, estimating tokens from text length: %v", name, err)
+		return
+	}
+	encodingsMu.Lock()
+	defer encodingsMu.Unlock()
+	encodings[name] = encoding
+}
+
+// encodingCached reports whether the ranks of an encoding are in the cache
+// directory of tiktoken-go: $TIKTOKEN_CACHE_DIR, $DATA_GYM_CACHE_DIR or
+// data-gym-cache in the temporary directory, named by the SHA-1 of their URL.
+func encodingCached(name string) bool {
+	url, ok := encodingFiles[name]
+	if !ok {
+		return false
+	}
+	cacheDir := strings.TrimSpace(os.Getenv("TIKTOKEN_CACHE_DIR"))
+	if cacheDir == "" {
+		cacheDir = strings.TrimSpace(os.Getenv("DATA_GYM_CACHE_DIR"))
+	}
+	if cacheDir == "" {
+		cacheDir = filepath.Join(os.TempDir(), "data-gym-cache")
+	}
+	_, err := os.Stat(filepath.Join(cacheDir, fmt.Sprintf("%x", sha1.Sum([]byte(url)))))
+	return err == nil
+}
+
+// promptText renders parts as the text the model reads: text and thoughts as
+// they are, function calls and responses as JSON.
+func promptText(parts []types.Part) string {
+	var text strings.Builder
+	for _, part := range parts {
+		text.WriteString(part.Text)
+		text.WriteString(part.Thought)
+		if part.FunctionCall != nil {
+			args, _ := json.Marshal(part.FunctionCall.Args)
+			text.WriteString(part.FunctionCall.Name + string(args))
+		}
+		if part.FunctionResponse != nil {
+			response, _ := json.Marshal(part.FunctionResponse.Response)
+			text.WriteString(part.FunctionResponse.Name + string(response))
+		}
+		if part.InlineData != nil {
+			text.WriteString(part.InlineData.Data)
+		}
+	}
+	return text.String()
+}
+
+// contextWindows are the input limits of the models of the built-in
+// executors, in tokens. Names are matched by the longest prefix.
+var contextWindows = map[string]int{
+	"gemini-":       1048576,
+	"gpt-4o":        128000,
+	"gpt-4.1":       1047576,
+	"gpt-4-turbo":   128000,
+	"gpt-4":         8192,
+	"gpt-3.5-turbo": 16385,
+	"o1":            200000,
+	"o3":            200000,
+	"o4-mini":       200000,
+	"claude-":       200000,
+	"qwen-max":      32768,
+	"qwen-plus":     131072,
+	"qwen-turbo":    1000000,
+	"qwen-flash":    1000000,
+	"llama3.1":      131072,
+	"llama3.2":      131072,
+	"qwen2.5-coder": 32768,
+}
+
+// ContextWindow returns the context window of a model in tokens, or 0 when it
+// is unknown.
+func ContextWindow(model string) int {
+	model = strings.TrimPrefix(strings.ToLower(model), "models/")
+	window, longest := 0, 0
+	for prefix, size := range contextWindows {
+		if strings.HasPrefix(model, prefix) && len(prefix) > longest {
+			window, longest = size, len(prefix)
+		}
+	}
+	return window
+}
+
+// encodingForModel returns the BPE encoding of an OpenAI model, or the
+// default encoding for other models, such as Qwen.
+func encodingForModel(model string) string {
+	if name, ok := tiktoken.MODEL_TO_ENCODING[model]; ok {
+		return name
+	}
+	for prefix, name := range tiktoken.MODEL_PREFIX_TO_ENCODING {
+		if strings.HasPrefix(model, prefix) {
+			return name
+		}
+	}
+	if strings.HasPrefix(model, "o1") || strings.HasPrefix(model, "o3") || strings.HasPrefix(model, "o4") {
+		return tiktoken.MODEL_O200K_BASE
+	}
+	return defaultEncoding
+}
@@ -0,0 +1,102 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"go-ai-agent-v2/go-cli/pkg/types"
+
+	"github.com/pkoukk/tiktoken-go"
+	"github.com/stretchr/testify/assert"
+)
+
+// countingExecutor is a MockExecutor that counts tokens itself.
+type countingExecutor struct {
+	MockExecutor
+	count int
+	err   error
+}
+
+func (e *countingExecutor) CountTokens(ctx context.Context, contents []*types.Content, tools []types.Tool) (int, error) {
+	return e.count, e.err
+}
+
+func TestCountTokens(t *testing.T) {
+	contents := []*types.Content{{Role: "user", Parts: []types.Part{{Text: "Refactor the chat service."}}}}
+
+	assert.Equal(t, 42, CountTokens(context.Background(), &countingExecutor{count: 42}, contents, nil))
+
+	estimate := EstimateTokens(contents, nil)
+	assert.Positive(t, estimate)
+	assert.Equal(t, estimate, CountTokens(context.Background(), &countingExecutor{err: fmt.Errorf("offline")}, contents, nil), "falls back to the estimate")
+	assert.Equal(t, estimate, CountTokens(context.Background(), &MockExecutor{}, contents, nil))
+}
+
+func TestEstimateTokens(t *testing.T) {
+	short := []*types.Content{{Role: "user", Parts: []types.Part{{Text: "Hi"}}}}
+	long := []*types.Content{{Role: "user", Parts: []types.Part{{Text: strings.Repeat("The quick brown fox jumps over the lazy dog. ", 100)}}}}
+	assert.Greater(t, EstimateTokens(long, nil), 10*EstimateTokens(short, nil))
+
+	withCall := append(short, &types.Content{Role: "model", Parts: []types.Part{{FunctionCall: &types.FunctionCall{Name: "read_file", Args: map[string]any{"path": "main.go"}}}}})
+	assert.Greater(t, EstimateTokens(withCall, nil), EstimateTokens(short, nil), "function calls are counted")
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) { return f(req) }
+
+func TestEstimateTokens_Offline(t *testing.T) {
+	// An empty tiktoken cache and no network.
+	t.Setenv("TIKTOKEN_CACHE_DIR", t.TempDir())
+	downloads := make(chan string, 1)
+	transport := http.DefaultTransport
+	http.DefaultTransport = roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		downloads <- req.URL.String()
+		return nil, errors.New("network disabled")
+	})
+	t.Cleanup(func() { http.DefaultTransport = transport })
+	encodingsMu.Lock()
+	loaded := encodings
+	encodings = map[string]*tiktoken.Tiktoken{}
+	encodingsMu.Unlock()
+	t.Cleanup(func() {
+		encodingsMu.Lock()
+		encodings = loaded
+		encodingsMu.Unlock()
+	})
+
+	contents := []*types.Content{{Role: "user", Parts: []types.Part{{Text: strings.Repeat("a", 40)}}}}
+	start := time.Now()
+	assert.Equal(t, tokensPerMessage+1+10, EstimateTokens(contents, nil), "tokens are estimated from the text length")
+	assert.Equal(t, 3, TextTokens("Hello world"))
+	assert.Less(t, time.Since(start), time.Second, "estimates must not wait for the network")
+
+	select {
+	case url := <-downloads:
+		assert.Contains(t, url, "cl100k_base")
+	case <-time.After(5 * time.Second):
+		t.Fatal("the encoding was not downloaded in the background")
+	}
+	assert.Equal(t, tokensPerMessage+1+10, EstimateTokens(contents, nil))
+}
+
+func TestContextWindow(t *testing.T) {
+	assert.Equal(t, 1048576, ContextWindow("gemini-2.5-pro"))
+	assert.Equal(t, 1048576, ContextWindow("models/gemini-flash-latest"))
+	assert.Equal(t, 128000, ContextWindow("gpt-4o-mini"))
+	assert.Equal(t, 8192, ContextWindow("gpt-4"))
+	assert.Equal(t, 200000, ContextWindow("claude-sonnet-4-5"))
+	assert.Zero(t, ContextWindow("mock"))
+}
+
+func TestEncodingForModel(t *testing.T) {
+	assert.Equal(t, "o200k_base", encodingForModel("gpt-4o-2024-08-06"))
+	assert.Equal(t, "o200k_base", encodingForModel("o3-mini"))
+	assert.Equal(t, "cl100k_base", encodingForModel("gpt-4"))
+	assert.Equal(t, "cl100k_base", encodingForModel("qwen-plus"))
+}
@@ -1,17 +1,40 @@
 package mcp
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"go-ai-agent-v2/go-cli/pkg/telemetry"
 	"go-ai-agent-v2/go-cli/pkg/types"
+	"strconv"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
-// McpClient represents a simplified MCP client.
+// DefaultRequestTimeout bounds a single MCP request when the server config does not set a timeout.
+const DefaultRequestTimeout = 60 * time.Second
+
+// ErrNotConnected is returned when a request is made before Connect or after Close.
+var ErrNotConnected = errors.New("MCP client is not connected")
+
+// McpClient is a JSON-RPC 2.0 client for a single MCP server. It speaks stdio
+// for servers configured with a Command, streamable HTTP for HttpUrl and the
+// legacy HTTP+SSE transport for Url.
 type McpClient struct {
 	name    string
 	version string
 	config  types.MCPServerConfig // Store the config
 
+	mu         sync.Mutex
+	transport  transport
+	pending    map[string]chan *jsonrpcMessage
+	nextID     atomic.Int64
+	done       chan struct{}
+	closeErr   error
+	serverInfo initializeResult
+
 	// For testing purposes, allow overriding Connect and Close behavior
 	ConnectFunc func(timeout time.Duration) error
 	CloseFunc   func() error
@@ -26,31 +49,84 @@ func NewMcpClient(name, version string, config types.MCPServerConfig) *McpClient
 	return client
 }
 
-// defaultConnect is the default implementation for Connect.
+// defaultConnect opens the transport and performs the MCP initialize handshake.
 func (c *McpClient) defaultConnect(timeout time.Duration) error {
-	fmt.Printf("Simulating connection to MCP server (name: %s, config: %+v) with timeout %v\n", c.name, c.config, timeout)
-	// For now, always succeed.
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	t, err := newTransport(c.name, c.config)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	if c.transport != nil {
+		c.mu.Unlock()
+		return fmt.Errorf("MCP client '%s' is already connected", c.name)
+	}
+	c.transport = t
+	c.pending = make(map[string]chan *jsonrpcMessage)
+	c.done = make(chan struct{})
+	c.closeErr = nil
+	c.mu.Unlock()
+
+	if err := t.start(ctx, c); err != nil {
+		c.reset()
+		return err
+	}
+
+	params := initializeParams{
+		ProtocolVersion: ProtocolVersion,
+		Capabilities:    map[string]any{},
+		ClientInfo:      implementationInfo{Name: "go-ai-agent", Version: c.version},
+	}
+	var result initializeResult
+	if err := c.call(ctx, "initialize", params, &result); err != nil {
+		t.close()
+		c.reset()
+		return fmt.Errorf("MCP initialize with server '%s' failed: %w", c.name, err)
+	}
+	c.mu.Lock()
+	c.serverInfo = result
+	c.mu.Unlock()
+
+	if err := c.notify(ctx, "notifications/initialized", nil); err != nil {
+		t.close()
+		c.reset()
+		return fmt.Errorf("MCP initialized notification to server '%s' failed: %w", c.name, err)
+	}
+
+	telemetry.LogDebugf("Connected to MCP server '%s' (%s %s, protocol %s)", c.name, result.ServerInfo.Name, result.ServerInfo.Version, result.ProtocolVersion)
 	return nil
 }
 
-// Connect simulates connecting to an MCP server.
+// Connect opens the connection to the MCP server and performs the initialize handshake.
 func (c *McpClient) Connect(timeout time.Duration) error {
 	return c.ConnectFunc(timeout)
 }
 
-// Ping simulates pinging the MCP server.
+// Ping checks that the MCP server is still responsive.
 func (c *McpClient) Ping() error {
-	fmt.Println("Simulating ping to MCP server.")
-	return nil
+	ctx, cancel := context.WithTimeout(context.Background(), c.requestTimeout())
+	defer cancel()
+	return c.call(ctx, "ping", nil, nil)
 }
 
 // defaultClose is the default implementation for Close.
 func (c *McpClient) defaultClose() error {
-	fmt.Println("Simulating closing MCP client.")
-	return nil
+	c.mu.Lock()
+	t := c.transport
+	c.mu.Unlock()
+	if t == nil {
+		return nil
+	}
+	err := t.close()
+	c.handleClose(ErrNotConnected)
+	c.reset()
+	return err
 }
 
-// Close simulates closing the MCP client connection.
+// Close shuts down the connection and stops any server process the client spawned.
 func (c *McpClient) Close() error {
 	return c.CloseFunc()
 }
@@ -60,24 +136,235 @@ func (c *McpClient) Name() string {
 	return c.name
 }
 
-// GetTools simulates retrieving tools from the MCP server.
+// ServerName returns the name the MCP server reported during initialization.
+func (c *McpClient) ServerName() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.serverInfo.ServerInfo.Name
+}
+
+// ListTools returns every tool advertised by the server, following pagination cursors.
+func (c *McpClient) ListTools(ctx context.Context) ([]ToolInfo, error) {
+	var tools []ToolInfo
+	cursor := ""
+	for {
+		var page listToolsResult
+		var params any
+		if cursor != "" {
+			params = listToolsParams{Cursor: cursor}
+		}
+		if err := c.call(ctx, "tools/list", params, &page); err != nil {
+			return nil, err
+		}
+		tools = append(tools, page.Tools...)
+		if page.NextCursor == "" || page.NextCursor == cursor {
+			return tools, nil
+		}
+		cursor = page.NextCursor
+	}
+}
+
+// CallTool invokes a tool on the server and returns its result.
+func (c *McpClient) CallTool(ctx context.Context, name string, args map[string]any) (*CallToolResult, error) {
+	if args == nil {
+		args = map[string]any{}
+	}
+	ctx, cancel := context.WithTimeout(ctx, c.requestTimeout())
+	defer cancel()
+
+	var result CallToolResult
+	if err := c.call(ctx, "tools/call", callToolParams{Name: name, Arguments: args}, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// GetTools lists the server's tools and wraps them as types.Tool, applying the
+// IncludeTools and ExcludeTools filters from the server config.
 func (c *McpClient) GetTools() ([]types.Tool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), c.requestTimeout())
+	defer cancel()
+
+	infos, err := c.ListTools(ctx)
+	if err != nil {
+		return nil, err
+	}
+
 	var tools []types.Tool
-	for _, toolName := range c.config.IncludeTools {
-		dummyTool := types.NewBaseDeclarativeTool(
-			toolName,
-			toolName,
-			fmt.Sprintf("Dummy tool from MCP server %s", c.name),
-			types.KindOther,
-			&types.JsonSchemaObject{
-				Type:       "object",
-				Properties: map[string]*types.JsonSchemaProperty{},
-			},
-			false,
-			false,
-			nil,
-		)
-		tools = append(tools, dummyTool)
+	for _, info := range infos {
+		if !isToolEnabled(info.Name, c.config.IncludeTools, c.config.ExcludeTools) {
+			continue
+		}
+		tools = append(tools, NewMcpTool(c, info))
 	}
 	return tools, nil
 }
+
+// isToolEnabled applies the include/exclude lists of an MCP server config.
+func isToolEnabled(name string, include, exclude []string) bool {
+	for _, ex := range exclude {
+		if ex == name {
+			return false
+		}
+	}
+	if len(include) == 0 {
+		return true
+	}
+	for _, in := range include {
+		if in == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *McpClient) requestTimeout() time.Duration {
+	if c.config.Timeout > 0 {
+		return time.Duration(c.config.Timeout) * time.Millisecond
+	}
+	return DefaultRequestTimeout
+}
+
+// call sends a request and waits for the matching response.
+func (c *McpClient) call(ctx context.Context, method string, params any, result any) error {
+	c.mu.Lock()
+	t, done := c.transport, c.done
+	if t == nil {
+		c.mu.Unlock()
+		return ErrNotConnected
+	}
+	id := json.RawMessage(strconv.FormatInt(c.nextID.Add(1), 10))
+	respChan := make(chan *jsonrpcMessage, 1)
+	c.pending[string(id)] = respChan
+	c.mu.Unlock()
+
+	defer func() {
+		c.mu.Lock()
+		delete(c.pending, string(id))
+		c.mu.Unlock()
+	}()
+
+	msg, err := newRequest(id, method, params)
+	if err != nil {
+		return err
+	}
+	if err := t.send(ctx, msg); err != nil {
+		return err
+	}
+
+	select {
+	case resp := <-respChan:
+		if resp.Error != nil {
+			return resp.Error
+		}
+		if result != nil && len(resp.Result) > 0 {
+			if err := json.Unmarshal(resp.Result, result); err != nil {
+				return fmt.Errorf("failed to decode %s result: %w", method, err)
+			}
+		}
+		return nil
+	case <-ctx.Done():
+		// Let the server stop working on a request nobody is waiting for anymore.
+		c.notify(context.Background(), "notifications/cancelled", cancelledParams{RequestID: id, Reason: ctx.Err().Error()})
+		return ctx.Err()
+	case <-done:
+		c.mu.Lock()
+		err := c.closeErr
+		c.mu.Unlock()
+		return fmt.Errorf("%s: %w", method, err)
+	}
+}
+
+// notify sends a notification, which has no response.
+func (c *McpClient) notify(ctx context.Context, method string, params any) error {
+	c.mu.Lock()
+	t := c.transport
+	c.mu.Unlock()
+	if t == nil {
+		return ErrNotConnected
+	}
+	msg, err := newRequest(nil, method, params)
+	if err != nil {
+		return err
+	}
+	return t.send(ctx, msg)
+}
+
+// handleMessage routes responses to their waiting callers and answers
+// requests initiated by the server.
+func (c *McpClient) handleMessage(msg *jsonrpcMessage) {
+	switch {
+	case msg.isResponse():
+		c.mu.Lock()
+		respChan, ok := c.pending[string(msg.ID)]
+		c.mu.Unlock()
+		if !ok {
+			telemetry.LogDebugf("MCP server '%s' sent a response for unknown request %s", c.name, string(msg.ID))
+			return
+		}
+		select {
+		case respChan <- msg:
+		default: // duplicate response; the caller already has one
+		}
+	case msg.isRequest():
+		go c.answerServerRequest(msg)
+	default:
+		switch msg.Method {
+		case "notifications/tools/list_changed":
+			telemetry.LogDebugf("MCP server '%s' reported a changed tool list", c.name)
+		case "notifications/message":
+			telemetry.LogDebugf("MCP server '%s' log: %s", c.name, string(msg.Params))
+		}
+	}
+}
+
+// answerServerRequest replies to a request sent by the server. Only ping is supported.
+func (c *McpClient) answerServerRequest(msg *jsonrpcMessage) {
+	c.mu.Lock()
+	t := c.transport
+	c.mu.Unlock()
+	if t == nil {
+		return
+	}
+
+	var reply *jsonrpcMessage
+	if msg.Method == "ping" {
+		var err error
+		if reply, err = newResponse(msg.ID, struct{}{}); err != nil {
+			return
+		}
+	} else {
+		reply = newErrorResponse(msg.ID, jsonrpcMethodNotFound, fmt.Sprintf("method %q is not supported by this client", msg.Method))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.requestTimeout())
+	defer cancel()
+	if err := t.send(ctx, reply); err != nil {
+		telemetry.LogWarnf("Failed to answer %s request from MCP server '%s': %v", msg.Method, c.name, err)
+	}
+}
+
+// handleClose fails every in-flight request once the connection is gone.
+func (c *McpClient) handleClose(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.done == nil {
+		return
+	}
+	select {
+	case <-c.done:
+		return
+	default:
+	}
+	c.closeErr = err
+	close(c.done)
+	telemetry.LogDebugf("MCP connection '%s' closed: %v", c.name, err)
+}
+
+// reset forgets the current transport so the client can connect again.
+func (c *McpClient) reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.transport = nil
+	c.pending = nil
+}
@@ -0,0 +1,174 @@
+package mcp_test
+
+import (
+	"context"
+	"os"
+	"sort"
+	"testing"
+	"time"
+
+	"go-ai-agent-v2/go-cli/pkg/mcp"
+	"go-ai-agent-v2/go-cli/pkg/types"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeStdioConfig returns a config that runs this test binary as a stdio MCP server.
+func fakeStdioConfig(t *testing.T) types.MCPServerConfig {
+	executable, err := os.Executable()
+	require.NoError(t, err)
+	return types.MCPServerConfig{
+		Command: executable,
+		Args:    []string{"-test.run=^$"},
+		Env:     map[string]string{fakeServerEnv: "1"},
+	}
+}
+
+func connectClient(t *testing.T, name string, config types.MCPServerConfig) *mcp.McpClient {
+	client := mcp.NewMcpClient(name, "test", config)
+	require.NoError(t, client.Connect(10*time.Second))
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+func toolNames(tools []types.Tool) []string {
+	var names []string
+	for _, tool := range tools {
+		names = append(names, tool.Name())
+	}
+	sort.Strings(names)
+	return names
+}
+
+func findTool(tools []types.Tool, name string) types.Tool {
+	for _, tool := range tools {
+		if tool.Name() == name {
+			return tool
+		}
+	}
+	return nil
+}
+
+// exerciseClient checks discovery and tool calls against the fake server.
+func exerciseClient(t *testing.T, client *mcp.McpClient) {
+	t.Helper()
+	assert.Equal(t, "fake-mcp", client.ServerName())
+	assert.NoError(t, client.Ping())
+
+	tools, err := client.GetTools()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"add", "echo", "fail"}, toolNames(tools))
+
+	echo := findTool(tools, "echo")
+	assert.Equal(t, client.Name(), echo.ServerName())
+	assert.Equal(t, "Echoes the given text.", echo.Description())
+	assert.Equal(t, "string", echo.Parameters().Properties["text"].Type)
+	assert.Equal(t, []string{"text"}, echo.Parameters().Required)
+
+	result, err := echo.Execute(context.Background(), map[string]any{"text": "hello"})
+	require.NoError(t, err)
+	assert.Nil(t, result.Error)
+	assert.Equal(t, "hello", result.LLMContent)
+
+	add := findTool(tools, "add")
+	assert.Equal(t, "number", add.Parameters().Properties["b"].Type)
+	result, err = add.Execute(context.Background(), map[string]any{"a": 2, "b": 3})
+	require.NoError(t, err)
+	assert.Equal(t, "5", result.LLMContent)
+
+	result, err = findTool(tools, "fail").Execute(context.Background(), nil)
+	require.NoError(t, err)
+	require.NotNil(t, result.Error)
+	assert.Equal(t, "something went wrong", result.Error.Message)
+}
+
+func TestMcpClient_Stdio(t *testing.T) {
+	client := connectClient(t, "stdio-server", fakeStdioConfig(t))
+	exerciseClient(t, client)
+
+	require.NoError(t, client.Close())
+	_, err := client.GetTools()
+	assert.ErrorIs(t, err, mcp.ErrNotConnected)
+}
+
+func TestMcpClient_StdioToolFilters(t *testing.T) {
+	config := fakeStdioConfig(t)
+	config.IncludeTools = []string{"echo", "fail"}
+	config.ExcludeTools = []string{"fail"}
+	client := connectClient(t, "filtered", config)
+
+	tools, err := client.GetTools()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"echo"}, toolNames(tools))
+}
+
+func TestMcpClient_StreamableHTTP(t *testing.T) {
+	t.Run("json responses", func(t *testing.T) {
+		server := newFakeStreamableHTTPServer(t, false, "Bearer secret")
+		client := connectClient(t, "http-json", types.MCPServerConfig{
+			HttpUrl: server.URL,
+			Headers: map[string]string{"Authorization": "Bearer secret"},
+		})
+		exerciseClient(t, client)
+	})
+
+	t.Run("sse responses", func(t *testing.T) {
+		server := newFakeStreamableHTTPServer(t, true, "")
+		client := connectClient(t, "http-sse", types.MCPServerConfig{HttpUrl: server.URL})
+		exerciseClient(t, client)
+	})
+
+	t.Run("rejected headers", func(t *testing.T) {
+		server := newFakeStreamableHTTPServer(t, false, "Bearer secret")
+		client := mcp.NewMcpClient("http-unauthorized", "test", types.MCPServerConfig{HttpUrl: server.URL})
+		err := client.Connect(5 * time.Second)
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "401")
+	})
+}
+
+func TestMcpClient_SSE(t *testing.T) {
+	server := newFakeSSEServer(t)
+	client := connectClient(t, "sse-server", types.MCPServerConfig{Url: server.URL + "/sse"})
+	exerciseClient(t, client)
+}
+
+func TestMcpClient_ConnectErrors(t *testing.T) {
+	t.Run("no transport configured", func(t *testing.T) {
+		client := mcp.NewMcpClient("empty", "test", types.MCPServerConfig{})
+		assert.Error(t, client.Connect(time.Second))
+	})
+
+	t.Run("command does not exist", func(t *testing.T) {
+		client := mcp.NewMcpClient("missing", "test", types.MCPServerConfig{Command: "/nonexistent/mcp-server"})
+		assert.Error(t, client.Connect(time.Second))
+	})
+}
+
+func TestMcpClientManager_DiscoverRealServer(t *testing.T) {
+	mockToolRegistry := NewMockToolRegistry()
+	// A built-in tool named "echo" forces the MCP tool onto its qualified name.
+	require.NoError(t, mockToolRegistry.Register(&MockTool{name: "echo"}))
+	manager := mcp.NewMcpClientManager(mockToolRegistry)
+	t.Cleanup(func() { manager.Stop() })
+
+	mockConfig := &MockConfig{
+		McpServers: map[string]types.MCPServerConfig{"fake": fakeStdioConfig(t)},
+	}
+	require.NoError(t, manager.DiscoverAllMcpTools(mockConfig))
+
+	add, err := mockToolRegistry.GetTool("add")
+	require.NoError(t, err)
+	assert.Equal(t, "fake", add.ServerName())
+
+	echo, err := mockToolRegistry.GetTool("fake__echo")
+	require.NoError(t, err)
+	result, err := echo.Execute(context.Background(), map[string]any{"text": "qualified"})
+	require.NoError(t, err)
+	assert.Equal(t, "qualified", result.LLMContent)
+
+	statuses := manager.ListServers(mockConfig)
+	require.Len(t, statuses, 1)
+	assert.Equal(t, types.MCPServerStatusConnected, statuses[0].Status)
+}
@@ -0,0 +1,227 @@
+package mcp_test
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+)
+
+// fakeServerEnv makes the test binary act as a stdio MCP server instead of running tests.
+const fakeServerEnv = "GO_AI_AGENT_FAKE_MCP_SERVER"
+
+func TestMain(m *testing.M) {
+	if os.Getenv(fakeServerEnv) == "1" {
+		runFakeStdioServer()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+type fakeMessage struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method,omitempty"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	Result  any             `json:"result,omitempty"`
+	Error   *fakeError      `json:"error,omitempty"`
+}
+
+type fakeError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+var fakeTools = []map[string]any{
+	{
+		"name":        "echo",
+		"description": "Echoes the given text.",
+		"inputSchema": map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"text": map[string]any{"type": "string", "description": "Text to echo"},
+			},
+			"required": []string{"text"},
+		},
+	},
+	{
+		"name":        "add",
+		"description": "Adds two numbers.",
+		"inputSchema": map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"a": map[string]any{"type": "number"},
+				"b": map[string]any{"type": []string{"number", "null"}},
+			},
+		},
+	},
+	{
+		"name":        "fail",
+		"description": "Always reports an error.",
+		"inputSchema": map[string]any{"type": "object"},
+	},
+}
+
+// handleFakeRequest implements the MCP methods used by the client. Notifications return nil.
+func handleFakeRequest(msg *fakeMessage) *fakeMessage {
+	if len(msg.ID) == 0 {
+		return nil
+	}
+	resp := &fakeMessage{JSONRPC: "2.0", ID: msg.ID}
+	switch msg.Method {
+	case "initialize":
+		resp.Result = map[string]any{
+			"protocolVersion": "2025-03-26",
+			"capabilities":    map[string]any{"tools": map[string]any{}},
+			"serverInfo":      map[string]any{"name": "fake-mcp", "version": "0.0.1"},
+		}
+	case "ping":
+		resp.Result = map[string]any{}
+	case "tools/list":
+		// Serve the tools in two pages to exercise cursor handling.
+		var params struct {
+			Cursor string `json:"cursor"`
+		}
+		json.Unmarshal(msg.Params, &params)
+		if params.Cursor == "" {
+			resp.Result = map[string]any{"tools": fakeTools[:2], "nextCursor": "page-2"}
+		} else {
+			resp.Result = map[string]any{"tools": fakeTools[2:]}
+		}
+	case "tools/call":
+		var params struct {
+			Name      string         `json:"name"`
+			Arguments map[string]any `json:"arguments"`
+		}
+		json.Unmarshal(msg.Params, &params)
+		switch params.Name {
+		case "echo":
+			resp.Result = textResult(fmt.Sprint(params.Arguments["text"]), false)
+		case "add":
+			a, _ := params.Arguments["a"].(float64)
+			b, _ := params.Arguments["b"].(float64)
+			resp.Result = textResult(fmt.Sprint(a+b), false)
+		case "fail":
+			resp.Result = textResult("something went wrong", true)
+		default:
+			resp.Error = &fakeError{Code: -32602, Message: "unknown tool " + params.Name}
+		}
+	default:
+		resp.Error = &fakeError{Code: -32601, Message: "method not found"}
+	}
+	return resp
+}
+
+func textResult(text string, isError bool) map[string]any {
+	return map[string]any{
+		"content": []map[string]any{{"type": "text", "text": text}},
+		"isError": isError,
+	}
+}
+
+func runFakeStdioServer() {
+	scanner := bufio.NewScanner(os.Stdin)
+	encoder := json.NewEncoder(os.Stdout)
+	for scanner.Scan() {
+		var msg fakeMessage
+		if err := json.Unmarshal(scanner.Bytes(), &msg); err != nil {
+			fmt.Fprintf(os.Stderr, "bad message: %v\n", err)
+			continue
+		}
+		if resp := handleFakeRequest(&msg); resp != nil {
+			encoder.Encode(resp)
+		}
+	}
+}
+
+// newFakeStreamableHTTPServer serves the fake MCP server over streamable HTTP.
+// Responses are sent as SSE streams when useSSE is true and as JSON otherwise.
+func newFakeStreamableHTTPServer(t *testing.T, useSSE bool, requiredHeader string) *httptest.Server {
+	const sessionID = "fake-session"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requiredHeader != "" && r.Header.Get("Authorization") != requiredHeader {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if r.Method == http.MethodDelete {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		var msg fakeMessage
+		if err := json.NewDecoder(r.Body).Decode(&msg); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if msg.Method == "initialize" {
+			w.Header().Set("Mcp-Session-Id", sessionID)
+		} else if r.Header.Get("Mcp-Session-Id") != sessionID {
+			http.Error(w, "missing session", http.StatusBadRequest)
+			return
+		}
+		resp := handleFakeRequest(&msg)
+		if resp == nil {
+			w.WriteHeader(http.StatusAccepted)
+			return
+		}
+		data, _ := json.Marshal(resp)
+		if useSSE {
+			w.Header().Set("Content-Type", "text/event-stream")
+			fmt.Fprintf(w, ": keep-alive\n\nevent: message\ndata: %s\n\n", data)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(data)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// newFakeSSEServer serves the fake MCP server over the legacy HTTP+SSE transport.
+func newFakeSSEServer(t *testing.T) *httptest.Server {
+	var mu sync.Mutex
+	var stream chan []byte
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/sse", func(w http.ResponseWriter, r *http.Request) {
+		flusher := w.(http.Flusher)
+		events := make(chan []byte, 16)
+		mu.Lock()
+		stream = events
+		mu.Unlock()
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "event: endpoint\ndata: /messages?session=1\n\n")
+		flusher.Flush()
+		for {
+			select {
+			case data := <-events:
+				fmt.Fprintf(w, "event: message\ndata: %s\n\n", data)
+				flusher.Flush()
+			case <-r.Context().Done():
+				return
+			}
+		}
+	})
+	mux.HandleFunc("/messages", func(w http.ResponseWriter, r *http.Request) {
+		var msg fakeMessage
+		if err := json.NewDecoder(r.Body).Decode(&msg); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+		if resp := handleFakeRequest(&msg); resp != nil {
+			data, _ := json.Marshal(resp)
+			mu.Lock()
+			events := stream
+			mu.Unlock()
+			events <- data
+		}
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
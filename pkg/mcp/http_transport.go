@@ -0,0 +1,361 @@
+package mcp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"go-ai-agent-v2/go-cli/pkg/telemetry"
+)
+
+const sessionIDHeader = "Mcp-Session-Id"
+
+// readSSE parses a text/event-stream body and calls fn for every dispatched event.
+// Parsing stops when fn returns false or the stream ends.
+func readSSE(r io.Reader, fn func(event, data string) bool) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxMessageSize)
+
+	var event string
+	var data strings.Builder
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			if data.Len() > 0 {
+				name := event
+				if name == "" {
+					name = "message"
+				}
+				if !fn(name, strings.TrimSuffix(data.String(), "\n")) {
+					return nil
+				}
+			}
+			event = ""
+			data.Reset()
+			continue
+		}
+		if strings.HasPrefix(line, ":") {
+			continue // comment / keep-alive
+		}
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+		switch field {
+		case "event":
+			event = value
+		case "data":
+			data.WriteString(value)
+			data.WriteString("\n")
+		}
+	}
+	return scanner.Err()
+}
+
+// dispatchSSEMessage decodes the data of an SSE "message" event and hands it to handler.
+func dispatchSSEMessage(name, data string, handler messageHandler) {
+	msgs, err := decodeMessages([]byte(data))
+	if err != nil {
+		telemetry.LogWarnf("MCP server '%s' sent an invalid JSON-RPC event: %v", name, err)
+		return
+	}
+	for _, msg := range msgs {
+		handler.handleMessage(msg)
+	}
+}
+
+// streamableHTTPTransport implements the MCP "Streamable HTTP" transport: every
+// client message is POSTed to a single endpoint, and the server answers either
+// with a JSON body or with an SSE stream carrying the response.
+type streamableHTTPTransport struct {
+	name     string
+	endpoint string
+	headers  map[string]string
+	client   *http.Client
+
+	mu        sync.Mutex
+	sessionID string
+	handler   messageHandler
+}
+
+func newStreamableHTTPTransport(name, endpoint string, headers map[string]string) *streamableHTTPTransport {
+	return &streamableHTTPTransport{name: name, endpoint: endpoint, headers: headers, client: http.DefaultClient}
+}
+
+func (t *streamableHTTPTransport) start(ctx context.Context, handler messageHandler) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.handler = handler
+	return nil
+}
+
+func (t *streamableHTTPTransport) send(ctx context.Context, msg *jsonrpcMessage) error {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("failed to marshal MCP message: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request for MCP server '%s': %w", t.name, err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json, text/event-stream")
+	for k, v := range t.headers {
+		req.Header.Set(k, v)
+	}
+	t.mu.Lock()
+	if t.sessionID != "" {
+		req.Header.Set(sessionIDHeader, t.sessionID)
+	}
+	handler := t.handler
+	t.mu.Unlock()
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to reach MCP server '%s': %w", t.name, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		snippet, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return &httpStatusError{StatusCode: resp.StatusCode, Body: strings.TrimSpace(string(snippet))}
+	}
+	if id := resp.Header.Get(sessionIDHeader); id != "" {
+		t.mu.Lock()
+		t.sessionID = id
+		t.mu.Unlock()
+	}
+	if resp.StatusCode == http.StatusAccepted || handler == nil {
+		return nil
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	switch mediaType {
+	case "text/event-stream":
+		return readSSE(resp.Body, func(event, data string) bool {
+			if event == "message" {
+				dispatchSSEMessage(t.name, data, handler)
+			}
+			return true
+		})
+	case "application/json":
+		data, err := io.ReadAll(io.LimitReader(resp.Body, maxMessageSize))
+		if err != nil {
+			return fmt.Errorf("failed to read response from MCP server '%s': %w", t.name, err)
+		}
+		if len(bytes.TrimSpace(data)) == 0 {
+			return nil
+		}
+		msgs, err := decodeMessages(data)
+		if err != nil {
+			return fmt.Errorf("invalid JSON-RPC response from MCP server '%s': %w", t.name, err)
+		}
+		for _, m := range msgs {
+			handler.handleMessage(m)
+		}
+		return nil
+	default:
+		return nil
+	}
+}
+
+func (t *streamableHTTPTransport) close() error {
+	t.mu.Lock()
+	sessionID := t.sessionID
+	t.sessionID = ""
+	t.mu.Unlock()
+	if sessionID == "" {
+		return nil
+	}
+
+	// Tell the server the session is over. Servers may answer 405 if they do
+	// not support explicit termination, which is not an error for us.
+	req, err := http.NewRequest(http.MethodDelete, t.endpoint, nil)
+	if err != nil {
+		return nil
+	}
+	req.Header.Set(sessionIDHeader, sessionID)
+	for k, v := range t.headers {
+		req.Header.Set(k, v)
+	}
+	if resp, err := t.client.Do(req); err == nil {
+		resp.Body.Close()
+	}
+	return nil
+}
+
+// httpStatusError reports a non-2xx answer from an HTTP based MCP server.
+type httpStatusError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *httpStatusError) Error() string {
+	if e.Body == "" {
+		return fmt.Sprintf("MCP server returned HTTP %d", e.StatusCode)
+	}
+	return fmt.Sprintf("MCP server returned HTTP %d: %s", e.StatusCode, e.Body)
+}
+
+// sseTransport implements the legacy HTTP+SSE transport: the client keeps a GET
+// event stream open for server messages and POSTs its own messages to the
+// endpoint announced in the stream's first "endpoint" event.
+type sseTransport struct {
+	name    string
+	url     string
+	headers map[string]string
+	client  *http.Client
+
+	mu       sync.Mutex
+	endpoint string
+	cancel   context.CancelFunc
+	done     chan struct{}
+}
+
+func newSSETransport(name, url string, headers map[string]string) *sseTransport {
+	return &sseTransport{name: name, url: url, headers: headers, client: http.DefaultClient}
+}
+
+func (t *sseTransport) start(ctx context.Context, handler messageHandler) error {
+	// The stream lives until close, so it gets its own context rather than ctx.
+	streamCtx, cancel := context.WithCancel(context.Background())
+	req, err := http.NewRequestWithContext(streamCtx, http.MethodGet, t.url, nil)
+	if err != nil {
+		cancel()
+		return fmt.Errorf("failed to create request for MCP server '%s': %w", t.name, err)
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	for k, v := range t.headers {
+		req.Header.Set(k, v)
+	}
+
+	type dialResult struct {
+		resp *http.Response
+		err  error
+	}
+	dialed := make(chan dialResult, 1)
+	go func() {
+		resp, err := t.client.Do(req)
+		dialed <- dialResult{resp, err}
+	}()
+
+	var resp *http.Response
+	select {
+	case r := <-dialed:
+		if r.err != nil {
+			cancel()
+			return fmt.Errorf("failed to reach MCP server '%s': %w", t.name, r.err)
+		}
+		resp = r.resp
+	case <-ctx.Done():
+		cancel()
+		return ctx.Err()
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		cancel()
+		return &httpStatusError{StatusCode: resp.StatusCode}
+	}
+
+	base, err := url.Parse(t.url)
+	if err != nil {
+		resp.Body.Close()
+		cancel()
+		return fmt.Errorf("invalid url for MCP server '%s': %w", t.name, err)
+	}
+
+	endpointReady := make(chan struct{})
+	var endpointOnce sync.Once
+	t.cancel = cancel
+	t.done = make(chan struct{})
+
+	go func() {
+		defer close(t.done)
+		defer resp.Body.Close()
+		err := readSSE(resp.Body, func(event, data string) bool {
+			switch event {
+			case "endpoint":
+				ref, err := url.Parse(strings.TrimSpace(data))
+				if err != nil {
+					telemetry.LogWarnf("MCP server '%s' announced an invalid endpoint %q: %v", t.name, data, err)
+					return true
+				}
+				t.mu.Lock()
+				t.endpoint = base.ResolveReference(ref).String()
+				t.mu.Unlock()
+				endpointOnce.Do(func() { close(endpointReady) })
+			case "message":
+				dispatchSSEMessage(t.name, data, handler)
+			}
+			return true
+		})
+		if err == nil || errors.Is(streamCtx.Err(), context.Canceled) {
+			err = io.EOF
+		}
+		handler.handleClose(fmt.Errorf("MCP server '%s' event stream closed: %w", t.name, err))
+	}()
+
+	select {
+	case <-endpointReady:
+		return nil
+	case <-t.done:
+		return fmt.Errorf("MCP server '%s' closed the event stream before announcing an endpoint", t.name)
+	case <-ctx.Done():
+		t.close()
+		return ctx.Err()
+	}
+}
+
+func (t *sseTransport) send(ctx context.Context, msg *jsonrpcMessage) error {
+	t.mu.Lock()
+	endpoint := t.endpoint
+	t.mu.Unlock()
+	if endpoint == "" {
+		return errors.New("SSE transport is not connected")
+	}
+
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("failed to marshal MCP message: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request for MCP server '%s': %w", t.name, err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range t.headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to reach MCP server '%s': %w", t.name, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		snippet, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return &httpStatusError{StatusCode: resp.StatusCode, Body: strings.TrimSpace(string(snippet))}
+	}
+	io.Copy(io.Discard, resp.Body)
+	return nil
+}
+
+func (t *sseTransport) close() error {
+	t.mu.Lock()
+	cancel := t.cancel
+	t.cancel = nil
+	t.endpoint = ""
+	t.mu.Unlock()
+	if cancel == nil {
+		return nil
+	}
+	cancel()
+	<-t.done
+	return nil
+}
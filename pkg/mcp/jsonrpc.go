@@ -0,0 +1,89 @@
+package mcp
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+const jsonrpcVersion = "2.0"
+
+// JSON-RPC 2.0 error codes used by the client when answering server requests.
+const (
+	jsonrpcMethodNotFound = -32601
+)
+
+// jsonrpcMessage is a single JSON-RPC 2.0 request, notification or response.
+// Requests carry an ID and a Method, notifications only a Method and
+// responses only an ID together with either Result or Error.
+type jsonrpcMessage struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method,omitempty"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *jsonrpcError   `json:"error,omitempty"`
+}
+
+// jsonrpcError is the error object of a JSON-RPC 2.0 response.
+type jsonrpcError struct {
+	Code    int             `json:"code"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data,omitempty"`
+}
+
+func (e *jsonrpcError) Error() string {
+	return fmt.Sprintf("MCP error %d: %s", e.Code, e.Message)
+}
+
+func (m *jsonrpcMessage) isResponse() bool {
+	return m.Method == "" && len(m.ID) > 0
+}
+
+func (m *jsonrpcMessage) isRequest() bool {
+	return m.Method != "" && len(m.ID) > 0
+}
+
+// newRequest builds a request message. A nil id produces a notification.
+func newRequest(id json.RawMessage, method string, params any) (*jsonrpcMessage, error) {
+	msg := &jsonrpcMessage{JSONRPC: jsonrpcVersion, ID: id, Method: method}
+	if params != nil {
+		raw, err := json.Marshal(params)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal params for %s: %w", method, err)
+		}
+		msg.Params = raw
+	}
+	return msg, nil
+}
+
+// newResponse builds a successful response to a server-initiated request.
+func newResponse(id json.RawMessage, result any) (*jsonrpcMessage, error) {
+	raw, err := json.Marshal(result)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal result: %w", err)
+	}
+	return &jsonrpcMessage{JSONRPC: jsonrpcVersion, ID: id, Result: raw}, nil
+}
+
+// newErrorResponse builds an error response to a server-initiated request.
+func newErrorResponse(id json.RawMessage, code int, message string) *jsonrpcMessage {
+	return &jsonrpcMessage{JSONRPC: jsonrpcVersion, ID: id, Error: &jsonrpcError{Code: code, Message: message}}
+}
+
+// decodeMessages decodes a single JSON-RPC message or a batch of messages.
+func decodeMessages(data []byte) ([]*jsonrpcMessage, error) {
+	trimmed := bytes.TrimLeft(data, " \t\r\n")
+	if len(trimmed) > 0 && trimmed[0] == '[' {
+		var batch []*jsonrpcMessage
+		if err := json.Unmarshal(trimmed, &batch); err != nil {
+			return nil, err
+		}
+		return batch, nil
+	}
+	var msg jsonrpcMessage
+	if err := json.Unmarshal(trimmed, &msg); err != nil {
+		return nil, err
+	}
+	return []*jsonrpcMessage{&msg}, nil
+}
@@ -18,6 +18,9 @@ type McpClientInterface interface {
 	Name() string
 }
 
+// DefaultConnectTimeout bounds connecting to a server when its config does not set a timeout.
+const DefaultConnectTimeout = 30 * time.Second
+
 // newMcpClientFactory is a variable that can be overridden for testing purposes.
 // It should return an implementation of McpClientInterface.
 var NewMcpClientFactory func(name, version string, serverConfig types.MCPServerConfig) McpClientInterface
@@ -105,11 +108,10 @@ func (m *McpClientManager) DiscoverAllMcpTools(cliConfig types.Config) error {
 	}
 
 	for name, serverConfig := range mcpServers {
-		telemetry.LogDebugf("Connecting to MCP server: %s (URL: %s)", name, serverConfig.Url)
+		telemetry.LogDebugf("Connecting to MCP server: %s", name)
 		client := NewMcpClientFactory(name, "v1.0", serverConfig) // Use the mockable NewMcpClientFactory function
 
-		// Simulate connection
-		if err := client.Connect(5 * time.Second); err != nil {
+		if err := client.Connect(connectTimeout(serverConfig)); err != nil {
 			telemetry.LogErrorf("Error connecting to MCP server %s: %v", name, err)
 			continue
 		}
@@ -117,16 +119,23 @@ func (m *McpClientManager) DiscoverAllMcpTools(cliConfig types.Config) error {
 		m.clients[name] = client
 		m.mu.Unlock()
 
-		// Simulate tool discovery and registration
-		telemetry.LogDebugf("Simulating tool discovery for %s...", name)
+		telemetry.LogDebugf("Discovering tools for MCP server %s...", name)
 		discoveredTools, err := client.GetTools()
 		if err != nil {
-			telemetry.LogErrorf("Error getting simulated tools from MCP server %s: %v", name, err)
+			telemetry.LogErrorf("Error getting tools from MCP server %s: %v", name, err)
 			continue
 		}
 
 		for _, tool := range discoveredTools {
-			if err := m.toolRegistry.Register(tool); err != nil {
+			err := m.toolRegistry.Register(tool)
+			if err != nil {
+				// Fall back to a server-qualified name when another tool already uses this one.
+				if mcpTool, ok := tool.(*McpTool); ok {
+					tool = mcpTool.QualifiedName()
+					err = m.toolRegistry.Register(tool)
+				}
+			}
+			if err != nil {
 				telemetry.LogErrorf("Error registering tool %s from MCP server %s: %v", tool.Name(), name, err)
 			} else {
 				telemetry.LogDebugf("Registered tool: %s from MCP server: %s", tool.Name(), name)
@@ -137,6 +146,14 @@ func (m *McpClientManager) DiscoverAllMcpTools(cliConfig types.Config) error {
 	return nil
 }
 
+// connectTimeout returns the time allowed for connecting to and initializing a server.
+func connectTimeout(serverConfig types.MCPServerConfig) time.Duration {
+	if serverConfig.Timeout > 0 {
+		return time.Duration(serverConfig.Timeout) * time.Millisecond
+	}
+	return DefaultConnectTimeout
+}
+
 // Stop stops all running local MCP servers and closes all client connections.
 func (m *McpClientManager) Stop() error {
 	telemetry.LogDebugf("Stopping MCP clients and local servers...")
@@ -0,0 +1,236 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"go-ai-agent-v2/go-cli/pkg/types"
+	"regexp"
+	"strings"
+)
+
+// maxToolNameLength is the longest function name accepted by the model APIs.
+const maxToolNameLength = 64
+
+var invalidToolNameChars = regexp.MustCompile(`[^a-zA-Z0-9_.-]`)
+
+// McpTool exposes a tool of an MCP server through the types.Tool interface.
+// Executing it forwards the call to the server with "tools/call".
+type McpTool struct {
+	*types.BaseDeclarativeTool
+	client     *McpClient
+	serverName string
+	info       ToolInfo
+}
+
+// NewMcpTool wraps a tool advertised by client as a types.Tool.
+func NewMcpTool(client *McpClient, info ToolInfo) *McpTool {
+	return newMcpTool(client, info, sanitizeToolName(info.Name))
+}
+
+func newMcpTool(client *McpClient, info ToolInfo, registeredName string) *McpTool {
+	description := info.Description
+	if description == "" {
+		description = fmt.Sprintf("Tool '%s' provided by MCP server '%s'.", info.Name, client.Name())
+	}
+	return &McpTool{
+		BaseDeclarativeTool: types.NewBaseDeclarativeTool(
+			registeredName,
+			info.Name,
+			description,
+			types.KindOther,
+			convertInputSchema(info.InputSchema),
+			false,
+			false,
+			nil,
+		),
+		client:     client,
+		serverName: client.Name(),
+		info:       info,
+	}
+}
+
+// QualifiedName returns a copy of the tool registered as "<server>__<tool>",
+// used when the plain name collides with a tool that is already registered.
+func (t *McpTool) QualifiedName() *McpTool {
+	return newMcpTool(t.client, t.info, sanitizeToolName(t.serverName+"__"+t.info.Name))
+}
+
+// ServerName returns the name of the MCP server that provides the tool.
+func (t *McpTool) ServerName() string {
+	return t.serverName
+}
+
+// ServerToolName returns the tool's name as known by the MCP server.
+func (t *McpTool) ServerToolName() string {
+	return t.info.Name
+}
+
+// Execute forwards the call to the MCP server.
+func (t *McpTool) Execute(ctx context.Context, args map[string]any) (types.ToolResult, error) {
+	result, err := t.client.CallTool(ctx, t.info.Name, args)
+	if err != nil {
+		return types.ToolResult{
+			Error: &types.ToolError{
+				Message: fmt.Sprintf("MCP tool '%s' on server '%s' failed: %v", t.info.Name, t.serverName, err),
+				Type:    types.ToolErrorTypeExecutionFailed,
+			},
+		}, err
+	}
+
+	text := contentToText(result)
+	if result.IsError {
+		return types.ToolResult{
+			LLMContent:    text,
+			ReturnDisplay: text,
+			Error: &types.ToolError{
+				Message: text,
+				Type:    types.ToolErrorTypeExecutionFailed,
+			},
+		}, nil
+	}
+	return types.ToolResult{LLMContent: text, ReturnDisplay: text}, nil
+}
+
+// contentToText flattens the content blocks of a tool result into text for the model.
+func contentToText(result *CallToolResult) string {
+	var parts []string
+	for _, block := range result.Content {
+		switch block.Type {
+		case "text":
+			parts = append(parts, block.Text)
+		case "image", "audio":
+			parts = append(parts, fmt.Sprintf("[%s content: %s]", block.Type, block.MimeType))
+		case "resource":
+			if block.Resource == nil {
+				continue
+			}
+			if block.Resource.Text != "" {
+				parts = append(parts, block.Resource.Text)
+			} else {
+				parts = append(parts, fmt.Sprintf("[resource: %s]", block.Resource.URI))
+			}
+		default:
+			parts = append(parts, fmt.Sprintf("[unsupported content type: %s]", block.Type))
+		}
+	}
+	if len(parts) == 0 && result.StructuredContent != nil {
+		if data, err := json.Marshal(result.StructuredContent); err == nil {
+			parts = append(parts, string(data))
+		}
+	}
+	return strings.Join(parts, "\n")
+}
+
+// sanitizeToolName makes an MCP tool name acceptable as a model function name.
+func sanitizeToolName(name string) string {
+	name = invalidToolNameChars.ReplaceAllString(name, "_")
+	if len(name) > maxToolNameLength {
+		// Keep both ends so that server-qualified names stay recognisable.
+		name = name[:28] + "___" + name[len(name)-33:]
+	}
+	return name
+}
+
+// convertInputSchema converts an MCP tool's JSON Schema into the subset used by types.JsonSchemaObject.
+func convertInputSchema(raw json.RawMessage) *types.JsonSchemaObject {
+	obj := types.NewJsonSchemaObject()
+	if len(raw) == 0 {
+		return obj
+	}
+	var schema map[string]any
+	if err := json.Unmarshal(raw, &schema); err != nil {
+		return obj
+	}
+	obj.Properties = convertProperties(schema["properties"])
+	obj.Required = toStringSlice(schema["required"])
+	return obj
+}
+
+func convertProperties(v any) map[string]*types.JsonSchemaProperty {
+	props := make(map[string]*types.JsonSchemaProperty)
+	m, ok := v.(map[string]any)
+	if !ok {
+		return props
+	}
+	for name, raw := range m {
+		if schema, ok := raw.(map[string]any); ok {
+			props[name] = convertProperty(schema)
+		}
+	}
+	return props
+}
+
+func convertProperty(schema map[string]any) *types.JsonSchemaProperty {
+	prop := &types.JsonSchemaProperty{
+		Type:        schemaType(schema),
+		Description: stringValue(schema["description"]),
+	}
+	for _, e := range toSlice(schema["enum"]) {
+		prop.Enum = append(prop.Enum, fmt.Sprint(e))
+	}
+	switch prop.Type {
+	case "object":
+		prop.Properties = convertProperties(schema["properties"])
+		prop.Required = toStringSlice(schema["required"])
+	case "array":
+		if items, ok := schema["items"].(map[string]any); ok {
+			prop.Items = &types.JsonSchemaObject{
+				Type:       schemaType(items),
+				Properties: convertProperties(items["properties"]),
+				Required:   toStringSlice(items["required"]),
+			}
+		} else {
+			prop.Items = &types.JsonSchemaObject{Type: "string"}
+		}
+	}
+	return prop
+}
+
+// schemaType resolves the JSON Schema "type" keyword, which may be a string or
+// a list such as ["string", "null"], falling back to anyOf/oneOf alternatives.
+func schemaType(schema map[string]any) string {
+	switch t := schema["type"].(type) {
+	case string:
+		return t
+	case []any:
+		for _, v := range t {
+			if s, ok := v.(string); ok && s != "null" {
+				return s
+			}
+		}
+	}
+	for _, key := range []string{"anyOf", "oneOf"} {
+		for _, alt := range toSlice(schema[key]) {
+			if m, ok := alt.(map[string]any); ok {
+				if t := schemaType(m); t != "" && t != "null" {
+					return t
+				}
+			}
+		}
+	}
+	if _, ok := schema["properties"]; ok {
+		return "object"
+	}
+	return "string"
+}
+
+func stringValue(v any) string {
+	s, _ := v.(string)
+	return s
+}
+
+func toSlice(v any) []any {
+	s, _ := v.([]any)
+	return s
+}
+
+func toStringSlice(v any) []string {
+	var out []string
+	for _, item := range toSlice(v) {
+		if s, ok := item.(string); ok {
+			out = append(out, s)
+		}
+	}
+	return out
+}
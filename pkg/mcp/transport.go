@@ -0,0 +1,189 @@
+package mcp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+
+	"go-ai-agent-v2/go-cli/pkg/telemetry"
+	"go-ai-agent-v2/go-cli/pkg/types"
+)
+
+// maxMessageSize bounds a single newline-delimited JSON-RPC message read from stdio.
+const maxMessageSize = 16 * 1024 * 1024
+
+// shutdownGracePeriod is how long a stdio server may take to exit after its stdin is closed.
+const shutdownGracePeriod = 2 * time.Second
+
+// messageHandler receives messages and connection loss notifications from a transport.
+type messageHandler interface {
+	handleMessage(msg *jsonrpcMessage)
+	handleClose(err error)
+}
+
+// transport moves JSON-RPC messages between the client and an MCP server.
+type transport interface {
+	// start opens the connection. Incoming messages are delivered to handler
+	// until the transport is closed or the connection drops.
+	start(ctx context.Context, handler messageHandler) error
+	// send writes a single message to the server.
+	send(ctx context.Context, msg *jsonrpcMessage) error
+	// close releases the connection and any spawned process.
+	close() error
+}
+
+// newTransport selects a transport for the given server configuration.
+// A command takes precedence, then a streamable HTTP URL, then an SSE URL.
+func newTransport(name string, config types.MCPServerConfig) (transport, error) {
+	switch {
+	case config.Command != "":
+		return &stdioTransport{name: name, config: config}, nil
+	case config.HttpUrl != "":
+		return newStreamableHTTPTransport(name, config.HttpUrl, config.Headers), nil
+	case config.Url != "":
+		return newSSETransport(name, config.Url, config.Headers), nil
+	case config.Tcp != "":
+		return nil, fmt.Errorf("MCP server '%s': tcp transport is not supported", name)
+	default:
+		return nil, fmt.Errorf("MCP server '%s' has no command, url or httpUrl configured", name)
+	}
+}
+
+// stdioTransport spawns the server as a child process and exchanges
+// newline-delimited JSON-RPC messages over its stdin and stdout.
+type stdioTransport struct {
+	name   string
+	config types.MCPServerConfig
+
+	cmd     *exec.Cmd
+	stdin   io.WriteCloser
+	writeMu sync.Mutex
+	done    chan struct{}
+}
+
+func (t *stdioTransport) start(ctx context.Context, handler messageHandler) error {
+	// The process must outlive the connect context, so it is not bound to ctx.
+	cmd := exec.Command(t.config.Command, t.config.Args...)
+	if t.config.Cwd != "" {
+		cmd.Dir = t.config.Cwd
+	}
+	if len(t.config.Env) > 0 {
+		cmd.Env = os.Environ()
+		for k, v := range t.config.Env {
+			cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%s", k, v))
+		}
+	}
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return fmt.Errorf("failed to open stdin for MCP server '%s': %w", t.name, err)
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return fmt.Errorf("failed to open stdout for MCP server '%s': %w", t.name, err)
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return fmt.Errorf("failed to open stderr for MCP server '%s': %w", t.name, err)
+	}
+
+	telemetry.LogDebugf("Starting MCP server '%s' over stdio: %s %v", t.name, t.config.Command, t.config.Args)
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start MCP server '%s': %w", t.name, err)
+	}
+	t.cmd = cmd
+	t.stdin = stdin
+	t.done = make(chan struct{})
+
+	stderrDone := make(chan struct{})
+	go func() {
+		defer close(stderrDone)
+		scanner := bufio.NewScanner(stderr)
+		for scanner.Scan() {
+			telemetry.LogDebugf("MCP server '%s' stderr: %s", t.name, scanner.Text())
+		}
+	}()
+
+	go func() {
+		defer close(t.done)
+		scanner := bufio.NewScanner(stdout)
+		scanner.Buffer(make([]byte, 64*1024), maxMessageSize)
+		for scanner.Scan() {
+			line := scanner.Bytes()
+			if len(line) == 0 {
+				continue
+			}
+			msgs, err := decodeMessages(line)
+			if err != nil {
+				telemetry.LogWarnf("MCP server '%s' wrote invalid JSON-RPC to stdout: %v", t.name, err)
+				continue
+			}
+			for _, msg := range msgs {
+				handler.handleMessage(msg)
+			}
+		}
+		readErr := scanner.Err()
+		<-stderrDone
+		waitErr := cmd.Wait()
+		switch {
+		case readErr != nil:
+			handler.handleClose(fmt.Errorf("MCP server '%s' stdout: %w", t.name, readErr))
+		case waitErr != nil:
+			handler.handleClose(fmt.Errorf("MCP server '%s' exited: %w", t.name, waitErr))
+		default:
+			handler.handleClose(fmt.Errorf("MCP server '%s' exited", t.name))
+		}
+	}()
+
+	return nil
+}
+
+func (t *stdioTransport) send(ctx context.Context, msg *jsonrpcMessage) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("failed to marshal MCP message: %w", err)
+	}
+	data = append(data, '\n')
+
+	t.writeMu.Lock()
+	defer t.writeMu.Unlock()
+	if t.stdin == nil {
+		return errors.New("stdio transport is not started")
+	}
+	if _, err := t.stdin.Write(data); err != nil {
+		return fmt.Errorf("failed to write to MCP server '%s': %w", t.name, err)
+	}
+	return nil
+}
+
+func (t *stdioTransport) close() error {
+	t.writeMu.Lock()
+	stdin := t.stdin
+	t.stdin = nil
+	t.writeMu.Unlock()
+	if stdin == nil {
+		return nil
+	}
+
+	// Closing stdin asks a well-behaved server to exit; kill it if it does not.
+	stdin.Close()
+	select {
+	case <-t.done:
+		return nil
+	case <-time.After(shutdownGracePeriod):
+	}
+	if t.cmd.Process != nil {
+		if err := t.cmd.Process.Kill(); err != nil && !errors.Is(err, os.ErrProcessDone) {
+			return fmt.Errorf("failed to kill MCP server '%s': %w", t.name, err)
+		}
+	}
+	<-t.done
+	return nil
+}
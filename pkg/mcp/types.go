@@ -1 +1,81 @@
-package mcp
\ No newline at end of file
+package mcp
+
+import "encoding/json"
+
+// ProtocolVersion is the MCP protocol revision requested during initialization.
+const ProtocolVersion = "2025-03-26"
+
+// implementationInfo identifies a client or server implementation.
+type implementationInfo struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+// initializeParams are the parameters of the "initialize" request.
+type initializeParams struct {
+	ProtocolVersion string             `json:"protocolVersion"`
+	Capabilities    map[string]any     `json:"capabilities"`
+	ClientInfo      implementationInfo `json:"clientInfo"`
+}
+
+// initializeResult is the server's answer to the "initialize" request.
+type initializeResult struct {
+	ProtocolVersion string             `json:"protocolVersion"`
+	Capabilities    map[string]any     `json:"capabilities"`
+	ServerInfo      implementationInfo `json:"serverInfo"`
+	Instructions    string             `json:"instructions,omitempty"`
+}
+
+// ToolInfo describes a tool as advertised by an MCP server in "tools/list".
+type ToolInfo struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	InputSchema json.RawMessage `json:"inputSchema,omitempty"`
+}
+
+// listToolsParams are the parameters of the "tools/list" request.
+type listToolsParams struct {
+	Cursor string `json:"cursor,omitempty"`
+}
+
+// listToolsResult is one page of the "tools/list" response.
+type listToolsResult struct {
+	Tools      []ToolInfo `json:"tools"`
+	NextCursor string     `json:"nextCursor,omitempty"`
+}
+
+// callToolParams are the parameters of the "tools/call" request.
+type callToolParams struct {
+	Name      string         `json:"name"`
+	Arguments map[string]any `json:"arguments"`
+}
+
+// CallToolResult is the server's answer to a "tools/call" request.
+type CallToolResult struct {
+	Content           []ContentBlock `json:"content"`
+	StructuredContent any            `json:"structuredContent,omitempty"`
+	IsError           bool           `json:"isError,omitempty"`
+}
+
+// ContentBlock is a single piece of content returned by a tool call.
+type ContentBlock struct {
+	Type     string           `json:"type"`
+	Text     string           `json:"text,omitempty"`
+	Data     string           `json:"data,omitempty"`
+	MimeType string           `json:"mimeType,omitempty"`
+	Resource *ResourceContent `json:"resource,omitempty"`
+}
+
+// ResourceContent is an embedded resource inside a ContentBlock.
+type ResourceContent struct {
+	URI      string `json:"uri"`
+	MimeType string `json:"mimeType,omitempty"`
+	Text     string `json:"text,omitempty"`
+	Blob     string `json:"blob,omitempty"`
+}
+
+// cancelledParams are the parameters of the "notifications/cancelled" notification.
+type cancelledParams struct {
+	RequestID json.RawMessage `json:"requestId"`
+	Reason    string          `json:"reason,omitempty"`
+}
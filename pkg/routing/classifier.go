@@ -0,0 +1,291 @@
+package routing
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"go-ai-agent-v2/go-cli/pkg/telemetry"
+	"go-ai-agent-v2/go-cli/pkg/types"
+)
+
+// Tiers of models the ClassifierStrategy chooses between.
+const (
+	TierFast   = "fast"
+	TierStrong = "strong"
+)
+
+// recentHistoryTurns is how many turns before the request the classifiers see.
+const recentHistoryTurns = 6
+
+// ModelTiers are the fast and strong models of an executor.
+type ModelTiers struct {
+	Fast   string
+	Strong string
+}
+
+// modelTiers are the built-in tiers of each executor. Executors without one,
+// such as ollama, need the fastModel and strongModel routing settings.
+var modelTiers = map[string]ModelTiers{
+	types.ExecutorTypeGemini:    {Fast: "gemini-flash-latest", Strong: "gemini-pro-latest"},
+	types.ExecutorTypeQwen:      {Fast: "qwen-turbo", Strong: "qwen-plus"},
+	types.ExecutorTypeOpenAI:    {Fast: "gpt-4o-mini", Strong: "gpt-4o"},
+	types.ExecutorTypeAnthropic: {Fast: "claude-3-5-haiku-latest", Strong: "claude-sonnet-4-0"},
+}
+
+// TiersFor returns the tiers of an executor, with the models of the routing
+// settings taking precedence over the built-in ones.
+func TiersFor(executorType string, settings *types.RoutingSettings) (ModelTiers, bool) {
+	tiers := modelTiers[executorType]
+	if settings != nil {
+		if settings.FastModel != "" {
+			tiers.Fast = settings.FastModel
+		}
+		if settings.StrongModel != "" {
+			tiers.Strong = settings.StrongModel
+		}
+	}
+	return tiers, tiers.Fast != "" && tiers.Strong != ""
+}
+
+// ContextFromHistory builds the routing context of a turn: the request is the
+// text of the last user message, and the history the turns before it.
+func ContextFromHistory(signal context.Context, executorType string, history []*types.Content) *RoutingContext {
+	routingCtx := &RoutingContext{Signal: signal, ExecutorType: executorType}
+	last := -1
+	for i := len(history) - 1; i >= 0; i-- {
+		if history[i].Role == "user" && contentText(history[i]) != "" {
+			last = i
+			break
+		}
+	}
+	if last < 0 {
+		return routingCtx
+	}
+	routingCtx.Request = contentText(history[last])
+	for _, content := range history[max(0, last-recentHistoryTurns):last] {
+		if text := contentText(content); text != "" {
+			routingCtx.History = append(routingCtx.History, fmt.Sprintf("%s: %s", content.Role, text))
+		}
+	}
+	return routingCtx
+}
+
+func contentText(content *types.Content) string {
+	var text strings.Builder
+	for _, part := range content.Parts {
+		text.WriteString(part.Text)
+	}
+	return text.String()
+}
+
+// Classification is the tier a classifier chose for a request, and why.
+type Classification struct {
+	Tier      string
+	Reasoning string
+	Signals   []string // What the heuristic scorer found in the request
+}
+
+// Classifier decides whether a request needs the fast or the strong model.
+type Classifier interface {
+	Name() string
+	Classify(ctx *RoutingContext) (*Classification, error)
+}
+
+// heuristicRule is a sign of complex (positive weight) or trivial (negative
+// weight) work found in a request.
+type heuristicRule struct {
+	signal  string
+	weight  int
+	pattern *regexp.Regexp
+}
+
+var heuristicRules = []heuristicRule{
+	{"complex task", 2, regexp.MustCompile(`(?i)\b(refactor\w*|architect\w*|design\w*|migrat\w*|optimi[sz]\w*|implement\w*|rewrite|debug\w*)\b`)},
+	{"analysis", 1, regexp.MustCompile(`(?i)\b(why|explain|analy[sz]e|review|compare|trade-?offs?|root cause)\b`)},
+	{"hard domain", 2, regexp.MustCompile(`(?i)\b(concurren\w*|race condition|deadlock|security|vulnerab\w*|performance|algorithm\w*)\b`)},
+	{"code block", 2, regexp.MustCompile("```")},
+	{"stack trace", 2, regexp.MustCompile(`(?m)(panic:|Traceback|goroutine \d+ \[|^\s+at \S+\()`)},
+	{"several files", 1, regexp.MustCompile(`(?i)\b(all|every|across|multiple|several) (the )?(files|packages|modules|tests)\b`)},
+	{"simple task", -2, regexp.MustCompile(`(?i)^\s*(hi|hello|thanks|thank you|ok|yes|no)\b|\b(list|show|print|rename|typo)\b`)},
+}
+
+// strongScore is the score from which the heuristic scorer picks the strong tier.
+const strongScore = 2
+
+// HeuristicClassifier scores a request locally, from its length and the signs
+// of complex or trivial work in it and in the recent history.
+type HeuristicClassifier struct{}
+
+func (c *HeuristicClassifier) Name() string {
+	return "heuristic"
+}
+
+func (c *HeuristicClassifier) Classify(ctx *RoutingContext) (*Classification, error) {
+	if strings.TrimSpace(ctx.Request) == "" {
+		return &Classification{Tier: TierFast, Reasoning: "No request yet, starting with the fast model."}, nil
+	}
+
+	score := 0
+	var signals []string
+	add := func(signal string, weight int) {
+		score += weight
+		signals = append(signals, signal)
+	}
+	switch words := len(strings.Fields(ctx.Request)); {
+	case words > 150:
+		add("long request", 2)
+	case words > 60:
+		add("long request", 1)
+	case words < 8:
+		add("short request", -1)
+	}
+	for _, rule := range heuristicRules {
+		if rule.pattern.MatchString(ctx.Request) {
+			add(rule.signal, rule.weight)
+		}
+	}
+	for _, turn := range ctx.History {
+		if strings.Contains(turn, "```") || strings.Contains(turn, "panic:") {
+			add("technical conversation", 1)
+			break
+		}
+	}
+
+	tier := TierFast
+	if score >= strongScore {
+		tier = TierStrong
+	}
+	reasoning := fmt.Sprintf("Score %d, no sign of complex work: %s model.", score, tier)
+	if len(signals) > 0 {
+		reasoning = fmt.Sprintf("Score %d (%s): %s model.", score, strings.Join(signals, ", "), tier)
+	}
+	return &Classification{Tier: tier, Reasoning: reasoning, Signals: signals}, nil
+}
+
+// classifierPrompt asks a model to classify a request. It is followed by the
+// recent history and the request.
+const classifierPrompt = `You route the requests of a coding agent to a model. Choose "fast" for simple requests, such as questions with short answers, small edits, listing or reading files. Choose "strong" for requests that need careful reasoning, such as designing, refactoring or debugging code, changes across several files, or explaining complex behavior.
+
+Answer only with JSON: {"tier": "fast" or "strong", "reasoning": "<one short sentence>"}`
+
+// maxClassifierTurnLength truncates the turns of the history shown to the
+// classifier model.
+const maxClassifierTurnLength = 500
+
+// ModelClassifier asks a cheap model to classify the request. Generate sends
+// a prompt to that model and returns the text of its answer.
+type ModelClassifier struct {
+	Model    string
+	Generate func(ctx context.Context, prompt string) (string, error)
+}
+
+func (c *ModelClassifier) Name() string {
+	return "model"
+}
+
+func (c *ModelClassifier) Classify(ctx *RoutingContext) (*Classification, error) {
+	if strings.TrimSpace(ctx.Request) == "" {
+		return &Classification{Tier: TierFast, Reasoning: "No request yet, starting with the fast model."}, nil
+	}
+
+	var prompt strings.Builder
+	prompt.WriteString(classifierPrompt)
+	if len(ctx.History) > 0 {
+		prompt.WriteString("\n\n--- RECENT HISTORY ---\n")
+		for _, turn := range ctx.History {
+			if len(turn) > maxClassifierTurnLength {
+				turn = turn[:maxClassifierTurnLength] + "..."
+			}
+			prompt.WriteString(turn + "\n")
+		}
+	}
+	prompt.WriteString("\n--- REQUEST ---\n" + ctx.Request)
+
+	signal := ctx.Signal
+	if signal == nil {
+		signal = context.Background()
+	}
+	answer, err := c.Generate(signal, prompt.String())
+	if err != nil {
+		return nil, fmt.Errorf("classifier model %s failed: %w", c.Model, err)
+	}
+	start, end := strings.Index(answer, "{"), strings.LastIndex(answer, "}")
+	if start < 0 || end < start {
+		return nil, fmt.Errorf("classifier model %s did not answer with JSON: %q", c.Model, answer)
+	}
+	var verdict struct {
+		Tier      string `json:"tier"`
+		Reasoning string `json:"reasoning"`
+	}
+	if err := json.Unmarshal([]byte(answer[start:end+1]), &verdict); err != nil {
+		return nil, fmt.Errorf("failed to parse the answer of classifier model %s: %w", c.Model, err)
+	}
+	if verdict.Tier != TierFast && verdict.Tier != TierStrong {
+		return nil, fmt.Errorf("classifier model %s chose an unknown tier %q", c.Model, verdict.Tier)
+	}
+	return &Classification{Tier: verdict.Tier, Reasoning: verdict.Reasoning}, nil
+}
+
+// ClassifierStrategy picks the fast or the strong model of the executor when
+// the model is "auto". It asks Classifier or, without one or when it fails,
+// the HeuristicClassifier.
+type ClassifierStrategy struct {
+	Classifier Classifier
+}
+
+func (s *ClassifierStrategy) Name() string {
+	return "classifier"
+}
+
+func (s *ClassifierStrategy) Route(ctx *RoutingContext, cfg types.Config) (*RoutingDecision, error) {
+	if modelVal, ok := cfg.Get("model"); ok {
+		if model, _ := modelVal.(string); model != types.AutoModel {
+			return nil, nil // Pass to the next strategy.
+		}
+	}
+	var settings *types.RoutingSettings
+	if settingsVal, ok := cfg.Get("routingSettings"); ok {
+		settings, _ = settingsVal.(*types.RoutingSettings)
+	}
+	tiers, ok := TiersFor(ctx.ExecutorType, settings)
+	if !ok {
+		telemetry.LogDebugf("ClassifierStrategy: no model tiers for executor %q", ctx.ExecutorType)
+		return nil, nil // Pass to the next strategy.
+	}
+
+	var classifier Classifier = &HeuristicClassifier{}
+	var classification *Classification
+	if s.Classifier != nil {
+		var err error
+		if classification, err = s.Classifier.Classify(ctx); err != nil {
+			telemetry.LogErrorf("ClassifierStrategy: %v; falling back to the heuristic classifier", err)
+		} else {
+			classifier = s.Classifier
+		}
+	}
+	if classification == nil {
+		var err error
+		if classification, err = classifier.Classify(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	model := tiers.Fast
+	if classification.Tier == TierStrong {
+		model = tiers.Strong
+	}
+	telemetry.LogDebugf("ClassifierStrategy: %s classifier chose %s (%s): %s", classifier.Name(), classification.Tier, model, classification.Reasoning)
+	metadata := map[string]interface{}{
+		"source":     s.Name(),
+		"classifier": classifier.Name(),
+		"tier":       classification.Tier,
+		"reasoning":  classification.Reasoning,
+	}
+	if len(classification.Signals) > 0 {
+		metadata["signals"] = classification.Signals
+	}
+	return &RoutingDecision{Model: model, Metadata: metadata}, nil
+}
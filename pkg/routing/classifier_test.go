@@ -0,0 +1,116 @@
+package routing
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"go-ai-agent-v2/go-cli/pkg/config"
+	"go-ai-agent-v2/go-cli/pkg/types"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHeuristicClassifier(t *testing.T) {
+	tests := []struct {
+		name    string
+		request string
+		history []string
+		want    string
+	}{
+		{"no request", "", nil, TierFast},
+		{"greeting", "hi", nil, TierFast},
+		{"simple task", "List the files in the current directory", nil, TierFast},
+		{"mentions code", "Show me the code of main.go", nil, TierFast},
+		{"refactoring", "Refactor the session store so that concurrent saves cannot race, and explain why the current one fails", nil, TierStrong},
+		{"stack trace", "What is this?\npanic: runtime error: index out of range [0] with length 0\n\ngoroutine 1 [running]:", nil, TierStrong},
+		{"follow-up in a technical conversation", "Now implement it", []string{"model: ```go\nfunc main() {}\n```"}, TierStrong},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			classification, err := (&HeuristicClassifier{}).Classify(&RoutingContext{Request: tt.request, History: tt.history})
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, classification.Tier, classification.Reasoning)
+			assert.NotEmpty(t, classification.Reasoning)
+		})
+	}
+}
+
+func TestClassifierStrategy_Route(t *testing.T) {
+	autoCfg := config.NewConfig(&config.ConfigParameters{ModelName: types.AutoModel})
+	refactor := &RoutingContext{Request: "Refactor the session store to remove the race condition", ExecutorType: types.ExecutorTypeGemini}
+
+	t.Run("Routes auto requests to a tier of the executor", func(t *testing.T) {
+		decision, err := (&ClassifierStrategy{}).Route(refactor, autoCfg)
+		require.NoError(t, err)
+		assert.Equal(t, "gemini-pro-latest", decision.Model)
+		assert.Equal(t, "classifier", decision.Metadata["source"])
+		assert.Equal(t, "heuristic", decision.Metadata["classifier"])
+		assert.Equal(t, TierStrong, decision.Metadata["tier"])
+		assert.Contains(t, decision.Metadata["reasoning"], "complex task")
+		assert.Contains(t, decision.Metadata["signals"], "hard domain")
+	})
+
+	t.Run("Uses the models of the routing settings", func(t *testing.T) {
+		cfg := config.NewConfig(&config.ConfigParameters{ModelName: types.AutoModel, RoutingSettings: &types.RoutingSettings{FastModel: "llama3.2:3b", StrongModel: "qwen2.5-coder:32b"}})
+		decision, err := (&ClassifierStrategy{}).Route(&RoutingContext{Request: "thanks", ExecutorType: types.ExecutorTypeOllama}, cfg)
+		require.NoError(t, err)
+		assert.Equal(t, "llama3.2:3b", decision.Model)
+
+		decision, err = (&ClassifierStrategy{}).Route(&RoutingContext{Request: "thanks", ExecutorType: types.ExecutorTypeOllama}, autoCfg)
+		assert.NoError(t, err)
+		assert.Nil(t, decision, "ollama has no built-in tiers")
+	})
+
+	t.Run("Leaves explicit models alone", func(t *testing.T) {
+		decision, err := (&ClassifierStrategy{}).Route(refactor, config.NewConfig(&config.ConfigParameters{ModelName: "gemini-flash-latest"}))
+		assert.NoError(t, err)
+		assert.Nil(t, decision)
+	})
+
+	t.Run("Asks the classifier model", func(t *testing.T) {
+		var prompt string
+		classifier := &ModelClassifier{Model: "gemini-flash-lite-latest", Generate: func(ctx context.Context, p string) (string, error) {
+			prompt = p
+			return "```json\n{\"tier\": \"fast\", \"reasoning\": \"A small, well-scoped change.\"}\n```", nil
+		}}
+		routingCtx := &RoutingContext{Request: refactor.Request, History: []string{"user: Hello"}, ExecutorType: types.ExecutorTypeGemini}
+		decision, err := (&ClassifierStrategy{Classifier: classifier}).Route(routingCtx, autoCfg)
+		require.NoError(t, err)
+		assert.Equal(t, "gemini-flash-latest", decision.Model)
+		assert.Equal(t, "model", decision.Metadata["classifier"])
+		assert.Equal(t, "A small, well-scoped change.", decision.Metadata["reasoning"])
+		assert.Contains(t, prompt, "user: Hello")
+		assert.Contains(t, prompt, refactor.Request)
+	})
+
+	t.Run("Falls back to the heuristic classifier", func(t *testing.T) {
+		for _, generate := range []func(context.Context, string) (string, error){
+			func(context.Context, string) (string, error) { return "", errors.New("quota exceeded") },
+			func(context.Context, string) (string, error) { return "strong, probably", nil },
+			func(context.Context, string) (string, error) { return `{"tier": "medium"}`, nil },
+		} {
+			decision, err := (&ClassifierStrategy{Classifier: &ModelClassifier{Model: "broken", Generate: generate}}).Route(refactor, autoCfg)
+			require.NoError(t, err)
+			assert.Equal(t, "gemini-pro-latest", decision.Model)
+			assert.Equal(t, "heuristic", decision.Metadata["classifier"])
+		}
+	})
+}
+
+func TestContextFromHistory(t *testing.T) {
+	history := []*types.Content{
+		{Role: "user", Parts: []types.Part{{Text: "Read main.go"}}},
+		{Role: "model", Parts: []types.Part{{FunctionCall: &types.FunctionCall{Name: "read_file"}}}},
+		{Role: "tool", Parts: []types.Part{{FunctionResponse: &types.FunctionResponse{Name: "read_file"}}}},
+		{Role: "model", Parts: []types.Part{{Text: "It prints hello."}}},
+		{Role: "user", Parts: []types.Part{{Text: "Make it print goodbye"}}},
+	}
+	routingCtx := ContextFromHistory(context.Background(), types.ExecutorTypeQwen, history)
+	assert.Equal(t, "Make it print goodbye", routingCtx.Request)
+	assert.Equal(t, []string{"user: Read main.go", "model: It prints hello."}, routingCtx.History)
+	assert.Equal(t, types.ExecutorTypeQwen, routingCtx.ExecutorType)
+
+	assert.Empty(t, ContextFromHistory(context.Background(), types.ExecutorTypeQwen, nil).Request)
+}
@@ -38,15 +38,17 @@ func (s *CompositeStrategy) Route(ctx *RoutingContext, cfg types.Config) (*Routi
 
 // ModelRouterService is a centralized service for making model routing decisions.
 type ModelRouterService struct {
-	strategy RoutingStrategy
+	strategy   RoutingStrategy
+	classifier *ClassifierStrategy
 }
 
 func NewModelRouterService(cfg types.Config) *ModelRouterService {
 	telemetry.LogDebugf("NewModelRouterService called: Initializing routing strategies.")
+	classifier := &ClassifierStrategy{}
 	strategies := []RoutingStrategy{
 		&FallbackStrategy{},
 		&OverrideStrategy{},
-		&ClassifierStrategy{},
+		classifier,
 		&DefaultStrategy{},
 	}
 	for i, s := range strategies {
@@ -54,10 +56,17 @@ func NewModelRouterService(cfg types.Config) *ModelRouterService {
 	}
 	strategy := NewCompositeStrategy(strategies...)
 	return &ModelRouterService{
-		strategy: strategy,
+		strategy:   strategy,
+		classifier: classifier,
 	}
 }
 
+// SetClassifier replaces the heuristic scorer of the classifier strategy, e.g.
+// with a ModelClassifier.
+func (s *ModelRouterService) SetClassifier(classifier Classifier) {
+	s.classifier.Classifier = classifier
+}
+
 // Route determines which model to use for a given request context.
 func (s *ModelRouterService) Route(ctx *RoutingContext, cfg types.Config) (*RoutingDecision, error) {
 	return s.strategy.Route(ctx, cfg)
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"go-ai-agent-v2/go-cli/pkg/telemetry" // Re-add telemetry import
 	"go-ai-agent-v2/go-cli/pkg/types"
+	"regexp"
 	"strings"
 )
 
@@ -81,7 +82,7 @@ func (s *OverrideStrategy) Route(ctx *RoutingContext, cfg types.Config) (*Routin
 		telemetry.LogErrorf(err.Error())
 		return nil, err
 	}
-	if model == "auto" {
+	if model == types.AutoModel {
 		return nil, nil // Pass to the next strategy
 	}
 
@@ -168,54 +169,35 @@ var modelSuggesters = map[string]func(string) (string, bool){
 			return "", false
 		}
 	},
-}
-
-// ClassifierStrategy suggests a model based on the content of the request.
-type ClassifierStrategy struct{}
-
-func (s *ClassifierStrategy) Name() string {
-	return "classifier"
-}
-
-func (s *ClassifierStrategy) Route(ctx *RoutingContext, cfg types.Config) (*RoutingDecision, error) {
-	// Simplified heuristic: if the request contains "code", use a more powerful model.
-	if strings.Contains(strings.ToLower(ctx.Request), "code") {
-		currentModelVal, ok := cfg.Get("model")
-		if !ok || currentModelVal == nil {
-			err := fmt.Errorf("current model not found in config for ClassifierStrategy")
-			telemetry.LogErrorf(err.Error())
-			return nil, err
-		}
-		currentModel, ok := currentModelVal.(string)
-		if !ok {
-			err := fmt.Errorf("current model in config is not a string for ClassifierStrategy")
-			telemetry.LogErrorf(err.Error())
-			return nil, err
+	"ollama": func(currentModel string) (string, bool) {
+		telemetry.LogDebugf("Ollama Suggester: currentModel=%s", currentModel)
+		// Local models are named by size, e.g. "llama3.1:70b" or "qwen2.5-coder:32b-instruct-q4_K_M",
+		// so step down to the next smaller size of the same family.
+		if m := ollamaSizeTag.FindStringSubmatchIndex(currentModel); m != nil {
+			if smaller, ok := ollamaSmallerSizes[currentModel[m[2]:m[3]]]; ok {
+				return currentModel[:m[2]] + smaller + currentModel[m[3]:], true
+			}
 		}
+		telemetry.LogDebugf("Ollama Suggester: No suggestion found for modelName=%s", currentModel)
+		return "", false
+	},
+}
 
-		var modelSuggestion string = ""
-
-		switch {
-		case strings.Contains(currentModel, "gemini"):
-			telemetry.LogDebugf("ClassifierStrategy: Request contains 'code', suggesting 'gemini-pro-latest'")
-			modelSuggestion = "gemini-pro-latest"
-		case strings.Contains(currentModel, "qwen"):
-			telemetry.LogDebugf("ClassifierStrategy: Request contains 'code', suggesting 'qwen-plus'")
-			modelSuggestion = "qwen-plus"
-		default:
-			telemetry.LogDebugf("ClassifierStrategy: Request contains 'code', but no specific executor handling implemented")
-			modelSuggestion = currentModel // No change
-		}
-
-		// This could be made more generic, e.g., by getting the "powerful" model from config.
-		return &RoutingDecision{
-			Model: modelSuggestion,
-			Metadata: map[string]interface{}{
-				"source":    s.Name(),
-				"reasoning": "Request contains 'code', suggesting a more powerful model.",
-			},
-		}, nil
-	}
-
-	return nil, nil // Pass to the next strategy.
+// ollamaSizeTag matches the parameter size at the start of an Ollama model tag.
+var ollamaSizeTag = regexp.MustCompile(`:(\d+(?:\.\d+)?b)`)
+
+// ollamaSmallerSizes maps a model size to the next smaller size published for
+// the common Llama, Qwen, Gemma and DeepSeek families.
+var ollamaSmallerSizes = map[string]string{
+	"405b": "70b",
+	"72b":  "32b",
+	"70b":  "8b",
+	"32b":  "14b",
+	"27b":  "12b",
+	"14b":  "7b",
+	"12b":  "4b",
+	"8b":   "3b",
+	"7b":   "3b",
+	"4b":   "1b",
+	"3b":   "1b",
 }
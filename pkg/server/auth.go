@@ -0,0 +1,272 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go-ai-agent-v2/go-cli/pkg/types"
+)
+
+// Scopes a server token can grant.
+const (
+	// ScopeEventsRead allows opening the WebSocket and reading session events and task states.
+	ScopeEventsRead = "events:read"
+	// ScopeTasksWrite allows submitting, prompting and cancelling tasks.
+	ScopeTasksWrite = "tasks:write"
+	// ScopeToolsApprove allows answering tool confirmation requests.
+	ScopeToolsApprove = "tools:approve"
+)
+
+// SignatureHeader carries the HMAC-SHA256 signature of a webhook task, as
+// "sha256=<hex digest>", keyed with the webhook secret. The signed message is
+// the TimestampHeader value, a dot and the body.
+const SignatureHeader = "X-Signature-256"
+
+// TimestampHeader carries the Unix time in seconds at which a webhook task was signed.
+const TimestampHeader = "X-Signature-Timestamp"
+
+// signatureMaxAge is how far the timestamp of a signed webhook may be from the
+// server's clock. A signature is accepted once within that window.
+const signatureMaxAge = 5 * time.Minute
+
+// maxSignedBodySize bounds the webhook bodies read to check their signature.
+const maxSignedBodySize = 1 << 20
+
+// Principal is the caller of an authenticated request.
+type Principal struct {
+	Name   string
+	Scopes map[string]bool
+}
+
+// HasScope reports whether the principal was granted a scope.
+func (p *Principal) HasScope(scope string) bool {
+	return p != nil && p.Scopes[scope]
+}
+
+type principalKey struct{}
+
+// PrincipalFromContext returns the principal stored in a request context by Authenticator.
+func PrincipalFromContext(ctx context.Context) *Principal {
+	principal, _ := ctx.Value(principalKey{}).(*Principal)
+	return principal
+}
+
+// Authenticator checks the bearer tokens, webhook signatures and WebSocket
+// origins of requests to the server, and the destinations of task callbacks.
+type Authenticator struct {
+	tokens         map[string]*Principal
+	webhookSecret  []byte
+	allowedOrigins []string
+	callbackHosts  []string
+	callbackClient *http.Client
+	now            func() time.Time
+
+	seenMu sync.Mutex
+	seen   map[string]time.Time // Signatures accepted within signatureMaxAge, by timestamp
+}
+
+// NewAuthenticator creates an Authenticator from the serverAuth settings.
+// Without tokens and webhook secret, every request is allowed with all scopes.
+func NewAuthenticator(settings *types.ServerAuthSettings) *Authenticator {
+	a := &Authenticator{tokens: make(map[string]*Principal), now: time.Now, seen: make(map[string]time.Time)}
+	a.callbackClient = a.newCallbackClient()
+	if settings == nil {
+		return a
+	}
+	for i, token := range settings.Tokens {
+		if token.Token == "" {
+			log.Printf("Warning: serverAuth token %d has no value and is ignored", i)
+			continue
+		}
+		principal := &Principal{Name: token.Name, Scopes: make(map[string]bool)}
+		if principal.Name == "" {
+			// Sessions belong to principals by name, so unnamed tokens must not share one.
+			principal.Name = fmt.Sprintf("token %d", i)
+		}
+		for _, scope := range token.Scopes {
+			principal.Scopes[scope] = true
+		}
+		a.tokens[token.Token] = principal
+	}
+	a.webhookSecret = []byte(settings.WebhookSecret)
+	a.allowedOrigins = settings.AllowedOrigins
+	a.callbackHosts = settings.CallbackAllowedHosts
+	return a
+}
+
+// Enabled reports whether requests must be authenticated.
+func (a *Authenticator) Enabled() bool {
+	return len(a.tokens) > 0 || len(a.webhookSecret) > 0
+}
+
+// RequireScope wraps a handler so that it only runs for callers granted scope.
+// Callers are identified by a bearer token in the Authorization header or, for
+// browsers that cannot set headers on WebSocket requests, the token query
+// parameter. When signed is set, a valid webhook signature grants the scope too.
+func (a *Authenticator) RequireScope(scope string, signed bool, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !a.Enabled() {
+			next(w, r.WithContext(context.WithValue(r.Context(), principalKey{}, allScopes())))
+			return
+		}
+
+		principal := a.principalOf(r)
+		if principal == nil && signed && r.Header.Get(SignatureHeader) != "" {
+			ok, err := a.verifySignature(r)
+			if err != nil {
+				http.Error(w, "Failed to read request body", http.StatusBadRequest)
+				return
+			}
+			if ok {
+				principal = &Principal{Name: "webhook", Scopes: map[string]bool{scope: true}}
+			}
+		}
+
+		if principal == nil {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="go-ai-agent"`)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if !principal.HasScope(scope) {
+			http.Error(w, "Token lacks scope "+scope, http.StatusForbidden)
+			return
+		}
+		next(w, r.WithContext(context.WithValue(r.Context(), principalKey{}, principal)))
+	}
+}
+
+// CheckOrigin reports whether a WebSocket upgrade request comes from an
+// allowed origin: the server's own, one of allowedOrigins, or any if
+// allowedOrigins contains "*". Requests without an Origin header do not come
+// from a browser and are allowed.
+func (a *Authenticator) CheckOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	for _, allowed := range a.allowedOrigins {
+		if allowed == "*" || strings.EqualFold(strings.TrimSuffix(allowed, "/"), origin) {
+			return true
+		}
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(u.Host, r.Host)
+}
+
+// principalOf returns the principal of the bearer token of a request, or nil.
+func (a *Authenticator) principalOf(r *http.Request) *Principal {
+	token := ""
+	if header := r.Header.Get("Authorization"); strings.HasPrefix(header, "Bearer ") {
+		token = strings.TrimSpace(strings.TrimPrefix(header, "Bearer "))
+	} else {
+		token = r.URL.Query().Get("token")
+	}
+	if token == "" {
+		return nil
+	}
+	// Compare against every token so that the time taken does not depend on which one matches.
+	var match *Principal
+	for candidate, principal := range a.tokens {
+		if subtle.ConstantTimeCompare([]byte(candidate), []byte(token)) == 1 {
+			match = principal
+		}
+	}
+	return match
+}
+
+// verifySignature checks the webhook signature of a request, its timestamp
+// and that it was not accepted before. It reads the body and puts it back for
+// the next handler.
+func (a *Authenticator) verifySignature(r *http.Request) (bool, error) {
+	if len(a.webhookSecret) == 0 {
+		return false, nil
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxSignedBodySize))
+	if err != nil {
+		return false, err
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+
+	timestamp := r.Header.Get(TimestampHeader)
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return false, nil
+	}
+	now := a.now()
+	signedAt := time.Unix(seconds, 0)
+	if signedAt.Before(now.Add(-signatureMaxAge)) || signedAt.After(now.Add(signatureMaxAge)) {
+		log.Printf("Rejected webhook signed at %s: outside the %s window", signedAt.Format(time.RFC3339), signatureMaxAge)
+		return false, nil
+	}
+	signature, err := hex.DecodeString(strings.TrimPrefix(r.Header.Get(SignatureHeader), "sha256="))
+	if err != nil || !hmac.Equal(signature, SignBody(a.webhookSecret, timestamp, body)) {
+		return false, nil
+	}
+	return a.firstUse(string(signature), signedAt, now), nil
+}
+
+// firstUse records a valid signature and reports whether it was not seen
+// before. Signatures older than the window are forgotten, since their
+// timestamps are rejected anyway.
+func (a *Authenticator) firstUse(signature string, signedAt, now time.Time) bool {
+	a.seenMu.Lock()
+	defer a.seenMu.Unlock()
+	for seen, at := range a.seen {
+		if at.Before(now.Add(-signatureMaxAge)) {
+			delete(a.seen, seen)
+		}
+	}
+	if _, replayed := a.seen[signature]; replayed {
+		log.Printf("Rejected replayed webhook signed at %s", signedAt.Format(time.RFC3339))
+		return false
+	}
+	a.seen[signature] = signedAt
+	return true
+}
+
+// SignBody returns the HMAC-SHA256, keyed with secret, of a webhook body
+// signed at timestamp, a Unix time in seconds.
+func SignBody(secret []byte, timestamp string, body []byte) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return mac.Sum(nil)
+}
+
+// allScopes is the principal of requests when authentication is disabled.
+func allScopes() *Principal {
+	return &Principal{Name: "anonymous", Scopes: map[string]bool{
+		ScopeEventsRead:   true,
+		ScopeTasksWrite:   true,
+		ScopeToolsApprove: true,
+	}}
+}
+
+// messageScope returns the scope a WebSocket client message requires.
+func messageScope(messageType string) string {
+	switch messageType {
+	case ClientMessageResume:
+		return ScopeEventsRead
+	case ClientMessageToolConfirmation:
+		return ScopeToolsApprove
+	default:
+		return ScopeTasksWrite
+	}
+}
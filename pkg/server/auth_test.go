@@ -0,0 +1,176 @@
+package server
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"go-ai-agent-v2/go-cli/pkg/types"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newAuthTestServer(t *testing.T) (*Server, *httptest.Server) {
+	srv, httpServer := newTestServer(t)
+	srv.Auth = NewAuthenticator(&types.ServerAuthSettings{
+		Tokens: []types.ServerToken{
+			{Name: "viewer", Token: "read-token", Scopes: []string{ScopeEventsRead}},
+			{Name: "ci", Token: "write-token", Scopes: []string{ScopeEventsRead, ScopeTasksWrite}},
+		},
+		WebhookSecret:  "secret",
+		AllowedOrigins: []string{"http://localhost:5173"},
+	})
+	return srv, httpServer
+}
+
+func postTask(t *testing.T, httpServer *httptest.Server, body string, header http.Header) int {
+	req, err := http.NewRequest(http.MethodPost, httpServer.URL+"/api/v1/tasks", strings.NewReader(body))
+	require.NoError(t, err)
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+func TestAuth_BearerTokenScopes(t *testing.T) {
+	_, httpServer := newAuthTestServer(t)
+	body := `{"prompt": "hello"}`
+
+	assert.Equal(t, http.StatusUnauthorized, postTask(t, httpServer, body, nil))
+	assert.Equal(t, http.StatusUnauthorized, postTask(t, httpServer, body, http.Header{"Authorization": {"Bearer wrong"}}))
+	assert.Equal(t, http.StatusForbidden, postTask(t, httpServer, body, http.Header{"Authorization": {"Bearer read-token"}}))
+	assert.Equal(t, http.StatusAccepted, postTask(t, httpServer, body, http.Header{"Authorization": {"Bearer write-token"}}))
+
+	req, err := http.NewRequest(http.MethodPost, httpServer.URL+"/api/v1/sessions/s/confirmations/c", strings.NewReader(`{"outcome": "CANCEL"}`))
+	require.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer write-token")
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+}
+
+func signedHeader(secret, body string, signedAt time.Time) http.Header {
+	timestamp := strconv.FormatInt(signedAt.Unix(), 10)
+	return http.Header{
+		SignatureHeader: {"sha256=" + hex.EncodeToString(SignBody([]byte(secret), timestamp, []byte(body)))},
+		TimestampHeader: {timestamp},
+	}
+}
+
+func TestAuth_WebhookSignature(t *testing.T) {
+	_, httpServer := newAuthTestServer(t)
+	body := `{"prompt": "hello"}`
+	header := signedHeader("secret", body, time.Now())
+
+	assert.Equal(t, http.StatusAccepted, postTask(t, httpServer, body, header))
+	assert.Equal(t, http.StatusUnauthorized, postTask(t, httpServer, body, header), "a replayed delivery must be rejected")
+	assert.Equal(t, http.StatusUnauthorized, postTask(t, httpServer, `{"prompt": "other"}`, signedHeader("secret", body, time.Now())))
+	assert.Equal(t, http.StatusUnauthorized, postTask(t, httpServer, body, signedHeader("wrong", body, time.Now())))
+	assert.Equal(t, http.StatusUnauthorized, postTask(t, httpServer, body, http.Header{SignatureHeader: {"sha256=zz"}, TimestampHeader: header[TimestampHeader]}))
+
+	// The timestamp is signed and must be recent.
+	stale := signedHeader("secret", body, time.Now().Add(-10*time.Minute))
+	assert.Equal(t, http.StatusUnauthorized, postTask(t, httpServer, body, stale))
+	stale[TimestampHeader] = []string{strconv.FormatInt(time.Now().Unix(), 10)}
+	assert.Equal(t, http.StatusUnauthorized, postTask(t, httpServer, body, stale))
+	assert.Equal(t, http.StatusAccepted, postTask(t, httpServer, body, signedHeader("secret", body, time.Now().Add(-time.Minute))))
+}
+
+func TestAuth_WebSocket(t *testing.T) {
+	_, httpServer := newAuthTestServer(t)
+	url := "ws" + strings.TrimPrefix(httpServer.URL, "http") + "/ws"
+
+	_, resp, err := websocket.DefaultDialer.Dial(url, nil)
+	require.Error(t, err)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	_, resp, err = websocket.DefaultDialer.Dial(url+"?token=read-token", http.Header{"Origin": {"http://evil.example"}})
+	require.Error(t, err)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+
+	conn, _, err := websocket.DefaultDialer.Dial(url+"?token=read-token", http.Header{"Origin": {"http://localhost:5173"}})
+	require.NoError(t, err)
+	defer conn.Close()
+
+	// A read-only token can resume sessions but not send prompts.
+	send(t, conn, ClientMessage{Type: ClientMessagePrompt, SessionID: "s", Prompt: "hello"})
+	events := readUntil(t, conn, "error")
+	assert.Contains(t, events[len(events)-1].Payload, "error")
+	send(t, conn, ClientMessage{Type: ClientMessageResume, SessionID: "s"})
+	readUntil(t, conn, "resumed")
+}
+
+func TestAuth_SessionsBelongToTheirPrincipal(t *testing.T) {
+	srv, httpServer := newAuthTestServer(t)
+	srv.Auth = NewAuthenticator(&types.ServerAuthSettings{Tokens: []types.ServerToken{
+		{Name: "alice", Token: "alice-token", Scopes: []string{ScopeEventsRead, ScopeTasksWrite}},
+		{Name: "bob", Token: "bob-token", Scopes: []string{ScopeEventsRead, ScopeTasksWrite}},
+	}})
+	url := "ws" + strings.TrimPrefix(httpServer.URL, "http") + "/ws?token="
+
+	alice, _, err := websocket.DefaultDialer.Dial(url+"alice-token", nil)
+	require.NoError(t, err)
+	defer alice.Close()
+	send(t, alice, ClientMessage{Type: ClientMessagePrompt, SessionID: "alice-session", Prompt: "hello"})
+	readUntil(t, alice, "run_finished")
+
+	bob, _, err := websocket.DefaultDialer.Dial(url+"bob-token", nil)
+	require.NoError(t, err)
+	defer bob.Close()
+	for _, msg := range []ClientMessage{
+		{Type: ClientMessageResume, SessionID: "alice-session"},
+		{Type: ClientMessagePrompt, SessionID: "alice-session", Prompt: "hello"},
+	} {
+		send(t, bob, msg)
+		events := readUntil(t, bob, "error")
+		assert.Contains(t, events[len(events)-1].Payload, "error", msg.Type)
+		assert.Empty(t, events[:len(events)-1], "%s must not replay the session", msg.Type)
+	}
+	send(t, alice, ClientMessage{Type: ClientMessageResume, SessionID: "alice-session"})
+	readUntil(t, alice, "resumed")
+
+	// Tasks belong to the principal that submitted them.
+	req, err := http.NewRequest(http.MethodPost, httpServer.URL+"/api/v1/tasks", strings.NewReader(`{"prompt": "hello"}`))
+	require.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer alice-token")
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	var accepted map[string]string
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&accepted))
+	resp.Body.Close()
+	for token, status := range map[string]int{"alice-token": http.StatusOK, "bob-token": http.StatusForbidden} {
+		req, err := http.NewRequest(http.MethodGet, httpServer.URL+"/api/v1/tasks/"+accepted["taskId"], nil)
+		require.NoError(t, err)
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, status, resp.StatusCode, token)
+	}
+}
+
+func TestAuthenticator_CheckOrigin(t *testing.T) {
+	auth := NewAuthenticator(nil)
+	req := httptest.NewRequest(http.MethodGet, "http://agent.local:8080/ws", nil)
+	assert.True(t, auth.CheckOrigin(req), "requests without Origin are allowed")
+
+	req.Header.Set("Origin", "http://agent.local:8080")
+	assert.True(t, auth.CheckOrigin(req))
+	req.Header.Set("Origin", "http://other.local")
+	assert.False(t, auth.CheckOrigin(req))
+
+	auth = NewAuthenticator(&types.ServerAuthSettings{AllowedOrigins: []string{"*"}})
+	assert.True(t, auth.CheckOrigin(req))
+	assert.False(t, auth.Enabled())
+}
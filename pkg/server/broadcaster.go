@@ -1,55 +1,238 @@
 package server
 
 import (
+	"encoding/json"
 	"log"
 	"sync"
+	"time"
 
 	"github.com/gorilla/websocket"
 )
 
-// Broadcaster manages active WebSocket connections and broadcasts messages to them.
+const (
+	// DefaultReplayBufferSize is the number of events kept per session for replay on reconnect.
+	DefaultReplayBufferSize = 1000
+	// clientSendBufferSize is the number of messages queued for a client before
+	// it is dropped as too slow. It holds a full replay plus live events, so that
+	// a client resuming a busy session is not dropped by its own replay.
+	clientSendBufferSize = DefaultReplayBufferSize + 256
+	writeTimeout         = 10 * time.Second
+)
+
+// Event is a message sent from the server to WebSocket clients. Events of a
+// session carry increasing sequence numbers, so that a client can resume a
+// session after reconnecting. Replies that only concern one client have Seq 0.
+type Event struct {
+	Seq       int64  `json:"seq,omitempty"`
+	Type      string `json:"type"`
+	SessionID string `json:"sessionId,omitempty"`
+	Payload   any    `json:"payload,omitempty"`
+}
+
+// Client is a WebSocket connection. All writes go through a single goroutine,
+// as required by gorilla/websocket.
+type Client struct {
+	conn      *websocket.Conn
+	send      chan []byte
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// NewClient wraps conn and starts its writer goroutine.
+func NewClient(conn *websocket.Conn) *Client {
+	c := &Client{
+		conn: conn,
+		send: make(chan []byte, clientSendBufferSize),
+		done: make(chan struct{}),
+	}
+	go c.writePump()
+	return c
+}
+
+// Send queues an event for the client. It reports false when the client is
+// closed or too slow to keep up, in which case it is closed.
+func (c *Client) Send(event Event) bool {
+	data, err := json.Marshal(event)
+	if err != nil {
+		log.Printf("Error marshaling event to JSON: %v", err)
+		return true
+	}
+	select {
+	case <-c.done:
+		return false
+	default:
+	}
+	select {
+	case c.send <- data:
+		return true
+	default:
+		log.Println("Client is not keeping up with events; closing connection.")
+		c.Close()
+		return false
+	}
+}
+
+// Close closes the connection and stops the writer goroutine.
+func (c *Client) Close() {
+	c.closeOnce.Do(func() {
+		close(c.done)
+		c.conn.Close()
+	})
+}
+
+func (c *Client) writePump() {
+	for {
+		select {
+		case data := <-c.send:
+			c.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+			if err := c.conn.WriteMessage(websocket.TextMessage, data); err != nil {
+				log.Printf("Error writing to client: %v", err)
+				c.Close()
+				return
+			}
+		case <-c.done:
+			return
+		}
+	}
+}
+
+// sessionStream holds the recent events of a session and its subscribers.
+// A released stream is removed once it has no subscribers left.
+type sessionStream struct {
+	lastSeq     int64
+	events      []Event
+	subscribers map[*Client]bool
+	released    bool
+}
+
+// Broadcaster routes session events to the WebSocket clients subscribed to
+// that session and keeps a replay buffer per session.
 type Broadcaster struct {
-	mu      sync.RWMutex
-	clients map[*websocket.Conn]bool
+	mu         sync.Mutex
+	clients    map[*Client]bool
+	sessions   map[string]*sessionStream
+	replaySize int
 }
 
 // NewBroadcaster creates a new Broadcaster.
 func NewBroadcaster() *Broadcaster {
 	return &Broadcaster{
-		clients: make(map[*websocket.Conn]bool),
+		clients:    make(map[*Client]bool),
+		sessions:   make(map[string]*sessionStream),
+		replaySize: DefaultReplayBufferSize,
 	}
 }
 
 // AddClient registers a new WebSocket client.
-func (b *Broadcaster) AddClient(conn *websocket.Conn) {
+func (b *Broadcaster) AddClient(client *Client) {
 	b.mu.Lock()
 	defer b.mu.Unlock()
-	b.clients[conn] = true
+	b.clients[client] = true
 	log.Println("Client added. Total clients:", len(b.clients))
 }
 
-// RemoveClient unregisters a WebSocket client.
-func (b *Broadcaster) RemoveClient(conn *websocket.Conn) {
+// RemoveClient unregisters a WebSocket client and unsubscribes it from all sessions.
+func (b *Broadcaster) RemoveClient(client *Client) {
 	b.mu.Lock()
 	defer b.mu.Unlock()
-	if _, ok := b.clients[conn]; ok {
-		conn.Close()
-		delete(b.clients, conn)
+	if _, ok := b.clients[client]; ok {
+		client.Close()
+		delete(b.clients, client)
+		for _, stream := range b.sessions {
+			delete(stream.subscribers, client)
+		}
 		log.Println("Client removed. Total clients:", len(b.clients))
 	}
 }
 
-// Broadcast sends a message to all registered clients.
-func (b *Broadcaster) Broadcast(messageType int, data []byte) {
-	b.mu.RLock()
-	defer b.mu.RUnlock()
+// Subscribe makes client receive the events of a session. Buffered events with
+// a sequence number above afterSeq are replayed first. The returned flag is
+// true when events after afterSeq are no longer buffered and could not be replayed.
+func (b *Broadcaster) Subscribe(client *Client, sessionID string, afterSeq int64) (truncated bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	stream := b.stream(sessionID)
+	stream.subscribers[client] = true
+
+	if afterSeq < stream.lastSeq && (len(stream.events) == 0 || stream.events[0].Seq > afterSeq+1) {
+		truncated = true
+	}
+	for _, event := range stream.events {
+		if event.Seq > afterSeq {
+			client.Send(event)
+		}
+	}
+	return truncated
+}
+
+// Unsubscribe stops sending the events of a session to client.
+func (b *Broadcaster) Unsubscribe(client *Client, sessionID string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if stream, ok := b.sessions[sessionID]; ok {
+		delete(stream.subscribers, client)
+		b.removeIfUnused(sessionID, stream)
+	}
+}
+
+// Publish assigns the next sequence number of the session to an event, keeps
+// it for replay and sends it to the session's subscribers.
+func (b *Broadcaster) Publish(sessionID, eventType string, payload any) Event {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	stream := b.stream(sessionID)
+	stream.released = false
+	stream.lastSeq++
+	event := Event{Seq: stream.lastSeq, Type: eventType, SessionID: sessionID, Payload: payload}
 
-	for client := range b.clients {
-		if err := client.WriteMessage(messageType, data); err != nil {
-			log.Printf("Error broadcasting to client: %v", err)
-			// Assume the client is disconnected and remove it.
-			// This is a bit simplistic; a more robust implementation would handle this better.
-			go b.RemoveClient(client)
+	stream.events = append(stream.events, event)
+	if len(stream.events) > b.replaySize {
+		stream.events = stream.events[len(stream.events)-b.replaySize:]
+	}
+	for client := range stream.subscribers {
+		if !client.Send(event) {
+			delete(stream.subscribers, client)
 		}
 	}
-}
\ No newline at end of file
+	return event
+}
+
+// LastSeq returns the sequence number of the latest event of a session.
+func (b *Broadcaster) LastSeq(sessionID string) int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if stream, ok := b.sessions[sessionID]; ok {
+		return stream.lastSeq
+	}
+	return 0
+}
+
+// ReleaseSession drops the replay buffer of a session. While the session has
+// subscribers, its sequence numbers are kept, so that they keep receiving its
+// events in order when it is used again; after that, its stream is removed.
+func (b *Broadcaster) ReleaseSession(sessionID string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if stream, ok := b.sessions[sessionID]; ok {
+		stream.events = nil
+		stream.released = true
+		b.removeIfUnused(sessionID, stream)
+	}
+}
+
+// removeIfUnused removes a released stream without subscribers. b.mu must be held.
+func (b *Broadcaster) removeIfUnused(sessionID string, stream *sessionStream) {
+	if stream.released && len(stream.subscribers) == 0 {
+		delete(b.sessions, sessionID)
+	}
+}
+
+// stream returns the stream of a session, creating it if needed. b.mu must be held.
+func (b *Broadcaster) stream(sessionID string) *sessionStream {
+	stream, ok := b.sessions[sessionID]
+	if !ok {
+		stream = &sessionStream{subscribers: make(map[*Client]bool)}
+		b.sessions[sessionID] = stream
+	}
+	return stream
+}
@@ -0,0 +1,161 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrCallbackDestination is returned for callback URLs that point to the
+// server's own host or network and are not in callbackAllowedHosts.
+var ErrCallbackDestination = errors.New("callback destination is not allowed")
+
+// CheckCallbackURL checks a task's callback URL before the task is queued: it
+// must be an absolute http or https URL, and its host must not be a loopback,
+// link-local or private address unless it is in callbackAllowedHosts. Host
+// names are checked again when the callback is sent, once they are resolved.
+func (a *Authenticator) CheckCallbackURL(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("callbackUrl must be an absolute http or https URL")
+	}
+	host := u.Hostname()
+	if a.callbackHostAllowed(host) {
+		return nil
+	}
+	if strings.EqualFold(host, "localhost") || strings.HasSuffix(strings.ToLower(host), ".localhost") {
+		return fmt.Errorf("%w: %s", ErrCallbackDestination, host)
+	}
+	if addr, err := netip.ParseAddr(host); err == nil && !isPublicAddress(addr) {
+		return fmt.Errorf("%w: %s", ErrCallbackDestination, host)
+	}
+	return nil
+}
+
+// maxCallbackRedirects is how many redirects a callback follows.
+const maxCallbackRedirects = 10
+
+// CallbackClient returns the HTTP client of task callbacks. It connects only
+// to public addresses or to callbackAllowedHosts, and ignores proxy settings
+// so that the check applies to the actual destination, redirects included.
+// The client is shared by all callbacks, so that connections are reused.
+func (a *Authenticator) CallbackClient() *http.Client {
+	return a.callbackClient
+}
+
+func (a *Authenticator) newCallbackClient() *http.Client {
+	return &http.Client{
+		Timeout: callbackTimeout,
+		Transport: &http.Transport{
+			Proxy:                 nil,
+			DialContext:           a.dialCallback,
+			ForceAttemptHTTP2:     true,
+			MaxIdleConns:          100,
+			IdleConnTimeout:       90 * time.Second,
+			TLSHandshakeTimeout:   10 * time.Second,
+			ExpectContinueTimeout: 1 * time.Second,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= maxCallbackRedirects {
+				return fmt.Errorf("stopped after %d redirects", maxCallbackRedirects)
+			}
+			return a.CheckCallbackURL(req.URL.String())
+		},
+	}
+}
+
+// dialCallback resolves the host of a callback and connects to its first
+// address, after checking that none of them is loopback, link-local or private.
+func (a *Authenticator) dialCallback(ctx context.Context, network, address string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	var dialer net.Dialer
+	if a.callbackHostAllowed(host) {
+		return dialer.DialContext(ctx, network, address)
+	}
+	addrs, err := net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+	if err != nil {
+		return nil, err
+	}
+	for _, addr := range addrs {
+		if !isPublicAddress(addr) {
+			return nil, fmt.Errorf("%w: %s resolves to %s", ErrCallbackDestination, host, addr)
+		}
+	}
+	if len(addrs) == 0 {
+		return nil, fmt.Errorf("no address found for %s", host)
+	}
+	return dialer.DialContext(ctx, network, net.JoinHostPort(addrs[0].String(), port))
+}
+
+// callbackHostAllowed reports whether a host is in callbackAllowedHosts.
+func (a *Authenticator) callbackHostAllowed(host string) bool {
+	for _, allowed := range a.callbackHosts {
+		if strings.EqualFold(strings.Trim(allowed, "[]"), strings.Trim(host, "[]")) {
+			return true
+		}
+	}
+	return false
+}
+
+// isPublicAddress reports whether an address may be the destination of a
+// callback: it is not loopback, link-local, private, shared (100.64.0.0/10),
+// unspecified or multicast.
+func isPublicAddress(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	return addr.IsGlobalUnicast() && !addr.IsPrivate() && !sharedAddressSpace.Contains(addr)
+}
+
+// sharedAddressSpace is the carrier-grade NAT range of RFC 6598.
+var sharedAddressSpace = netip.MustParsePrefix("100.64.0.0/10")
+
+// SignRequest signs a request with body the way webhook tasks are signed:
+// the TimestampHeader is set to the current time and SignatureHeader to the
+// HMAC of the timestamp and the body. Without webhook secret, it does nothing.
+func (a *Authenticator) SignRequest(req *http.Request, body []byte) {
+	if len(a.webhookSecret) == 0 {
+		return
+	}
+	timestamp := strconv.FormatInt(a.now().Unix(), 10)
+	req.Header.Set(TimestampHeader, timestamp)
+	req.Header.Set(SignatureHeader, "sha256="+hex.EncodeToString(SignBody(a.webhookSecret, timestamp, body)))
+}
+
+// sendTaskCallback posts a finished task to its callback URL, signed with the
+// webhook secret.
+func (s *Server) sendTaskCallback(task Task) {
+	data, err := json.Marshal(task)
+	if err != nil {
+		log.Printf("Error marshaling task %s for callback: %v", task.ID, err)
+		return
+	}
+	req, err := http.NewRequest(http.MethodPost, task.CallbackURL, bytes.NewReader(data))
+	if err != nil {
+		log.Printf("Error creating callback request for task %s: %v", task.ID, err)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	s.Auth.SignRequest(req, data)
+	resp, err := s.Auth.CallbackClient().Do(req)
+	if err != nil {
+		log.Printf("Error sending callback for task %s: %v", task.ID, err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		log.Printf("Callback for task %s returned %s", task.ID, resp.Status)
+	}
+}
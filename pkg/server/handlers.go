@@ -3,31 +3,56 @@ package server
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"log"
 	"net/http"
+	"time"
 
-	"go-ai-agent-v2/go-cli/pkg/types"
+	"github.com/gorilla/mux"
 	"github.com/gorilla/websocket"
+	"go-ai-agent-v2/go-cli/pkg/services"
+	"go-ai-agent-v2/go-cli/pkg/types"
 )
 
-var upgrader = websocket.Upgrader{
-	CheckOrigin: func(r *http.Request) bool {
-		// Allow all connections by default.
-		return true
-	},
+// Types of the messages a WebSocket client can send.
+const (
+	ClientMessagePrompt           = "prompt"
+	ClientMessageResume           = "resume"
+	ClientMessageCancel           = "cancel"
+	ClientMessageToolConfirmation = "tool_confirmation"
+)
+
+// ClientMessage is a message sent by a WebSocket client.
+type ClientMessage struct {
+	Type       string                        `json:"type"`
+	SessionID  string                        `json:"sessionId,omitempty"`
+	Prompt     string                        `json:"prompt,omitempty"`
+	LastSeq    int64                         `json:"lastSeq,omitempty"`
+	ToolCallID string                        `json:"toolCallId,omitempty"`
+	Outcome    types.ToolConfirmationOutcome `json:"outcome,omitempty"`
+	// ModifiedArgs replaces the tool call's arguments when Outcome is MODIFY.
+	ModifiedArgs map[string]any `json:"modifiedArgs,omitempty"`
 }
 
 // handleWebSocket is the HTTP handler for WebSocket connections.
 func (s *Server) handleWebSocket() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		upgrader := websocket.Upgrader{CheckOrigin: s.Auth.CheckOrigin}
 		conn, err := upgrader.Upgrade(w, r, nil)
 		if err != nil {
 			log.Printf("Failed to upgrade connection: %v", err)
 			return
 		}
-		defer s.Broadcaster.RemoveClient(conn)
+		client := NewClient(conn)
+		defer s.Broadcaster.RemoveClient(client)
+
+		s.Broadcaster.AddClient(client)
+		principal := PrincipalFromContext(r.Context())
 
-		s.Broadcaster.AddClient(conn)
+		// The session of the last prompt or resume, used when a message names none.
+		currentSessionID := ""
 
 		// Loop to handle incoming messages
 		for {
@@ -37,79 +62,386 @@ func (s *Server) handleWebSocket() http.HandlerFunc {
 				break
 			}
 
-			prompt := string(message)
-			log.Printf("Received prompt: %s", prompt)
+			var msg ClientMessage
+			if err := json.Unmarshal(message, &msg); err != nil {
+				// Plain text is a prompt, as in the first version of the protocol.
+				msg = ClientMessage{Type: ClientMessagePrompt, Prompt: string(message)}
+			} else if msg.Type == "" && msg.Prompt != "" {
+				// {"prompt": "..."} without a type, as sent by older clients.
+				msg.Type = ClientMessagePrompt
+			}
+			if msg.SessionID == "" {
+				msg.SessionID = currentSessionID
+			}
 
-			// Generate a new session ID for each new WebSocket message
-			sessionID := s.SessionService.GenerateSessionID()
+			if scope := messageScope(msg.Type); !principal.HasScope(scope) {
+				client.Send(Event{Type: "error", SessionID: msg.SessionID, Payload: map[string]string{"error": fmt.Sprintf("%s messages require scope %s", msg.Type, scope)}})
+				continue
+			}
 
-			eventChan, err := s.ChatService.SendMessage(r.Context(), sessionID, prompt)
+			sessionID, err := s.handleClientMessage(client, principal, msg)
 			if err != nil {
-				log.Printf("Error sending message to chat service: %v", err)
-				// Optionally send an error message back to the client
+				log.Printf("Error handling %s message: %v", msg.Type, err)
+				client.Send(Event{Type: "error", SessionID: msg.SessionID, Payload: map[string]string{"error": err.Error()}})
 				continue
 			}
+			currentSessionID = sessionID
+		}
+	}
+}
+
+// handleClientMessage executes a client message of principal and returns the
+// session it concerns.
+func (s *Server) handleClientMessage(client *Client, principal *Principal, msg ClientMessage) (string, error) {
+	if msg.SessionID != "" && !s.Sessions.CanAccess(msg.SessionID, principal.Name) {
+		return "", fmt.Errorf("%w: %s", ErrSessionForbidden, msg.SessionID)
+	}
+	switch msg.Type {
+	case ClientMessagePrompt:
+		if msg.Prompt == "" {
+			return msg.SessionID, fmt.Errorf("prompt cannot be empty")
+		}
+		sessionID := msg.SessionID
+		if sessionID == "" {
+			sessionID = s.SessionService.GenerateSessionID()
+		}
+		if !s.Sessions.Claim(sessionID, principal.Name) {
+			return "", fmt.Errorf("%w: %s", ErrSessionForbidden, sessionID)
+		}
+		lastSeq := s.Broadcaster.LastSeq(sessionID)
+		s.Broadcaster.Subscribe(client, sessionID, lastSeq)
+		client.Send(Event{Type: "session", SessionID: sessionID, Payload: map[string]any{"lastSeq": lastSeq}})
+		log.Printf("Received prompt for session %s: %s", sessionID, msg.Prompt)
+		return sessionID, s.startRun(sessionID, msg.Prompt)
+
+	case ClientMessageResume:
+		if msg.SessionID == "" {
+			return "", fmt.Errorf("resume requires a sessionId")
+		}
+		truncated := s.Broadcaster.Subscribe(client, msg.SessionID, msg.LastSeq)
+		// "resumed" marks the end of the replayed events.
+		client.Send(Event{Type: "resumed", SessionID: msg.SessionID, Payload: map[string]any{
+			"lastSeq":   s.Broadcaster.LastSeq(msg.SessionID),
+			"truncated": truncated,
+			"running":   s.isRunning(msg.SessionID),
+		}})
+		return msg.SessionID, nil
 
-			go s.broadcastEvents(eventChan, sessionID)
+	case ClientMessageCancel:
+		if !s.cancelRun(msg.SessionID) {
+			return msg.SessionID, fmt.Errorf("session %q has no prompt in progress", msg.SessionID)
 		}
+		return msg.SessionID, nil
+
+	case ClientMessageToolConfirmation:
+		if !s.isRunning(msg.SessionID) {
+			return msg.SessionID, fmt.Errorf("session %q has no prompt in progress", msg.SessionID)
+		}
+		confirmation := types.ToolConfirmation{Outcome: msg.Outcome, ModifiedArgs: msg.ModifiedArgs}
+		chatService, ok := s.Sessions.Get(msg.SessionID)
+		if !ok {
+			return msg.SessionID, fmt.Errorf("session %q has no prompt in progress", msg.SessionID)
+		}
+		return msg.SessionID, chatService.ConfirmToolCall(msg.ToolCallID, confirmation)
+
+	default:
+		return msg.SessionID, fmt.Errorf("unknown message type %q", msg.Type)
 	}
 }
 
-// broadcastEvents reads events from the chat service channel and broadcasts them to all clients.
-func (s *Server) broadcastEvents(eventChan <-chan any, sessionID string) {
-	for event := range eventChan {
-		var eventData struct {
-			Type      string      `json:"type"`
-			Payload   interface{} `json:"payload"`
-			SessionID string      `json:"sessionId"` // Include session ID
-		}
-		eventData.SessionID = sessionID
-
-		switch e := event.(type) {
-		case types.Part:
-			eventData.Type = "chunk"
-			eventData.Payload = e
-		case types.StreamingStartedEvent:
-			eventData.Type = "streaming_started"
-			eventData.Payload = e
-		case types.ThinkingEvent:
-			eventData.Type = "thinking"
-			eventData.Payload = e
-		case types.FinalResponseEvent:
-			eventData.Type = "final_response"
-			eventData.Payload = e
-		case types.ToolCallStartEvent:
-			eventData.Type = "tool_call_start"
-			eventData.Payload = e
-		case types.ToolCallEndEvent:
-			eventData.Type = "tool_call_end"
-			eventData.Payload = e
-		case types.ErrorEvent:
-			eventData.Type = "error"
-			eventData.Payload = e
-		case types.TokenCountEvent:
-			eventData.Type = "token_count"
-			eventData.Payload = e
-		case types.ModelSwitchEvent:
-			eventData.Type = "model_switch"
-			eventData.Payload = e
-		case types.ToolConfirmationRequestEvent:
-			eventData.Type = "tool_confirmation_request"
-			eventData.Payload = e
-		case types.TodosSummaryUpdateEvent:
-			eventData.Type = "todos_summary_update"
-			eventData.Payload = e
-		default:
-			log.Printf("Unknown event type: %T", e)
-			continue
+// handleToolConfirmation is the HTTP handler that answers the confirmation
+// request of a tool call, for clients that do not keep a WebSocket open.
+func (s *Server) handleToolConfirmation() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		sessionID, toolCallID := vars["id"], vars["toolCallId"]
+
+		var confirmation types.ToolConfirmation
+		if err := json.NewDecoder(r.Body).Decode(&confirmation); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		if !s.authorizeSession(w, r, sessionID) {
+			return
+		}
+		chatService, ok := s.Sessions.Get(sessionID)
+		if !ok || !s.isRunning(sessionID) {
+			http.Error(w, fmt.Sprintf("session %q has no prompt in progress", sessionID), http.StatusNotFound)
+			return
+		}
+
+		if err := chatService.ConfirmToolCall(toolCallID, confirmation); err != nil {
+			status := http.StatusBadRequest
+			if errors.Is(err, services.ErrNoPendingConfirmation) {
+				status = http.StatusNotFound
+			}
+			http.Error(w, err.Error(), status)
+			return
+		}
+
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(map[string]string{"status": "confirmation accepted", "sessionId": sessionID, "toolCallId": toolCallID})
+	}
+}
+
+// handleForkSession is the HTTP handler that copies the first messages of a
+// session into a new session. Without an index, all messages are copied.
+func (s *Server) handleForkSession() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		sessionID := mux.Vars(r)["id"]
+		var req struct {
+			Index *int `json:"index"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		if !s.authorizeSession(w, r, sessionID) {
+			return
+		}
+		history, err := s.SessionService.LoadHistory(sessionID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if len(history) == 0 {
+			http.Error(w, fmt.Sprintf("session %q not found", sessionID), http.StatusNotFound)
+			return
+		}
+		index := len(history)
+		if req.Index != nil {
+			index = *req.Index
+		}
+
+		forkID, err := s.SessionService.ForkSession(sessionID, index)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		s.Sessions.Claim(forkID, PrincipalFromContext(r.Context()).Name)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]any{"sessionId": forkID, "parentId": sessionID, "index": index})
+	}
+}
+
+// handleRewindSession is the HTTP handler that drops the last turns of a
+// session, 1 by default. Sessions with a prompt in progress cannot be rewound.
+func (s *Server) handleRewindSession() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		sessionID := mux.Vars(r)["id"]
+		req := struct {
+			Turns int `json:"turns"`
+		}{Turns: 1}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		if !s.authorizeSession(w, r, sessionID) {
+			return
+		}
+
+		// Holding runsMu keeps a prompt from starting during the rewind.
+		s.runsMu.Lock()
+		_, busy := s.runs[sessionID]
+		var dropped []*types.Content
+		var err error
+		if !busy {
+			dropped, err = s.SessionService.RewindSession(sessionID, req.Turns)
+		}
+		s.runsMu.Unlock()
+		if busy {
+			http.Error(w, fmt.Sprintf("session %q is processing a prompt", sessionID), http.StatusConflict)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
 		}
 
-		jsonData, err := json.Marshal(eventData)
+		history, err := s.SessionService.LoadHistory(sessionID)
 		if err != nil {
-			log.Printf("Error marshaling event to JSON: %v", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{"sessionId": sessionID, "turns": req.Turns, "dropped": dropped, "messageCount": len(history)})
+	}
+}
+
+// authorizeSession replies 403 and returns false when the session belongs to
+// another principal than the caller of r.
+func (s *Server) authorizeSession(w http.ResponseWriter, r *http.Request, sessionID string) bool {
+	if !s.Sessions.CanAccess(sessionID, PrincipalFromContext(r.Context()).Name) {
+		http.Error(w, fmt.Sprintf("%v: %s", ErrSessionForbidden, sessionID), http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// startRun sends a prompt to the chat service and publishes the resulting
+// events to the session's subscribers. The run is not tied to any connection,
+// so clients can disconnect and resume it later. A session runs one prompt at a time.
+func (s *Server) startRun(sessionID, prompt string) error {
+	eventChan, err := s.openRun(sessionID, prompt)
+	if err != nil {
+		return err
+	}
+	go s.completeRun(eventChan, sessionID, "")
+	return nil
+}
+
+// runTask is the JobRunner of webhook tasks. It runs the task's prompt in the
+// task's session and returns once the run has ended.
+func (s *Server) runTask(job *services.Job) error {
+	s.Tasks.Begin(job.ID, job.Attempts)
+	eventChan, err := s.openRun(job.ID, job.Prompt)
+	if err != nil {
+		return err
+	}
+	// A cancellation that arrived before the run was registered.
+	if s.Tasks.CancelRequested(job.ID) {
+		s.cancelRun(job.ID)
+	}
+	return s.completeRun(s.countToolCalls(eventChan, job), job.ID, job.ID)
+}
+
+// countToolCalls passes the events of a run through and records the tool
+// calls they start in the job, which the job queue reads once the run ended.
+func (s *Server) countToolCalls(eventChan <-chan any, job *services.Job) <-chan any {
+	counted := make(chan any)
+	go func() {
+		defer close(counted)
+		for event := range eventChan {
+			if _, ok := event.(types.ToolCallStartEvent); ok {
+				s.Jobs.RecordToolCall(job)
+			}
+			counted <- event
+		}
+	}()
+	return counted
+}
+
+// openRun registers a run of the session and sends the prompt to the session's chat service.
+func (s *Server) openRun(sessionID, prompt string) (<-chan any, error) {
+	s.runsMu.Lock()
+	if _, busy := s.runs[sessionID]; busy {
+		s.runsMu.Unlock()
+		return nil, fmt.Errorf("session %q is already processing a prompt", sessionID)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	s.runs[sessionID] = cancel
+	s.runsMu.Unlock()
+
+	chatService, err := s.Sessions.Acquire(sessionID)
+	if err != nil {
+		s.finishRun(sessionID)
+		return nil, err
+	}
+	eventChan, err := chatService.SendMessage(ctx, sessionID, prompt)
+	if err != nil {
+		s.Sessions.Release(sessionID)
+		s.finishRun(sessionID)
+		return nil, err
+	}
+	return eventChan, nil
+}
+
+// completeRun publishes the events of a run until it ends and releases the
+// session. It returns the last error the run reported. When taskID is not
+// empty, the events also update that webhook task.
+func (s *Server) completeRun(eventChan <-chan any, sessionID, taskID string) error {
+	runErr := s.publishEvents(eventChan, sessionID, taskID)
+	s.Sessions.Release(sessionID)
+	s.finishRun(sessionID)
+	s.Broadcaster.Publish(sessionID, "run_finished", nil)
+	return runErr
+}
+
+// finishRun unregisters the run of a session and releases its context.
+func (s *Server) finishRun(sessionID string) {
+	s.runsMu.Lock()
+	defer s.runsMu.Unlock()
+	if cancel, ok := s.runs[sessionID]; ok {
+		cancel()
+		delete(s.runs, sessionID)
+	}
+}
+
+// cancelRun cancels the prompt in progress of a session, if any.
+func (s *Server) cancelRun(sessionID string) bool {
+	s.runsMu.Lock()
+	defer s.runsMu.Unlock()
+	cancel, ok := s.runs[sessionID]
+	if ok {
+		cancel()
+	}
+	return ok
+}
+
+func (s *Server) isRunning(sessionID string) bool {
+	s.runsMu.Lock()
+	defer s.runsMu.Unlock()
+	_, ok := s.runs[sessionID]
+	return ok
+}
+
+// publishEvents reads events from the chat service channel and publishes them
+// to the clients subscribed to the session. It returns the last error event.
+func (s *Server) publishEvents(eventChan <-chan any, sessionID, taskID string) error {
+	var runErr error
+	for event := range eventChan {
+		if taskID != "" {
+			s.Tasks.Record(taskID, event)
+		}
+		if e, ok := event.(types.ErrorEvent); ok {
+			runErr = e.Err
+		}
+		eventType, ok := eventTypeOf(event)
+		if !ok {
+			log.Printf("Unknown event type: %T", event)
 			continue
 		}
-		s.Broadcaster.Broadcast(websocket.TextMessage, jsonData)
+		s.Broadcaster.Publish(sessionID, eventType, event)
+	}
+	return runErr
+}
+
+// eventTypeOf returns the protocol name of a chat service event.
+func eventTypeOf(event any) (string, bool) {
+	switch event.(type) {
+	case types.Part:
+		return "chunk", true
+	case types.StreamingStartedEvent:
+		return "streaming_started", true
+	case types.ThinkingEvent:
+		return "thinking", true
+	case types.FinalResponseEvent:
+		return "final_response", true
+	case types.ToolCallStartEvent:
+		return "tool_call_start", true
+	case types.ToolCallEndEvent:
+		return "tool_call_end", true
+	case types.ErrorEvent:
+		return "error", true
+	case types.TokenCountEvent:
+		return "token_count", true
+	case types.ModelSwitchEvent:
+		return "model_switch", true
+	case types.RetryEvent:
+		return "retry", true
+	case types.BudgetWarningEvent:
+		return "budget_warning", true
+	case types.PromptSizeEvent:
+		return "prompt_size", true
+	case types.ContextReducedEvent:
+		return "context_reduced", true
+	case types.ToolConfirmationRequestEvent:
+		return "tool_confirmation_request", true
+	case types.TodosSummaryUpdateEvent:
+		return "todos_summary_update", true
+	default:
+		return "", false
 	}
 }
 
@@ -126,25 +458,89 @@ func (s *Server) handleTaskWebhook() http.HandlerFunc {
 			http.Error(w, "Prompt cannot be empty", http.StatusBadRequest)
 			return
 		}
+		if taskReq.CallbackURL != "" {
+			if err := s.Auth.CheckCallbackURL(taskReq.CallbackURL); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
 
 		log.Printf("Received webhook task with prompt: %s", taskReq.Prompt)
 
-		// Generate a new session ID for each webhook task
+		// Generate a new session ID for each webhook task; it doubles as the task ID.
 		sessionID := s.SessionService.GenerateSessionID()
+		job := &services.Job{
+			ID:          sessionID,
+			Prompt:      taskReq.Prompt,
+			Priority:    taskReq.Priority,
+			CallbackURL: taskReq.CallbackURL,
+			Owner:       PrincipalFromContext(r.Context()).Name,
+			CreatedAt:   time.Now(),
+		}
+		s.Sessions.Claim(sessionID, job.Owner)
+		s.Tasks.Create(job)
 
-		// We need a separate context for the background task.
-		taskCtx := context.Background()
+		if err := s.Jobs.Enqueue(job); err != nil {
+			log.Printf("Error queuing webhook task: %v", err)
+			s.finishTask(sessionID, err)
+			http.Error(w, "Failed to queue task", http.StatusInternalServerError)
+			return
+		}
 
-		go func() {
-			eventChan, err := s.ChatService.SendMessage(taskCtx, sessionID, taskReq.Prompt)
-			if err != nil {
-				log.Printf("Error starting webhook task: %v", err)
-				return
-			}
-			s.broadcastEvents(eventChan, sessionID)
-		}()
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(map[string]string{"status": "task accepted", "taskId": sessionID, "sessionId": sessionID})
+	}
+}
 
+// handleGetTask is the HTTP handler that returns the state and result of a webhook task.
+func (s *Server) handleGetTask() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		task, ok := s.Tasks.Get(mux.Vars(r)["id"])
+		if !ok {
+			http.Error(w, "Task not found", http.StatusNotFound)
+			return
+		}
+		if !s.authorizeSession(w, r, task.SessionID) {
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(task)
+	}
+}
+
+// handleCancelTask is the HTTP handler that cancels a webhook task.
+func (s *Server) handleCancelTask() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		taskID := mux.Vars(r)["id"]
+		if !s.authorizeSession(w, r, taskID) {
+			return
+		}
+		task, ok := s.Tasks.RequestCancel(taskID)
+		if !ok {
+			http.Error(w, "Task not found", http.StatusNotFound)
+			return
+		}
+		if task.State.Finished() {
+			http.Error(w, fmt.Sprintf("task %q already %s", taskID, task.State), http.StatusConflict)
+			return
+		}
+		if err := s.Jobs.Cancel(taskID); err == nil {
+			s.finishTask(taskID, nil)
+			task, _ = s.Tasks.Get(taskID)
+		} else {
+			s.cancelRun(task.SessionID)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusAccepted)
-		json.NewEncoder(w).Encode(map[string]string{"status": "task accepted", "sessionId": sessionID})
+		json.NewEncoder(w).Encode(task)
+	}
+}
+
+// finishTask records the end of a webhook task and sends its callback, if any.
+func (s *Server) finishTask(taskID string, runErr error) {
+	task, ok := s.Tasks.Finish(taskID, runErr)
+	if ok && task.CallbackURL != "" {
+		go s.sendTaskCallback(task)
 	}
 }
@@ -0,0 +1,438 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go-ai-agent-v2/go-cli/pkg/config"
+	"go-ai-agent-v2/go-cli/pkg/core"
+	"go-ai-agent-v2/go-cli/pkg/services"
+	"go-ai-agent-v2/go-cli/pkg/types"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestServer starts a server whose model echoes the last user message.
+func newTestServer(t *testing.T) (*Server, *httptest.Server) {
+	return newTestServerWithModel(t, func(ctx context.Context, contents ...*types.Content) (<-chan any, error) {
+		eventChan := make(chan any)
+		go func() {
+			defer close(eventChan)
+			last := contents[len(contents)-1]
+			eventChan <- types.Part{Text: "echo: " + last.Parts[0].Text}
+		}()
+		return eventChan, nil
+	})
+}
+
+// newTestServerWithModel starts a server whose model streams with the given
+// function and whose write_file tool needs confirmation.
+func newTestServerWithModel(t *testing.T, streamContent func(ctx context.Context, contents ...*types.Content) (<-chan any, error)) (*Server, *httptest.Server) {
+	projectRoot := t.TempDir()
+	store, err := services.NewFileSessionStore(projectRoot + "/sessions")
+	require.NoError(t, err)
+	sessionService, err := services.NewSessionService(store)
+	require.NoError(t, err)
+
+	settingsService := new(services.MockSettingsService)
+	settingsService.On("Get", mock.Anything).Return(nil, false).Maybe()
+	settingsService.On("GetDangerousTools").Return([]string{types.WRITE_FILE_TOOL_NAME}).Maybe()
+	settingsService.On("GetRetrySettings").Return(&types.RetrySettings{MaxAttempts: 1}).Maybe()
+	settingsService.On("GetBudgetSettings").Return(nil).Maybe()
+	settingsService.On("GetWorkspaceDir").Return("").Maybe()
+
+	toolRegistry := types.NewToolRegistry()
+	require.NoError(t, toolRegistry.Register(&fakeWriteFileTool{}))
+
+	sessions := NewSessionManager(func() (*services.ChatService, error) {
+		executor := &core.MockExecutor{StreamContentFunc: streamContent}
+		return services.NewChatService(executor, toolRegistry, sessionService, settingsService,
+			services.NewContextService(projectRoot), config.NewConfig(&config.ConfigParameters{}), types.GenerateContentConfig{}, nil)
+	}, 0, 0)
+
+	srv := NewServer(sessions, sessionService, TaskQueueOptions{RetryBackoff: 10 * time.Millisecond})
+	require.NoError(t, srv.StartTaskQueue())
+	t.Cleanup(srv.Jobs.Stop)
+	httpServer := httptest.NewServer(srv.Router)
+	t.Cleanup(httpServer.Close)
+	return srv, httpServer
+}
+
+// fakeWriteFileTool reports the path it would write to without touching the disk.
+type fakeWriteFileTool struct {
+	types.BaseDeclarativeTool
+}
+
+func (t *fakeWriteFileTool) Name() string { return types.WRITE_FILE_TOOL_NAME }
+func (t *fakeWriteFileTool) Execute(ctx context.Context, args map[string]any) (types.ToolResult, error) {
+	return types.ToolResult{LLMContent: fmt.Sprintf("wrote %v", args["file_path"])}, nil
+}
+
+func dial(t *testing.T, httpServer *httptest.Server) *websocket.Conn {
+	url := "ws" + strings.TrimPrefix(httpServer.URL, "http") + "/ws"
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func send(t *testing.T, conn *websocket.Conn, msg ClientMessage) {
+	require.NoError(t, conn.WriteJSON(msg))
+}
+
+// readUntil reads events until one of the given type arrives and returns all of them.
+func readUntil(t *testing.T, conn *websocket.Conn, eventType string) []Event {
+	var events []Event
+	for {
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		var event Event
+		require.NoError(t, conn.ReadJSON(&event))
+		events = append(events, event)
+		if event.Type == eventType {
+			return events
+		}
+	}
+}
+
+func finalResponse(events []Event) string {
+	for _, event := range events {
+		if event.Type == "final_response" {
+			payload, _ := event.Payload.(map[string]any)
+			content, _ := payload["Content"].(string)
+			return content
+		}
+	}
+	return ""
+}
+
+func TestWebSocket_SessionRouting(t *testing.T) {
+	_, httpServer := newTestServer(t)
+	clientA := dial(t, httpServer)
+	clientB := dial(t, httpServer)
+
+	send(t, clientA, ClientMessage{Type: ClientMessagePrompt, SessionID: "session-a", Prompt: "hello from a"})
+	eventsA := readUntil(t, clientA, "run_finished")
+	assert.Equal(t, "session", eventsA[0].Type)
+	assert.Equal(t, "echo: hello from a", finalResponse(eventsA))
+	var lastSeq int64
+	for _, event := range eventsA[1:] {
+		assert.Equal(t, "session-a", event.SessionID)
+		assert.Greater(t, event.Seq, lastSeq, "sequence numbers must increase")
+		lastSeq = event.Seq
+	}
+
+	send(t, clientB, ClientMessage{Type: ClientMessagePrompt, SessionID: "session-b", Prompt: "hello from b"})
+	eventsB := readUntil(t, clientB, "run_finished")
+	assert.Equal(t, "echo: hello from b", finalResponse(eventsB))
+
+	// Client A is not subscribed to session-b and must not see its events.
+	clientA.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+	var unexpected Event
+	assert.Error(t, clientA.ReadJSON(&unexpected), "client A received %+v", unexpected)
+}
+
+func TestWebSocket_ResumeReplaysFromSequence(t *testing.T) {
+	_, httpServer := newTestServer(t)
+	first := dial(t, httpServer)
+	send(t, first, ClientMessage{Type: ClientMessagePrompt, SessionID: "resumable", Prompt: "remember me"})
+	original := readUntil(t, first, "run_finished")
+	first.Close()
+
+	// A new connection resumes after the second event and gets the rest replayed.
+	second := dial(t, httpServer)
+	send(t, second, ClientMessage{Type: ClientMessageResume, SessionID: "resumable", LastSeq: 2})
+	replayed := readUntil(t, second, "resumed")
+
+	require.Len(t, replayed, len(original)-2)
+	for i, event := range replayed[:len(replayed)-1] {
+		assert.Equal(t, original[i+3].Seq, event.Seq)
+		assert.Equal(t, original[i+3].Type, event.Type)
+	}
+	payload := replayed[len(replayed)-1].Payload.(map[string]any)
+	assert.Equal(t, false, payload["truncated"])
+	assert.Equal(t, false, payload["running"])
+}
+
+func TestWebSocket_InvalidMessages(t *testing.T) {
+	_, httpServer := newTestServer(t)
+	conn := dial(t, httpServer)
+
+	for _, msg := range []ClientMessage{
+		{Type: "unknown"},
+		{Type: ClientMessageResume},
+		{Type: ClientMessageCancel, SessionID: "idle"},
+		{Type: ClientMessagePrompt, SessionID: "empty"},
+	} {
+		send(t, conn, msg)
+		events := readUntil(t, conn, "error")
+		require.Len(t, events, 1)
+		data, err := json.Marshal(events[0].Payload)
+		require.NoError(t, err)
+		assert.Contains(t, string(data), "error")
+	}
+}
+
+func TestBroadcaster_ReplayBufferIsBounded(t *testing.T) {
+	b := NewBroadcaster()
+	b.replaySize = 3
+	for i := 0; i < 5; i++ {
+		b.Publish("s", "chunk", i)
+	}
+	assert.Equal(t, int64(5), b.LastSeq("s"))
+	stream := b.sessions["s"]
+	require.Len(t, stream.events, 3)
+	assert.Equal(t, int64(3), stream.events[0].Seq)
+}
+
+func TestWebSocket_ResumeReplaysFullBuffer(t *testing.T) {
+	srv, httpServer := newTestServer(t)
+	for i := 0; i < DefaultReplayBufferSize; i++ {
+		srv.Broadcaster.Publish("busy", "chunk", i)
+	}
+
+	// The whole replay buffer fits in the client's queue, so the client is
+	// not dropped while it is replayed.
+	conn := dial(t, httpServer)
+	send(t, conn, ClientMessage{Type: ClientMessageResume, SessionID: "busy"})
+	replayed := readUntil(t, conn, "resumed")
+	require.Len(t, replayed, DefaultReplayBufferSize+1)
+	assert.Equal(t, int64(1), replayed[0].Seq)
+	assert.Equal(t, int64(DefaultReplayBufferSize), replayed[DefaultReplayBufferSize-1].Seq)
+}
+
+func TestBroadcaster_RemovesReleasedStreams(t *testing.T) {
+	b := NewBroadcaster()
+	b.Publish("idle", "chunk", nil)
+	b.ReleaseSession("idle")
+	assert.NotContains(t, b.sessions, "idle")
+
+	// A stream with subscribers is kept until the last one leaves.
+	client := &Client{send: make(chan []byte, 1), done: make(chan struct{})}
+	b.AddClient(client)
+	b.Subscribe(client, "watched", 0)
+	b.Publish("watched", "chunk", nil)
+	b.ReleaseSession("watched")
+	require.Contains(t, b.sessions, "watched")
+	assert.Equal(t, int64(1), b.LastSeq("watched"))
+	b.Unsubscribe(client, "watched")
+	assert.NotContains(t, b.sessions, "watched")
+}
+
+func TestWebSocket_UntypedPrompt(t *testing.T) {
+	_, httpServer := newTestServer(t)
+	conn := dial(t, httpServer)
+
+	require.NoError(t, conn.WriteMessage(websocket.TextMessage, []byte(`{"prompt": "legacy client"}`)))
+	assert.Equal(t, "echo: legacy client", finalResponse(readUntil(t, conn, "run_finished")))
+
+	require.NoError(t, conn.WriteMessage(websocket.TextMessage, []byte("plain text")))
+	assert.Equal(t, "echo: plain text", finalResponse(readUntil(t, conn, "run_finished")))
+}
+
+func TestToolConfirmation_REST(t *testing.T) {
+	_, httpServer := newTestServerWithModel(t, func(ctx context.Context, contents ...*types.Content) (<-chan any, error) {
+		eventChan := make(chan any)
+		go func() {
+			defer close(eventChan)
+			if len(contents) == 1 {
+				eventChan <- types.Part{FunctionCall: &types.FunctionCall{
+					ID:   "call-1",
+					Name: types.WRITE_FILE_TOOL_NAME,
+					Args: map[string]any{"file_path": "original.txt", "content": "Hello"},
+				}}
+			} else {
+				eventChan <- types.Part{Text: "done"}
+			}
+		}()
+		return eventChan, nil
+	})
+	conn := dial(t, httpServer)
+
+	send(t, conn, ClientMessage{Type: ClientMessagePrompt, SessionID: "confirm", Prompt: "write it"})
+	events := readUntil(t, conn, "tool_confirmation_request")
+	assert.Equal(t, "confirm", events[len(events)-1].SessionID)
+
+	post := func(sessionID, toolCallID, body string) int {
+		url := fmt.Sprintf("%s/api/v1/sessions/%s/confirmations/%s", httpServer.URL, sessionID, toolCallID)
+		resp, err := http.Post(url, "application/json", strings.NewReader(body))
+		require.NoError(t, err)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	assert.Equal(t, http.StatusNotFound, post("idle", "call-1", `{"outcome": "PROCEED_ONCE"}`))
+	assert.Equal(t, http.StatusNotFound, post("confirm", "unknown", `{"outcome": "PROCEED_ONCE"}`))
+	assert.Equal(t, http.StatusBadRequest, post("confirm", "call-1", `{"outcome": "MAYBE"}`))
+	assert.Equal(t, http.StatusAccepted, post("confirm", "call-1", `{"outcome": "MODIFY", "modifiedArgs": {"file_path": "modified.txt", "content": "Hello"}}`))
+
+	events = readUntil(t, conn, "run_finished")
+	for _, event := range events {
+		if event.Type == "tool_call_end" {
+			payload := event.Payload.(map[string]any)
+			assert.Equal(t, "wrote modified.txt", payload["Result"])
+		}
+	}
+	assert.Equal(t, "done", finalResponse(events))
+}
+
+func TestToolConfirmation_WebSocket(t *testing.T) {
+	_, httpServer := newTestServerWithModel(t, func(ctx context.Context, contents ...*types.Content) (<-chan any, error) {
+		eventChan := make(chan any)
+		go func() {
+			defer close(eventChan)
+			if len(contents) == 1 {
+				eventChan <- types.Part{FunctionCall: &types.FunctionCall{
+					Name: types.WRITE_FILE_TOOL_NAME,
+					Args: map[string]any{"file_path": "cancelled.txt", "content": "Hello"},
+				}}
+			} else {
+				eventChan <- types.Part{Text: "cancelled"}
+			}
+		}()
+		return eventChan, nil
+	})
+	conn := dial(t, httpServer)
+
+	send(t, conn, ClientMessage{Type: ClientMessagePrompt, SessionID: "confirm", Prompt: "write it"})
+	events := readUntil(t, conn, "tool_confirmation_request")
+	request := events[len(events)-1].Payload.(map[string]any)
+
+	send(t, conn, ClientMessage{Type: ClientMessageToolConfirmation, SessionID: "confirm", ToolCallID: request["ToolCallID"].(string), Outcome: types.ToolConfirmationOutcomeCancel})
+	events = readUntil(t, conn, "run_finished")
+	assert.Equal(t, "cancelled", finalResponse(events))
+}
+
+func TestTaskWebhook_ParallelSessionsAreIsolated(t *testing.T) {
+	srv, httpServer := newTestServer(t)
+
+	const tasks = 8
+	sessionIDs := make([]string, tasks)
+	var wg sync.WaitGroup
+	for i := 0; i < tasks; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			body := fmt.Sprintf(`{"prompt": "task %d"}`, i)
+			resp, err := http.Post(httpServer.URL+"/api/v1/tasks", "application/json", strings.NewReader(body))
+			require.NoError(t, err)
+			defer resp.Body.Close()
+			require.Equal(t, http.StatusAccepted, resp.StatusCode)
+			var accepted map[string]string
+			require.NoError(t, json.NewDecoder(resp.Body).Decode(&accepted))
+			sessionIDs[i] = accepted["sessionId"]
+		}(i)
+	}
+	wg.Wait()
+
+	for i, sessionID := range sessionIDs {
+		require.Eventually(t, func() bool { return !srv.isRunning(sessionID) }, 5*time.Second, 10*time.Millisecond)
+		history, err := srv.SessionService.LoadHistory(sessionID)
+		require.NoError(t, err)
+		require.Len(t, history, 2, "session %s must only hold its own task", sessionID)
+		assert.Equal(t, fmt.Sprintf("task %d", i), history[0].Parts[0].Text)
+		assert.Equal(t, fmt.Sprintf("echo: task %d", i), history[1].Parts[0].Text)
+	}
+	assert.Equal(t, tasks, srv.Sessions.Len())
+}
+
+func TestSessionForkAndRewind_REST(t *testing.T) {
+	srv, httpServer := newTestServer(t)
+	conn := dial(t, httpServer)
+	for _, prompt := range []string{"first", "second"} {
+		send(t, conn, ClientMessage{Type: ClientMessagePrompt, SessionID: "original", Prompt: prompt})
+		readUntil(t, conn, "run_finished")
+	}
+
+	post := func(path, body string, response any) int {
+		resp, err := http.Post(httpServer.URL+"/api/v1/sessions/"+path, "application/json", strings.NewReader(body))
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		if response != nil && resp.StatusCode < 300 {
+			require.NoError(t, json.NewDecoder(resp.Body).Decode(response))
+		}
+		return resp.StatusCode
+	}
+
+	var fork struct {
+		SessionID string `json:"sessionId"`
+		ParentID  string `json:"parentId"`
+		Index     int    `json:"index"`
+	}
+	assert.Equal(t, http.StatusCreated, post("original/fork", `{"index": 2}`, &fork))
+	assert.Equal(t, "original", fork.ParentID)
+	forkHistory, err := srv.SessionService.LoadHistory(fork.SessionID)
+	require.NoError(t, err)
+	require.Len(t, forkHistory, 2)
+	assert.Equal(t, "first", forkHistory[0].Parts[0].Text)
+	metadata, err := srv.SessionService.GetMetadata(fork.SessionID)
+	require.NoError(t, err)
+	assert.Equal(t, "original", metadata.ParentID)
+
+	// The fork continues on its own.
+	send(t, conn, ClientMessage{Type: ClientMessagePrompt, SessionID: fork.SessionID, Prompt: "other"})
+	assert.Equal(t, "echo: other", finalResponse(readUntil(t, conn, "run_finished")))
+
+	var rewind struct {
+		MessageCount int `json:"messageCount"`
+	}
+	assert.Equal(t, http.StatusOK, post("original/rewind", "", &rewind))
+	assert.Equal(t, 2, rewind.MessageCount)
+	original, err := srv.SessionService.LoadHistory("original")
+	require.NoError(t, err)
+	assert.Equal(t, "echo: first", original[len(original)-1].Parts[0].Text)
+
+	assert.Equal(t, http.StatusNotFound, post("unknown/fork", "", nil))
+	assert.Equal(t, http.StatusBadRequest, post("original/fork", `{"index": 9}`, nil))
+	assert.Equal(t, http.StatusBadRequest, post("original/rewind", `{"turns": 5}`, nil))
+
+	srv.runsMu.Lock()
+	srv.runs["original"] = func() {}
+	srv.runsMu.Unlock()
+	assert.Equal(t, http.StatusConflict, post("original/rewind", "", nil), "a session with a prompt in progress cannot be rewound")
+	srv.finishRun("original")
+}
+
+func TestWebSocket_EvictedSessionKeepsSequence(t *testing.T) {
+	srv, httpServer := newTestServer(t)
+	prompter, watcher := dial(t, httpServer), dial(t, httpServer)
+	send(t, prompter, ClientMessage{Type: ClientMessagePrompt, SessionID: "evicted", Prompt: "first"})
+	first := readUntil(t, prompter, "run_finished")
+	lastSeq := first[len(first)-1].Seq
+	send(t, watcher, ClientMessage{Type: ClientMessageResume, SessionID: "evicted", LastSeq: lastSeq})
+	readUntil(t, watcher, "resumed")
+
+	srv.Sessions.now = func() time.Time { return time.Now().Add(24 * time.Hour) }
+	require.Equal(t, 1, srv.Sessions.EvictIdle())
+	srv.Sessions.now = time.Now
+
+	// Both clients keep receiving the session's events, numbered after the
+	// events they have already seen.
+	send(t, prompter, ClientMessage{Type: ClientMessagePrompt, SessionID: "evicted", Prompt: "second"})
+	for _, conn := range []*websocket.Conn{prompter, watcher} {
+		events := readUntil(t, conn, "run_finished")
+		var seqs []int64
+		for _, event := range events {
+			if event.Seq != 0 {
+				seqs = append(seqs, event.Seq)
+			}
+		}
+		require.NotEmpty(t, seqs)
+		assert.Equal(t, lastSeq+1, seqs[0], "no sequence numbers should be reused or skipped")
+		assert.Equal(t, "echo: second", finalResponse(events))
+	}
+
+	// The replay buffer was freed, so a resume from before the eviction is truncated.
+	late := dial(t, httpServer)
+	send(t, late, ClientMessage{Type: ClientMessageResume, SessionID: "evicted", LastSeq: 1})
+	resumed := readUntil(t, late, "resumed")
+	assert.Equal(t, true, resumed[len(resumed)-1].Payload.(map[string]any)["truncated"])
+}
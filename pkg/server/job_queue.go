@@ -0,0 +1,292 @@
+package server
+
+import (
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"go-ai-agent-v2/go-cli/pkg/services"
+)
+
+const (
+	// DefaultTaskWorkers is the number of webhook tasks that run at the same time.
+	DefaultTaskWorkers = 4
+	// DefaultTaskMaxAttempts is how many times a task is tried when the executor fails transiently.
+	DefaultTaskMaxAttempts = 3
+	// DefaultTaskRetryBackoff is the delay before the first retry; it doubles with every attempt.
+	DefaultTaskRetryBackoff = 5 * time.Second
+	// maxTaskRetryDelay bounds the doubling delay between retries.
+	maxTaskRetryDelay = 10 * time.Minute
+)
+
+// ErrJobNotQueued is returned by JobQueue.Cancel for a job that is not waiting in the queue.
+var ErrJobNotQueued = errors.New("job is not queued")
+
+// ErrJobInterrupted is the error of a job that a previous run of the server
+// left unfinished and that cannot be run again: it had started tool calls or
+// used up its attempts.
+var ErrJobInterrupted = errors.New("job was interrupted and cannot be retried")
+
+// JobRunner runs a job to completion and returns the error it ended with.
+type JobRunner func(job *services.Job) error
+
+// JobQueue runs jobs on a bounded pool of workers, highest priority first.
+// Jobs are kept in a JobStore until they finish, so that they survive a
+// restart, and are retried with exponential backoff on transient errors.
+type JobQueue struct {
+	mu          sync.Mutex
+	store       services.JobStore
+	pending     []*services.Job
+	run         JobRunner
+	onRetry     func(job *services.Job, err error, delay time.Duration)
+	onFinish    func(job *services.Job, err error)
+	workers     int
+	maxAttempts int
+	backoff     time.Duration
+	wake        chan struct{}
+	stop        chan struct{}
+	wg          sync.WaitGroup
+}
+
+// NewJobQueue creates a JobQueue. Non-positive values select
+// DefaultTaskWorkers, DefaultTaskMaxAttempts and DefaultTaskRetryBackoff.
+func NewJobQueue(store services.JobStore, run JobRunner, workers, maxAttempts int, backoff time.Duration) *JobQueue {
+	if workers <= 0 {
+		workers = DefaultTaskWorkers
+	}
+	if maxAttempts <= 0 {
+		maxAttempts = DefaultTaskMaxAttempts
+	}
+	if backoff <= 0 {
+		backoff = DefaultTaskRetryBackoff
+	}
+	return &JobQueue{
+		store:       store,
+		run:         run,
+		workers:     workers,
+		maxAttempts: maxAttempts,
+		backoff:     backoff,
+		wake:        make(chan struct{}, workers),
+		stop:        make(chan struct{}),
+	}
+}
+
+// OnRetry registers a function called when a job is put back in the queue after a transient error.
+func (q *JobQueue) OnRetry(fn func(job *services.Job, err error, delay time.Duration)) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.onRetry = fn
+}
+
+// OnFinish registers a function called when a job leaves the queue for good.
+func (q *JobQueue) OnFinish(fn func(job *services.Job, err error)) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.onFinish = fn
+}
+
+// Recover queues the jobs left in the store by a previous run and returns
+// them. Jobs that were interrupted after starting tool calls, or in their
+// last attempt, are removed from the store and returned as interrupted
+// instead, since running them again could repeat side effects or exceed
+// maxAttempts.
+func (q *JobQueue) Recover() (queued, interrupted []*services.Job, err error) {
+	jobs, err := q.store.List()
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, job := range jobs {
+		if job.ToolCalls == 0 && job.Attempts < q.maxAttempts {
+			queued = append(queued, job)
+			continue
+		}
+		if err := q.store.Delete(job.ID); err != nil {
+			log.Printf("Error deleting job %s: %v", job.ID, err)
+		}
+		interrupted = append(interrupted, job)
+	}
+	q.mu.Lock()
+	q.pending = append(q.pending, queued...)
+	q.mu.Unlock()
+	return queued, interrupted, nil
+}
+
+// Start starts the workers.
+func (q *JobQueue) Start() {
+	for i := 0; i < q.workers; i++ {
+		q.wg.Add(1)
+		go q.worker()
+	}
+}
+
+// Stop stops the workers once they finish their current job.
+func (q *JobQueue) Stop() {
+	close(q.stop)
+	q.wg.Wait()
+}
+
+// Enqueue stores a job and queues it.
+func (q *JobQueue) Enqueue(job *services.Job) error {
+	if err := q.store.Save(job); err != nil {
+		return err
+	}
+	q.mu.Lock()
+	q.pending = append(q.pending, job)
+	q.mu.Unlock()
+	q.notify()
+	return nil
+}
+
+// Cancel removes a job that is waiting in the queue.
+func (q *JobQueue) Cancel(jobID string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for i, job := range q.pending {
+		if job.ID == jobID {
+			q.pending = append(q.pending[:i], q.pending[i+1:]...)
+			return q.store.Delete(jobID)
+		}
+	}
+	return ErrJobNotQueued
+}
+
+// RecordToolCall counts a tool call started by a running job and saves the
+// job, so that it is not run again if the server stops before it finishes.
+func (q *JobQueue) RecordToolCall(job *services.Job) {
+	job.ToolCalls++
+	if err := q.store.Save(job); err != nil {
+		log.Printf("Error saving job %s: %v", job.ID, err)
+	}
+}
+
+// Len returns the number of jobs waiting in the queue.
+func (q *JobQueue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.pending)
+}
+
+func (q *JobQueue) notify() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (q *JobQueue) worker() {
+	defer q.wg.Done()
+	for {
+		job, wait := q.next()
+		if job != nil {
+			q.runJob(job)
+			continue
+		}
+
+		var timer *time.Timer
+		var retry <-chan time.Time
+		if wait > 0 {
+			timer = time.NewTimer(wait)
+			retry = timer.C
+		}
+		select {
+		case <-q.wake:
+		case <-retry:
+		case <-q.stop:
+			return
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+	}
+}
+
+// next takes the job to run from the queue: the one with the highest priority
+// among those not waiting for a retry, oldest first. When there is none, it
+// returns how long until a retry is due, or 0 if none is.
+func (q *JobQueue) next() (*services.Job, time.Duration) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	now := time.Now()
+	best := -1
+	var wait time.Duration
+	for i, job := range q.pending {
+		if job.NotBefore.After(now) {
+			if until := job.NotBefore.Sub(now); wait == 0 || until < wait {
+				wait = until
+			}
+			continue
+		}
+		if best < 0 || job.Priority > q.pending[best].Priority ||
+			(job.Priority == q.pending[best].Priority && job.CreatedAt.Before(q.pending[best].CreatedAt)) {
+			best = i
+		}
+	}
+	if best < 0 {
+		return nil, wait
+	}
+
+	job := q.pending[best]
+	q.pending = append(q.pending[:best], q.pending[best+1:]...)
+	job.Attempts++
+	job.ToolCalls = 0
+	if err := q.store.Save(job); err != nil {
+		log.Printf("Error saving job %s: %v", job.ID, err)
+	}
+	return job, 0
+}
+
+// runJob runs a job and either queues it again or removes it from the store.
+// A job is only retried when its attempt started no tool call, since tools
+// may have side effects that must not run twice.
+func (q *JobQueue) runJob(job *services.Job) {
+	err := q.run(job)
+
+	q.mu.Lock()
+	onRetry, onFinish := q.onRetry, q.onFinish
+	q.mu.Unlock()
+
+	if isRetryable(err) && job.ToolCalls > 0 {
+		log.Printf("Job %s failed with a transient error after %d tool calls, not retrying: %v", job.ID, job.ToolCalls, err)
+	}
+	if isRetryable(err) && job.ToolCalls == 0 && job.Attempts < q.maxAttempts {
+		delay := q.retryDelay(job.Attempts)
+		job.NotBefore = time.Now().Add(delay)
+		if saveErr := q.store.Save(job); saveErr != nil {
+			log.Printf("Error saving job %s: %v", job.ID, saveErr)
+		}
+		log.Printf("Job %s failed with a transient error, retrying in %s: %v", job.ID, delay, err)
+		if onRetry != nil {
+			onRetry(job, err, delay)
+		}
+
+		q.mu.Lock()
+		q.pending = append(q.pending, job)
+		q.mu.Unlock()
+		q.notify()
+		return
+	}
+
+	if deleteErr := q.store.Delete(job.ID); deleteErr != nil {
+		log.Printf("Error deleting job %s: %v", job.ID, deleteErr)
+	}
+	if onFinish != nil {
+		onFinish(job, err)
+	}
+}
+
+// retryDelay returns the delay before the retry that follows an attempt: the
+// backoff, doubled for every earlier attempt, up to maxTaskRetryDelay.
+func (q *JobQueue) retryDelay(attempt int) time.Duration {
+	delay := q.backoff
+	for i := 1; i < attempt && delay < maxTaskRetryDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, maxTaskRetryDelay)
+}
+
+// isRetryable reports whether a job that failed with err may succeed later.
+func isRetryable(err error) bool {
+	return services.IsTransientError(err) || errors.Is(err, ErrTooManySessions)
+}
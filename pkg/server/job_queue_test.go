@@ -0,0 +1,205 @@
+package server
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"go-ai-agent-v2/go-cli/pkg/services"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/api/googleapi"
+)
+
+// recordingRunner records the IDs of the jobs it runs and fails each job with
+// the errors queued for it, one per attempt.
+type recordingRunner struct {
+	mu     sync.Mutex
+	ran    []string
+	errors map[string][]error
+}
+
+func (r *recordingRunner) run(job *services.Job) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.ran = append(r.ran, job.ID)
+	if errs := r.errors[job.ID]; len(errs) > 0 {
+		r.errors[job.ID] = errs[1:]
+		return errs[0]
+	}
+	return nil
+}
+
+func (r *recordingRunner) runs() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.ran...)
+}
+
+// finishedJobs collects the jobs a queue finishes.
+func finishedJobs(q *JobQueue) <-chan *services.Job {
+	finished := make(chan *services.Job, 10)
+	q.OnFinish(func(job *services.Job, err error) { finished <- job })
+	return finished
+}
+
+func waitForJobs(t *testing.T, finished <-chan *services.Job, n int) []*services.Job {
+	var jobs []*services.Job
+	for len(jobs) < n {
+		select {
+		case job := <-finished:
+			jobs = append(jobs, job)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("only %d of %d jobs finished", len(jobs), n)
+		}
+	}
+	return jobs
+}
+
+func TestJobQueue_RunsHighestPriorityFirst(t *testing.T) {
+	runner := &recordingRunner{}
+	q := NewJobQueue(services.NewMemoryJobStore(), runner.run, 1, 0, 0)
+	finished := finishedJobs(q)
+
+	created := time.Now()
+	for i, priority := range []int{0, 5, 1, 5} {
+		require.NoError(t, q.Enqueue(&services.Job{
+			ID:        fmt.Sprintf("job-%d", i),
+			Priority:  priority,
+			CreatedAt: created.Add(time.Duration(i) * time.Millisecond),
+		}))
+	}
+	q.Start()
+	defer q.Stop()
+
+	waitForJobs(t, finished, 4)
+	assert.Equal(t, []string{"job-1", "job-3", "job-2", "job-0"}, runner.runs())
+}
+
+func TestJobQueue_RetriesTransientErrors(t *testing.T) {
+	transient := &googleapi.Error{Code: 503}
+	runner := &recordingRunner{errors: map[string][]error{
+		"flaky":     {transient},
+		"exhausted": {transient, transient, transient},
+		"broken":    {fmt.Errorf("invalid prompt")},
+	}}
+	store := services.NewMemoryJobStore()
+	q := NewJobQueue(store, runner.run, 2, 3, time.Millisecond)
+	finished := finishedJobs(q)
+	var retries []string
+	var retriesMu sync.Mutex
+	q.OnRetry(func(job *services.Job, err error, delay time.Duration) {
+		retriesMu.Lock()
+		defer retriesMu.Unlock()
+		retries = append(retries, fmt.Sprintf("%s after %s", job.ID, delay))
+	})
+
+	q.Start()
+	defer q.Stop()
+	for _, id := range []string{"flaky", "exhausted", "broken"} {
+		require.NoError(t, q.Enqueue(&services.Job{ID: id, CreatedAt: time.Now()}))
+	}
+
+	attempts := make(map[string]int)
+	for _, job := range waitForJobs(t, finished, 3) {
+		attempts[job.ID] = job.Attempts
+	}
+	assert.Equal(t, map[string]int{"flaky": 2, "exhausted": 3, "broken": 1}, attempts)
+	assert.ElementsMatch(t, []string{"flaky after 1ms", "exhausted after 1ms", "exhausted after 2ms"}, retries)
+
+	jobs, err := store.List()
+	require.NoError(t, err)
+	assert.Empty(t, jobs, "finished jobs must be removed from the store")
+}
+
+func TestJobQueue_DoesNotRetryAfterToolCalls(t *testing.T) {
+	transient := &googleapi.Error{Code: 503}
+	runner := &recordingRunner{errors: map[string][]error{"tools": {transient, transient}}}
+	run := func(job *services.Job) error {
+		// The first attempt started a tool call before failing.
+		job.ToolCalls = 1
+		return runner.run(job)
+	}
+	q := NewJobQueue(services.NewMemoryJobStore(), run, 1, 3, time.Millisecond)
+	finished := finishedJobs(q)
+	q.Start()
+	defer q.Stop()
+	require.NoError(t, q.Enqueue(&services.Job{ID: "tools", CreatedAt: time.Now()}))
+
+	jobs := waitForJobs(t, finished, 1)
+	assert.Equal(t, 1, jobs[0].Attempts)
+	assert.Equal(t, []string{"tools"}, runner.runs())
+}
+
+func TestJobQueue_RetryDelayIsCapped(t *testing.T) {
+	q := NewJobQueue(services.NewMemoryJobStore(), (&recordingRunner{}).run, 1, 100, time.Second)
+	assert.Equal(t, time.Second, q.retryDelay(1))
+	assert.Equal(t, 8*time.Second, q.retryDelay(4))
+	assert.Equal(t, maxTaskRetryDelay, q.retryDelay(20))
+	assert.Equal(t, maxTaskRetryDelay, q.retryDelay(99))
+}
+
+func TestJobQueue_RecoversStoredJobs(t *testing.T) {
+	store, err := services.NewFileJobStore(t.TempDir())
+	require.NoError(t, err)
+
+	// A server that stops before running its jobs leaves them in the store.
+	first := NewJobQueue(store, func(job *services.Job) error { return nil }, 1, 0, 0)
+	require.NoError(t, first.Enqueue(&services.Job{ID: "left-over", Prompt: "resume me", CreatedAt: time.Now()}))
+
+	runner := &recordingRunner{}
+	second := NewJobQueue(store, runner.run, 1, 0, 0)
+	finished := finishedJobs(second)
+	recovered, interrupted, err := second.Recover()
+	require.NoError(t, err)
+	require.Len(t, recovered, 1)
+	assert.Empty(t, interrupted)
+	assert.Equal(t, "resume me", recovered[0].Prompt)
+
+	second.Start()
+	defer second.Stop()
+	waitForJobs(t, finished, 1)
+	assert.Equal(t, []string{"left-over"}, runner.runs())
+}
+
+func TestJobQueue_DoesNotRecoverInterruptedJobs(t *testing.T) {
+	store := services.NewMemoryJobStore()
+	first := NewJobQueue(store, func(job *services.Job) error { return nil }, 1, 2, 0)
+	require.NoError(t, first.Enqueue(&services.Job{ID: "waiting", CreatedAt: time.Now()}))
+	// A server that stops while these jobs run leaves them in the store.
+	toolsRan := &services.Job{ID: "tools-ran", Attempts: 1, CreatedAt: time.Now()}
+	require.NoError(t, store.Save(toolsRan))
+	first.RecordToolCall(toolsRan)
+	require.NoError(t, store.Save(&services.Job{ID: "last-attempt", Attempts: 2, CreatedAt: time.Now()}))
+
+	second := NewJobQueue(store, func(job *services.Job) error { return nil }, 1, 2, 0)
+	recovered, interrupted, err := second.Recover()
+	require.NoError(t, err)
+	require.Len(t, recovered, 1)
+	assert.Equal(t, "waiting", recovered[0].ID)
+	var ids []string
+	for _, job := range interrupted {
+		ids = append(ids, job.ID)
+	}
+	assert.ElementsMatch(t, []string{"tools-ran", "last-attempt"}, ids)
+
+	jobs, err := store.List()
+	require.NoError(t, err)
+	require.Len(t, jobs, 1, "interrupted jobs are removed from the store")
+	assert.Equal(t, 1, second.Len())
+}
+
+func TestJobQueue_Cancel(t *testing.T) {
+	store := services.NewMemoryJobStore()
+	q := NewJobQueue(store, func(job *services.Job) error { return nil }, 1, 0, 0)
+	require.NoError(t, q.Enqueue(&services.Job{ID: "queued", CreatedAt: time.Now()}))
+
+	require.NoError(t, q.Cancel("queued"))
+	assert.ErrorIs(t, q.Cancel("queued"), ErrJobNotQueued)
+	assert.Equal(t, 0, q.Len())
+	jobs, err := store.List()
+	require.NoError(t, err)
+	assert.Empty(t, jobs)
+}
@@ -1,29 +1,61 @@
 package server
 
 import (
+	"context"
+	"fmt"
 	"log"
 	"net/http"
+	"sync"
+	"time"
 
-	"go-ai-agent-v2/go-cli/pkg/services"
 	"github.com/gorilla/mux"
+	"go-ai-agent-v2/go-cli/pkg/services"
 )
 
 // Server holds the dependencies for the HTTP server.
 type Server struct {
-	Router        *mux.Router
-	Broadcaster   *Broadcaster
-	ChatService   *services.ChatService
+	Router         *mux.Router
+	Broadcaster    *Broadcaster
+	Sessions       *SessionManager
+	Tasks          *TaskStore
+	Jobs           *JobQueue
 	SessionService *services.SessionService
+	// Auth authenticates requests; by default every request is allowed.
+	Auth *Authenticator
+
+	runsMu sync.Mutex
+	runs   map[string]context.CancelFunc // cancels the prompt in progress, by session ID
+}
+
+// TaskQueueOptions configures how webhook tasks are queued and run. Zero
+// values select the defaults of NewJobQueue; a nil Store keeps tasks in memory.
+type TaskQueueOptions struct {
+	Store        services.JobStore
+	Workers      int
+	MaxAttempts  int
+	RetryBackoff time.Duration
 }
 
 // NewServer creates a new Server instance.
-func NewServer(chatService *services.ChatService, sessionService *services.SessionService) *Server {
+func NewServer(sessions *SessionManager, sessionService *services.SessionService, queueOptions TaskQueueOptions) *Server {
 	s := &Server{
-		Router:        mux.NewRouter(),
-		Broadcaster:   NewBroadcaster(),
-		ChatService:   chatService,
+		Router:         mux.NewRouter(),
+		Broadcaster:    NewBroadcaster(),
+		Sessions:       sessions,
+		Tasks:          NewTaskStore(),
 		SessionService: sessionService,
+		Auth:           NewAuthenticator(nil),
+		runs:           make(map[string]context.CancelFunc),
 	}
+	// An evicted session is reloaded from the session store, so its replay buffer can go.
+	sessions.OnEvict(s.Broadcaster.ReleaseSession)
+
+	if queueOptions.Store == nil {
+		queueOptions.Store = services.NewMemoryJobStore()
+	}
+	s.Jobs = NewJobQueue(queueOptions.Store, s.runTask, queueOptions.Workers, queueOptions.MaxAttempts, queueOptions.RetryBackoff)
+	s.Jobs.OnRetry(func(job *services.Job, err error, delay time.Duration) { s.Tasks.Requeue(job.ID, err) })
+	s.Jobs.OnFinish(func(job *services.Job, err error) { s.finishTask(job.ID, err) })
 	s.routes()
 	return s
 }
@@ -31,13 +63,54 @@ func NewServer(chatService *services.ChatService, sessionService *services.Sessi
 // Start starts the HTTP server on the specified address.
 func (s *Server) Start(addr string) {
 	log.Printf("Agent server listening on %s", addr)
+	go s.Sessions.RunEviction(time.Minute, nil)
+	if err := s.StartTaskQueue(); err != nil {
+		log.Fatalf("Failed to start task queue: %v", err)
+	}
 	if err := http.ListenAndServe(addr, s.Router); err != nil {
 		log.Fatalf("Failed to start server: %v", err)
 	}
 }
 
+// StartTaskQueue queues the tasks left over by a previous run of the server
+// and starts the task workers. Tasks that cannot be run again fail with
+// ErrJobInterrupted.
+func (s *Server) StartTaskQueue() error {
+	jobs, interrupted, err := s.Jobs.Recover()
+	if err != nil {
+		return err
+	}
+	for _, job := range append(jobs, interrupted...) {
+		s.Tasks.Create(job)
+		if job.Owner != "" {
+			s.Sessions.Claim(job.ID, job.Owner)
+		}
+	}
+	for _, job := range interrupted {
+		s.finishTask(job.ID, fmt.Errorf("%w after %d attempts and %d tool calls", ErrJobInterrupted, job.Attempts, job.ToolCalls))
+	}
+	if len(jobs) > 0 || len(interrupted) > 0 {
+		log.Printf("Recovered %d queued tasks, %d interrupted", len(jobs), len(interrupted))
+	}
+	s.Jobs.Start()
+	return nil
+}
+
 // routes sets up the routes for the server.
 func (s *Server) routes() {
-	s.Router.HandleFunc("/ws", s.handleWebSocket())
-	s.Router.HandleFunc("/api/v1/tasks", s.handleTaskWebhook()).Methods("POST")
+	s.Router.HandleFunc("/ws", s.requireScope(ScopeEventsRead, false, s.handleWebSocket()))
+	s.Router.HandleFunc("/api/v1/tasks", s.requireScope(ScopeTasksWrite, true, s.handleTaskWebhook())).Methods("POST")
+	s.Router.HandleFunc("/api/v1/tasks/{id}", s.requireScope(ScopeEventsRead, false, s.handleGetTask())).Methods("GET")
+	s.Router.HandleFunc("/api/v1/tasks/{id}", s.requireScope(ScopeTasksWrite, false, s.handleCancelTask())).Methods("DELETE")
+	s.Router.HandleFunc("/api/v1/sessions/{id}/confirmations/{toolCallId}", s.requireScope(ScopeToolsApprove, false, s.handleToolConfirmation())).Methods("POST")
+	s.Router.HandleFunc("/api/v1/sessions/{id}/fork", s.requireScope(ScopeTasksWrite, false, s.handleForkSession())).Methods("POST")
+	s.Router.HandleFunc("/api/v1/sessions/{id}/rewind", s.requireScope(ScopeTasksWrite, false, s.handleRewindSession())).Methods("POST")
+}
+
+// requireScope defers to s.Auth when the request comes in, so that Auth can be
+// replaced after NewServer.
+func (s *Server) requireScope(scope string, signed bool, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s.Auth.RequireScope(scope, signed, next)(w, r)
+	}
 }
@@ -0,0 +1,213 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"go-ai-agent-v2/go-cli/pkg/services"
+)
+
+const (
+	// DefaultMaxSessions is the number of sessions kept in memory at the same time.
+	DefaultMaxSessions = 16
+	// DefaultSessionIdleTimeout is how long a session without a prompt in progress is kept in memory.
+	DefaultSessionIdleTimeout = 30 * time.Minute
+)
+
+// ErrTooManySessions is returned by SessionManager.Acquire when every session
+// slot is taken by a session with a prompt in progress.
+var ErrTooManySessions = errors.New("too many concurrent sessions")
+
+// ErrSessionForbidden is returned for requests about a session owned by another principal.
+var ErrSessionForbidden = errors.New("session belongs to another principal")
+
+// ChatServiceFactory creates the ChatService, and with it the executor, of a new session.
+type ChatServiceFactory func() (*services.ChatService, error)
+
+// managedSession is a ChatService owned by one session.
+type managedSession struct {
+	chatService *services.ChatService
+	lastUsed    time.Time
+	active      int // Prompts in progress; active sessions are never evicted
+}
+
+// SessionManager gives every session its own ChatService, so that concurrent
+// sessions do not share history or tool approvals. Idle sessions are evicted
+// and recreated on demand; their history is reloaded from the session store.
+// Every session belongs to the principal that used it first, so that other
+// callers cannot read its events or send it prompts.
+type SessionManager struct {
+	mu          sync.Mutex
+	factory     ChatServiceFactory
+	sessions    map[string]*managedSession
+	owners      map[string]string // Principal names by session ID, kept when sessions are evicted
+	maxSessions int
+	idleTimeout time.Duration
+	onEvict     func(sessionID string)
+	now         func() time.Time
+}
+
+// NewSessionManager creates a SessionManager that keeps at most maxSessions
+// sessions and evicts those idle for longer than idleTimeout. Non-positive
+// values select DefaultMaxSessions and DefaultSessionIdleTimeout.
+func NewSessionManager(factory ChatServiceFactory, maxSessions int, idleTimeout time.Duration) *SessionManager {
+	if maxSessions <= 0 {
+		maxSessions = DefaultMaxSessions
+	}
+	if idleTimeout <= 0 {
+		idleTimeout = DefaultSessionIdleTimeout
+	}
+	return &SessionManager{
+		factory:     factory,
+		sessions:    make(map[string]*managedSession),
+		owners:      make(map[string]string),
+		maxSessions: maxSessions,
+		idleTimeout: idleTimeout,
+		now:         time.Now,
+	}
+}
+
+// OnEvict registers a function called with the ID of every evicted session.
+func (m *SessionManager) OnEvict(fn func(sessionID string)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.onEvict = fn
+}
+
+// Claim makes owner the owner of a session that has none and reports whether
+// the session belongs to owner.
+func (m *SessionManager) Claim(sessionID, owner string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if current, ok := m.owners[sessionID]; ok {
+		return current == owner
+	}
+	m.owners[sessionID] = owner
+	return true
+}
+
+// CanAccess reports whether owner may use a session: it belongs to owner or
+// to nobody yet.
+func (m *SessionManager) CanAccess(sessionID, owner string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	current, ok := m.owners[sessionID]
+	return !ok || current == owner
+}
+
+// Acquire returns the ChatService of a session, creating it if needed, and
+// marks the session active until the matching Release. When all slots are
+// taken, the least recently used inactive session is evicted to make room.
+func (m *SessionManager) Acquire(sessionID string) (*services.ChatService, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	session, ok := m.sessions[sessionID]
+	if !ok {
+		m.evictIdleLocked()
+		if len(m.sessions) >= m.maxSessions && !m.evictOldestLocked() {
+			return nil, fmt.Errorf("%w (limit %d)", ErrTooManySessions, m.maxSessions)
+		}
+		chatService, err := m.factory()
+		if err != nil {
+			return nil, fmt.Errorf("failed to create chat service for session %s: %w", sessionID, err)
+		}
+		session = &managedSession{chatService: chatService}
+		m.sessions[sessionID] = session
+		log.Printf("Session %s created. Total sessions: %d", sessionID, len(m.sessions))
+	}
+	session.active++
+	session.lastUsed = m.now()
+	return session.chatService, nil
+}
+
+// Release marks the end of a prompt started after Acquire.
+func (m *SessionManager) Release(sessionID string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if session, ok := m.sessions[sessionID]; ok && session.active > 0 {
+		session.active--
+		session.lastUsed = m.now()
+	}
+}
+
+// Get returns the ChatService of a session that is in memory.
+func (m *SessionManager) Get(sessionID string) (*services.ChatService, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	session, ok := m.sessions[sessionID]
+	if !ok {
+		return nil, false
+	}
+	return session.chatService, true
+}
+
+// Len returns the number of sessions in memory.
+func (m *SessionManager) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.sessions)
+}
+
+// EvictIdle removes the inactive sessions idle for longer than the idle
+// timeout and returns how many were removed.
+func (m *SessionManager) EvictIdle() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.evictIdleLocked()
+}
+
+// RunEviction calls EvictIdle periodically until stop is closed.
+func (m *SessionManager) RunEviction(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			m.EvictIdle()
+		case <-stop:
+			return
+		}
+	}
+}
+
+// evictIdleLocked implements EvictIdle. m.mu must be held.
+func (m *SessionManager) evictIdleLocked() int {
+	evicted := 0
+	for sessionID, session := range m.sessions {
+		if session.active == 0 && m.now().Sub(session.lastUsed) > m.idleTimeout {
+			m.evictLocked(sessionID)
+			evicted++
+		}
+	}
+	return evicted
+}
+
+// evictOldestLocked removes the least recently used inactive session and
+// reports whether there was one. m.mu must be held.
+func (m *SessionManager) evictOldestLocked() bool {
+	oldestID := ""
+	var oldest *managedSession
+	for sessionID, session := range m.sessions {
+		if session.active == 0 && (oldest == nil || session.lastUsed.Before(oldest.lastUsed)) {
+			oldestID, oldest = sessionID, session
+		}
+	}
+	if oldest == nil {
+		return false
+	}
+	m.evictLocked(oldestID)
+	return true
+}
+
+// evictLocked removes a session. m.mu must be held.
+func (m *SessionManager) evictLocked(sessionID string) {
+	delete(m.sessions, sessionID)
+	log.Printf("Session %s evicted. Total sessions: %d", sessionID, len(m.sessions))
+	if m.onEvict != nil {
+		m.onEvict(sessionID)
+	}
+}
@@ -0,0 +1,105 @@
+package server
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"go-ai-agent-v2/go-cli/pkg/config"
+	"go-ai-agent-v2/go-cli/pkg/core"
+	"go-ai-agent-v2/go-cli/pkg/services"
+	"go-ai-agent-v2/go-cli/pkg/types"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestSessionManager returns a SessionManager with a controllable clock.
+func newTestSessionManager(t *testing.T, maxSessions int, idleTimeout time.Duration) (*SessionManager, *time.Time) {
+	projectRoot := t.TempDir()
+	store, err := services.NewFileSessionStore(projectRoot + "/sessions")
+	require.NoError(t, err)
+	sessionService, err := services.NewSessionService(store)
+	require.NoError(t, err)
+	settingsService := new(services.MockSettingsService)
+	settingsService.On("Get", mock.Anything).Return(nil, false).Maybe()
+
+	m := NewSessionManager(func() (*services.ChatService, error) {
+		return services.NewChatService(&core.MockExecutor{}, types.NewToolRegistry(), sessionService, settingsService,
+			services.NewContextService(projectRoot), config.NewConfig(&config.ConfigParameters{}), types.GenerateContentConfig{}, nil)
+	}, maxSessions, idleTimeout)
+	now := time.Now()
+	m.now = func() time.Time { return now }
+	return m, &now
+}
+
+func TestSessionManager_IsolatesSessions(t *testing.T) {
+	m, _ := newTestSessionManager(t, 2, time.Minute)
+
+	a, err := m.Acquire("a")
+	require.NoError(t, err)
+	b, err := m.Acquire("b")
+	require.NoError(t, err)
+	assert.NotSame(t, a, b)
+	assert.NotSame(t, a.GetExecutor(), b.GetExecutor())
+
+	again, err := m.Acquire("a")
+	require.NoError(t, err)
+	assert.Same(t, a, again)
+}
+
+func TestSessionManager_CapsConcurrentSessions(t *testing.T) {
+	m, now := newTestSessionManager(t, 2, time.Hour)
+	var evicted []string
+	m.OnEvict(func(sessionID string) { evicted = append(evicted, sessionID) })
+
+	_, err := m.Acquire("a")
+	require.NoError(t, err)
+	*now = now.Add(time.Second)
+	_, err = m.Acquire("b")
+	require.NoError(t, err)
+
+	// Both sessions have a prompt in progress, so there is no room.
+	_, err = m.Acquire("c")
+	assert.ErrorIs(t, err, ErrTooManySessions)
+
+	// Once they are released, the least recently used one makes room.
+	m.Release("b")
+	*now = now.Add(time.Second)
+	m.Release("a")
+	_, err = m.Acquire("c")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"b"}, evicted)
+	assert.Equal(t, 2, m.Len())
+}
+
+func TestSessionManager_EvictsIdleSessions(t *testing.T) {
+	m, now := newTestSessionManager(t, 4, time.Minute)
+
+	for _, sessionID := range []string{"idle", "busy"} {
+		_, err := m.Acquire(sessionID)
+		require.NoError(t, err)
+	}
+	m.Release("idle")
+
+	*now = now.Add(30 * time.Second)
+	assert.Equal(t, 0, m.EvictIdle())
+
+	*now = now.Add(time.Minute)
+	assert.Equal(t, 1, m.EvictIdle())
+	_, ok := m.Get("idle")
+	assert.False(t, ok)
+	_, ok = m.Get("busy")
+	assert.True(t, ok, "sessions with a prompt in progress are never evicted")
+}
+
+func TestSessionManager_FactoryError(t *testing.T) {
+	m := NewSessionManager(func() (*services.ChatService, error) {
+		return nil, fmt.Errorf("no executor")
+	}, 0, 0)
+
+	_, err := m.Acquire("a")
+	assert.ErrorContains(t, err, "no executor")
+	assert.Equal(t, 0, m.Len())
+}
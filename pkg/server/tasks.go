@@ -0,0 +1,245 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"go-ai-agent-v2/go-cli/pkg/services"
+	"go-ai-agent-v2/go-cli/pkg/types"
+)
+
+// TaskState is the lifecycle state of a webhook task.
+type TaskState string
+
+const (
+	TaskStateQueued               TaskState = "queued"
+	TaskStateRunning              TaskState = "running"
+	TaskStateAwaitingConfirmation TaskState = "awaiting_confirmation"
+	TaskStateSucceeded            TaskState = "succeeded"
+	TaskStateFailed               TaskState = "failed"
+	TaskStateCancelled            TaskState = "cancelled"
+)
+
+const (
+	// maxFinishedTasks is the number of finished tasks kept for status requests.
+	maxFinishedTasks = 1000
+	callbackTimeout  = 10 * time.Second
+)
+
+// Finished reports whether the state is terminal.
+func (s TaskState) Finished() bool {
+	return s == TaskStateSucceeded || s == TaskStateFailed || s == TaskStateCancelled
+}
+
+// TaskToolCall is an entry of the tool-call log of a task.
+type TaskToolCall struct {
+	ToolCallID string         `json:"toolCallId"`
+	ToolName   string         `json:"toolName"`
+	Args       map[string]any `json:"args,omitempty"`
+	Result     string         `json:"result,omitempty"`
+	Error      string         `json:"error,omitempty"`
+}
+
+// TaskTokenUsage is the number of tokens a task consumed, and their cost in USD.
+type TaskTokenUsage struct {
+	InputTokens  int     `json:"inputTokens"`
+	OutputTokens int     `json:"outputTokens"`
+	CostUSD      float64 `json:"costUsd"`
+}
+
+// Task is a prompt submitted through the webhook API. Each task runs in its
+// own session, whose ID is also the task ID.
+type Task struct {
+	ID            string         `json:"id"`
+	SessionID     string         `json:"sessionId"`
+	Prompt        string         `json:"prompt"`
+	Priority      int            `json:"priority"`
+	State         TaskState      `json:"state"`
+	Attempts      int            `json:"attempts"`
+	FinalResponse string         `json:"finalResponse,omitempty"`
+	Error         string         `json:"error,omitempty"`
+	ToolCalls     []TaskToolCall `json:"toolCalls"`
+	TokenUsage    TaskTokenUsage `json:"tokenUsage"`
+	CallbackURL   string         `json:"callbackUrl,omitempty"`
+	CreatedAt     time.Time      `json:"createdAt"`
+	UpdatedAt     time.Time      `json:"updatedAt"`
+	FinishedAt    *time.Time     `json:"finishedAt,omitempty"`
+
+	cancelRequested bool
+}
+
+// TaskStore keeps the state of webhook tasks in memory.
+type TaskStore struct {
+	mu       sync.Mutex
+	tasks    map[string]*Task
+	finished []string // IDs of finished tasks, oldest first
+}
+
+// NewTaskStore creates an empty TaskStore.
+func NewTaskStore() *TaskStore {
+	return &TaskStore{tasks: make(map[string]*Task)}
+}
+
+// Create registers the queued task of a job.
+func (ts *TaskStore) Create(job *services.Job) *Task {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	task := &Task{
+		ID:          job.ID,
+		SessionID:   job.ID,
+		Prompt:      job.Prompt,
+		Priority:    job.Priority,
+		State:       TaskStateQueued,
+		Attempts:    job.Attempts,
+		ToolCalls:   []TaskToolCall{},
+		CallbackURL: job.CallbackURL,
+		CreatedAt:   job.CreatedAt,
+		UpdatedAt:   time.Now(),
+	}
+	ts.tasks[job.ID] = task
+	return task
+}
+
+// Begin marks a task as running its given attempt.
+func (ts *TaskStore) Begin(id string, attempt int) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	if task, ok := ts.tasks[id]; ok && !task.State.Finished() {
+		task.State = TaskStateRunning
+		task.Attempts = attempt
+		task.UpdatedAt = time.Now()
+	}
+}
+
+// Requeue puts a task back in the queued state after an attempt failed with
+// a transient error. The result of the failed attempt is discarded.
+func (ts *TaskStore) Requeue(id string, err error) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	if task, ok := ts.tasks[id]; ok && !task.State.Finished() {
+		task.State = TaskStateQueued
+		task.FinalResponse = ""
+		task.Error = err.Error()
+		task.UpdatedAt = time.Now()
+	}
+}
+
+// CancelRequested reports whether a client asked to cancel a task.
+func (ts *TaskStore) CancelRequested(id string) bool {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	task, ok := ts.tasks[id]
+	return ok && task.cancelRequested
+}
+
+// Get returns a copy of a task.
+func (ts *TaskStore) Get(id string) (Task, bool) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	task, ok := ts.tasks[id]
+	if !ok {
+		return Task{}, false
+	}
+	return task.snapshot(), true
+}
+
+// RequestCancel marks a task as cancelled by the client, so that the end of
+// its run is reported as cancelled rather than failed. It returns a copy of the task.
+func (ts *TaskStore) RequestCancel(id string) (Task, bool) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	task, ok := ts.tasks[id]
+	if !ok {
+		return Task{}, false
+	}
+	if !task.State.Finished() {
+		task.cancelRequested = true
+	}
+	return task.snapshot(), true
+}
+
+// Record updates a task with an event of its run.
+func (ts *TaskStore) Record(id string, event any) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	task, ok := ts.tasks[id]
+	if !ok || task.State.Finished() {
+		return
+	}
+	task.UpdatedAt = time.Now()
+
+	switch e := event.(type) {
+	case types.StreamingStartedEvent:
+		task.State = TaskStateRunning
+		task.Error = ""
+	case types.ToolCallStartEvent:
+		task.ToolCalls = append(task.ToolCalls, TaskToolCall{ToolCallID: e.ToolCallID, ToolName: e.ToolName, Args: e.Args})
+	case types.ToolConfirmationRequestEvent:
+		task.State = TaskStateAwaitingConfirmation
+	case types.ToolCallEndEvent:
+		task.State = TaskStateRunning
+		for i := range task.ToolCalls {
+			if task.ToolCalls[i].ToolCallID == e.ToolCallID {
+				task.ToolCalls[i].Result = e.Result
+				if e.Err != nil {
+					task.ToolCalls[i].Error = e.Err.Error()
+				}
+			}
+		}
+	case types.TokenCountEvent:
+		task.TokenUsage.InputTokens += e.InputTokens
+		task.TokenUsage.OutputTokens += e.OutputTokens
+		task.TokenUsage.CostUSD += e.CostUSD
+	case types.FinalResponseEvent:
+		task.FinalResponse = e.Content
+	case types.ErrorEvent:
+		if e.Err != nil {
+			task.Error = e.Err.Error()
+		}
+		if errors.Is(e.Err, context.Canceled) {
+			task.cancelRequested = true
+		}
+	}
+}
+
+// Finish moves a task to its final state once its run ended, or failed to
+// start with runErr, and returns a copy of it.
+func (ts *TaskStore) Finish(id string, runErr error) (Task, bool) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	task, ok := ts.tasks[id]
+	if !ok || task.State.Finished() {
+		return Task{}, false
+	}
+	if runErr != nil {
+		task.Error = runErr.Error()
+	}
+
+	switch {
+	case task.cancelRequested:
+		task.State = TaskStateCancelled
+	case task.Error != "":
+		task.State = TaskStateFailed
+	default:
+		task.State = TaskStateSucceeded
+	}
+	now := time.Now()
+	task.UpdatedAt = now
+	task.FinishedAt = &now
+
+	ts.finished = append(ts.finished, id)
+	if len(ts.finished) > maxFinishedTasks {
+		delete(ts.tasks, ts.finished[0])
+		ts.finished = ts.finished[1:]
+	}
+	return task.snapshot(), true
+}
+
+// snapshot returns a copy of the task that is safe to use without the lock.
+func (t *Task) snapshot() Task {
+	c := *t
+	c.ToolCalls = append([]TaskToolCall(nil), t.ToolCalls...)
+	return c
+}
@@ -0,0 +1,235 @@
+package server
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go-ai-agent-v2/go-cli/pkg/types"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeFileModel asks for one write_file call and answers "done" once it has the result.
+func writeFileModel(ctx context.Context, contents ...*types.Content) (<-chan any, error) {
+	eventChan := make(chan any)
+	go func() {
+		defer close(eventChan)
+		if len(contents) == 1 {
+			eventChan <- types.TokenCountEvent{InputTokens: 10, OutputTokens: 2}
+			eventChan <- types.Part{FunctionCall: &types.FunctionCall{
+				ID:   "call-1",
+				Name: types.WRITE_FILE_TOOL_NAME,
+				Args: map[string]any{"file_path": "task.txt", "content": "Hello"},
+			}}
+		} else {
+			eventChan <- types.TokenCountEvent{InputTokens: 20, OutputTokens: 3}
+			eventChan <- types.Part{Text: "done"}
+		}
+	}()
+	return eventChan, nil
+}
+
+func submitTask(t *testing.T, httpServer *httptest.Server, body string) string {
+	resp, err := http.Post(httpServer.URL+"/api/v1/tasks", "application/json", strings.NewReader(body))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusAccepted, resp.StatusCode)
+	var accepted map[string]string
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&accepted))
+	return accepted["taskId"]
+}
+
+func getTask(t *testing.T, httpServer *httptest.Server, taskID string) Task {
+	resp, err := http.Get(httpServer.URL + "/api/v1/tasks/" + taskID)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var task Task
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&task))
+	return task
+}
+
+// waitForTaskState polls a task until it reaches the given state.
+func waitForTaskState(t *testing.T, httpServer *httptest.Server, taskID string, state TaskState) Task {
+	var task Task
+	require.Eventually(t, func() bool {
+		task = getTask(t, httpServer, taskID)
+		return task.State == state
+	}, 5*time.Second, 10*time.Millisecond, "task never reached state %s", state)
+	return task
+}
+
+func deleteTask(t *testing.T, httpServer *httptest.Server, taskID string) int {
+	req, err := http.NewRequest(http.MethodDelete, httpServer.URL+"/api/v1/tasks/"+taskID, nil)
+	require.NoError(t, err)
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+func TestTasks_StatusAndResult(t *testing.T) {
+	srv, httpServer := newTestServerWithModel(t, writeFileModel)
+
+	taskID := submitTask(t, httpServer, `{"prompt": "write a file"}`)
+	task := waitForTaskState(t, httpServer, taskID, TaskStateAwaitingConfirmation)
+	require.Len(t, task.ToolCalls, 1)
+	assert.Equal(t, types.WRITE_FILE_TOOL_NAME, task.ToolCalls[0].ToolName)
+
+	// The tool call is saved with the job, so that a restart does not run it again.
+	jobs, err := srv.Jobs.store.List()
+	require.NoError(t, err)
+	require.Len(t, jobs, 1)
+	assert.Equal(t, 1, jobs[0].ToolCalls)
+
+	chatService, ok := srv.Sessions.Get(task.SessionID)
+	require.True(t, ok)
+	require.NoError(t, chatService.ConfirmToolCall("call-1", types.ToolConfirmation{Outcome: types.ToolConfirmationOutcomeProceedOnce}))
+
+	task = waitForTaskState(t, httpServer, taskID, TaskStateSucceeded)
+	assert.Equal(t, "write a file", task.Prompt)
+	assert.Equal(t, "done", task.FinalResponse)
+	assert.Empty(t, task.Error)
+	assert.Equal(t, "wrote task.txt", task.ToolCalls[0].Result)
+	assert.Equal(t, TaskTokenUsage{InputTokens: 30, OutputTokens: 5}, task.TokenUsage)
+	assert.NotNil(t, task.FinishedAt)
+
+	assert.Equal(t, http.StatusConflict, deleteTask(t, httpServer, taskID))
+}
+
+func TestTasks_Cancel(t *testing.T) {
+	_, httpServer := newTestServerWithModel(t, writeFileModel)
+
+	taskID := submitTask(t, httpServer, `{"prompt": "write a file"}`)
+	waitForTaskState(t, httpServer, taskID, TaskStateAwaitingConfirmation)
+
+	assert.Equal(t, http.StatusAccepted, deleteTask(t, httpServer, taskID))
+	task := waitForTaskState(t, httpServer, taskID, TaskStateCancelled)
+	assert.Empty(t, task.FinalResponse)
+}
+
+func TestTasks_Callback(t *testing.T) {
+	received := make(chan Task, 1)
+	callbackServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		assert.NoError(t, err)
+		signature := "sha256=" + hex.EncodeToString(SignBody([]byte("secret"), r.Header.Get(TimestampHeader), body))
+		assert.Equal(t, signature, r.Header.Get(SignatureHeader), "the callback must be signed with the webhook secret")
+		var task Task
+		assert.NoError(t, json.Unmarshal(body, &task))
+		received <- task
+	}))
+	defer callbackServer.Close()
+
+	srv, httpServer := newTestServer(t)
+	srv.Auth = NewAuthenticator(&types.ServerAuthSettings{
+		Tokens:               []types.ServerToken{{Name: "ci", Token: "write-token", Scopes: []string{ScopeEventsRead, ScopeTasksWrite}}},
+		WebhookSecret:        "secret",
+		CallbackAllowedHosts: []string{"127.0.0.1"},
+	})
+	req, err := http.NewRequest(http.MethodPost, httpServer.URL+"/api/v1/tasks", strings.NewReader(`{"prompt": "hello", "callbackUrl": "`+callbackServer.URL+`"}`))
+	require.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer write-token")
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusAccepted, resp.StatusCode)
+	var accepted map[string]string
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&accepted))
+
+	select {
+	case task := <-received:
+		assert.Equal(t, accepted["taskId"], task.ID)
+		assert.Equal(t, TaskStateSucceeded, task.State)
+		assert.Equal(t, "echo: hello", task.FinalResponse)
+	case <-time.After(5 * time.Second):
+		t.Fatal("callback was not called")
+	}
+}
+
+func TestTasks_CallbackDestinations(t *testing.T) {
+	_, httpServer := newTestServer(t)
+	for _, callbackURL := range []string{
+		"http://127.0.0.1:8080/hook",
+		"http://localhost/hook",
+		"http://169.254.169.254/latest/meta-data",
+		"http://10.0.0.5/hook",
+		"http://[::1]/hook",
+		"http://[::ffff:192.168.1.1]/hook",
+	} {
+		resp, err := http.Post(httpServer.URL+"/api/v1/tasks", "application/json", strings.NewReader(`{"prompt": "hi", "callbackUrl": "`+callbackURL+`"}`))
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode, callbackURL)
+	}
+
+	// Host names are checked once resolved, when the callback is sent.
+	var hits atomic.Int32
+	callbackServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { hits.Add(1) }))
+	defer callbackServer.Close()
+	auth := NewAuthenticator(nil)
+	require.NoError(t, auth.CheckCallbackURL("https://hooks.example.com/task"))
+	_, err := auth.CallbackClient().Post(callbackServer.URL, "application/json", strings.NewReader("{}"))
+	assert.ErrorIs(t, err, ErrCallbackDestination)
+	assert.Zero(t, hits.Load(), "a callback reached a loopback address")
+
+	allowed := NewAuthenticator(&types.ServerAuthSettings{CallbackAllowedHosts: []string{"127.0.0.1"}})
+	resp, err := allowed.CallbackClient().Post(callbackServer.URL, "application/json", strings.NewReader("{}"))
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, int32(1), hits.Load())
+	assert.Same(t, allowed.CallbackClient(), allowed.CallbackClient(), "callbacks share a client")
+
+	// Redirects are checked like callback URLs.
+	redirect := httptest.NewServer(http.RedirectHandler("http://localhost/hook", http.StatusFound))
+	defer redirect.Close()
+	_, err = allowed.CallbackClient().Post(redirect.URL, "application/json", strings.NewReader("{}"))
+	assert.ErrorIs(t, err, ErrCallbackDestination)
+}
+
+func TestIsPublicAddress(t *testing.T) {
+	for address, public := range map[string]bool{
+		"93.184.216.34":        true,
+		"2606:2800:220:1::248": true,
+		"127.0.0.1":            false,
+		"::1":                  false,
+		"10.1.2.3":             false,
+		"172.16.0.1":           false,
+		"192.168.0.10":         false,
+		"169.254.169.254":      false,
+		"fe80::1":              false,
+		"fd00::1":              false,
+		"100.64.0.1":           false,
+		"0.0.0.0":              false,
+		"224.0.0.1":            false,
+		"::ffff:127.0.0.1":     false,
+		"::ffff:93.184.216.34": true,
+	} {
+		assert.Equal(t, public, isPublicAddress(netip.MustParseAddr(address)), address)
+	}
+}
+
+func TestTasks_InvalidRequests(t *testing.T) {
+	_, httpServer := newTestServer(t)
+
+	resp, err := http.Get(httpServer.URL + "/api/v1/tasks/unknown")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	assert.Equal(t, http.StatusNotFound, deleteTask(t, httpServer, "unknown"))
+
+	resp, err = http.Post(httpServer.URL+"/api/v1/tasks", "application/json", strings.NewReader(`{"prompt": "hi", "callbackUrl": "ftp://example.com"}`))
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
@@ -6,17 +6,23 @@ import (
 	"fmt"
 	"go-ai-agent-v2/go-cli/pkg/telemetry"
 	"os"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"go-ai-agent-v2/go-cli/pkg/core"
 	"go-ai-agent-v2/go-cli/pkg/routing"
 	"go-ai-agent-v2/go-cli/pkg/types"
-
-	"google.golang.org/api/googleapi"
 )
 
 var EventChanKey = struct{}{}
 
+// ErrNoPendingConfirmation is returned by ConfirmToolCall when no tool call
+// with the given ID is waiting for confirmation.
+var ErrNoPendingConfirmation = errors.New("no tool confirmation is pending")
+
 // ChatService orchestrates the interactive chat session, handling the tool-calling loop.
 type ChatService struct {
 	executor             core.Executor
@@ -33,6 +39,24 @@ type ChatService struct {
 	toolErrorCounter     int
 	ToolConfirmationChan chan types.ToolConfirmationOutcome
 	userConfirmationChan chan bool
+
+	confirmationsMu      sync.Mutex
+	pendingConfirmations map[string]chan types.ToolConfirmation // by tool call ID
+
+	// The executor and model in use before the first fallback, restored after the cooldown.
+	primaryExecutor core.Executor
+	primary         types.ModelFallback
+	current         types.ModelFallback
+	fallbackDepth   int // Number of fallbacks since the primary model failed
+	fallbackAt      time.Time
+
+	// With the "auto" model, the router picks the model of each user turn.
+	router      *routing.ModelRouterService
+	routedModel string
+
+	costsMu   sync.Mutex
+	costs     *CostTracker // Created on first use
+	sessionID string       // Session of the last message, charged for compression
 }
 
 // NewChatService creates a new ChatService.
@@ -43,6 +67,7 @@ func NewChatService(executor core.Executor, toolRegistry types.ToolRegistryInter
 		generationConfig.SystemInstruction = contextContent + "\n\n" + generationConfig.SystemInstruction
 	}
 
+	executor = NewRetryingExecutor(executor, settingsService)
 	cs := &ChatService{
 		executor:             executor,
 		toolRegistry:         toolRegistry,
@@ -55,6 +80,7 @@ func NewChatService(executor core.Executor, toolRegistry types.ToolRegistryInter
 		proceedAlwaysTools:   make(map[string]bool),
 		ToolConfirmationChan: make(chan types.ToolConfirmationOutcome, 1),
 		userConfirmationChan: make(chan bool, 1),
+		pendingConfirmations: make(map[string]chan types.ToolConfirmation),
 	}
 
 	executor.SetToolConfirmationChannel(cs.ToolConfirmationChan)
@@ -84,10 +110,17 @@ func (cs *ChatService) SendMessage(ctx context.Context, sessionID string, userIn
 		Role:  "user",
 		Parts: []types.Part{{Text: userInput}},
 	})
+	cs.costsMu.Lock()
+	cs.sessionID = sessionID
+	cs.costsMu.Unlock()
 
 	go func() {
 		defer close(eventChan)
 		eventChan <- types.StreamingStartedEvent{}
+		cs.restorePrimaryModel(eventChan)
+		cs.routeTurn(ctx, eventChan)
+
+		var usage types.ModelTokenUsage // Of this message, added to the session metadata
 
 		for { // Main loop for multi-turn tool calls
 			select {
@@ -97,6 +130,12 @@ func (cs *ChatService) SendMessage(ctx context.Context, sessionID string, userIn
 			default:
 			}
 
+			if err := cs.costTracker().Check(sessionID); err != nil {
+				eventChan <- types.ErrorEvent{Err: err}
+				break
+			}
+
+			cs.fitContextWindow(ctx, eventChan, sessionID)
 			eventChan <- types.ThinkingEvent{}
 
 			stream, err := cs.executor.StreamContent(ctx, cs.history, cs.toolRegistry.GetAllTools())
@@ -122,11 +161,21 @@ func (cs *ChatService) SendMessage(ctx context.Context, sessionID string, userIn
 						eventChan <- e
 					}
 				case types.TokenCountEvent:
-					if _, ok := cs.tokenUsage[cs.executor.Name()]; !ok {
-						cs.tokenUsage[cs.executor.Name()] = &types.ModelTokenUsage{}
+					var warnings []types.BudgetWarningEvent
+					e.CostUSD, warnings = cs.recordUsage(sessionID, e.InputTokens, e.OutputTokens)
+					usage.InputTokens += e.InputTokens
+					usage.OutputTokens += e.OutputTokens
+					usage.CostUSD += e.CostUSD
+					eventChan <- e
+					for _, warning := range warnings {
+						eventChan <- warning
 					}
-					cs.tokenUsage[cs.executor.Name()].InputTokens += e.InputTokens
-					cs.tokenUsage[cs.executor.Name()].OutputTokens += e.OutputTokens
+				case types.RetryEvent:
+					// The attempt failed and is made again; drop what it streamed.
+					modelResponseParts = nil
+					functionCalls = nil
+					textResponse.Reset()
+					eventChan <- e
 				case types.ErrorEvent:
 					streamErr = e.Err
 					goto EndStream
@@ -135,56 +184,8 @@ func (cs *ChatService) SendMessage(ctx context.Context, sessionID string, userIn
 
 		EndStream:
 			if streamErr != nil {
-				currentExecutorTypeVal, _ := cs.settingsService.Get("executor")
-				currentExecutorType, ok := currentExecutorTypeVal.(string)
-				if !ok {
-					currentExecutorType = "gemini"
-				}
-
-				if strings.HasPrefix(currentExecutorType, "gemini") {
-					var apiErr *googleapi.Error
-					if errors.As(streamErr, &apiErr) && apiErr.Code == 429 {
-						telemetry.LogDebugf("Gemini Quota Exceeded error detected: %v", streamErr)
-
-						router := routing.NewModelRouterService(cs.appConfig)
-						routingCtx := &routing.RoutingContext{
-							Request:      userInput,
-							Signal:       ctx,
-							IsFallback:   true,
-							ExecutorType: "gemini",
-						}
-
-						decision, routeErr := router.Route(routingCtx, cs.appConfig)
-						if routeErr != nil || decision == nil || strings.HasPrefix(decision.Model, "gemini") {
-							eventChan <- types.ErrorEvent{
-								Err: fmt.Errorf("Quota Exceeded for Gemini. No fallback model found. Please try again later or switch models manually."),
-							}
-							return
-						}
-
-						eventChan <- types.ModelSwitchEvent{
-							OldModel: currentExecutorType,
-							NewModel: decision.Model,
-							Reason:   "Quota Exceeded",
-						}
-
-						fallbackExecutorType := "qwen"
-						executorFactory, factoryErr := core.NewExecutorFactory(fallbackExecutorType, cs.appConfig)
-						if factoryErr != nil {
-							eventChan <- types.ErrorEvent{Err: fmt.Errorf("failed to create factory for fallback model %s: %w", decision.Model, factoryErr)}
-							return
-						}
-						newExecutor, executorErr := executorFactory.NewExecutor(cs.appConfig, types.GenerateContentConfig{}, cs.history)
-						if executorErr != nil {
-							eventChan <- types.ErrorEvent{Err: fmt.Errorf("failed to create fallback executor %s: %w", decision.Model, executorErr)}
-							return
-						}
-
-						cs.executor = newExecutor
-						cs.settingsService.Set("executor", decision.Model)
-						cs.settingsService.Set("model", decision.Model)
-						continue // Re-attempt streaming with the new executor
-					}
+				if cs.switchToFallback(ctx, eventChan, streamErr) {
+					continue // Re-attempt streaming with the fallback executor
 				}
 				eventChan <- types.ErrorEvent{Err: streamErr}
 				return
@@ -193,106 +194,7 @@ func (cs *ChatService) SendMessage(ctx context.Context, sessionID string, userIn
 			cs.history = append(cs.history, &types.Content{Role: "model", Parts: modelResponseParts})
 
 			if len(functionCalls) > 0 {
-				var toolResponseParts []types.Part
-				for _, fc := range functionCalls {
-					var toolExecutionResult any = nil
-					var toolExecutionError error = nil
-					cs.toolCallCounter++
-					toolCallID := fc.ID
-
-					isDangerousTool := false
-					for _, dt := range cs.settingsService.GetDangerousTools() {
-						if fc.Name == dt {
-							isDangerousTool = true
-							break
-						}
-					}
-
-					eventChan <- types.ToolCallStartEvent{ToolCallID: toolCallID, ToolName: fc.Name, Args: fc.Args}
-
-					if isDangerousTool && !cs.proceedAlwaysTools[fc.Name] {
-						confirmationEvent := types.ToolConfirmationRequestEvent{
-							ToolCallID: toolCallID,
-							ToolName:   fc.Name,
-							ToolArgs:   fc.Args,
-							Type:       "exec",
-							Message:    fmt.Sprintf("Confirm execution of tool '%s'?", fc.Name),
-						}
-						switch fc.Name {
-						case types.USER_CONFIRM_TOOL_NAME:
-							confirmationEvent.Type = "info"
-							if msg, ok := fc.Args["message"].(string); ok {
-								confirmationEvent.Message = msg
-							}
-						case types.WRITE_FILE_TOOL_NAME:
-							confirmationEvent.Type = "edit"
-							confirmationEvent.Message = "Apply this change?"
-							if filePath, ok := fc.Args["file_path"].(string); ok {
-								confirmationEvent.FilePath = filePath
-								if newContent, ok := fc.Args["content"].(string); ok {
-									confirmationEvent.NewContent = newContent
-									if originalContentBytes, err := os.ReadFile(filePath); err == nil {
-										confirmationEvent.OriginalContent = string(originalContentBytes)
-										confirmationEvent.FileDiff = generateDiff(string(originalContentBytes), newContent)
-									}
-								}
-							}
-						}
-
-						eventChan <- confirmationEvent
-						outcome := <-cs.ToolConfirmationChan
-
-						switch outcome {
-						case types.ToolConfirmationOutcomeProceedOnce:
-							if fc.Name == types.USER_CONFIRM_TOOL_NAME {
-								toolExecutionResult = "continue"
-							} else {
-								toolExecutionResult, toolExecutionError = executeTool(context.WithValue(ctx, EventChanKey, eventChan), fc, cs.toolRegistry, cs.executor, telemetry.GlobalLogger)
-							}
-						case types.ToolConfirmationOutcomeProceedAlways:
-							cs.proceedAlwaysTools[fc.Name] = true
-							if fc.Name == types.USER_CONFIRM_TOOL_NAME {
-								toolExecutionResult = "continue"
-							} else {
-								toolExecutionResult, toolExecutionError = executeTool(context.WithValue(ctx, EventChanKey, eventChan), fc, cs.toolRegistry, cs.executor, telemetry.GlobalLogger)
-							}
-						case types.ToolConfirmationOutcomeCancel:
-							toolExecutionResult = "Tool execution cancelled by user."
-							toolExecutionError = fmt.Errorf("tool execution cancelled by user")
-							cs.toolErrorCounter++
-						default:
-							toolExecutionResult = "Unknown confirmation outcome."
-							toolExecutionError = fmt.Errorf("unknown confirmation outcome")
-							cs.toolErrorCounter++
-						}
-					} else {
-						toolExecutionResult, toolExecutionError = executeTool(context.WithValue(ctx, EventChanKey, eventChan), fc, cs.toolRegistry, cs.executor, telemetry.GlobalLogger)
-					}
-
-					if toolExecutionError == nil && fc.Name == types.WRITE_TODOS_TOOL_NAME {
-						if todosData, ok := fc.Args["todos"].([]interface{}); ok {
-							total := len(todosData)
-							completed := 0
-							for _, item := range todosData {
-								if todoMap, ok := item.(map[string]interface{}); ok {
-									if status, ok := todoMap["status"].(string); ok && status == "completed" {
-										completed++
-									}
-								}
-							}
-							eventChan <- types.TodosSummaryUpdateEvent{Summary: fmt.Sprintf("Todos %d/%d", completed, total)}
-						}
-					}
-
-					eventChan <- types.ToolCallEndEvent{ToolCallID: toolCallID, ToolName: fc.Name, Result: fmt.Sprintf("%v", toolExecutionResult), Err: toolExecutionError}
-
-					toolResponseParts = append(toolResponseParts, types.Part{
-						FunctionResponse: &types.FunctionResponse{
-							Name:     fc.Name,
-							Response: map[string]any{"result": toolExecutionResult},
-						},
-					})
-				}
+				toolResponseParts := cs.executeFunctionCalls(ctx, eventChan, functionCalls)
 				cs.history = append(cs.history, &types.Content{Role: "tool", Parts: toolResponseParts})
 				continue
 			}
@@ -306,12 +208,351 @@ func (cs *ChatService) SendMessage(ctx context.Context, sessionID string, userIn
 
 		if err := cs.sessionService.SaveHistory(sessionID, cs.history); err != nil {
 			telemetry.LogErrorf("Failed to save history: %v", err)
+			return
 		}
+		cs.updateSessionMetadata(sessionID, usage)
 	}()
 
 	return eventChan, nil
 }
 
+// DefaultMaxParallelTools is the number of read-only tool calls that run
+// concurrently when the maxParallelTools setting is not set.
+const DefaultMaxParallelTools = 4
+
+// toolCallOutcome is the result of a single tool call of a model turn.
+type toolCallOutcome struct {
+	result any
+	err    error
+}
+
+// executeFunctionCalls runs the tool calls of a model turn and returns their
+// responses in the order the model issued them. Consecutive read-only calls
+// run concurrently; edits, commands and calls needing confirmation run one at
+// a time, so they also act as a barrier between concurrent batches.
+func (cs *ChatService) executeFunctionCalls(ctx context.Context, eventChan chan any, functionCalls []*types.FunctionCall) []types.Part {
+	dangerousTools := cs.settingsService.GetDangerousTools()
+	outcomes := make([]toolCallOutcome, len(functionCalls))
+
+	for i := 0; i < len(functionCalls); {
+		if !cs.canRunInParallel(functionCalls[i], dangerousTools) {
+			fc := functionCalls[i]
+			cs.toolCallCounter++
+			outcomes[i] = cs.executeToolCall(ctx, eventChan, fc, cs.toolCallID(fc), slices.Contains(dangerousTools, fc.Name))
+			i++
+			continue
+		}
+
+		end := i + 1
+		for end < len(functionCalls) && cs.canRunInParallel(functionCalls[end], dangerousTools) {
+			end++
+		}
+		cs.executeToolCallsInParallel(ctx, eventChan, functionCalls[i:end], outcomes[i:end])
+		i = end
+	}
+
+	toolResponseParts := make([]types.Part, 0, len(functionCalls))
+	for i, fc := range functionCalls {
+		toolResponseParts = append(toolResponseParts, types.Part{
+			FunctionResponse: &types.FunctionResponse{
+				ID:       fc.ID,
+				Name:     fc.Name,
+				Response: map[string]any{"result": outcomes[i].result},
+			},
+		})
+	}
+	return toolResponseParts
+}
+
+// canRunInParallel reports whether a tool call only reads state and needs no
+// confirmation, which makes it safe to run alongside other such calls.
+func (cs *ChatService) canRunInParallel(fc *types.FunctionCall, dangerousTools []string) bool {
+	if slices.Contains(dangerousTools, fc.Name) {
+		return false
+	}
+	tool, err := cs.toolRegistry.GetTool(fc.Name)
+	if err != nil || tool == nil {
+		return false
+	}
+	switch tool.Kind() {
+	case types.KindRead, types.KindSearch, types.KindFetch:
+		return true
+	default:
+		return false
+	}
+}
+
+// toolCallID returns the ID the model gave a call, or a generated one for
+// models that do not assign IDs, so that concurrent calls stay distinguishable.
+func (cs *ChatService) toolCallID(fc *types.FunctionCall) string {
+	if fc.ID != "" {
+		return fc.ID
+	}
+	return fmt.Sprintf("%s-%d", fc.Name, cs.toolCallCounter)
+}
+
+// maxParallelTools returns the configured limit of concurrently running tool calls.
+func (cs *ChatService) maxParallelTools() int {
+	limit, ok := cs.intSetting("maxParallelTools")
+	if !ok || limit < 1 {
+		return DefaultMaxParallelTools
+	}
+	return limit
+}
+
+// intSetting returns a numeric setting of the chat service's settings.
+func (cs *ChatService) intSetting(key string) (int, bool) {
+	return IntSetting(cs.settingsService, key)
+}
+
+// floatSetting returns a fractional setting of the chat service's settings.
+func (cs *ChatService) floatSetting(key string) (float64, bool) {
+	return FloatSetting(cs.settingsService, key)
+}
+
+// IntSetting returns a numeric setting, which may have been decoded from JSON
+// or the environment as a float or a string.
+func IntSetting(settings types.SettingsServiceIface, key string) (int, bool) {
+	value, ok := settings.Get(key)
+	if !ok {
+		return 0, false
+	}
+	switch v := value.(type) {
+	case int:
+		return v, true
+	case int64:
+		return int(v), true
+	case float64:
+		return int(v), true
+	case string:
+		n, err := strconv.Atoi(v)
+		return n, err == nil
+	}
+	return 0, false
+}
+
+// FloatSetting returns a fractional setting, which may have been decoded from
+// JSON or the environment as an int or a string.
+func FloatSetting(settings types.SettingsServiceIface, key string) (float64, bool) {
+	value, ok := settings.Get(key)
+	if !ok {
+		return 0, false
+	}
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case int:
+		return float64(v), true
+	case string:
+		f, err := strconv.ParseFloat(v, 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// executeToolCallsInParallel runs read-only tool calls concurrently, bounded by
+// maxParallelTools, and stores each result at the index of its call.
+func (cs *ChatService) executeToolCallsInParallel(ctx context.Context, eventChan chan any, functionCalls []*types.FunctionCall, outcomes []toolCallOutcome) {
+	toolCallIDs := make([]string, len(functionCalls))
+	for i, fc := range functionCalls {
+		cs.toolCallCounter++
+		toolCallIDs[i] = cs.toolCallID(fc)
+		eventChan <- types.ToolCallStartEvent{ToolCallID: toolCallIDs[i], ToolName: fc.Name, Args: fc.Args}
+	}
+
+	toolCtx := context.WithValue(ctx, EventChanKey, eventChan)
+	executor := cs.executor
+	workers := make(chan struct{}, cs.maxParallelTools())
+	var wg sync.WaitGroup
+	for i, fc := range functionCalls {
+		wg.Add(1)
+		go func(i int, fc *types.FunctionCall) {
+			defer wg.Done()
+			workers <- struct{}{}
+			defer func() { <-workers }()
+
+			result, err := executeTool(toolCtx, fc, cs.toolRegistry, executor, telemetry.GlobalLogger)
+			outcomes[i] = toolCallOutcome{result: result, err: err}
+			eventChan <- types.ToolCallEndEvent{ToolCallID: toolCallIDs[i], ToolName: fc.Name, Result: fmt.Sprintf("%v", result), Err: err}
+		}(i, fc)
+	}
+	wg.Wait()
+}
+
+// executeToolCall runs a single tool call, asking the user for confirmation
+// first when the tool is dangerous and has not been allowed for the session.
+func (cs *ChatService) executeToolCall(ctx context.Context, eventChan chan any, fc *types.FunctionCall, toolCallID string, isDangerousTool bool) toolCallOutcome {
+	var toolExecutionResult any = nil
+	var toolExecutionError error = nil
+
+	eventChan <- types.ToolCallStartEvent{ToolCallID: toolCallID, ToolName: fc.Name, Args: fc.Args}
+
+	if isDangerousTool && !cs.proceedAlwaysTools[fc.Name] {
+		confirmationEvent := types.ToolConfirmationRequestEvent{
+			ToolCallID: toolCallID,
+			ToolName:   fc.Name,
+			ToolArgs:   fc.Args,
+			Type:       "exec",
+			Message:    fmt.Sprintf("Confirm execution of tool '%s'?", fc.Name),
+		}
+		switch fc.Name {
+		case types.USER_CONFIRM_TOOL_NAME:
+			confirmationEvent.Type = "info"
+			if msg, ok := fc.Args["message"].(string); ok {
+				confirmationEvent.Message = msg
+			}
+		case types.WRITE_FILE_TOOL_NAME:
+			confirmationEvent.Type = "edit"
+			confirmationEvent.Message = "Apply this change?"
+			if filePath, ok := fc.Args["file_path"].(string); ok {
+				confirmationEvent.FilePath = filePath
+				if newContent, ok := fc.Args["content"].(string); ok {
+					confirmationEvent.NewContent = newContent
+					if originalContentBytes, err := os.ReadFile(filePath); err == nil {
+						confirmationEvent.OriginalContent = string(originalContentBytes)
+						confirmationEvent.FileDiff = generateDiff(string(originalContentBytes), newContent)
+					}
+				}
+			}
+		}
+
+		confirmation := cs.awaitToolConfirmation(ctx, eventChan, confirmationEvent)
+
+		switch confirmation.Outcome {
+		case types.ToolConfirmationOutcomeProceedOnce:
+			if fc.Name == types.USER_CONFIRM_TOOL_NAME {
+				toolExecutionResult = "continue"
+			} else {
+				toolExecutionResult, toolExecutionError = executeTool(context.WithValue(ctx, EventChanKey, eventChan), fc, cs.toolRegistry, cs.executor, telemetry.GlobalLogger)
+			}
+		case types.ToolConfirmationOutcomeProceedAlways:
+			cs.proceedAlwaysTools[fc.Name] = true
+			if fc.Name == types.USER_CONFIRM_TOOL_NAME {
+				toolExecutionResult = "continue"
+			} else {
+				toolExecutionResult, toolExecutionError = executeTool(context.WithValue(ctx, EventChanKey, eventChan), fc, cs.toolRegistry, cs.executor, telemetry.GlobalLogger)
+			}
+		case types.ToolConfirmationOutcomeModify:
+			modified := *fc
+			modified.Args = confirmation.ModifiedArgs
+			toolExecutionResult, toolExecutionError = executeTool(context.WithValue(ctx, EventChanKey, eventChan), &modified, cs.toolRegistry, cs.executor, telemetry.GlobalLogger)
+		case types.ToolConfirmationOutcomeCancel:
+			toolExecutionResult = "Tool execution cancelled by user."
+			toolExecutionError = fmt.Errorf("tool execution cancelled by user")
+			cs.toolErrorCounter++
+		default:
+			toolExecutionResult = "Unknown confirmation outcome."
+			toolExecutionError = fmt.Errorf("unknown confirmation outcome")
+			cs.toolErrorCounter++
+		}
+	} else {
+		toolExecutionResult, toolExecutionError = executeTool(context.WithValue(ctx, EventChanKey, eventChan), fc, cs.toolRegistry, cs.executor, telemetry.GlobalLogger)
+	}
+
+	if toolExecutionError == nil && fc.Name == types.WRITE_TODOS_TOOL_NAME {
+		if todosData, ok := fc.Args["todos"].([]interface{}); ok {
+			total := len(todosData)
+			completed := 0
+			for _, item := range todosData {
+				if todoMap, ok := item.(map[string]interface{}); ok {
+					if status, ok := todoMap["status"].(string); ok && status == "completed" {
+						completed++
+					}
+				}
+			}
+			eventChan <- types.TodosSummaryUpdateEvent{Summary: fmt.Sprintf("Todos %d/%d", completed, total)}
+		}
+	}
+
+	eventChan <- types.ToolCallEndEvent{ToolCallID: toolCallID, ToolName: fc.Name, Result: fmt.Sprintf("%v", toolExecutionResult), Err: toolExecutionError}
+	return toolCallOutcome{result: toolExecutionResult, err: toolExecutionError}
+}
+
+// DefaultToolConfirmationOutcome is applied to a confirmation request that
+// times out when the toolConfirmationDefaultOutcome setting is not set.
+const DefaultToolConfirmationOutcome = types.ToolConfirmationOutcomeCancel
+
+// awaitToolConfirmation sends a confirmation request and waits for the reply,
+// either from the interactive UI through ToolConfirmationChan or from an API
+// client through ConfirmToolCall. When the toolConfirmationTimeout setting (in
+// seconds) is positive and expires, the configured default outcome is used.
+func (cs *ChatService) awaitToolConfirmation(ctx context.Context, eventChan chan any, request types.ToolConfirmationRequestEvent) types.ToolConfirmation {
+	replyChan := make(chan types.ToolConfirmation, 1)
+	cs.confirmationsMu.Lock()
+	cs.pendingConfirmations[request.ToolCallID] = replyChan
+	cs.confirmationsMu.Unlock()
+	defer func() {
+		cs.confirmationsMu.Lock()
+		delete(cs.pendingConfirmations, request.ToolCallID)
+		cs.confirmationsMu.Unlock()
+	}()
+
+	eventChan <- request
+
+	var timeout <-chan time.Time
+	if seconds, ok := cs.intSetting("toolConfirmationTimeout"); ok && seconds > 0 {
+		timer := time.NewTimer(time.Duration(seconds) * time.Second)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	select {
+	case outcome := <-cs.ToolConfirmationChan:
+		return types.ToolConfirmation{Outcome: outcome}
+	case confirmation := <-replyChan:
+		return confirmation
+	case <-timeout:
+		outcome := cs.defaultToolConfirmationOutcome()
+		telemetry.LogDebugf("Confirmation of tool call %s timed out; applying %s", request.ToolCallID, outcome)
+		return types.ToolConfirmation{Outcome: outcome}
+	case <-ctx.Done():
+		return types.ToolConfirmation{Outcome: types.ToolConfirmationOutcomeCancel}
+	}
+}
+
+// defaultToolConfirmationOutcome returns the outcome applied to confirmation
+// requests that time out. Only PROCEED_ONCE and CANCEL are accepted.
+func (cs *ChatService) defaultToolConfirmationOutcome() types.ToolConfirmationOutcome {
+	value, _ := cs.settingsService.Get("toolConfirmationDefaultOutcome")
+	outcome, _ := value.(string)
+	switch types.ToolConfirmationOutcome(strings.ToUpper(outcome)) {
+	case types.ToolConfirmationOutcomeProceedOnce:
+		return types.ToolConfirmationOutcomeProceedOnce
+	default:
+		return DefaultToolConfirmationOutcome
+	}
+}
+
+// ConfirmToolCall answers the confirmation request of a tool call. An empty
+// toolCallID answers the only pending request, for clients that do not track IDs.
+func (cs *ChatService) ConfirmToolCall(toolCallID string, confirmation types.ToolConfirmation) error {
+	switch confirmation.Outcome {
+	case types.ToolConfirmationOutcomeProceedOnce, types.ToolConfirmationOutcomeProceedAlways, types.ToolConfirmationOutcomeCancel:
+	case types.ToolConfirmationOutcomeModify:
+		if confirmation.ModifiedArgs == nil {
+			return fmt.Errorf("outcome %s requires modifiedArgs", confirmation.Outcome)
+		}
+	default:
+		return fmt.Errorf("invalid tool confirmation outcome %q", confirmation.Outcome)
+	}
+
+	cs.confirmationsMu.Lock()
+	defer cs.confirmationsMu.Unlock()
+	if toolCallID == "" && len(cs.pendingConfirmations) == 1 {
+		for id := range cs.pendingConfirmations {
+			toolCallID = id
+		}
+	}
+	replyChan, ok := cs.pendingConfirmations[toolCallID]
+	if !ok {
+		return fmt.Errorf("%w for tool call %q", ErrNoPendingConfirmation, toolCallID)
+	}
+	// The request is removed right away so that a second reply cannot block.
+	delete(cs.pendingConfirmations, toolCallID)
+	replyChan <- confirmation
+	return nil
+}
+
 func executeTool(ctx context.Context, fc *types.FunctionCall, toolRegistry types.ToolRegistryInterface, executor types.Executor, logger telemetry.TelemetryLogger) (any, error) {
 	logger.LogDebugf("Executing tool '%s' with args: %v", fc.Name, fc.Args)
 
@@ -400,26 +641,46 @@ func (cs *ChatService) GetUserConfirmationChannel() chan bool {
 	return cs.userConfirmationChan
 }
 
-// CompressHistory compresses the current chat history.
-func (cs *ChatService) CompressHistory() (*types.ChatCompressionResult, error) {
+// CompressHistory compresses the history of a session and saves it.
+func (cs *ChatService) CompressHistory(sessionID string) (*types.ChatCompressionResult, error) {
 	if cs.executor == nil {
 		return nil, fmt.Errorf("executor is not initialized")
 	}
 
-	// This promptID will not have the session ID if called from agent mode
-	// when sessionID is handled per-message.
-	// This will need to be refactored if CompressHistory is used in agent mode.
-	promptID := "compress-session"
-	result, err := cs.executor.CompressChat(cs.history, promptID)
+	history, err := cs.sessionService.LoadHistory(sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load session history for ID %s: %w", sessionID, err)
+	}
+	cs.costsMu.Lock()
+	cs.sessionID = sessionID
+	cs.costsMu.Unlock()
+
+	newHistory, result, err := cs.compress(history)
 	if err != nil {
 		return nil, err
 	}
+	cs.history = newHistory
+	if err := cs.sessionService.SaveHistory(sessionID, cs.history); err != nil {
+		return nil, fmt.Errorf("failed to save compressed history for session %s: %w", sessionID, err)
+	}
+	return result, nil
+}
 
-	if _, ok := cs.tokenUsage[cs.executor.Name()]; !ok {
-		cs.tokenUsage[cs.executor.Name()] = &types.ModelTokenUsage{}
+// compressionSummaryPrefix starts the message holding the summary of a
+// compressed history.
+const compressionSummaryPrefix = "Summary of previous conversation:\n"
+
+// compress summarizes contents with the executor and returns the history that
+// replaces them: the system prompt and the summary.
+func (cs *ChatService) compress(contents []*types.Content) ([]*types.Content, *types.ChatCompressionResult, error) {
+	cs.costsMu.Lock()
+	sessionID := cs.sessionID
+	cs.costsMu.Unlock()
+	result, err := cs.executor.CompressChat(contents, "compress-"+sessionID)
+	if err != nil {
+		return nil, nil, err
 	}
-	cs.tokenUsage[cs.executor.Name()].InputTokens += result.InputTokens
-	cs.tokenUsage[cs.executor.Name()].OutputTokens += result.OutputTokens
+	cs.recordUsage(sessionID, result.InputTokens, result.OutputTokens)
 
 	// Create a new history with the system prompt and the summary
 	newHistory := []*types.Content{}
@@ -431,23 +692,15 @@ func (cs *ChatService) CompressHistory() (*types.ChatCompressionResult, error) {
 	}
 	newHistory = append(newHistory, &types.Content{
 		Role:  "user",
-		Parts: []types.Part{{Text: "Summary of previous conversation:\n" + result.Summary}},
+		Parts: []types.Part{{Text: compressionSummaryPrefix + result.Summary}},
 	})
 	newHistory = append(newHistory, &types.Content{
 		Role:  "model",
 		Parts: []types.Part{{Text: "Okay, I have reviewed the summary and am ready to continue."}},
 	})
-
-	cs.history = newHistory
-
-	// The sessionID for SaveHistory needs to come from somewhere, maybe as a parameter.
-	// For now, it will not work correctly in agent mode.
-	// if err := cs.sessionService.SaveHistory(cs.sessionID, cs.history); err != nil {
-	// 	telemetry.LogErrorf("Failed to save compressed history for session %s: %v", cs.sessionID, err)
-	// }
-
-	return result, nil
+	return newHistory, result, nil
 }
+
 func (cs *ChatService) GetGenerationConfig() types.GenerateContentConfig {
 	return cs.generationConfig
 }
@@ -455,3 +708,49 @@ func (cs *ChatService) GetGenerationConfig() types.GenerateContentConfig {
 func (cs *ChatService) GetTokenUsage() map[string]*types.ModelTokenUsage {
 	return cs.tokenUsage
 }
+
+// updateSessionMetadata records the model in use and the token usage and cost
+// of a message in the metadata of its session.
+func (cs *ChatService) updateSessionMetadata(sessionID string, usage types.ModelTokenUsage) {
+	executorType := cs.current.Executor
+	if cs.fallbackDepth == 0 {
+		executorTypeVal, _ := cs.settingsService.Get("executor")
+		executorType, _ = executorTypeVal.(string)
+	}
+	workspaceDir := cs.settingsService.GetWorkspaceDir()
+	err := cs.sessionService.UpdateMetadata(sessionID, func(metadata *SessionMetadata) {
+		metadata.Executor = executorType
+		metadata.Model = cs.executor.Name()
+		metadata.WorkspaceDir = workspaceDir
+		metadata.InputTokens += usage.InputTokens
+		metadata.OutputTokens += usage.OutputTokens
+		metadata.CostUSD += usage.CostUSD
+	})
+	if err != nil {
+		telemetry.LogErrorf("Failed to update the metadata of session %s: %v", sessionID, err)
+	}
+}
+
+// GetCosts returns the cost in USD of the current session and of the day.
+func (cs *ChatService) GetCosts() (session, daily float64) {
+	cs.costsMu.Lock()
+	costs, sessionID := cs.costs, cs.sessionID
+	cs.costsMu.Unlock()
+	if costs == nil {
+		return 0, 0
+	}
+	return costs.SessionCost(sessionID), costs.DailyCost()
+}
+
+// GetSessionMetrics returns the token usage and costs of the chat, as
+// reported in JsonOutput.Stats.
+func (cs *ChatService) GetSessionMetrics() *types.SessionMetrics {
+	metrics := &types.SessionMetrics{TokenUsage: cs.tokenUsage}
+	for _, usage := range cs.tokenUsage {
+		metrics.InputTokens += usage.InputTokens
+		metrics.OutputTokens += usage.OutputTokens
+	}
+	metrics.TotalTokens = metrics.InputTokens + metrics.OutputTokens
+	metrics.CostUSD, metrics.DailyCostUSD = cs.GetCosts()
+	return metrics
+}
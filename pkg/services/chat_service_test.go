@@ -5,7 +5,10 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"go-ai-agent-v2/go-cli/pkg/config" // New import
 	"go-ai-agent-v2/go-cli/pkg/core"
@@ -13,6 +16,7 @@ import (
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
 )
 
 // MockWriteFileTool for testing
@@ -68,6 +72,37 @@ func (t *MockUserConfirmTool) Execute(ctx context.Context, args map[string]any)
 	return types.ToolResult{}, fmt.Errorf("user_confirm Execute should not be called directly")
 }
 
+// MockBarrierReadTool is a read-only tool whose calls only complete once the
+// given number of calls are running at the same time.
+type MockBarrierReadTool struct {
+	*types.BaseDeclarativeTool
+	arrived *sync.WaitGroup
+}
+
+func NewMockBarrierReadTool(concurrentCalls int) *MockBarrierReadTool {
+	arrived := &sync.WaitGroup{}
+	arrived.Add(concurrentCalls)
+	return &MockBarrierReadTool{
+		BaseDeclarativeTool: types.NewBaseDeclarativeTool("barrier_read", "Barrier Read", "Reads a file.", types.KindRead, types.NewJsonSchemaObject(), false, false, nil),
+		arrived:             arrived,
+	}
+}
+
+func (t *MockBarrierReadTool) Execute(ctx context.Context, args map[string]any) (types.ToolResult, error) {
+	t.arrived.Done()
+	done := make(chan struct{})
+	go func() {
+		t.arrived.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return types.ToolResult{LLMContent: fmt.Sprintf("read %v", args["path"])}, nil
+	case <-time.After(5 * time.Second):
+		return types.ToolResult{}, fmt.Errorf("calls did not run concurrently")
+	}
+}
+
 // setupTestChatService creates a temporary directory and a ChatService instance for testing.
 func setupTestChatService(t *testing.T) (*ChatService, *core.MockExecutor, *SessionService, types.ToolRegistryInterface, *MockSettingsService, types.Config, string, func()) {
 	projectRoot, err := os.MkdirTemp("", "chat_service_test_*")
@@ -87,6 +122,8 @@ func setupTestChatService(t *testing.T) (*ChatService, *core.MockExecutor, *Sess
 	mockSettingsService := new(MockSettingsService)
 	mockSettingsService.On("Get", mock.Anything).Return(nil, false).Maybe()
 	mockSettingsService.On("GetWorkspaceDir").Return(projectRoot).Maybe()
+	mockSettingsService.On("GetRetrySettings").Return(&types.RetrySettings{MaxAttempts: 1}).Maybe() // Errors reach the chat at once
+	mockSettingsService.On("GetBudgetSettings").Return(nil).Maybe()
 
 	toolRegistry := types.NewToolRegistry()
 	toolRegistry.Register(&MockWriteFileTool{})
@@ -282,3 +319,550 @@ func TestChatService_SendMessage_ProceedAlways(t *testing.T) {
 		assert.False(t, confirmationRequested, "Tool confirmation should NOT be requested for the second call.")
 	})
 }
+
+func TestChatService_SendMessage_ParallelReadOnlyTools(t *testing.T) {
+	chatService, mockExecutor, _, toolRegistry, mockSettingsService, _, projectRoot, cleanup := setupTestChatService(t)
+	defer cleanup()
+	assert.NoError(t, toolRegistry.Register(NewMockBarrierReadTool(3)))
+
+	var toolResponses []types.Part
+	mockExecutor.StreamContentFunc = func(ctx context.Context, contents ...*types.Content) (<-chan any, error) {
+		eventChan := make(chan any)
+		go func() {
+			defer close(eventChan)
+			if len(contents) == 1 {
+				for _, path := range []string{"a.txt", "b.txt", "c.txt"} {
+					eventChan <- types.Part{FunctionCall: &types.FunctionCall{Name: "barrier_read", Args: map[string]interface{}{"path": path}}}
+				}
+				eventChan <- types.Part{FunctionCall: &types.FunctionCall{
+					Name: types.WRITE_FILE_TOOL_NAME,
+					Args: map[string]interface{}{"file_path": filepath.Join(projectRoot, "out.txt"), "content": "done"},
+				}}
+			} else if len(contents) == 3 {
+				toolResponses = contents[2].Parts
+				eventChan <- types.Part{Text: "Mock: Task finished."}
+			}
+		}()
+		return eventChan, nil
+	}
+	mockSettingsService.On("GetDangerousTools").Return([]string{}).Once()
+
+	eventChan, err := chatService.SendMessage(context.Background(), "test_session_id", "test")
+	assert.NoError(t, err)
+
+	toolCallIDs := make(map[string]bool)
+	for event := range eventChan {
+		switch e := event.(type) {
+		case types.ToolCallStartEvent:
+			toolCallIDs[e.ToolCallID] = true
+		case types.ToolCallEndEvent:
+			assert.NoError(t, e.Err)
+		case types.ErrorEvent:
+			t.Fatalf("unexpected error: %v", e.Err)
+		}
+	}
+
+	assert.Len(t, toolCallIDs, 4, "every tool call should get a distinct ID")
+	if assert.Len(t, toolResponses, 4) {
+		for i, want := range []string{"read a.txt", "read b.txt", "read c.txt"} {
+			assert.Equal(t, "barrier_read", toolResponses[i].FunctionResponse.Name)
+			assert.Equal(t, want, toolResponses[i].FunctionResponse.Response["result"])
+		}
+		assert.Equal(t, types.WRITE_FILE_TOOL_NAME, toolResponses[3].FunctionResponse.Name)
+	}
+}
+
+func TestChatService_ConfirmToolCall(t *testing.T) {
+	t.Run("Modify replaces the tool call arguments", func(t *testing.T) {
+		chatService, mockExecutor, _, _, mockSettingsService, _, _, cleanup := setupTestChatService(t)
+		defer cleanup()
+
+		mockExecutor.StreamContentFunc = func(ctx context.Context, contents ...*types.Content) (<-chan any, error) {
+			eventChan := make(chan any)
+			go func() {
+				defer close(eventChan)
+				if len(contents) == 1 {
+					eventChan <- types.Part{FunctionCall: &types.FunctionCall{
+						ID:   "call-1",
+						Name: types.WRITE_FILE_TOOL_NAME,
+						Args: map[string]interface{}{"file_path": "original.txt", "content": "Hello"},
+					}}
+				} else if len(contents) == 3 {
+					eventChan <- types.Part{Text: "Mock: Task finished."}
+				}
+			}()
+			return eventChan, nil
+		}
+		mockSettingsService.On("GetDangerousTools").Return([]string{types.WRITE_FILE_TOOL_NAME}).Once()
+
+		eventChan, err := chatService.SendMessage(context.Background(), "test_session_id", "test")
+		assert.NoError(t, err)
+
+		var endEvent types.ToolCallEndEvent
+		for event := range eventChan {
+			switch e := event.(type) {
+			case types.ToolConfirmationRequestEvent:
+				assert.ErrorIs(t, chatService.ConfirmToolCall("unknown", types.ToolConfirmation{Outcome: types.ToolConfirmationOutcomeCancel}), ErrNoPendingConfirmation)
+				assert.Error(t, chatService.ConfirmToolCall(e.ToolCallID, types.ToolConfirmation{Outcome: "MAYBE"}))
+				assert.Error(t, chatService.ConfirmToolCall(e.ToolCallID, types.ToolConfirmation{Outcome: types.ToolConfirmationOutcomeModify}))
+				assert.NoError(t, chatService.ConfirmToolCall(e.ToolCallID, types.ToolConfirmation{
+					Outcome:      types.ToolConfirmationOutcomeModify,
+					ModifiedArgs: map[string]interface{}{"file_path": "modified.txt", "content": "Hello"},
+				}))
+				assert.ErrorIs(t, chatService.ConfirmToolCall(e.ToolCallID, types.ToolConfirmation{Outcome: types.ToolConfirmationOutcomeCancel}), ErrNoPendingConfirmation)
+			case types.ToolCallEndEvent:
+				endEvent = e
+			}
+		}
+
+		assert.NoError(t, endEvent.Err)
+		assert.Equal(t, "Successfully wrote to modified.txt", endEvent.Result)
+	})
+
+	t.Run("Timeout applies the default outcome", func(t *testing.T) {
+		chatService, mockExecutor, _, _, mockSettingsService, _, projectRoot, cleanup := setupTestChatService(t)
+		defer cleanup()
+
+		// Specific expectations must be registered before the catch-all one.
+		mockSettingsService.ExpectedCalls = nil
+		mockSettingsService.On("Get", "toolConfirmationTimeout").Return(1, true).Once()
+		mockSettingsService.On("Get", "toolConfirmationDefaultOutcome").Return("PROCEED_ONCE", true).Once()
+		mockSettingsService.On("Get", mock.Anything).Return(nil, false).Maybe()
+		mockSettingsService.On("GetWorkspaceDir").Return(projectRoot).Maybe()
+		mockSettingsService.On("GetRetrySettings").Return(&types.RetrySettings{MaxAttempts: 1}).Maybe()
+		mockSettingsService.On("GetBudgetSettings").Return(nil).Maybe()
+		mockSettingsService.On("GetDangerousTools").Return([]string{types.WRITE_FILE_TOOL_NAME}).Once()
+
+		mockExecutor.StreamContentFunc = func(ctx context.Context, contents ...*types.Content) (<-chan any, error) {
+			eventChan := make(chan any)
+			go func() {
+				defer close(eventChan)
+				if len(contents) == 1 {
+					eventChan <- types.Part{FunctionCall: &types.FunctionCall{
+						Name: types.WRITE_FILE_TOOL_NAME,
+						Args: map[string]interface{}{"file_path": "unattended.txt", "content": "Hello"},
+					}}
+				}
+			}()
+			return eventChan, nil
+		}
+
+		eventChan, err := chatService.SendMessage(context.Background(), "test_session_id", "test")
+		assert.NoError(t, err)
+
+		var endEvent types.ToolCallEndEvent
+		for event := range eventChan {
+			if e, ok := event.(types.ToolCallEndEvent); ok {
+				endEvent = e
+			}
+		}
+
+		assert.NoError(t, endEvent.Err)
+		assert.Equal(t, "Successfully wrote to unattended.txt", endEvent.Result)
+	})
+}
+
+func TestChatService_SendMessage_ReplaysRecordedToolLoop(t *testing.T) {
+	_, mockExecutor, sessionService, _, mockSettingsService, appConfig, projectRoot, cleanup := setupTestChatService(t)
+	defer cleanup()
+	mockSettingsService.On("GetDangerousTools").Return([]string{}).Maybe()
+
+	mockExecutor.StreamContentFunc = func(ctx context.Context, contents ...*types.Content) (<-chan any, error) {
+		eventChan := make(chan any)
+		go func() {
+			defer close(eventChan)
+			if len(contents) == 1 {
+				eventChan <- types.Part{FunctionCall: &types.FunctionCall{Name: "barrier_read", Args: map[string]interface{}{"path": "a.txt"}}}
+			} else {
+				eventChan <- types.Part{Text: fmt.Sprintf("The file says: %v", contents[2].Parts[0].FunctionResponse.Response["result"])}
+			}
+			eventChan <- types.TokenCountEvent{InputTokens: 10 * len(contents), OutputTokens: 5}
+		}()
+		return eventChan, nil
+	}
+
+	// run sends the same message through a fresh session and returns what the user would see.
+	run := func(executor core.Executor, sessionID string) []string {
+		toolRegistry := types.NewToolRegistry()
+		assert.NoError(t, toolRegistry.Register(NewMockBarrierReadTool(1)))
+		chatService, err := NewChatService(executor, toolRegistry, sessionService, mockSettingsService, NewContextService(projectRoot), appConfig, types.GenerateContentConfig{}, nil)
+		assert.NoError(t, err)
+		eventChan, err := chatService.SendMessage(context.Background(), sessionID, "What is in a.txt?")
+		assert.NoError(t, err)
+
+		var transcript []string
+		for event := range eventChan {
+			switch e := event.(type) {
+			case types.ToolCallStartEvent:
+				transcript = append(transcript, fmt.Sprintf("call %s %v", e.ToolName, e.Args))
+			case types.ToolCallEndEvent:
+				transcript = append(transcript, fmt.Sprintf("result %s", e.Result))
+			case types.Part:
+				transcript = append(transcript, e.Text)
+			case types.TokenCountEvent:
+				transcript = append(transcript, fmt.Sprintf("tokens %d/%d", e.InputTokens, e.OutputTokens))
+			case types.ErrorEvent:
+				t.Fatalf("unexpected error: %v", e.Err)
+			}
+		}
+		return transcript
+	}
+
+	cassettePath := filepath.Join(projectRoot, "cassettes", "read_file.json")
+	recorded := run(core.NewRecordingExecutor(mockExecutor, cassettePath), "record_session")
+	assert.Equal(t, []string{"tokens 10/5", "call barrier_read map[path:a.txt]", "result read a.txt", "The file says: read a.txt", "tokens 30/5"}, recorded)
+
+	replayExecutor, err := core.NewReplayExecutor(cassettePath)
+	assert.NoError(t, err)
+	assert.Equal(t, recorded, run(replayExecutor, "replay_session"))
+}
+
+func TestChatService_SendMessage_RoutesAutoModelPerTurn(t *testing.T) {
+	_, mockExecutor, sessionService, _, mockSettingsService, _, projectRoot, cleanup := setupTestChatService(t)
+	defer cleanup()
+
+	// Specific expectations must be registered before the catch-all one.
+	mockSettingsService.ExpectedCalls = nil
+	mockSettingsService.On("Get", "executor").Return(types.ExecutorTypeMock, true)
+	mockSettingsService.On("Get", mock.Anything).Return(nil, false).Maybe()
+	mockSettingsService.On("GetRoutingSettings").Return(&types.RoutingSettings{}).Once()
+	mockSettingsService.On("GetRetrySettings").Return(&types.RetrySettings{MaxAttempts: 1}).Maybe()
+	mockSettingsService.On("GetBudgetSettings").Return(nil).Maybe()
+	mockSettingsService.On("GetWorkspaceDir").Return(projectRoot).Maybe()
+	mockExecutor.StreamContentFunc = func(ctx context.Context, contents ...*types.Content) (<-chan any, error) {
+		t.Error("the executor created before routing was used")
+		return nil, fmt.Errorf("unexpected call")
+	}
+
+	scenarioPath := filepath.Join(projectRoot, "routed.yaml")
+	assert.NoError(t, os.WriteFile(scenarioPath, []byte("turns:\n  - chunks: [Routed answer.]\n"), 0644))
+	appConfig := config.NewConfig(&config.ConfigParameters{
+		ModelName:       types.AutoModel,
+		ToolRegistry:    types.NewToolRegistry(),
+		MockScenario:    scenarioPath,
+		RoutingSettings: &types.RoutingSettings{FastModel: "mock-fast", StrongModel: "mock-strong"},
+	})
+	chatService, err := NewChatService(mockExecutor, appConfig.ToolRegistry, sessionService, mockSettingsService, NewContextService(projectRoot), appConfig, types.GenerateContentConfig{}, nil)
+	assert.NoError(t, err)
+
+	// send returns the model switches of a message.
+	send := func(message string) []types.ModelSwitchEvent {
+		eventChan, err := chatService.SendMessage(context.Background(), "routing_session", message)
+		assert.NoError(t, err)
+		var switches []types.ModelSwitchEvent
+		for event := range eventChan {
+			switch e := event.(type) {
+			case types.ModelSwitchEvent:
+				switches = append(switches, e)
+			case types.ErrorEvent:
+				t.Errorf("unexpected error: %v", e.Err)
+			}
+		}
+		return switches
+	}
+
+	switches := send("List the files")
+	require.Len(t, switches, 1)
+	assert.Equal(t, types.AutoModel, switches[0].OldModel)
+	assert.Equal(t, "mock-fast", switches[0].NewModel)
+	assert.Contains(t, switches[0].Reason, "Auto routing: ")
+
+	switches = send("Refactor the session store so that concurrent saves cannot race, and explain why the current one fails")
+	require.Len(t, switches, 1)
+	assert.Equal(t, "mock-fast", switches[0].OldModel)
+	assert.Equal(t, "mock-strong", switches[0].NewModel)
+	assert.Contains(t, switches[0].Reason, "complex task")
+
+	assert.Equal(t, "mock-fast", send("Show the diff")[0].NewModel, "each turn is routed again")
+}
+
+func TestChatService_SendMessage_ModelFallbackChain(t *testing.T) {
+	// setupFallback returns a chat whose primary mock fails with the given
+	// errors in turn, and whose "mock" fallback plays a one-turn scenario.
+	setupFallback := func(t *testing.T, fallbackSettings *types.ModelFallbackSettings, primaryErrs ...error) (*ChatService, *MockSettingsService, func()) {
+		_, mockExecutor, sessionService, _, mockSettingsService, _, projectRoot, cleanup := setupTestChatService(t)
+		mockSettingsService.On("GetModelFallbackSettings").Return(fallbackSettings).Maybe()
+
+		calls := 0
+		mockExecutor.StreamContentFunc = func(ctx context.Context, contents ...*types.Content) (<-chan any, error) {
+			eventChan := make(chan any, 1)
+			if calls < len(primaryErrs) {
+				eventChan <- types.ErrorEvent{Err: primaryErrs[calls]}
+			} else {
+				eventChan <- types.Part{Text: "Primary answer."}
+			}
+			calls++
+			close(eventChan)
+			return eventChan, nil
+		}
+
+		scenarioPath := filepath.Join(projectRoot, "fallback.yaml")
+		assert.NoError(t, os.WriteFile(scenarioPath, []byte("turns:\n  - chunks: [Fallback answer.]\n"), 0644))
+		appConfig := config.NewConfig(&config.ConfigParameters{ModelName: "mock-primary", ToolRegistry: types.NewToolRegistry(), MockScenario: scenarioPath})
+		chatService, err := NewChatService(mockExecutor, appConfig.ToolRegistry, sessionService, mockSettingsService, NewContextService(projectRoot), appConfig, types.GenerateContentConfig{}, nil)
+		assert.NoError(t, err)
+		return chatService, mockSettingsService, cleanup
+	}
+
+	// send returns the model switches and the final response or error of a message.
+	send := func(t *testing.T, chatService *ChatService) ([]types.ModelSwitchEvent, string) {
+		eventChan, err := chatService.SendMessage(context.Background(), "fallback_session", "Hello")
+		assert.NoError(t, err)
+		var switches []types.ModelSwitchEvent
+		var result string
+		for event := range eventChan {
+			switch e := event.(type) {
+			case types.ModelSwitchEvent:
+				switches = append(switches, e)
+			case types.FinalResponseEvent:
+				result = e.Content
+			case types.ErrorEvent:
+				result = e.Err.Error()
+			}
+		}
+		return switches, result
+	}
+
+	t.Run("Switches down the chain and saves the switch", func(t *testing.T) {
+		chatService, mockSettingsService, cleanup := setupFallback(t, &types.ModelFallbackSettings{Chain: []types.ModelFallback{
+			{Executor: "unknown", Model: "broken"},
+			{Executor: types.ExecutorTypeMock, Model: "mock-fallback"},
+		}}, &core.ScenarioError{StatusCode: 429, Message: "Resource exhausted"})
+		defer cleanup()
+		mockSettingsService.On("Set", "executor", types.ExecutorTypeMock).Return(nil).Once()
+		mockSettingsService.On("Set", "model", "mock-fallback").Return(nil).Once()
+
+		switches, result := send(t, chatService)
+		assert.Equal(t, []types.ModelSwitchEvent{{OldModel: "mock-primary", NewModel: "mock-fallback", Executor: types.ExecutorTypeMock, Reason: "Rate limited"}}, switches)
+		assert.Equal(t, "Fallback answer.", result)
+		assert.Equal(t, "Hello", chatService.GetHistory()[0].Parts[0].Text, "the history is carried over")
+	})
+
+	t.Run("Restores the primary model after the cooldown", func(t *testing.T) {
+		chatService, mockSettingsService, cleanup := setupFallback(t, &types.ModelFallbackSettings{
+			Chain:    []types.ModelFallback{{Executor: types.ExecutorTypeMock, Model: "mock-fallback"}},
+			Cooldown: 60,
+		}, fmt.Errorf("stream: %w", &core.ScenarioError{StatusCode: 400, Message: "The input token count (1200000) exceeds the maximum number of tokens allowed"}))
+		defer cleanup()
+
+		switches, result := send(t, chatService)
+		assert.Equal(t, "Context length exceeded", switches[0].Reason)
+		assert.Equal(t, "Fallback answer.", result)
+
+		chatService.fallbackAt = time.Now().Add(-time.Minute)
+		switches, result = send(t, chatService)
+		assert.Equal(t, []types.ModelSwitchEvent{{OldModel: "mock-fallback", NewModel: "mock-primary", Reason: "Fallback cooldown elapsed"}}, switches)
+		assert.Equal(t, "Primary answer.", result)
+		mockSettingsService.AssertNotCalled(t, "Set", mock.Anything, mock.Anything)
+	})
+
+	t.Run("Does not fall back on client errors", func(t *testing.T) {
+		chatService, _, cleanup := setupFallback(t, &types.ModelFallbackSettings{
+			Chain: []types.ModelFallback{{Executor: types.ExecutorTypeMock, Model: "mock-fallback"}},
+		}, &core.ScenarioError{StatusCode: 401, Message: "Invalid API key"})
+		defer cleanup()
+
+		switches, result := send(t, chatService)
+		assert.Empty(t, switches)
+		assert.Equal(t, "scenario error (status 401): Invalid API key", result)
+	})
+}
+
+func TestChatService_SendMessage_FitsContextWindow(t *testing.T) {
+	// setup returns a chat with the given settings whose session has three
+	// long turns, and the history of each request to the model.
+	setup := func(t *testing.T, settings map[string]any, compress func(history []*types.Content, promptId string) (*types.ChatCompressionResult, error)) (*ChatService, *SessionService, *[][]*types.Content, func()) {
+		chatService, mockExecutor, sessionService, _, mockSettingsService, _, projectRoot, cleanup := setupTestChatService(t)
+		mockSettingsService.ExpectedCalls = nil
+		for key, value := range settings {
+			mockSettingsService.On("Get", key).Return(value, true)
+		}
+		mockSettingsService.On("Get", mock.Anything).Return(nil, false).Maybe()
+		mockSettingsService.On("GetRetrySettings").Return(&types.RetrySettings{MaxAttempts: 1}).Maybe()
+		mockSettingsService.On("GetBudgetSettings").Return(nil).Maybe()
+		mockSettingsService.On("GetWorkspaceDir").Return(projectRoot).Maybe()
+
+		var history []*types.Content
+		for i := 1; i <= 3; i++ {
+			history = append(history,
+				&types.Content{Role: "user", Parts: []types.Part{{Text: fmt.Sprintf("Question %d: %s", i, strings.Repeat("word ", 400))}}},
+				&types.Content{Role: "model", Parts: []types.Part{{Text: fmt.Sprintf("Answer %d.", i)}}},
+			)
+		}
+		require.NoError(t, sessionService.SaveHistory("long_session", history))
+
+		var requests [][]*types.Content
+		mockExecutor.CompressChatFunc = compress
+		mockExecutor.StreamContentFunc = func(ctx context.Context, contents ...*types.Content) (<-chan any, error) {
+			requests = append(requests, contents)
+			eventChan := make(chan any, 1)
+			eventChan <- types.Part{Text: "Done."}
+			close(eventChan)
+			return eventChan, nil
+		}
+		return chatService, sessionService, &requests, cleanup
+	}
+	send := func(t *testing.T, chatService *ChatService) []types.ContextReducedEvent {
+		eventChan, err := chatService.SendMessage(context.Background(), "long_session", "Next question")
+		require.NoError(t, err)
+		var reductions []types.ContextReducedEvent
+		for event := range eventChan {
+			switch e := event.(type) {
+			case types.ContextReducedEvent:
+				reductions = append(reductions, e)
+			case types.ErrorEvent:
+				t.Errorf("unexpected error: %v", e.Err)
+			}
+		}
+		return reductions
+	}
+	summarize := func(compressed *[]*types.Content) func(history []*types.Content, promptId string) (*types.ChatCompressionResult, error) {
+		return func(history []*types.Content, promptId string) (*types.ChatCompressionResult, error) {
+			*compressed = history
+			return &types.ChatCompressionResult{Summary: "The first questions were answered."}, nil
+		}
+	}
+
+	t.Run("Older turns are compressed and the last turns kept", func(t *testing.T) {
+		var compressed []*types.Content
+		chatService, sessionService, requests, cleanup := setup(t, map[string]any{"contextWindow": 1000}, summarize(&compressed))
+		defer cleanup()
+
+		reductions := send(t, chatService)
+		require.Len(t, reductions, 1)
+		assert.Equal(t, types.ContextReductionCompressed, reductions[0].Method)
+		assert.Greater(t, reductions[0].TokensBefore, 800)
+		assert.Less(t, reductions[0].TokensAfter, 800)
+		assert.Equal(t, reductions[0].TokensBefore-reductions[0].TokensAfter, reductions[0].TokensSaved)
+		assert.Len(t, compressed, 4, "the last two turns are not compressed")
+
+		require.Len(t, *requests, 1)
+		request := (*requests)[0]
+		require.Len(t, request, 5)
+		assert.Equal(t, "Summary of previous conversation:\nThe first questions were answered.", request[0].Parts[0].Text)
+		assert.True(t, strings.HasPrefix(request[2].Parts[0].Text, "Question 3: "))
+		assert.Equal(t, "Next question", request[4].Parts[0].Text)
+
+		saved, err := sessionService.LoadHistory("long_session")
+		require.NoError(t, err)
+		assert.Equal(t, request[0].Parts[0].Text, saved[0].Parts[0].Text, "the compressed history is saved to the session")
+	})
+
+	t.Run("Threshold and preserved turns are configurable", func(t *testing.T) {
+		var compressed []*types.Content
+		chatService, _, requests, cleanup := setup(t, map[string]any{"contextWindow": 4000, "compressionThreshold": 0.25, "compressionPreserveTurns": 1}, summarize(&compressed))
+		defer cleanup()
+
+		reductions := send(t, chatService)
+		require.Len(t, reductions, 1)
+		assert.Len(t, compressed, 6, "only the current turn is kept")
+		require.Len(t, *requests, 1)
+		assert.Len(t, (*requests)[0], 3)
+	})
+
+	t.Run("Oldest turns are trimmed when compression fails", func(t *testing.T) {
+		chatService, _, requests, cleanup := setup(t, map[string]any{"contextWindow": 1000}, func(history []*types.Content, promptId string) (*types.ChatCompressionResult, error) {
+			return nil, fmt.Errorf("compression unavailable")
+		})
+		defer cleanup()
+
+		reductions := send(t, chatService)
+		require.Len(t, reductions, 1)
+		assert.Equal(t, types.ContextReductionTrimmed, reductions[0].Method)
+		assert.Less(t, reductions[0].TokensAfter, 800)
+
+		require.Len(t, *requests, 1)
+		request := (*requests)[0]
+		assert.Less(t, len(request), 7)
+		assert.True(t, strings.HasPrefix(request[0].Parts[0].Text, "Question "), "whole turns are dropped")
+		assert.Equal(t, "Next question", request[len(request)-1].Parts[0].Text)
+	})
+
+	t.Run("The executor counts tokens only near the threshold", func(t *testing.T) {
+		for _, tt := range []struct {
+			window  int
+			counted bool
+		}{{window: 1_000_000, counted: false}, {window: 1000, counted: true}} {
+			chatService, _, _, cleanup := setup(t, map[string]any{"contextWindow": tt.window}, summarize(new([]*types.Content)))
+			retrying := chatService.executor.(*RetryingExecutor)
+			counter := &tokenCountingExecutor{MockExecutor: retrying.Executor.(*core.MockExecutor)}
+			retrying.Executor = counter
+			send(t, chatService)
+			cleanup()
+			assert.Equal(t, tt.counted, counter.calls > 0, "context window of %d tokens", tt.window)
+		}
+	})
+}
+
+// tokenCountingExecutor is a MockExecutor that counts tokens itself, and how
+// often it is asked to.
+type tokenCountingExecutor struct {
+	*core.MockExecutor
+	calls int
+}
+
+func (e *tokenCountingExecutor) CountTokens(ctx context.Context, contents []*types.Content, tools []types.Tool) (int, error) {
+	e.calls++
+	return core.EstimateTokens(contents, tools), nil
+}
+
+func TestChatService_CompressHistory_SavesSession(t *testing.T) {
+	chatService, mockExecutor, sessionService, _, _, _, _, cleanup := setupTestChatService(t)
+	defer cleanup()
+
+	history := []*types.Content{
+		{Role: "user", Parts: []types.Part{{Text: "Hello"}}},
+		{Role: "model", Parts: []types.Part{{Text: "Hi, how can I help?"}}},
+	}
+	require.NoError(t, sessionService.SaveHistory("compress_session", history))
+	mockExecutor.CompressChatFunc = func(contents []*types.Content, promptId string) (*types.ChatCompressionResult, error) {
+		assert.Len(t, contents, 2, "the history of the session is compressed")
+		return &types.ChatCompressionResult{Summary: "Greetings.", OriginalTokenCount: 20, NewTokenCount: 5}, nil
+	}
+
+	result, err := chatService.CompressHistory("compress_session")
+	require.NoError(t, err)
+	assert.Equal(t, "Greetings.", result.Summary)
+
+	saved, err := sessionService.LoadHistory("compress_session")
+	require.NoError(t, err)
+	require.Len(t, saved, 2)
+	assert.Equal(t, "Summary of previous conversation:\nGreetings.", saved[0].Parts[0].Text)
+}
+
+func TestChatService_SendMessage_UpdatesSessionMetadata(t *testing.T) {
+	chatService, mockExecutor, sessionService, _, mockSettingsService, _, projectRoot, cleanup := setupTestChatService(t)
+	defer cleanup()
+
+	mockSettingsService.ExpectedCalls = nil
+	mockSettingsService.On("Get", "executor").Return(types.ExecutorTypeMock, true)
+	mockSettingsService.On("Get", mock.Anything).Return(nil, false).Maybe()
+	mockSettingsService.On("GetRetrySettings").Return(&types.RetrySettings{MaxAttempts: 1}).Maybe()
+	mockSettingsService.On("GetBudgetSettings").Return(&types.BudgetSettings{Pricing: map[string]types.ModelPricing{"mock": {Input: 1, Output: 2}}}).Maybe()
+	mockSettingsService.On("GetWorkspaceDir").Return(projectRoot).Maybe()
+	mockExecutor.StreamContentFunc = func(ctx context.Context, contents ...*types.Content) (<-chan any, error) {
+		eventChan := make(chan any, 2)
+		eventChan <- types.Part{Text: "Done."}
+		eventChan <- types.TokenCountEvent{InputTokens: 1000, OutputTokens: 500}
+		close(eventChan)
+		return eventChan, nil
+	}
+
+	for _, message := range []string{"Rename the config package", "Thanks"} {
+		eventChan, err := chatService.SendMessage(context.Background(), "metadata_session", message)
+		require.NoError(t, err)
+		for range eventChan {
+		}
+	}
+
+	metadata, err := sessionService.GetMetadata("metadata_session")
+	require.NoError(t, err)
+	assert.Equal(t, "Rename the config package", metadata.Title)
+	assert.Equal(t, types.ExecutorTypeMock, metadata.Executor)
+	assert.Equal(t, "mock", metadata.Model)
+	assert.Equal(t, projectRoot, metadata.WorkspaceDir)
+	assert.Equal(t, 4, metadata.MessageCount)
+	assert.Equal(t, 2000, metadata.InputTokens)
+	assert.Equal(t, 1000, metadata.OutputTokens)
+	assert.InDelta(t, 0.004, metadata.CostUSD, 1e-9)
+}
@@ -0,0 +1,179 @@
+package services
+
+import (
+	"context"
+	"fmt"
+
+	"go-ai-agent-v2/go-cli/pkg/core"
+	"go-ai-agent-v2/go-cli/pkg/telemetry"
+	"go-ai-agent-v2/go-cli/pkg/types"
+)
+
+// DefaultCompressionThreshold is the share of the context window from which
+// the history is compressed when the compressionThreshold setting is not set.
+const DefaultCompressionThreshold = 0.8
+
+// DefaultCompressionPreserveTurns is the number of last turns, the current
+// one included, kept verbatim when the history is compressed.
+const DefaultCompressionPreserveTurns = 2
+
+// contextWindow returns the context window of the model in use: the
+// contextWindow setting, or the built-in size of the model.
+func (cs *ChatService) contextWindow() int {
+	if window, ok := cs.intSetting("contextWindow"); ok && window > 0 {
+		return window
+	}
+	return core.ContextWindow(cs.executor.Name())
+}
+
+// compressionThreshold returns the configured share of the context window
+// from which the history is compressed.
+func (cs *ChatService) compressionThreshold() float64 {
+	threshold, ok := cs.floatSetting("compressionThreshold")
+	if !ok || threshold <= 0 || threshold > 1 {
+		return DefaultCompressionThreshold
+	}
+	return threshold
+}
+
+// compressionPreserveTurns returns the configured number of last turns kept
+// verbatim when the history is compressed.
+func (cs *ChatService) compressionPreserveTurns() int {
+	turns, ok := cs.intSetting("compressionPreserveTurns")
+	if !ok || turns < 1 {
+		return DefaultCompressionPreserveTurns
+	}
+	return turns
+}
+
+// exactCountShare is the share of the compression threshold from which the
+// prompt is counted by the executor, which may take a request to its provider,
+// instead of only estimated locally.
+const exactCountShare = 0.9
+
+// fitContextWindow counts the prompt of the next request and sends its size.
+// When it passes the compression threshold of the context window, the older
+// turns are summarized and the history is saved to the session; when that
+// fails or is not enough, the oldest turns are dropped. The current turn is
+// always kept.
+func (cs *ChatService) fitContextWindow(ctx context.Context, eventChan chan any, sessionID string) {
+	tools := cs.toolRegistry.GetAllTools()
+	window := cs.contextWindow()
+	limit := int(float64(window) * cs.compressionThreshold())
+	tokens := cs.promptTokens(ctx, tools, limit)
+	eventChan <- types.PromptSizeEvent{Tokens: tokens, ContextWindow: window}
+
+	if window <= 0 || tokens <= limit {
+		return
+	}
+	telemetry.LogDebugf("Prompt of %d tokens is over %d tokens of the %d-token context window, reducing the history", tokens, limit, window)
+
+	reduced := types.ContextReducedEvent{Method: types.ContextReductionCompressed, TokensBefore: tokens}
+	if err := cs.compressOlderTurns(cs.compressionPreserveTurns()); err != nil {
+		telemetry.LogErrorf("Failed to compress the history, trimming it instead: %v", err)
+	} else {
+		tokens = cs.promptTokens(ctx, tools, limit)
+	}
+	if tokens > limit && cs.trimEarlierTurns(tokens-limit) > 0 {
+		reduced.Method = types.ContextReductionTrimmed
+		tokens = cs.promptTokens(ctx, tools, limit)
+	}
+	if tokens == reduced.TokensBefore {
+		telemetry.LogWarnf("The current turn alone is over %d tokens of the context window", limit)
+		return
+	}
+	if err := cs.sessionService.SaveHistory(sessionID, cs.history); err != nil {
+		telemetry.LogErrorf("Failed to save the reduced history of session %s: %v", sessionID, err)
+	}
+	reduced.TokensAfter, reduced.TokensSaved = tokens, reduced.TokensBefore-tokens
+	eventChan <- reduced
+	eventChan <- types.PromptSizeEvent{Tokens: tokens, ContextWindow: window}
+}
+
+// promptTokens returns the prompt size of the next request. It is estimated
+// locally, and counted by the executor only when the estimate is near limit.
+func (cs *ChatService) promptTokens(ctx context.Context, tools []types.Tool, limit int) int {
+	tokens := core.EstimateTokens(cs.history, tools)
+	if limit > 0 && float64(tokens) >= float64(limit)*exactCountShare {
+		return core.CountTokens(ctx, cs.executor, cs.history, tools)
+	}
+	return tokens
+}
+
+// currentTurnStart returns the index of the user message that started the
+// current turn, or -1 when there is none.
+func (cs *ChatService) currentTurnStart() int {
+	for i := len(cs.history) - 1; i >= 0; i-- {
+		if isTurnStart(cs.history[i]) {
+			return i
+		}
+	}
+	return -1
+}
+
+// isTurnStart reports whether a message starts a turn: a user message with
+// text. Tool responses do not start turns.
+func isTurnStart(content *types.Content) bool {
+	if content.Role != "user" {
+		return false
+	}
+	for _, part := range content.Parts {
+		if part.Text != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// compressOlderTurns replaces the turns before the last preserve turns with
+// their summary.
+func (cs *ChatService) compressOlderTurns(preserve int) error {
+	start := len(cs.history)
+	for turns := 0; turns < preserve && start > 0; {
+		start--
+		if isTurnStart(cs.history[start]) {
+			turns++
+		}
+	}
+	older := 0
+	for _, content := range cs.history[:start] {
+		if content.Role != "system" {
+			older++
+		}
+	}
+	if older == 0 {
+		return fmt.Errorf("no turn before the last %d to compress", preserve)
+	}
+	summary, _, err := cs.compress(cs.history[:start])
+	if err != nil {
+		return err
+	}
+	cs.history = append(summary, cs.history[start:]...)
+	return nil
+}
+
+// trimEarlierTurns drops the oldest turns, keeping system messages and the
+// current turn, until the estimated tokens dropped reach excess. Whole turns
+// are dropped, so that tool calls keep their responses. It returns the number
+// of messages dropped.
+func (cs *ChatService) trimEarlierTurns(excess int) int {
+	first := 0
+	for first < len(cs.history) && cs.history[first].Role == "system" {
+		first++
+	}
+	current := cs.currentTurnStart()
+	end, dropped := first, 0
+	for end < current && dropped < excess {
+		next := end + 1
+		for next < current && !isTurnStart(cs.history[next]) {
+			next++
+		}
+		dropped += core.EstimateTokens(cs.history[end:next], nil)
+		end = next
+	}
+	if end == first {
+		return 0
+	}
+	cs.history = append(cs.history[:first:first], cs.history[end:]...)
+	return end - first
+}
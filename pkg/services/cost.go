@@ -0,0 +1,316 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"go-ai-agent-v2/go-cli/pkg/telemetry"
+	"go-ai-agent-v2/go-cli/pkg/types"
+)
+
+// defaultModelPricing is the price of the models of the built-in executors,
+// in USD per million tokens. Names are matched exactly, then by the longest
+// prefix, so that dated versions get the price of their family. Local and
+// unknown models are free.
+var defaultModelPricing = map[string]types.ModelPricing{
+	"gemini-pro-latest":        {Input: 1.25, Output: 10},
+	"gemini-2.5-pro":           {Input: 1.25, Output: 10},
+	"gemini-flash-latest":      {Input: 0.30, Output: 2.50},
+	"gemini-2.5-flash":         {Input: 0.30, Output: 2.50},
+	"gemini-flash-lite-latest": {Input: 0.10, Output: 0.40},
+	"gemini-2.5-flash-lite":    {Input: 0.10, Output: 0.40},
+	"gpt-4o":                   {Input: 2.50, Output: 10},
+	"gpt-4o-mini":              {Input: 0.15, Output: 0.60},
+	"gpt-4.1":                  {Input: 2, Output: 8},
+	"gpt-4.1-mini":             {Input: 0.40, Output: 1.60},
+	"claude-opus-4":            {Input: 15, Output: 75},
+	"claude-sonnet-4":          {Input: 3, Output: 15},
+	"claude-3-7-sonnet":        {Input: 3, Output: 15},
+	"claude-3-5-haiku":         {Input: 0.80, Output: 4},
+	"qwen-max":                 {Input: 1.60, Output: 6.40},
+	"qwen-plus":                {Input: 0.40, Output: 1.20},
+	"qwen-turbo":               {Input: 0.05, Output: 0.20},
+	"qwen-flash":               {Input: 0.05, Output: 0.40},
+}
+
+// costLedgerDays is how many days of costs the ledger keeps.
+const costLedgerDays = 31
+
+// ledgerMu serializes updates of the ledger file by the chats of the process.
+var ledgerMu sync.Mutex
+
+// BudgetExceededError is returned when the session or the day has used up
+// its hard budget.
+type BudgetExceededError struct {
+	Scope   string // types.BudgetScopeSession or types.BudgetScopeDay
+	CostUSD float64
+	Limit   float64
+}
+
+func (e *BudgetExceededError) Error() string {
+	setting := "budget.sessionHard"
+	if e.Scope == types.BudgetScopeDay {
+		setting = "budget.dailyHard"
+	}
+	return fmt.Sprintf("%s budget exceeded: spent $%.4f of $%.2f; raise %s to continue", e.Scope, e.CostUSD, e.Limit, setting)
+}
+
+// CostTracker converts token usage to cost and enforces the budgets. The cost
+// of each session is kept in memory, starting from the cost loaded by
+// LoadSessionCosts; the cost of each day is kept in a ledger file, so that
+// the daily budget spans sessions and restarts.
+type CostTracker struct {
+	mu       sync.Mutex
+	settings types.BudgetSettings
+	pricing  map[string]types.ModelPricing
+	path     string             // Ledger file; when empty, daily costs are kept in memory
+	daily    map[string]float64 // By date, as last read from the ledger
+	sessions map[string]float64
+	warned   map[string]bool // Soft budgets already warned about, by scope and session or date
+	now      func() time.Time
+
+	loadSession func(sessionID string) float64
+}
+
+// NewCostTracker creates a CostTracker. The pricing of the settings is added
+// to the built-in prices.
+func NewCostTracker(settings *types.BudgetSettings, ledgerPath string) *CostTracker {
+	t := &CostTracker{
+		pricing:  make(map[string]types.ModelPricing, len(defaultModelPricing)),
+		path:     ledgerPath,
+		daily:    make(map[string]float64),
+		sessions: make(map[string]float64),
+		warned:   make(map[string]bool),
+		now:      time.Now,
+	}
+	for model, price := range defaultModelPricing {
+		t.pricing[model] = price
+	}
+	if settings != nil {
+		t.settings = *settings
+		for model, price := range settings.Pricing {
+			t.pricing[strings.ToLower(model)] = price
+		}
+	}
+	return t
+}
+
+// LoadSessionCosts sets the function that returns the cost a session had
+// before the tracker was created, such as the cost stored in its metadata.
+// It is called the first time the tracker sees a session.
+func (t *CostTracker) LoadSessionCosts(load func(sessionID string) float64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.loadSession = load
+}
+
+// Cost returns the cost in USD of tokens of a model, and whether the model
+// has a price.
+func (t *CostTracker) Cost(model string, inputTokens, outputTokens int) (float64, bool) {
+	model = strings.TrimPrefix(strings.ToLower(model), "models/")
+	price, ok := t.pricing[model]
+	if !ok {
+		longest := ""
+		for name, p := range t.pricing {
+			if strings.HasPrefix(model, name) && len(name) > len(longest) {
+				longest, price, ok = name, p, true
+			}
+		}
+	}
+	if !ok {
+		return 0, false
+	}
+	return (float64(inputTokens)*price.Input + float64(outputTokens)*price.Output) / 1e6, true
+}
+
+// Add records the cost of a model response of a session, and returns a
+// warning for each soft budget it passes.
+func (t *CostTracker) Add(sessionID string, cost float64) []types.BudgetWarningEvent {
+	if cost <= 0 {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.sessions[sessionID] = t.sessionCost(sessionID) + cost
+	day := t.today()
+	t.updateLedger(day, cost)
+
+	var warnings []types.BudgetWarningEvent
+	warn := func(scope, key string, spent, limit float64) {
+		if limit > 0 && spent > limit && !t.warned[scope+":"+key] {
+			t.warned[scope+":"+key] = true
+			warnings = append(warnings, types.BudgetWarningEvent{Scope: scope, CostUSD: spent, Limit: limit})
+		}
+	}
+	warn(types.BudgetScopeSession, sessionID, t.sessions[sessionID], t.settings.SessionSoft)
+	warn(types.BudgetScopeDay, day, t.daily[day], t.settings.DailySoft)
+	return warnings
+}
+
+// Check returns a BudgetExceededError when the session or the day has used
+// up its hard budget. The daily cost is read again from the ledger, since
+// other sessions may have added to it.
+func (t *CostTracker) Check(sessionID string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if limit := t.settings.SessionHard; limit > 0 && t.sessionCost(sessionID) >= limit {
+		return &BudgetExceededError{Scope: types.BudgetScopeSession, CostUSD: t.sessions[sessionID], Limit: limit}
+	}
+	if limit := t.settings.DailyHard; limit > 0 {
+		day := t.today()
+		t.updateLedger(day, 0)
+		if t.daily[day] >= limit {
+			return &BudgetExceededError{Scope: types.BudgetScopeDay, CostUSD: t.daily[day], Limit: limit}
+		}
+	}
+	return nil
+}
+
+// SessionCost returns the cost of a session so far.
+func (t *CostTracker) SessionCost(sessionID string) float64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.sessionCost(sessionID)
+}
+
+// sessionCost returns the cost of a session, loading its earlier cost the
+// first time the session is seen. A session loaded over its soft budget has
+// already been warned about. t.mu must be held.
+func (t *CostTracker) sessionCost(sessionID string) float64 {
+	cost, ok := t.sessions[sessionID]
+	if ok || t.loadSession == nil {
+		return cost
+	}
+	cost = t.loadSession(sessionID)
+	t.sessions[sessionID] = cost
+	if limit := t.settings.SessionSoft; limit > 0 && cost > limit {
+		t.warned[types.BudgetScopeSession+":"+sessionID] = true
+	}
+	return cost
+}
+
+// DailyCost returns the cost of the day so far, as last read from the ledger.
+func (t *CostTracker) DailyCost() float64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.daily[t.today()]
+}
+
+func (t *CostTracker) today() string {
+	return t.now().Format("2006-01-02")
+}
+
+// updateLedger adds cost to a day in the ledger file and refreshes the daily
+// costs from it. Without a ledger file, or when it cannot be written, the
+// cost is only added in memory.
+func (t *CostTracker) updateLedger(day string, cost float64) {
+	if t.path == "" {
+		t.daily[day] += cost
+		return
+	}
+	ledgerMu.Lock()
+	defer ledgerMu.Unlock()
+
+	daily := make(map[string]float64)
+	data, err := os.ReadFile(t.path)
+	if err == nil {
+		err = json.Unmarshal(data, &daily)
+	}
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		telemetry.LogErrorf("Failed to read cost ledger %s: %v", t.path, err)
+		t.daily[day] += cost
+		return
+	}
+	if cost == 0 {
+		t.daily = daily
+		return
+	}
+
+	daily[day] += cost
+	oldest := t.now().AddDate(0, 0, -costLedgerDays).Format("2006-01-02")
+	for date := range daily {
+		if date < oldest {
+			delete(daily, date)
+		}
+	}
+	t.daily = daily
+	if err := writeCostLedger(t.path, daily); err != nil {
+		telemetry.LogErrorf("Failed to write cost ledger %s: %v", t.path, err)
+	}
+}
+
+func writeCostLedger(path string, daily map[string]float64) error {
+	data, err := json.MarshalIndent(daily, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// costTracker returns the cost tracker of the chat, creating it on first use
+// with the budget settings and the ledger of the workspace.
+func (cs *ChatService) costTracker() *CostTracker {
+	cs.costsMu.Lock()
+	defer cs.costsMu.Unlock()
+	if cs.costs == nil {
+		var ledgerPath string
+		if workspaceDir := cs.settingsService.GetWorkspaceDir(); workspaceDir != "" {
+			ledgerPath = filepath.Join(workspaceDir, ".goaiagent", "costs.json")
+		}
+		cs.costs = NewCostTracker(cs.settingsService.GetBudgetSettings(), ledgerPath)
+		cs.costs.LoadSessionCosts(cs.storedSessionCost)
+	}
+	return cs.costs
+}
+
+// storedSessionCost returns the cost of a session recorded in its metadata,
+// so that resumed sessions keep counting towards their budget.
+func (cs *ChatService) storedSessionCost(sessionID string) float64 {
+	metadata, err := cs.sessionService.GetMetadata(sessionID)
+	if err != nil {
+		telemetry.LogErrorf("Failed to load the cost of session %s: %v", sessionID, err)
+		return 0
+	}
+	return metadata.CostUSD
+}
+
+// recordUsage adds tokens used by the model of the executor to the token
+// usage and costs of the chat. It returns their cost and a warning for each
+// soft budget they pass.
+func (cs *ChatService) recordUsage(sessionID string, inputTokens, outputTokens int) (float64, []types.BudgetWarningEvent) {
+	model := cs.executor.Name()
+	usage, ok := cs.tokenUsage[model]
+	if !ok {
+		usage = &types.ModelTokenUsage{}
+		cs.tokenUsage[model] = usage
+	}
+	usage.InputTokens += inputTokens
+	usage.OutputTokens += outputTokens
+
+	costs := cs.costTracker()
+	cost, priced := costs.Cost(model, inputTokens, outputTokens)
+	if !priced {
+		telemetry.LogDebugf("No price for model %s, its tokens are not charged", model)
+	}
+	usage.CostUSD += cost
+	warnings := costs.Add(sessionID, cost)
+	for _, warning := range warnings {
+		telemetry.LogWarnf("The %s cost $%.4f passed the soft budget of $%.2f", warning.Scope, warning.CostUSD, warning.Limit)
+	}
+	return cost, warnings
+}
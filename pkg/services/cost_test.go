@@ -0,0 +1,203 @@
+package services
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go-ai-agent-v2/go-cli/pkg/types"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCostTracker_Cost(t *testing.T) {
+	tracker := NewCostTracker(&types.BudgetSettings{Pricing: map[string]types.ModelPricing{
+		"qwen-plus":  {Input: 1, Output: 2},
+		"llama3:70b": {Input: 0.5, Output: 0.5},
+	}}, "")
+
+	cost, ok := tracker.Cost("gemini-pro-latest", 1_000_000, 100_000)
+	assert.True(t, ok)
+	assert.InDelta(t, 2.25, cost, 1e-9)
+
+	cost, ok = tracker.Cost("claude-sonnet-4-20250514", 1000, 1000)
+	assert.True(t, ok, "dated versions get the price of their family")
+	assert.InDelta(t, 0.018, cost, 1e-9)
+
+	cost, ok = tracker.Cost("gpt-4o-mini-2024-07-18", 1_000_000, 0)
+	assert.True(t, ok)
+	assert.InDelta(t, 0.15, cost, 1e-9, "the longest prefix wins")
+
+	cost, _ = tracker.Cost("qwen-plus", 1_000_000, 1_000_000)
+	assert.InDelta(t, 3, cost, 1e-9, "the settings override the built-in prices")
+	cost, _ = tracker.Cost("llama3:70b", 2_000_000, 0)
+	assert.InDelta(t, 1, cost, 1e-9)
+
+	cost, ok = tracker.Cost("mock", 1000, 1000)
+	assert.False(t, ok)
+	assert.Zero(t, cost)
+}
+
+func TestCostTracker_Budgets(t *testing.T) {
+	ledgerPath := filepath.Join(t.TempDir(), ".goaiagent", "costs.json")
+	settings := &types.BudgetSettings{SessionSoft: 1, SessionHard: 2, DailySoft: 2.5, DailyHard: 4}
+	tracker := NewCostTracker(settings, ledgerPath)
+
+	assert.Empty(t, tracker.Add("a", 0.8))
+	assert.Equal(t, []types.BudgetWarningEvent{{Scope: types.BudgetScopeSession, CostUSD: 1.6, Limit: 1}}, tracker.Add("a", 0.8))
+	assert.Empty(t, tracker.Add("a", 0.1), "soft budgets warn once")
+	assert.NoError(t, tracker.Check("a"))
+
+	tracker.Add("a", 0.5)
+	var exceeded *BudgetExceededError
+	require.ErrorAs(t, tracker.Check("a"), &exceeded)
+	assert.Equal(t, types.BudgetScopeSession, exceeded.Scope)
+	assert.Contains(t, exceeded.Error(), "session budget exceeded: spent $2.2000 of $2.00; raise budget.sessionHard to continue")
+	assert.NoError(t, tracker.Check("b"), "other sessions have their own budget")
+
+	// The daily cost is shared through the ledger with other chats.
+	other := NewCostTracker(settings, ledgerPath)
+	assert.Equal(t, []types.BudgetWarningEvent{{Scope: types.BudgetScopeDay, CostUSD: 3.2, Limit: 2.5}}, other.Add("c", 1))
+	assert.NoError(t, other.Check("c"))
+	tracker.Add("b", 1)
+	require.ErrorAs(t, other.Check("c"), &exceeded)
+	assert.Equal(t, types.BudgetScopeDay, exceeded.Scope)
+	assert.InDelta(t, 4.2, other.DailyCost(), 1e-9)
+	assert.InDelta(t, 1, other.SessionCost("c"), 1e-9)
+
+	// A new day starts from zero, and old days are dropped from the ledger.
+	other.now = func() time.Time { return time.Now().AddDate(0, 0, 40) }
+	assert.NoError(t, other.Check("d"))
+	other.Add("d", 0.1)
+	data, err := os.ReadFile(ledgerPath)
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), time.Now().Format("2006-01-02"))
+}
+
+func TestChatService_SendMessage_EnforcesBudgets(t *testing.T) {
+	_, mockExecutor, sessionService, toolRegistry, mockSettingsService, appConfig, projectRoot, cleanup := setupTestChatService(t)
+	defer cleanup()
+
+	mockSettingsService.ExpectedCalls = nil
+	mockSettingsService.On("Get", mock.Anything).Return(nil, false).Maybe()
+	mockSettingsService.On("GetWorkspaceDir").Return(projectRoot).Maybe()
+	mockSettingsService.On("GetRetrySettings").Return(&types.RetrySettings{MaxAttempts: 1}).Maybe()
+	mockSettingsService.On("GetDangerousTools").Return([]string{}).Maybe()
+	mockSettingsService.On("GetBudgetSettings").Return(&types.BudgetSettings{
+		Pricing:     map[string]types.ModelPricing{"mock": {Input: 1_000_000}}, // $1 per input token
+		SessionSoft: 1.5,
+		SessionHard: 2.5,
+	}).Once()
+
+	// Every turn costs $1 and calls a tool, so only the budget ends the loop.
+	turns := 0
+	mockExecutor.StreamContentFunc = func(ctx context.Context, contents ...*types.Content) (<-chan any, error) {
+		turns++
+		eventChan := make(chan any, 2)
+		eventChan <- types.TokenCountEvent{InputTokens: 1}
+		eventChan <- types.Part{FunctionCall: &types.FunctionCall{ID: "call", Name: "list_directory", Args: map[string]any{}}}
+		close(eventChan)
+		return eventChan, nil
+	}
+	chatService, err := NewChatService(mockExecutor, toolRegistry, sessionService, mockSettingsService, NewContextService(projectRoot), appConfig, types.GenerateContentConfig{}, nil)
+	require.NoError(t, err)
+
+	eventChan, err := chatService.SendMessage(context.Background(), "budget_session", "Keep going")
+	require.NoError(t, err)
+	var costs []float64
+	var warnings []types.BudgetWarningEvent
+	var lastErr error
+	for event := range eventChan {
+		switch e := event.(type) {
+		case types.TokenCountEvent:
+			costs = append(costs, e.CostUSD)
+		case types.BudgetWarningEvent:
+			warnings = append(warnings, e)
+		case types.ErrorEvent:
+			lastErr = e.Err
+		}
+	}
+
+	assert.Equal(t, 3, turns)
+	assert.Equal(t, []float64{1, 1, 1}, costs)
+	assert.Equal(t, []types.BudgetWarningEvent{{Scope: types.BudgetScopeSession, CostUSD: 2, Limit: 1.5}}, warnings)
+	var exceeded *BudgetExceededError
+	require.ErrorAs(t, lastErr, &exceeded)
+	assert.Equal(t, 2.5, exceeded.Limit)
+
+	metrics := chatService.GetSessionMetrics()
+	assert.Equal(t, 3, metrics.InputTokens)
+	assert.Equal(t, 3.0, metrics.CostUSD)
+	assert.Equal(t, 3.0, metrics.DailyCostUSD)
+	assert.Equal(t, 3.0, metrics.TokenUsage["mock"].CostUSD)
+
+	history, err := sessionService.LoadHistory("budget_session")
+	require.NoError(t, err)
+	assert.Len(t, history, 7, "the history is saved when the budget stops the loop")
+}
+
+func TestCostTracker_LoadsSessionCosts(t *testing.T) {
+	tracker := NewCostTracker(&types.BudgetSettings{SessionSoft: 1, SessionHard: 2}, "")
+	loads := 0
+	tracker.LoadSessionCosts(func(sessionID string) float64 {
+		loads++
+		if sessionID == "resumed" {
+			return 1.5
+		}
+		return 0
+	})
+
+	assert.NoError(t, tracker.Check("resumed"))
+	assert.Empty(t, tracker.Add("resumed", 0.2), "the soft budget was passed before the session was resumed")
+	assert.InDelta(t, 1.7, tracker.SessionCost("resumed"), 1e-9)
+	tracker.Add("resumed", 0.3)
+	var exceeded *BudgetExceededError
+	require.ErrorAs(t, tracker.Check("resumed"), &exceeded)
+	assert.InDelta(t, 2, exceeded.CostUSD, 1e-9)
+	assert.Equal(t, 1, loads, "a session is loaded once")
+
+	assert.Equal(t, []types.BudgetWarningEvent{{Scope: types.BudgetScopeSession, CostUSD: 1.2, Limit: 1}}, tracker.Add("new", 1.2))
+}
+
+func TestChatService_SendMessage_ResumedSessionKeepsBudget(t *testing.T) {
+	_, mockExecutor, sessionService, toolRegistry, mockSettingsService, appConfig, projectRoot, cleanup := setupTestChatService(t)
+	defer cleanup()
+
+	mockSettingsService.ExpectedCalls = nil
+	mockSettingsService.On("Get", mock.Anything).Return(nil, false).Maybe()
+	mockSettingsService.On("GetWorkspaceDir").Return(projectRoot).Maybe()
+	mockSettingsService.On("GetRetrySettings").Return(&types.RetrySettings{MaxAttempts: 1}).Maybe()
+	mockSettingsService.On("GetDangerousTools").Return([]string{}).Maybe()
+	mockSettingsService.On("GetBudgetSettings").Return(&types.BudgetSettings{SessionHard: 2.5}).Once()
+
+	// The session spent its budget before it was resumed by a new chat.
+	require.NoError(t, sessionService.SaveHistory("spent_session", []*types.Content{{Role: "user", Parts: []types.Part{{Text: "Earlier"}}}}))
+	require.NoError(t, sessionService.UpdateMetadata("spent_session", func(metadata *SessionMetadata) {
+		metadata.CostUSD = 3
+	}))
+	mockExecutor.StreamContentFunc = func(ctx context.Context, contents ...*types.Content) (<-chan any, error) {
+		t.Error("the model should not be called over the budget")
+		eventChan := make(chan any)
+		close(eventChan)
+		return eventChan, nil
+	}
+	chatService, err := NewChatService(mockExecutor, toolRegistry, sessionService, mockSettingsService, NewContextService(projectRoot), appConfig, types.GenerateContentConfig{}, nil)
+	require.NoError(t, err)
+
+	eventChan, err := chatService.SendMessage(context.Background(), "spent_session", "Keep going")
+	require.NoError(t, err)
+	var lastErr error
+	for event := range eventChan {
+		if e, ok := event.(types.ErrorEvent); ok {
+			lastErr = e.Err
+		}
+	}
+	var exceeded *BudgetExceededError
+	require.ErrorAs(t, lastErr, &exceeded)
+	assert.Equal(t, types.BudgetScopeSession, exceeded.Scope)
+	assert.Equal(t, 3.0, exceeded.CostUSD)
+}
@@ -0,0 +1,150 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"go-ai-agent-v2/go-cli/pkg/core"
+	"go-ai-agent-v2/go-cli/pkg/routing"
+	"go-ai-agent-v2/go-cli/pkg/telemetry"
+	"go-ai-agent-v2/go-cli/pkg/types"
+)
+
+// fallbackReason reports whether a stream error should make the chat switch
+// to the next fallback model, and why.
+func fallbackReason(err error) (string, bool) {
+	if IsContextLengthError(err) {
+		return "Context length exceeded", true
+	}
+	if !IsTransientError(err) {
+		return "", false
+	}
+	switch code := errorStatusCode(err); {
+	case code == http.StatusTooManyRequests:
+		return "Rate limited", true
+	case code != 0:
+		return fmt.Sprintf("Server error (%d)", code), true
+	default:
+		return "Timeout", true
+	}
+}
+
+// nextFallback returns the executor and model to switch to from the current
+// one: the next entry of the configured chain or, without a chain, the model
+// suggested by the routing fallback strategy for the current executor.
+func (cs *ChatService) nextFallback(ctx context.Context, settings *types.ModelFallbackSettings) (types.ModelFallback, bool) {
+	if len(settings.Chain) > 0 {
+		if cs.fallbackDepth < len(settings.Chain) {
+			return settings.Chain[cs.fallbackDepth], true
+		}
+		return types.ModelFallback{}, false
+	}
+
+	routingCtx := &routing.RoutingContext{
+		Signal:       ctx,
+		IsFallback:   true,
+		ExecutorType: cs.current.Executor,
+	}
+	decision, err := (&routing.FallbackStrategy{}).Route(routingCtx, cs.appConfig.WithModel(cs.current.Model))
+	if err != nil || decision == nil || decision.Model == cs.current.Model {
+		return types.ModelFallback{}, false
+	}
+	return types.ModelFallback{Executor: cs.current.Executor, Model: decision.Model}, true
+}
+
+// switchToFallback replaces the executor after a failed stream. The new
+// executor starts from the current history and generation config. Unless a
+// cooldown is configured, the switch is saved to the settings.
+func (cs *ChatService) switchToFallback(ctx context.Context, eventChan chan any, streamErr error) bool {
+	reason, ok := fallbackReason(streamErr)
+	if !ok || ctx.Err() != nil {
+		return false
+	}
+	settings := cs.settingsService.GetModelFallbackSettings()
+	if settings == nil {
+		settings = &types.ModelFallbackSettings{}
+	}
+	if cs.fallbackDepth == 0 {
+		executorTypeVal, _ := cs.settingsService.Get("executor")
+		cs.primary.Executor, _ = executorTypeVal.(string)
+		if modelVal, ok := cs.appConfig.Get("model"); ok {
+			cs.primary.Model, _ = modelVal.(string)
+		}
+		if cs.routedModel != "" {
+			cs.primary.Model = cs.routedModel // The model picked for this turn, rather than "auto"
+		}
+		cs.primaryExecutor = cs.executor
+		cs.current = cs.primary
+	}
+
+	startDepth := cs.fallbackDepth
+	for {
+		next, ok := cs.nextFallback(ctx, settings)
+		if !ok {
+			telemetry.LogDebugf("No fallback model left after %s/%s: %v", cs.current.Executor, cs.current.Model, streamErr)
+			cs.fallbackDepth = startDepth
+			return false
+		}
+		cs.fallbackDepth++
+
+		executor, err := cs.newExecutor(next)
+		if err != nil {
+			telemetry.LogErrorf("Failed to create fallback executor %s/%s: %v", next.Executor, next.Model, err)
+			if len(settings.Chain) == 0 {
+				cs.fallbackDepth = startDepth
+				return false
+			}
+			continue // Try the next entry of the chain
+		}
+
+		eventChan <- types.ModelSwitchEvent{OldModel: cs.current.Model, NewModel: next.Model, Executor: next.Executor, Reason: reason}
+		telemetry.LogDebugf("Switched from %s/%s to %s/%s: %v", cs.current.Executor, cs.current.Model, next.Executor, next.Model, streamErr)
+		cs.executor = executor
+		cs.current = next
+		cs.fallbackAt = time.Now()
+		if settings.Cooldown <= 0 {
+			cs.settingsService.Set("executor", next.Executor)
+			cs.settingsService.Set("model", next.Model)
+		}
+		return true
+	}
+}
+
+// restorePrimaryModel switches back to the primary executor once the
+// configured cooldown has passed since the last fallback.
+func (cs *ChatService) restorePrimaryModel(eventChan chan any) {
+	if cs.fallbackDepth == 0 {
+		return
+	}
+	settings := cs.settingsService.GetModelFallbackSettings()
+	if settings == nil || settings.Cooldown <= 0 || time.Since(cs.fallbackAt) < time.Duration(settings.Cooldown)*time.Second {
+		return
+	}
+
+	eventChan <- types.ModelSwitchEvent{OldModel: cs.current.Model, NewModel: cs.primary.Model, Executor: cs.primary.Executor, Reason: "Fallback cooldown elapsed"}
+	cs.executor = cs.primaryExecutor
+	cs.current = cs.primary
+	cs.fallbackDepth = 0
+}
+
+// newExecutor creates an executor for a fallback or routed model.
+func (cs *ChatService) newExecutor(fallback types.ModelFallback) (core.Executor, error) {
+	if fallback.Executor == "" || fallback.Model == "" {
+		return nil, errors.New("fallback needs both an executor and a model")
+	}
+	cfg := cs.appConfig.WithModel(fallback.Model)
+	factory, err := core.NewExecutorFactory(fallback.Executor, cfg)
+	if err != nil {
+		return nil, err
+	}
+	executor, err := factory.NewExecutor(cfg, cs.generationConfig, cs.history)
+	if err != nil {
+		return nil, err
+	}
+	executor.SetToolConfirmationChannel(cs.ToolConfirmationChan)
+	executor.SetUserConfirmationChannel(cs.userConfirmationChan)
+	return NewRetryingExecutor(executor, cs.settingsService), nil
+}
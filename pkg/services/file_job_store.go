@@ -0,0 +1,88 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	jobFileSuffix = "_job.json"
+)
+
+// FileJobStore is a file-based implementation of the JobStore interface.
+type FileJobStore struct {
+	jobsPath string
+}
+
+// NewFileJobStore creates a new FileJobStore.
+func NewFileJobStore(jobsPath string) (*FileJobStore, error) {
+	if err := os.MkdirAll(jobsPath, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create jobs directory: %w", err)
+	}
+	return &FileJobStore{
+		jobsPath: jobsPath,
+	}, nil
+}
+
+// getJobFilePath returns the full path for a given job ID.
+func (s *FileJobStore) getJobFilePath(jobID string) string {
+	return filepath.Join(s.jobsPath, fmt.Sprintf("%s%s", jobID, jobFileSuffix))
+}
+
+// Save writes a job to a JSON file. The file is replaced atomically, so that
+// a crash never leaves a truncated job behind.
+func (s *FileJobStore) Save(job *Job) error {
+	data, err := json.MarshalIndent(job, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal job: %w", err)
+	}
+
+	filePath := s.getJobFilePath(job.ID)
+	tmpPath := filePath + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+		return fmt.Errorf("failed to write job file: %w", err)
+	}
+	if err := os.Rename(tmpPath, filePath); err != nil {
+		return fmt.Errorf("failed to write job file: %w", err)
+	}
+	return nil
+}
+
+// List loads all saved jobs.
+func (s *FileJobStore) List() ([]*Job, error) {
+	files, err := os.ReadDir(s.jobsPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read jobs directory: %w", err)
+	}
+
+	var jobs []*Job
+	for _, file := range files {
+		if file.IsDir() || !strings.HasSuffix(file.Name(), jobFileSuffix) {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(s.jobsPath, file.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read job file: %w", err)
+		}
+		var job Job
+		if err := json.Unmarshal(data, &job); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal job %s: %w", file.Name(), err)
+		}
+		jobs = append(jobs, &job)
+	}
+	return jobs, nil
+}
+
+// Delete deletes the file of a job.
+func (s *FileJobStore) Delete(jobID string) error {
+	if err := os.Remove(s.getJobFilePath(jobID)); err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to delete job file: %w", err)
+	}
+	return nil
+}
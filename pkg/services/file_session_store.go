@@ -1,25 +1,50 @@
 package services
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
 	"sort"
 	"strings"
+	"syscall"
+	"time"
 
+	"go-ai-agent-v2/go-cli/pkg/telemetry"
 	"go-ai-agent-v2/go-cli/pkg/types"
 )
 
 const (
-	fileSuffix = "_session.json"
+	fileSuffix     = "_session.json"
+	metadataSuffix = "_meta.json"
+	journalSuffix  = "_journal.jsonl"
+	lockFileName   = ".sessions.lock"
 )
 
+// maxJournalEntries is the number of entries from which the journal of a
+// session is compacted into a single entry holding the whole history.
+const maxJournalEntries = 100
+
 // FileSessionStore is a file-based implementation of the SessionStore interface.
+//
+// Each session has a snapshot of its history, replaced atomically on every
+// save, and an append-only journal of the changes to it, written first. When
+// a crash leaves the snapshot behind the journal, or a torn last line in the
+// journal, the history is rebuilt from whichever is intact. Writers of all
+// processes are serialized with a lock file in the sessions directory.
 type FileSessionStore struct {
 	sessionsPath string
 }
 
+// journalEntry is a line of a session journal: the history is cut to its
+// first Base messages, and Messages are appended to it.
+type journalEntry struct {
+	Time     time.Time         `json:"time"`
+	Base     int               `json:"base"`
+	Messages []json.RawMessage `json:"messages"`
+}
+
 // NewFileSessionStore creates a new FileSessionStore.
 func NewFileSessionStore(sessionsPath string) (*FileSessionStore, error) {
 	if err := os.MkdirAll(sessionsPath, 0755); err != nil {
@@ -35,22 +60,174 @@ func (s *FileSessionStore) getSessionFilePath(sessionID string) string {
 	return filepath.Join(s.sessionsPath, fmt.Sprintf("%s%s", sessionID, fileSuffix))
 }
 
-// Save saves the chat history for a given session ID to a JSON file.
+// getJournalFilePath returns the full path of the journal of a session.
+func (s *FileSessionStore) getJournalFilePath(sessionID string) string {
+	return filepath.Join(s.sessionsPath, sessionID+journalSuffix)
+}
+
+// lock takes the lock of the store, shared for readers or exclusive for
+// writers, and returns the function that releases it.
+func (s *FileSessionStore) lock(exclusive bool) (func(), error) {
+	file, err := os.OpenFile(filepath.Join(s.sessionsPath, lockFileName), os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open session lock file: %w", err)
+	}
+	how := syscall.LOCK_SH
+	if exclusive {
+		how = syscall.LOCK_EX
+	}
+	if err := syscall.Flock(int(file.Fd()), how); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to lock sessions: %w", err)
+	}
+	return func() {
+		syscall.Flock(int(file.Fd()), syscall.LOCK_UN)
+		file.Close()
+	}, nil
+}
+
+// Save saves the chat history for a given session ID. The change is appended
+// to the journal of the session before its snapshot is replaced.
 func (s *FileSessionStore) Save(sessionID string, history []*types.Content) error {
-	filePath := s.getSessionFilePath(sessionID)
+	messages := make([]json.RawMessage, len(history))
+	for i, content := range history {
+		message, err := json.Marshal(content)
+		if err != nil {
+			return fmt.Errorf("failed to marshal history: %w", err)
+		}
+		messages[i] = message
+	}
 	data, err := json.MarshalIndent(history, "", "  ")
 	if err != nil {
 		return fmt.Errorf("failed to marshal history: %w", err)
 	}
 
-	if err := os.WriteFile(filePath, data, 0644); err != nil {
+	unlock, err := s.lock(true)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if err := s.appendJournal(sessionID, messages); err != nil {
+		return err
+	}
+	if err := writeFileAtomic(s.getSessionFilePath(sessionID), data); err != nil {
 		return fmt.Errorf("failed to write session file: %w", err)
 	}
 	return nil
 }
 
-// Load loads the chat history for a given session ID from a JSON file.
+// appendJournal appends the difference between the journaled history of a
+// session and messages to its journal. Journals that are unreadable or have
+// grown too long are rewritten with a single entry instead.
+func (s *FileSessionStore) appendJournal(sessionID string, messages []json.RawMessage) error {
+	saved, entries, torn, err := s.readJournal(sessionID)
+	if err != nil {
+		telemetry.LogWarnf("Rewriting the journal of session %s: %v", sessionID, err)
+	}
+	if err != nil || torn || entries == 0 || entries >= maxJournalEntries {
+		entry, err := json.Marshal(journalEntry{Time: time.Now(), Messages: messages})
+		if err != nil {
+			return fmt.Errorf("failed to marshal journal entry: %w", err)
+		}
+		if err := writeFileAtomic(s.getJournalFilePath(sessionID), append(entry, '\n')); err != nil {
+			return fmt.Errorf("failed to write session journal: %w", err)
+		}
+		return nil
+	}
+
+	base := 0
+	for base < len(saved) && base < len(messages) && bytes.Equal(saved[base], messages[base]) {
+		base++
+	}
+	if base == len(saved) && base == len(messages) {
+		return nil
+	}
+	entry, err := json.Marshal(journalEntry{Time: time.Now(), Base: base, Messages: messages[base:]})
+	if err != nil {
+		return fmt.Errorf("failed to marshal journal entry: %w", err)
+	}
+	file, err := os.OpenFile(s.getJournalFilePath(sessionID), os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open session journal: %w", err)
+	}
+	defer file.Close()
+	if _, err := file.Write(append(entry, '\n')); err != nil {
+		return fmt.Errorf("failed to append to session journal: %w", err)
+	}
+	if err := file.Sync(); err != nil {
+		return fmt.Errorf("failed to sync session journal: %w", err)
+	}
+	return nil
+}
+
+// readJournal replays the journal of a session and returns its history and
+// number of entries. A missing journal has no entries. A torn last line, left
+// by a crash during an append, is skipped and reported; other damage is an
+// error.
+func (s *FileSessionStore) readJournal(sessionID string) (messages []json.RawMessage, entries int, torn bool, err error) {
+	data, err := os.ReadFile(s.getJournalFilePath(sessionID))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, 0, false, nil
+		}
+		return nil, 0, false, fmt.Errorf("failed to read session journal: %w", err)
+	}
+
+	lines := bytes.Split(bytes.TrimRight(data, "\n"), []byte("\n"))
+	for i, line := range lines {
+		if len(line) == 0 {
+			continue
+		}
+		var entry journalEntry
+		if err := json.Unmarshal(line, &entry); err != nil {
+			if i == len(lines)-1 {
+				telemetry.LogWarnf("Skipping the incomplete last entry of the journal of session %s", sessionID)
+				torn = true
+				break
+			}
+			return nil, 0, false, fmt.Errorf("session journal is corrupt at line %d: %w", i+1, err)
+		}
+		if entry.Base < 0 || entry.Base > len(messages) {
+			return nil, 0, false, fmt.Errorf("session journal is corrupt at line %d: base %d is past %d messages", i+1, entry.Base, len(messages))
+		}
+		messages = append(messages[:entry.Base:entry.Base], entry.Messages...)
+		entries++
+	}
+	return messages, entries, torn, nil
+}
+
+// Load loads the chat history for a given session ID from its journal, or
+// from its snapshot when it has no readable journal.
 func (s *FileSessionStore) Load(sessionID string) ([]*types.Content, error) {
+	unlock, err := s.lock(false)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	return s.load(sessionID)
+}
+
+// load implements Load. The lock must be held.
+func (s *FileSessionStore) load(sessionID string) ([]*types.Content, error) {
+	messages, entries, _, err := s.readJournal(sessionID)
+	if err != nil {
+		telemetry.LogWarnf("Loading session %s from its snapshot: %v", sessionID, err)
+	}
+	if err == nil && entries > 0 {
+		history := make([]*types.Content, len(messages))
+		for i, message := range messages {
+			if err := json.Unmarshal(message, &history[i]); err != nil {
+				return nil, fmt.Errorf("failed to unmarshal history: %w", err)
+			}
+		}
+		return history, nil
+	}
+	return s.loadSnapshot(sessionID)
+}
+
+// loadSnapshot loads the history of a session from its snapshot.
+func (s *FileSessionStore) loadSnapshot(sessionID string) ([]*types.Content, error) {
 	filePath := s.getSessionFilePath(sessionID)
 
 	if _, err := os.Stat(filePath); os.IsNotExist(err) {
@@ -81,34 +258,171 @@ func (s *FileSessionStore) List() ([]string, error) {
 		return nil, fmt.Errorf("failed to read sessions directory: %w", err)
 	}
 
-	var sessions []string
+	// A session whose first save crashed before its snapshot has a journal only.
+	modTimes := map[string]time.Time{}
 	for _, file := range files {
-		if !file.IsDir() && strings.HasSuffix(file.Name(), fileSuffix) {
-			sessionID := strings.TrimSuffix(file.Name(), fileSuffix)
-			sessions = append(sessions, sessionID)
+		if file.IsDir() {
+			continue
+		}
+		sessionID, ok := strings.CutSuffix(file.Name(), fileSuffix)
+		if !ok {
+			sessionID, ok = strings.CutSuffix(file.Name(), journalSuffix)
+		}
+		if !ok {
+			continue
+		}
+		info, err := file.Info()
+		if err != nil {
+			continue
+		}
+		if modTime, seen := modTimes[sessionID]; !seen || info.ModTime().After(modTime) {
+			modTimes[sessionID] = info.ModTime()
 		}
 	}
 
-	sort.SliceStable(sessions, func(i, j int) bool {
-		infoI, errI := os.Stat(s.getSessionFilePath(sessions[i]))
-		infoJ, errJ := os.Stat(s.getSessionFilePath(sessions[j]))
-		if errI != nil || errJ != nil {
-			return false
+	sessions := make([]string, 0, len(modTimes))
+	for sessionID := range modTimes {
+		sessions = append(sessions, sessionID)
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		if !modTimes[sessions[i]].Equal(modTimes[sessions[j]]) {
+			return modTimes[sessions[i]].After(modTimes[sessions[j]])
 		}
-		return infoI.ModTime().After(infoJ.ModTime())
+		return sessions[i] > sessions[j]
 	})
 
 	return sessions, nil
 }
 
-// Delete deletes the session file for a given session ID.
+// Delete deletes the snapshot, journal and metadata files for a given session ID.
 func (s *FileSessionStore) Delete(sessionID string) error {
-	filePath := s.getSessionFilePath(sessionID)
-	if err := os.Remove(filePath); err != nil {
+	unlock, err := s.lock(true)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	for _, filePath := range []string{s.getSessionFilePath(sessionID), s.getJournalFilePath(sessionID), s.getMetadataFilePath(sessionID)} {
+		if err := os.Remove(filePath); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to delete session file: %w", err)
+		}
+	}
+	return nil
+}
+
+// getMetadataFilePath returns the full path of the metadata of a session.
+func (s *FileSessionStore) getMetadataFilePath(sessionID string) string {
+	return filepath.Join(s.sessionsPath, sessionID+metadataSuffix)
+}
+
+// SaveMetadata saves the metadata of a session to a JSON file beside its history.
+func (s *FileSessionStore) SaveMetadata(metadata *SessionMetadata) error {
+	data, err := json.MarshalIndent(metadata, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal session metadata: %w", err)
+	}
+	unlock, err := s.lock(true)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	if err := writeFileAtomic(s.getMetadataFilePath(metadata.ID), data); err != nil {
+		return fmt.Errorf("failed to write session metadata file: %w", err)
+	}
+	return nil
+}
+
+// LoadMetadata loads the metadata of a session, or nil when it has none.
+func (s *FileSessionStore) LoadMetadata(sessionID string) (*SessionMetadata, error) {
+	unlock, err := s.lock(false)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	return s.loadMetadata(sessionID)
+}
+
+// UpdateMetadata applies update to the metadata of a session, derived from
+// its history when it has none, and saves it. The lock is held from reading
+// the metadata to replacing it, so that concurrent updates are not lost.
+func (s *FileSessionStore) UpdateMetadata(sessionID string, update func(metadata *SessionMetadata)) error {
+	unlock, err := s.lock(true)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	metadata, err := s.loadMetadata(sessionID)
+	if err != nil {
+		return err
+	}
+	if metadata == nil {
+		history, err := s.load(sessionID)
+		if err != nil {
+			return err
+		}
+		metadata = deriveSessionMetadata(sessionID, history)
+	}
+	update(metadata)
+	data, err := json.MarshalIndent(metadata, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal session metadata: %w", err)
+	}
+	if err := writeFileAtomic(s.getMetadataFilePath(sessionID), data); err != nil {
+		return fmt.Errorf("failed to write session metadata file: %w", err)
+	}
+	return nil
+}
+
+// loadMetadata implements LoadMetadata. The lock must be held.
+func (s *FileSessionStore) loadMetadata(sessionID string) (*SessionMetadata, error) {
+	data, err := os.ReadFile(s.getMetadataFilePath(sessionID))
+	if err != nil {
 		if os.IsNotExist(err) {
-			return nil
+			return nil, nil
 		}
-		return fmt.Errorf("failed to delete session file: %w", err)
+		return nil, fmt.Errorf("failed to read session metadata file: %w", err)
+	}
+	var metadata SessionMetadata
+	if err := json.Unmarshal(data, &metadata); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal session metadata: %w", err)
+	}
+	return &metadata, nil
+}
+
+// writeFileAtomic replaces a file with data through a synced temporary file
+// in the same directory, so that readers and crashes see either the old or
+// the new content, never a part of it.
+func writeFileAtomic(filePath string, data []byte) error {
+	dir := filepath.Dir(filePath)
+	file, err := os.CreateTemp(dir, filepath.Base(filePath)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	tmpPath := file.Name()
+	defer os.Remove(tmpPath) // Fails once renamed
+
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmpPath, 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpPath, filePath); err != nil {
+		return err
+	}
+	// Sync the directory too, so that the rename survives a power loss.
+	if dirFile, err := os.Open(dir); err == nil {
+		dirFile.Sync()
+		dirFile.Close()
 	}
 	return nil
 }
@@ -0,0 +1,186 @@
+package services
+
+import (
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go-ai-agent-v2/go-cli/pkg/types"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func textContent(role, text string) *types.Content {
+	return &types.Content{Role: role, Parts: []types.Part{{Text: text}}}
+}
+
+func TestFileSessionStore_Journal(t *testing.T) {
+	store, err := NewFileSessionStore(t.TempDir())
+	require.NoError(t, err)
+
+	history := []*types.Content{textContent("user", "Hello"), textContent("model", "Hi")}
+	require.NoError(t, store.Save("s1", history))
+	history = append(history, textContent("user", "Fix the tests"))
+	require.NoError(t, store.Save("s1", history))
+	// A compressed history replaces the earlier messages.
+	compressed := []*types.Content{textContent("user", "Summary"), history[2]}
+	require.NoError(t, store.Save("s1", compressed))
+
+	journal, err := os.ReadFile(store.getJournalFilePath("s1"))
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(journal)), "\n")
+	require.Len(t, lines, 3, "each change should append one entry")
+	assert.Contains(t, lines[1], `"base":2`, "only the new message should be appended")
+	assert.NotContains(t, lines[1], "Hello")
+
+	loaded, err := store.Load("s1")
+	require.NoError(t, err)
+	assert.Equal(t, compressed, loaded)
+
+	t.Run("stale snapshot", func(t *testing.T) {
+		// A crash between the journal append and the snapshot rename.
+		require.NoError(t, os.WriteFile(store.getSessionFilePath("s1"), []byte(`[{"role":"user","parts":[{"text":"Hel`), 0644))
+		loaded, err := store.Load("s1")
+		require.NoError(t, err)
+		assert.Equal(t, compressed, loaded)
+	})
+
+	t.Run("torn journal entry", func(t *testing.T) {
+		file, err := os.OpenFile(store.getJournalFilePath("s1"), os.O_APPEND|os.O_WRONLY, 0644)
+		require.NoError(t, err)
+		_, err = file.WriteString(`{"time":"2024-01-15T15:04:05Z","base":2,"messages":[{"role":"mo`)
+		require.NoError(t, err)
+		require.NoError(t, file.Close())
+
+		loaded, err := store.Load("s1")
+		require.NoError(t, err)
+		assert.Equal(t, compressed, loaded)
+
+		// The next save rewrites the damaged journal.
+		require.NoError(t, store.Save("s1", append(compressed, textContent("model", "Done"))))
+		loaded, err = store.Load("s1")
+		require.NoError(t, err)
+		assert.Len(t, loaded, 3)
+	})
+
+	t.Run("corrupt journal", func(t *testing.T) {
+		require.NoError(t, store.Save("s2", history))
+		require.NoError(t, os.WriteFile(store.getJournalFilePath("s2"), []byte("garbage\n{}\n"), 0644))
+		loaded, err := store.Load("s2")
+		require.NoError(t, err)
+		assert.Equal(t, history, loaded, "the snapshot should be used")
+	})
+}
+
+func TestFileSessionStore_JournalCompaction(t *testing.T) {
+	store, err := NewFileSessionStore(t.TempDir())
+	require.NoError(t, err)
+
+	var history []*types.Content
+	for i := 0; i < maxJournalEntries+5; i++ {
+		history = append(history, textContent("user", "message"))
+		require.NoError(t, store.Save("s1", history))
+	}
+	_, entries, _, err := store.readJournal("s1")
+	require.NoError(t, err)
+	assert.Equal(t, 5, entries)
+
+	loaded, err := store.Load("s1")
+	require.NoError(t, err)
+	assert.Len(t, loaded, maxJournalEntries+5)
+}
+
+func TestFileSessionStore_ListJournalOnly(t *testing.T) {
+	store, err := NewFileSessionStore(t.TempDir())
+	require.NoError(t, err)
+
+	history := []*types.Content{textContent("user", "Hello")}
+	require.NoError(t, store.Save("s1", history))
+	// A crash during the first save, before the snapshot was written.
+	require.NoError(t, os.Remove(store.getSessionFilePath("s1")))
+
+	sessions, err := store.List()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"s1"}, sessions)
+	loaded, err := store.Load("s1")
+	require.NoError(t, err)
+	assert.Equal(t, history, loaded)
+
+	require.NoError(t, store.Delete("s1"))
+	sessions, err = store.List()
+	require.NoError(t, err)
+	assert.Empty(t, sessions)
+}
+
+func TestFileSessionStore_ConcurrentSaves(t *testing.T) {
+	sessionsPath := t.TempDir()
+	// Two stores on the same directory stand for two processes.
+	stores := make([]*FileSessionStore, 2)
+	for i := range stores {
+		store, err := NewFileSessionStore(sessionsPath)
+		require.NoError(t, err)
+		stores[i] = store
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			history := make([]*types.Content, i+1)
+			for j := range history {
+				history[j] = textContent("user", strings.Repeat("x", 1000))
+			}
+			assert.NoError(t, stores[i%2].Save("s1", history))
+		}(i)
+	}
+	wg.Wait()
+
+	fromJournal, err := stores[0].Load("s1")
+	require.NoError(t, err)
+	fromSnapshot, err := stores[1].loadSnapshot("s1")
+	require.NoError(t, err)
+	assert.Equal(t, fromSnapshot, fromJournal, "the journal and the snapshot should agree")
+
+	matches, err := os.ReadDir(sessionsPath)
+	require.NoError(t, err)
+	for _, file := range matches {
+		assert.False(t, strings.HasSuffix(file.Name(), ".tmp"), "temporary files should be removed")
+	}
+}
+
+func TestFileSessionStore_ConcurrentMetadataUpdates(t *testing.T) {
+	sessionsPath := t.TempDir()
+	// Two session services on the same directory stand for two processes.
+	services := make([]*SessionService, 2)
+	for i := range services {
+		store, err := NewFileSessionStore(sessionsPath)
+		require.NoError(t, err)
+		services[i], err = NewSessionService(store)
+		require.NoError(t, err)
+	}
+	require.NoError(t, services[0].SaveHistory("s1", []*types.Content{textContent("user", "Count the tokens")}))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 40; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			assert.NoError(t, services[i%2].UpdateMetadata("s1", func(metadata *SessionMetadata) {
+				tokens := metadata.InputTokens
+				time.Sleep(time.Millisecond) // Widens the window for a lost update
+				metadata.InputTokens = tokens + 10
+			}))
+		}(i)
+	}
+	wg.Wait()
+
+	metadata, err := services[1].GetMetadata("s1")
+	require.NoError(t, err)
+	assert.Equal(t, 400, metadata.InputTokens, "no update should be lost")
+	assert.Equal(t, "Count the tokens", metadata.Title)
+	assert.Equal(t, 1, metadata.MessageCount)
+}
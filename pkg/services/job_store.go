@@ -0,0 +1,67 @@
+package services
+
+import (
+	"sync"
+	"time"
+)
+
+// Job is a queued prompt of the agent server that has not finished yet.
+type Job struct {
+	ID          string    `json:"id"`
+	Prompt      string    `json:"prompt"`
+	Priority    int       `json:"priority,omitempty"` // Higher runs first
+	CallbackURL string    `json:"callbackUrl,omitempty"`
+	Owner       string    `json:"owner,omitempty"` // Name of the principal that submitted the job
+	Attempts    int       `json:"attempts"`
+	ToolCalls   int       `json:"toolCalls,omitempty"` // Tool calls started by the current attempt
+	NotBefore   time.Time `json:"notBefore,omitempty"` // Retries wait until then
+	CreatedAt   time.Time `json:"createdAt"`
+}
+
+// JobStore is the interface for job persistence. Jobs are deleted once they
+// finish, so the store holds what must be resumed after a restart.
+type JobStore interface {
+	Save(job *Job) error
+	List() ([]*Job, error)
+	Delete(jobID string) error
+}
+
+// MemoryJobStore is a JobStore that keeps jobs in memory only, for servers
+// that do not need to resume jobs after a restart.
+type MemoryJobStore struct {
+	mu   sync.Mutex
+	jobs map[string]Job
+}
+
+// NewMemoryJobStore creates a new MemoryJobStore.
+func NewMemoryJobStore() *MemoryJobStore {
+	return &MemoryJobStore{jobs: make(map[string]Job)}
+}
+
+// Save keeps a copy of a job.
+func (s *MemoryJobStore) Save(job *Job) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.jobs[job.ID] = *job
+	return nil
+}
+
+// List returns copies of all jobs.
+func (s *MemoryJobStore) List() ([]*Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	jobs := make([]*Job, 0, len(s.jobs))
+	for _, job := range s.jobs {
+		job := job
+		jobs = append(jobs, &job)
+	}
+	return jobs, nil
+}
+
+// Delete removes a job.
+func (s *MemoryJobStore) Delete(jobID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.jobs, jobID)
+	return nil
+}
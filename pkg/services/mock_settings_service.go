@@ -83,6 +83,78 @@ func (m *MockSettingsService) GetCodebaseInvestigatorSettings() *types.CodebaseI
 	return args.Get(0).(*types.CodebaseInvestigatorSettings)
 }
 
+// GetOpenAISettings provides a mock function for GetOpenAISettings.
+func (m *MockSettingsService) GetOpenAISettings() *types.OpenAISettings {
+	args := m.Called()
+	if args.Get(0) == nil {
+		return nil
+	}
+	return args.Get(0).(*types.OpenAISettings)
+}
+
+// GetAnthropicSettings provides a mock function for GetAnthropicSettings.
+func (m *MockSettingsService) GetAnthropicSettings() *types.AnthropicSettings {
+	args := m.Called()
+	if args.Get(0) == nil {
+		return nil
+	}
+	return args.Get(0).(*types.AnthropicSettings)
+}
+
+// GetOllamaSettings provides a mock function for GetOllamaSettings.
+func (m *MockSettingsService) GetOllamaSettings() *types.OllamaSettings {
+	args := m.Called()
+	if args.Get(0) == nil {
+		return nil
+	}
+	return args.Get(0).(*types.OllamaSettings)
+}
+
+// GetModelFallbackSettings provides a mock function for GetModelFallbackSettings.
+func (m *MockSettingsService) GetModelFallbackSettings() *types.ModelFallbackSettings {
+	args := m.Called()
+	if args.Get(0) == nil {
+		return nil
+	}
+	return args.Get(0).(*types.ModelFallbackSettings)
+}
+
+// GetRetrySettings provides a mock function for GetRetrySettings.
+func (m *MockSettingsService) GetRetrySettings() *types.RetrySettings {
+	args := m.Called()
+	if args.Get(0) == nil {
+		return nil
+	}
+	return args.Get(0).(*types.RetrySettings)
+}
+
+// GetRoutingSettings provides a mock function for GetRoutingSettings.
+func (m *MockSettingsService) GetRoutingSettings() *types.RoutingSettings {
+	args := m.Called()
+	if args.Get(0) == nil {
+		return nil
+	}
+	return args.Get(0).(*types.RoutingSettings)
+}
+
+// GetBudgetSettings provides a mock function for GetBudgetSettings.
+func (m *MockSettingsService) GetBudgetSettings() *types.BudgetSettings {
+	args := m.Called()
+	if args.Get(0) == nil {
+		return nil
+	}
+	return args.Get(0).(*types.BudgetSettings)
+}
+
+// GetServerAuthSettings provides a mock function for GetServerAuthSettings.
+func (m *MockSettingsService) GetServerAuthSettings() *types.ServerAuthSettings {
+	args := m.Called()
+	if args.Get(0) == nil {
+		return nil
+	}
+	return args.Get(0).(*types.ServerAuthSettings)
+}
+
 // Set provides a mock function for Set.
 func (m *MockSettingsService) Set(key string, value interface{}) error {
 	args := m.Called(key, value)
@@ -0,0 +1,119 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"go-ai-agent-v2/go-cli/pkg/core"
+	"go-ai-agent-v2/go-cli/pkg/routing"
+	"go-ai-agent-v2/go-cli/pkg/telemetry"
+	"go-ai-agent-v2/go-cli/pkg/types"
+)
+
+// routeTurn picks the model of a user turn when the model setting is "auto",
+// and switches the executor when the router chooses another model than the
+// one in use. A fallback model stays in use until its cooldown has passed.
+func (cs *ChatService) routeTurn(ctx context.Context, eventChan chan any) {
+	if cs.fallbackDepth > 0 {
+		return
+	}
+	if modelVal, _ := cs.appConfig.Get("model"); modelVal != types.AutoModel {
+		return
+	}
+	executorTypeVal, _ := cs.settingsService.Get("executor")
+	executorType, _ := executorTypeVal.(string)
+	if cs.router == nil {
+		cs.router = cs.newModelRouter(executorType)
+	}
+
+	decision, err := cs.router.Route(routing.ContextFromHistory(ctx, executorType, cs.history), cs.appConfig)
+	if err != nil || decision == nil || decision.Model == types.AutoModel {
+		telemetry.LogDebugf("No model routed for executor %s, keeping the current one: %v", executorType, err)
+		return
+	}
+	reasoning, _ := decision.Metadata["reasoning"].(string)
+	telemetry.LogDebugf("Routed turn to %s/%s: %v", executorType, decision.Model, decision.Metadata)
+	if decision.Model == cs.routedModel {
+		return
+	}
+
+	executor, err := cs.newExecutor(types.ModelFallback{Executor: executorType, Model: decision.Model})
+	if err != nil {
+		telemetry.LogErrorf("Failed to create routed executor %s/%s: %v", executorType, decision.Model, err)
+		return
+	}
+	oldModel := cs.routedModel
+	if oldModel == "" {
+		oldModel = types.AutoModel
+	}
+	eventChan <- types.ModelSwitchEvent{OldModel: oldModel, NewModel: decision.Model, Executor: executorType, Reason: "Auto routing: " + reasoning}
+	cs.executor = executor
+	cs.routedModel = decision.Model
+}
+
+// newModelRouter creates the router of "auto" turns. With the "model"
+// classifier, requests are classified by the classifier model of the
+// executor; if it cannot be created, the heuristic scorer is used.
+func (cs *ChatService) newModelRouter(executorType string) *routing.ModelRouterService {
+	router := routing.NewModelRouterService(cs.appConfig)
+	settings := cs.settingsService.GetRoutingSettings()
+	if settings == nil || settings.Classifier != types.RoutingClassifierModel {
+		return router
+	}
+
+	model := settings.ClassifierModel
+	if model == "" {
+		tiers, _ := routing.TiersFor(executorType, settings)
+		model = tiers.Fast
+	}
+	executor, err := cs.newClassifierExecutor(executorType, model)
+	if err != nil {
+		telemetry.LogErrorf("Failed to create classifier model %s/%s, using the heuristic classifier: %v", executorType, model, err)
+		return router
+	}
+	router.SetClassifier(&routing.ModelClassifier{
+		Model: model,
+		Generate: func(ctx context.Context, prompt string) (string, error) {
+			return generateText(ctx, executor, prompt)
+		},
+	})
+	return router
+}
+
+// newClassifierExecutor creates the executor of the classifier model, without
+// history or system instruction.
+func (cs *ChatService) newClassifierExecutor(executorType, model string) (core.Executor, error) {
+	if executorType == "" || model == "" {
+		return nil, fmt.Errorf("classifier needs both an executor and a model")
+	}
+	cfg := cs.appConfig.WithModel(model)
+	factory, err := core.NewExecutorFactory(executorType, cfg)
+	if err != nil {
+		return nil, err
+	}
+	return factory.NewExecutor(cfg, types.GenerateContentConfig{}, nil)
+}
+
+// generateText sends a single prompt to an executor and returns the text of
+// its answer.
+func generateText(ctx context.Context, executor core.Executor, prompt string) (string, error) {
+	stream, err := executor.StreamContent(ctx, []*types.Content{{Role: "user", Parts: []types.Part{{Text: prompt}}}}, nil)
+	if err != nil {
+		return "", err
+	}
+	var text strings.Builder
+	for event := range stream {
+		switch e := event.(type) {
+		case types.Part:
+			text.WriteString(e.Text)
+		case types.ErrorEvent:
+			go func() {
+				for range stream {
+				}
+			}()
+			return "", e.Err
+		}
+	}
+	return text.String(), nil
+}
@@ -0,0 +1,67 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// redisJobsKey is the hash holding all jobs, keyed by job ID.
+const redisJobsKey = "goaiagent:jobs"
+
+// RedisJobStore is a Redis-based implementation of the JobStore interface.
+type RedisJobStore struct {
+	client *redis.Client
+}
+
+// NewRedisJobStore creates a RedisJobStore on an existing connection, such as
+// the one of a RedisSessionStore.
+func NewRedisJobStore(client *redis.Client) *RedisJobStore {
+	return &RedisJobStore{
+		client: client,
+	}
+}
+
+// Save saves a job to Redis.
+func (s *RedisJobStore) Save(job *Job) error {
+	ctx := context.Background()
+	data, err := json.Marshal(job)
+	if err != nil {
+		return fmt.Errorf("failed to marshal job: %w", err)
+	}
+
+	if err := s.client.HSet(ctx, redisJobsKey, job.ID, data).Err(); err != nil {
+		return fmt.Errorf("failed to save job to redis: %w", err)
+	}
+	return nil
+}
+
+// List loads all saved jobs from Redis.
+func (s *RedisJobStore) List() ([]*Job, error) {
+	ctx := context.Background()
+	values, err := s.client.HVals(ctx, redisJobsKey).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list jobs from redis: %w", err)
+	}
+
+	jobs := make([]*Job, 0, len(values))
+	for _, value := range values {
+		var job Job
+		if err := json.Unmarshal([]byte(value), &job); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal job: %w", err)
+		}
+		jobs = append(jobs, &job)
+	}
+	return jobs, nil
+}
+
+// Delete deletes a job from Redis.
+func (s *RedisJobStore) Delete(jobID string) error {
+	ctx := context.Background()
+	if err := s.client.HDel(ctx, redisJobsKey, jobID).Err(); err != nil {
+		return fmt.Errorf("failed to delete job from redis: %w", err)
+	}
+	return nil
+}
@@ -5,12 +5,17 @@ import (
 	"encoding/json"
 	"fmt"
 	"sort"
+	"strings"
 
 	"go-ai-agent-v2/go-cli/pkg/types"
 
 	"github.com/go-redis/redis/v8"
 )
 
+// redisSessionMetadataKey is the hash holding the metadata of all sessions,
+// keyed by session ID.
+const redisSessionMetadataKey = "goaiagent:sessions"
+
 // RedisSessionStore is a Redis-based implementation of the SessionStore interface.
 type RedisSessionStore struct {
 	client *redis.Client
@@ -34,6 +39,11 @@ func NewRedisSessionStore(addr, password string, db int) (*RedisSessionStore, er
 	}, nil
 }
 
+// Client returns the Redis connection, so that other stores can share it.
+func (s *RedisSessionStore) Client() *redis.Client {
+	return s.client
+}
+
 // Save saves the chat history for a given session ID to Redis.
 func (s *RedisSessionStore) Save(sessionID string, history []*types.Content) error {
 	ctx := context.Background()
@@ -75,15 +85,56 @@ func (s *RedisSessionStore) List() ([]string, error) {
 		return nil, fmt.Errorf("failed to list sessions from redis: %w", err)
 	}
 
-	sort.Strings(keys)
-	return keys, nil
+	// Keys with the "goaiagent:" prefix belong to other stores, such as RedisJobStore.
+	sessions := keys[:0]
+	for _, key := range keys {
+		if !strings.HasPrefix(key, "goaiagent:") {
+			sessions = append(sessions, key)
+		}
+	}
+
+	sort.Strings(sessions)
+	return sessions, nil
 }
 
-// Delete deletes the session for a given session ID from Redis.
+// Delete deletes the session and its metadata for a given session ID from Redis.
 func (s *RedisSessionStore) Delete(sessionID string) error {
 	ctx := context.Background()
 	if err := s.client.Del(ctx, sessionID).Err(); err != nil {
 		return fmt.Errorf("failed to delete session from redis: %w", err)
 	}
+	if err := s.client.HDel(ctx, redisSessionMetadataKey, sessionID).Err(); err != nil {
+		return fmt.Errorf("failed to delete session metadata from redis: %w", err)
+	}
+	return nil
+}
+
+// SaveMetadata saves the metadata of a session to Redis.
+func (s *RedisSessionStore) SaveMetadata(metadata *SessionMetadata) error {
+	ctx := context.Background()
+	data, err := json.Marshal(metadata)
+	if err != nil {
+		return fmt.Errorf("failed to marshal session metadata: %w", err)
+	}
+	if err := s.client.HSet(ctx, redisSessionMetadataKey, metadata.ID, data).Err(); err != nil {
+		return fmt.Errorf("failed to save session metadata to redis: %w", err)
+	}
 	return nil
 }
+
+// LoadMetadata loads the metadata of a session from Redis, or nil when it has none.
+func (s *RedisSessionStore) LoadMetadata(sessionID string) (*SessionMetadata, error) {
+	ctx := context.Background()
+	data, err := s.client.HGet(ctx, redisSessionMetadataKey, sessionID).Bytes()
+	if err != nil {
+		if err == redis.Nil {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to load session metadata from redis: %w", err)
+	}
+	var metadata SessionMetadata
+	if err := json.Unmarshal(data, &metadata); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal session metadata: %w", err)
+	}
+	return &metadata, nil
+}
@@ -0,0 +1,348 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"maps"
+	"math/rand"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"go-ai-agent-v2/go-cli/pkg/core"
+	"go-ai-agent-v2/go-cli/pkg/telemetry"
+	"go-ai-agent-v2/go-cli/pkg/types"
+
+	"github.com/sashabaranov/go-openai"
+	"google.golang.org/api/googleapi"
+)
+
+// IsTransientError reports whether an executor error is likely to go away
+// when the request is retried later: rate limits, server errors and timeouts.
+func IsTransientError(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	if code := errorStatusCode(err); code != 0 {
+		return isTransientStatus(code)
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// contextLengthMessages are fragments of the errors providers return when a
+// request does not fit in the model's context window.
+var contextLengthMessages = []string{
+	"context_length_exceeded",
+	"context length",
+	"context window",
+	"prompt is too long",
+	"input token count",
+	"exceeds the maximum number of tokens",
+}
+
+// IsContextLengthError reports whether an executor error says the request is
+// too long for the model.
+func IsContextLengthError(err error) bool {
+	if err == nil {
+		return false
+	}
+	var openaiErr *openai.APIError
+	if errors.As(err, &openaiErr) && openaiErr.Code == "context_length_exceeded" {
+		return true
+	}
+	message := strings.ToLower(err.Error())
+	for _, fragment := range contextLengthMessages {
+		if strings.Contains(message, fragment) {
+			return true
+		}
+	}
+	return false
+}
+
+// errorStatusCode returns the HTTP status of an API error from any executor,
+// or 0 when err carries none.
+func errorStatusCode(err error) int {
+	var googleErr *googleapi.Error
+	if errors.As(err, &googleErr) {
+		return googleErr.Code
+	}
+	var openaiErr *openai.APIError
+	if errors.As(err, &openaiErr) {
+		return openaiErr.HTTPStatusCode
+	}
+	var requestErr *openai.RequestError
+	if errors.As(err, &requestErr) {
+		return requestErr.HTTPStatusCode
+	}
+	var anthropicErr *core.AnthropicError
+	if errors.As(err, &anthropicErr) {
+		return anthropicErr.StatusCode
+	}
+	var ollamaErr *core.OllamaError
+	if errors.As(err, &ollamaErr) {
+		return ollamaErr.StatusCode
+	}
+	var scenarioErr *core.ScenarioError
+	if errors.As(err, &scenarioErr) {
+		return scenarioErr.StatusCode
+	}
+	return 0
+}
+
+func isTransientStatus(code int) bool {
+	return code == http.StatusTooManyRequests || code >= http.StatusInternalServerError
+}
+
+// RetryAfter returns how long the server asked to wait before the request is
+// retried, or 0 when the error does not say.
+func RetryAfter(err error) time.Duration {
+	var googleErr *googleapi.Error
+	if errors.As(err, &googleErr) {
+		return core.ParseRetryAfter(googleErr.Header.Get("Retry-After"))
+	}
+	var openaiErr *core.OpenAIError
+	if errors.As(err, &openaiErr) {
+		return openaiErr.RetryAfter
+	}
+	var anthropicErr *core.AnthropicError
+	if errors.As(err, &anthropicErr) {
+		return anthropicErr.RetryAfter
+	}
+	var ollamaErr *core.OllamaError
+	if errors.As(err, &ollamaErr) {
+		return ollamaErr.RetryAfter
+	}
+	var scenarioErr *core.ScenarioError
+	if errors.As(err, &scenarioErr) {
+		return time.Duration(scenarioErr.RetryAfter) * time.Second
+	}
+	return 0
+}
+
+// RetryingExecutor wraps an executor and retries requests that fail with a
+// transient error, with exponential backoff and jitter between attempts. The
+// retry settings are read on each request.
+type RetryingExecutor struct {
+	core.Executor
+	settingsService types.SettingsServiceIface
+}
+
+// NewRetryingExecutor wraps executor with retries, unless it already has them.
+func NewRetryingExecutor(executor core.Executor, settingsService types.SettingsServiceIface) core.Executor {
+	if _, ok := executor.(*RetryingExecutor); ok {
+		return executor
+	}
+	return &RetryingExecutor{Executor: executor, settingsService: settingsService}
+}
+
+// StreamContent streams the response of the wrapped executor. When a stream
+// fails with a transient error, a RetryEvent is sent and the request is made
+// again after the backoff; consumers must discard what the failed attempt
+// streamed. Once the attempts are used up, the last error is sent.
+func (r *RetryingExecutor) StreamContent(ctx context.Context, contents []*types.Content, tools []types.Tool) (<-chan any, error) {
+	settings := r.settings()
+	stream, err := r.Executor.StreamContent(ctx, contents, tools)
+	if err != nil && (settings.MaxAttempts <= 1 || !IsTransientError(err)) {
+		return nil, err
+	}
+
+	eventChan := make(chan any)
+	go func() {
+		defer close(eventChan)
+		send := func(event any) bool {
+			select {
+			case eventChan <- event:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+
+		for attempt := 1; ; attempt++ {
+			if err == nil {
+				if err = forwardStream(ctx, stream, eventChan); err == nil {
+					return
+				}
+			}
+			if attempt >= settings.MaxAttempts || !IsTransientError(err) || ctx.Err() != nil {
+				send(types.ErrorEvent{Err: err})
+				return
+			}
+
+			event := r.recordRetry(settings, attempt, err)
+			if !send(event) {
+				return
+			}
+			if waitErr := sleepContext(ctx, event.Delay); waitErr != nil {
+				send(types.ErrorEvent{Err: waitErr})
+				return
+			}
+			stream, err = r.Executor.StreamContent(ctx, contents, tools)
+		}
+	}()
+	return eventChan, nil
+}
+
+// CountTokens counts the prompt tokens of a request with the wrapped
+// executor. Counting is not retried: on failure, tokens are estimated.
+func (r *RetryingExecutor) CountTokens(ctx context.Context, contents []*types.Content, tools []types.Tool) (int, error) {
+	return core.CountTokens(ctx, r.Executor, contents, tools), nil
+}
+
+// GenerateContent generates content with the wrapped executor, retrying
+// transient errors.
+func (r *RetryingExecutor) GenerateContent(contents ...*types.Content) (*types.GenerateContentResponse, error) {
+	var resp *types.GenerateContentResponse
+	err := r.retry(context.Background(), func() (err error) {
+		resp, err = r.Executor.GenerateContent(contents...)
+		return err
+	})
+	return resp, err
+}
+
+// GenerateContentWithTools generates content with the wrapped executor,
+// retrying transient errors.
+func (r *RetryingExecutor) GenerateContentWithTools(ctx context.Context, history []*types.Content, tools []types.Tool) (*types.GenerateContentResponse, error) {
+	var resp *types.GenerateContentResponse
+	err := r.retry(ctx, func() (err error) {
+		resp, err = r.Executor.GenerateContentWithTools(ctx, history, tools)
+		return err
+	})
+	return resp, err
+}
+
+// retry calls request until it succeeds, fails with an error that is not
+// transient, or runs out of attempts.
+func (r *RetryingExecutor) retry(ctx context.Context, request func() error) error {
+	settings := r.settings()
+	for attempt := 1; ; attempt++ {
+		err := request()
+		if err == nil || attempt >= settings.MaxAttempts || !IsTransientError(err) || ctx.Err() != nil {
+			return err
+		}
+		if sleepContext(ctx, r.recordRetry(settings, attempt, err).Delay) != nil {
+			return err
+		}
+	}
+}
+
+// retryCounts counts the retried requests of every executor, by executor name.
+var retryCounts = struct {
+	sync.Mutex
+	byExecutor map[string]int
+}{byExecutor: make(map[string]int)}
+
+// RetryCounts returns how many requests were retried after a transient error
+// since the process started, by executor name.
+func RetryCounts() map[string]int {
+	retryCounts.Lock()
+	defer retryCounts.Unlock()
+	return maps.Clone(retryCounts.byExecutor)
+}
+
+// recordRetry counts and logs the retry that follows a failed attempt and
+// returns its RetryEvent, with the backoff to wait before the next attempt.
+func (r *RetryingExecutor) recordRetry(settings types.RetrySettings, attempt int, err error) types.RetryEvent {
+	reason, _ := fallbackReason(err)
+	event := types.RetryEvent{
+		Attempt:     attempt + 1,
+		MaxAttempts: settings.MaxAttempts,
+		Delay:       retryBackoff(settings, attempt, err),
+		Reason:      reason,
+		Executor:    r.Name(),
+		StatusCode:  errorStatusCode(err),
+		RetryAfter:  RetryAfter(err),
+	}
+	retryCounts.Lock()
+	retryCounts.byExecutor[event.Executor]++
+	retryCounts.Unlock()
+	telemetry.LogWarnf("%s request failed (attempt %d/%d), retrying in %s: %v", event.Executor, attempt, settings.MaxAttempts, event.Delay, err)
+	return event
+}
+
+// settings returns the configured retry settings with defaults filled in.
+func (r *RetryingExecutor) settings() types.RetrySettings {
+	var settings types.RetrySettings
+	if r.settingsService != nil {
+		if configured := r.settingsService.GetRetrySettings(); configured != nil {
+			settings = *configured
+		}
+	}
+	if settings.MaxAttempts <= 0 {
+		settings.MaxAttempts = types.DefaultRetryMaxAttempts
+	}
+	if settings.InitialBackoff <= 0 {
+		settings.InitialBackoff = types.DefaultRetryInitialBackoff
+	}
+	if settings.MaxBackoff <= 0 {
+		settings.MaxBackoff = types.DefaultRetryMaxBackoff
+	}
+	if settings.Jitter <= 0 {
+		settings.Jitter = types.DefaultRetryJitter
+	} else if settings.Jitter > 1 {
+		settings.Jitter = 1
+	}
+	return settings
+}
+
+// retryBackoff returns how long to wait after the given failed attempt: the
+// initial backoff doubled on each attempt up to the maximum, plus or minus the
+// jitter, but never less than the server's Retry-After.
+func retryBackoff(settings types.RetrySettings, attempt int, err error) time.Duration {
+	delay := time.Duration(settings.InitialBackoff) * time.Millisecond
+	maxDelay := time.Duration(settings.MaxBackoff) * time.Millisecond
+	for i := 1; i < attempt && delay < maxDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxDelay {
+		delay = maxDelay
+	}
+	delay += time.Duration((rand.Float64()*2 - 1) * settings.Jitter * float64(delay))
+	if retryAfter := RetryAfter(err); retryAfter > delay {
+		delay = retryAfter
+	}
+	return delay
+}
+
+// forwardStream forwards the events of stream to eventChan until the stream
+// ends or reports an error, which is returned. The rest of a failed stream is
+// drained in the background.
+func forwardStream(ctx context.Context, stream <-chan any, eventChan chan<- any) error {
+	drain := func() {
+		go func() {
+			for range stream {
+			}
+		}()
+	}
+	for event := range stream {
+		if e, ok := event.(types.ErrorEvent); ok {
+			drain()
+			return e.Err
+		}
+		select {
+		case eventChan <- event:
+		case <-ctx.Done():
+			drain()
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// sleepContext waits for d, or until ctx is done.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,164 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"go-ai-agent-v2/go-cli/pkg/core"
+	"go-ai-agent-v2/go-cli/pkg/types"
+
+	"github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/api/googleapi"
+)
+
+func TestIsTransientError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"nil", nil, false},
+		{"gemini rate limit", fmt.Errorf("stream: %w", &googleapi.Error{Code: 429}), true},
+		{"gemini server error", &googleapi.Error{Code: 503}, true},
+		{"gemini bad request", &googleapi.Error{Code: 400}, false},
+		{"qwen server error", fmt.Errorf("error receiving Qwen stream: %w", &openai.APIError{HTTPStatusCode: 502}), true},
+		{"qwen unauthorized", &openai.RequestError{HTTPStatusCode: 401}, false},
+		{"anthropic overloaded", &core.AnthropicError{StatusCode: 529, Type: "overloaded_error"}, true},
+		{"anthropic bad request", &core.AnthropicError{StatusCode: 400, Type: "invalid_request_error"}, false},
+		{"ollama server error", &core.OllamaError{StatusCode: 500, Message: "model runner has unexpectedly stopped"}, true},
+		{"ollama model not found", &core.OllamaError{StatusCode: 404, Message: "model \"llama9\" not found"}, false},
+		{"injected rate limit", &core.ScenarioError{StatusCode: 429, Message: "Resource exhausted"}, true},
+		{"deadline", context.DeadlineExceeded, true},
+		{"cancelled", context.Canceled, false},
+		{"other", fmt.Errorf("tool not found"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, IsTransientError(tt.err))
+		})
+	}
+}
+
+func TestIsContextLengthError(t *testing.T) {
+	assert.True(t, IsContextLengthError(&openai.APIError{HTTPStatusCode: 400, Code: "context_length_exceeded", Message: "too long"}))
+	assert.True(t, IsContextLengthError(&core.AnthropicError{StatusCode: 400, Type: "invalid_request_error", Message: "prompt is too long: 210000 tokens > 200000 maximum"}))
+	assert.True(t, IsContextLengthError(&googleapi.Error{Code: 400, Message: "The input token count (1200000) exceeds the maximum number of tokens allowed (1048576)."}))
+	assert.False(t, IsContextLengthError(&googleapi.Error{Code: 400, Message: "Invalid argument"}))
+	assert.False(t, IsContextLengthError(nil))
+}
+
+func TestRetryingExecutor_StreamContent(t *testing.T) {
+	// newExecutor returns an executor whose inner mock streams the given
+	// errors in turn, each after a partial answer, and then succeeds.
+	newExecutor := func(errs ...error) (core.Executor, *int) {
+		settingsService := new(MockSettingsService)
+		settingsService.On("GetRetrySettings").Return(&types.RetrySettings{MaxAttempts: 3, InitialBackoff: 1, MaxBackoff: 5})
+		calls := 0
+		inner := &core.MockExecutor{StreamContentFunc: func(ctx context.Context, contents ...*types.Content) (<-chan any, error) {
+			eventChan := make(chan any, 2)
+			if calls < len(errs) {
+				eventChan <- types.Part{Text: "Partial"}
+				eventChan <- types.ErrorEvent{Err: errs[calls]}
+			} else {
+				eventChan <- types.Part{Text: "Answer"}
+			}
+			calls++
+			close(eventChan)
+			return eventChan, nil
+		}}
+		return NewRetryingExecutor(inner, settingsService), &calls
+	}
+	collect := func(t *testing.T, executor core.Executor) []any {
+		stream, err := executor.StreamContent(context.Background(), nil, nil)
+		require.NoError(t, err)
+		var events []any
+		for event := range stream {
+			events = append(events, event)
+		}
+		return events
+	}
+
+	t.Run("Transient error is retried", func(t *testing.T) {
+		retriesBefore := RetryCounts()["mock"]
+		executor, calls := newExecutor(&googleapi.Error{Code: 503})
+		events := collect(t, executor)
+
+		require.Len(t, events, 3)
+		assert.Equal(t, types.Part{Text: "Partial"}, events[0])
+		retry, ok := events[1].(types.RetryEvent)
+		require.True(t, ok, "expected a RetryEvent, got %T", events[1])
+		assert.Equal(t, 2, retry.Attempt)
+		assert.Equal(t, 3, retry.MaxAttempts)
+		assert.Equal(t, "Server error (503)", retry.Reason)
+		assert.Equal(t, "mock", retry.Executor)
+		assert.Equal(t, 503, retry.StatusCode)
+		assert.Equal(t, types.Part{Text: "Answer"}, events[2])
+		assert.Equal(t, 2, *calls)
+		assert.Equal(t, retriesBefore+1, RetryCounts()["mock"], "the retry should be counted")
+	})
+
+	t.Run("Last error is sent once attempts are used up", func(t *testing.T) {
+		rateLimited := &core.ScenarioError{StatusCode: 429, Message: "Resource exhausted"}
+		executor, calls := newExecutor(rateLimited, rateLimited, rateLimited)
+		events := collect(t, executor)
+
+		require.NotEmpty(t, events)
+		assert.Equal(t, types.ErrorEvent{Err: rateLimited}, events[len(events)-1])
+		assert.Equal(t, 3, *calls)
+	})
+
+	t.Run("Other errors are not retried", func(t *testing.T) {
+		badRequest := &core.AnthropicError{StatusCode: 400, Type: "invalid_request_error"}
+		executor, calls := newExecutor(badRequest)
+		events := collect(t, executor)
+
+		assert.Equal(t, []any{types.Part{Text: "Partial"}, types.ErrorEvent{Err: badRequest}}, events)
+		assert.Equal(t, 1, *calls)
+	})
+}
+
+func TestRetryBackoff(t *testing.T) {
+	settings := types.RetrySettings{MaxAttempts: 5, InitialBackoff: 1000, MaxBackoff: 3000, Jitter: 0.2}
+	assert.InDelta(t, float64(time.Second), float64(retryBackoff(settings, 1, nil)), float64(200*time.Millisecond))
+	assert.InDelta(t, float64(2*time.Second), float64(retryBackoff(settings, 2, nil)), float64(400*time.Millisecond))
+	assert.InDelta(t, float64(3*time.Second), float64(retryBackoff(settings, 4, nil)), float64(600*time.Millisecond), "capped at the maximum")
+
+	rateLimited := &googleapi.Error{Code: 429, Header: http.Header{"Retry-After": []string{"10"}}}
+	assert.Equal(t, 10*time.Second, RetryAfter(rateLimited))
+	assert.Equal(t, 10*time.Second, retryBackoff(settings, 1, rateLimited), "the server's Retry-After wins")
+
+	date := time.Now().Add(time.Minute).UTC().Format(http.TimeFormat)
+	assert.InDelta(t, float64(time.Minute), float64(core.ParseRetryAfter(date)), float64(2*time.Second))
+	assert.Zero(t, core.ParseRetryAfter("soon"))
+}
+
+func TestRetryAfter(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want time.Duration
+	}{
+		{"gemini", &googleapi.Error{Code: 429, Header: http.Header{"Retry-After": []string{"10"}}}, 10 * time.Second},
+		{"gemini without header", &googleapi.Error{Code: 429}, 0},
+		{"openai-compatible", fmt.Errorf("failed to create chat completion: %w", &core.OpenAIError{Err: &openai.APIError{HTTPStatusCode: 429}, RetryAfter: 20 * time.Second}), 20 * time.Second},
+		{"openai-compatible without header", &openai.APIError{HTTPStatusCode: 429}, 0},
+		{"anthropic", &core.AnthropicError{StatusCode: 529, Type: "overloaded_error", RetryAfter: 30 * time.Second}, 30 * time.Second},
+		{"ollama", fmt.Errorf("chat: %w", &core.OllamaError{StatusCode: 503, Message: "server busy", RetryAfter: 5 * time.Second}), 5 * time.Second},
+		{"ollama without header", &core.OllamaError{StatusCode: 503, Message: "server busy"}, 0},
+		{"injected", &core.ScenarioError{StatusCode: 429, RetryAfter: 2}, 2 * time.Second},
+		{"other", fmt.Errorf("tool not found"), 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, RetryAfter(tt.err))
+		})
+	}
+
+	// The status of the wrapped error is still found.
+	assert.True(t, IsTransientError(&core.OpenAIError{Err: &openai.APIError{HTTPStatusCode: 429}, RetryAfter: time.Second}))
+}
@@ -0,0 +1,103 @@
+package services
+
+import (
+	"crypto/rand"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Session IDs are ULIDs: a 48-bit millisecond timestamp and 80 random bits,
+// written as 26 characters of Crockford's base32. They sort by creation time,
+// and IDs created within the same millisecond increment the random part, so
+// that they stay unique and ordered within a process.
+const (
+	ulidLength       = 26
+	ulidEntropyBytes = 10
+	crockfordBase32  = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+)
+
+// legacySessionIDTimeFormat is the time prefix of the session IDs generated
+// before ULIDs, such as 20240115-150405 or 20240115-150405-1a2b3c4d.
+const legacySessionIDTimeFormat = "20060102-150405"
+
+var (
+	ulidMu      sync.Mutex
+	ulidLastMs  int64
+	ulidEntropy [ulidEntropyBytes]byte
+)
+
+// newULID returns a ULID for a time.
+func newULID(now time.Time) string {
+	ulidMu.Lock()
+	defer ulidMu.Unlock()
+
+	ms := now.UnixMilli()
+	if ms <= ulidLastMs && incrementEntropy(&ulidEntropy) {
+		ms = ulidLastMs
+	} else {
+		rand.Read(ulidEntropy[:])
+		ulidLastMs = max(ms, ulidLastMs)
+		ms = ulidLastMs
+	}
+
+	var id [16]byte
+	for i := 5; i >= 0; i-- {
+		id[i] = byte(ms)
+		ms >>= 8
+	}
+	copy(id[6:], ulidEntropy[:])
+	return encodeULID(id)
+}
+
+// incrementEntropy adds one to the random part of a ULID. It returns false
+// when it overflows.
+func incrementEntropy(entropy *[ulidEntropyBytes]byte) bool {
+	for i := len(entropy) - 1; i >= 0; i-- {
+		entropy[i]++
+		if entropy[i] != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// encodeULID writes the 128 bits of a ULID as 26 base32 characters, the first
+// of which holds the 3 highest bits.
+func encodeULID(id [16]byte) string {
+	var text [ulidLength]byte
+	for i := range text {
+		// Bit offset of the character, counted from the 2 padding bits before id.
+		offset := i*5 - 2
+		value := 0
+		for bit := offset; bit < offset+5; bit++ {
+			value <<= 1
+			if bit >= 0 && id[bit/8]&(0x80>>(bit%8)) != 0 {
+				value |= 1
+			}
+		}
+		text[i] = crockfordBase32[value]
+	}
+	return string(text[:])
+}
+
+// sessionIDTime returns the creation time encoded in a session ID, for ULIDs
+// and for the time-based IDs of older sessions.
+func sessionIDTime(sessionID string) (time.Time, bool) {
+	if len(sessionID) == ulidLength {
+		var ms int64
+		for i, char := range strings.ToUpper(sessionID[:10]) {
+			value := strings.IndexRune(crockfordBase32, char)
+			if value < 0 || (i == 0 && value > 7) {
+				return time.Time{}, false
+			}
+			ms = ms<<5 | int64(value)
+		}
+		return time.UnixMilli(ms), true
+	}
+	if len(sessionID) >= len(legacySessionIDTimeFormat) {
+		created, err := time.ParseInLocation(legacySessionIDTimeFormat, sessionID[:len(legacySessionIDTimeFormat)], time.Local)
+		return created, err == nil
+	}
+	return time.Time{}, false
+}
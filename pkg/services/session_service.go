@@ -1,11 +1,42 @@
 package services
 
 import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 
+	"go-ai-agent-v2/go-cli/pkg/telemetry"
 	"go-ai-agent-v2/go-cli/pkg/types"
 )
 
+// maxSessionTitleLength is the length in runes from which titles are cut.
+const maxSessionTitleLength = 60
+
+// Fields ListSessionMetadata sorts by.
+const (
+	SessionSortUpdated  = "updated"
+	SessionSortCreated  = "created"
+	SessionSortTitle    = "title"
+	SessionSortMessages = "messages"
+	SessionSortCost     = "cost"
+)
+
+// SessionListOptions filters and sorts the sessions of ListSessionMetadata.
+// Empty fields do not filter.
+type SessionListOptions struct {
+	Query        string    // Case-insensitive part of the title or ID
+	WorkspaceDir string    // Sessions of this workspace only
+	Executor     string    // Sessions of this executor only
+	Model        string    // Sessions of this model only
+	Since        time.Time // Sessions updated since then only
+	SortBy       string    // One of the SessionSort fields; SessionSortUpdated by default
+	Reverse      bool      // Reverse the default order: newest and largest first, titles from A to Z
+	Limit        int       // At most this many sessions; 0 lists all
+}
+
 // SessionService handles the persistence of chat sessions.
 type SessionService struct {
 	store SessionStore
@@ -18,9 +49,211 @@ func NewSessionService(store SessionStore) (*SessionService, error) {
 	}, nil
 }
 
-// SaveHistory saves the chat history for a given session ID.
+// Store returns the underlying session store.
+func (s *SessionService) Store() SessionStore {
+	return s.store
+}
+
+// SaveHistory saves the chat history for a given session ID, and updates the
+// title, message count and update time of its metadata.
 func (s *SessionService) SaveHistory(sessionID string, history []*types.Content) error {
-	return s.store.Save(sessionID, history)
+	if err := s.store.Save(sessionID, history); err != nil {
+		return err
+	}
+	err := s.UpdateMetadata(sessionID, func(metadata *SessionMetadata) {
+		metadata.MessageCount = len(history)
+		if metadata.Title == "" {
+			metadata.Title = SessionTitle(history)
+		}
+	})
+	if err != nil {
+		telemetry.LogErrorf("Failed to update the metadata of session %s: %v", sessionID, err)
+	}
+	return nil
+}
+
+// UpdateMetadata applies update to the metadata of a session and saves it
+// with the current time as its update time. Sessions saved before metadata
+// existed get metadata derived from their history. Stores that are
+// SessionMetadataUpdaters apply the update themselves.
+func (s *SessionService) UpdateMetadata(sessionID string, update func(metadata *SessionMetadata)) error {
+	stamped := func(metadata *SessionMetadata) {
+		update(metadata)
+		metadata.UpdatedAt = time.Now()
+		if metadata.CreatedAt.IsZero() {
+			metadata.CreatedAt = metadata.UpdatedAt
+		}
+	}
+	if updater, ok := s.store.(SessionMetadataUpdater); ok {
+		return updater.UpdateMetadata(sessionID, stamped)
+	}
+
+	metadata, err := s.GetMetadata(sessionID)
+	if err != nil {
+		return err
+	}
+	stamped(metadata)
+	return s.store.SaveMetadata(metadata)
+}
+
+// GetMetadata returns the metadata of a session. For sessions without
+// metadata, it is derived from their history and ID.
+func (s *SessionService) GetMetadata(sessionID string) (*SessionMetadata, error) {
+	metadata, err := s.store.LoadMetadata(sessionID)
+	if err != nil {
+		return nil, err
+	}
+	if metadata != nil {
+		return metadata, nil
+	}
+	history, err := s.store.Load(sessionID)
+	if err != nil {
+		return nil, err
+	}
+	return deriveSessionMetadata(sessionID, history), nil
+}
+
+// deriveSessionMetadata returns the metadata of a session that has none,
+// from its history and ID.
+func deriveSessionMetadata(sessionID string, history []*types.Content) *SessionMetadata {
+	metadata := &SessionMetadata{ID: sessionID, MessageCount: len(history), Title: SessionTitle(history)}
+	if created, ok := sessionIDTime(sessionID); ok {
+		metadata.CreatedAt, metadata.UpdatedAt = created, created
+	}
+	return metadata
+}
+
+// ListSessionMetadata returns the metadata of the saved sessions that match
+// the options, in their order. Stores that are SessionListers list them
+// themselves.
+func (s *SessionService) ListSessionMetadata(options SessionListOptions) ([]*SessionMetadata, error) {
+	if lister, ok := s.store.(SessionLister); ok {
+		return lister.ListMetadata(options)
+	}
+	ids, err := s.store.List()
+	if err != nil {
+		return nil, err
+	}
+	query := strings.ToLower(options.Query)
+	var sessions []*SessionMetadata
+	for _, id := range ids {
+		metadata, err := s.GetMetadata(id)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load session %s: %w", id, err)
+		}
+		switch {
+		case query != "" && !strings.Contains(strings.ToLower(metadata.Title), query) && !strings.Contains(strings.ToLower(metadata.ID), query):
+		case options.WorkspaceDir != "" && metadata.WorkspaceDir != options.WorkspaceDir:
+		case options.Executor != "" && metadata.Executor != options.Executor:
+		case options.Model != "" && metadata.Model != options.Model:
+		case !options.Since.IsZero() && metadata.UpdatedAt.Before(options.Since):
+		default:
+			sessions = append(sessions, metadata)
+		}
+	}
+
+	var less func(a, b *SessionMetadata) bool
+	switch options.SortBy {
+	case SessionSortUpdated, "":
+		less = func(a, b *SessionMetadata) bool { return a.UpdatedAt.After(b.UpdatedAt) }
+	case SessionSortCreated:
+		less = func(a, b *SessionMetadata) bool { return a.CreatedAt.After(b.CreatedAt) }
+	case SessionSortTitle:
+		less = func(a, b *SessionMetadata) bool { return strings.ToLower(a.Title) < strings.ToLower(b.Title) }
+	case SessionSortMessages:
+		less = func(a, b *SessionMetadata) bool { return a.MessageCount > b.MessageCount }
+	case SessionSortCost:
+		less = func(a, b *SessionMetadata) bool { return a.CostUSD > b.CostUSD }
+	default:
+		return nil, fmt.Errorf("unknown session sort field %q", options.SortBy)
+	}
+	sort.SliceStable(sessions, func(i, j int) bool {
+		if options.Reverse {
+			return less(sessions[j], sessions[i])
+		}
+		return less(sessions[i], sessions[j])
+	})
+
+	if options.Limit > 0 && len(sessions) > options.Limit {
+		sessions = sessions[:options.Limit]
+	}
+	return sessions, nil
+}
+
+// ParseSessionListOptions parses the terms of a session filter, such as
+// "model:gpt-4o since:7d sort:cost refactor". Terms are executor:, model:,
+// workspace: (a path), since: (a duration, or a number of days like 7d),
+// sort: (a SessionSort field), limit: and reverse; other words are matched
+// against titles and IDs.
+func ParseSessionListOptions(terms []string) (SessionListOptions, error) {
+	var options SessionListOptions
+	var query []string
+	for _, term := range terms {
+		key, value, _ := strings.Cut(term, ":")
+		switch key {
+		case "executor":
+			options.Executor = value
+		case "model":
+			options.Model = value
+		case "workspace":
+			workspaceDir, err := filepath.Abs(value)
+			if err != nil {
+				return options, fmt.Errorf("invalid workspace %q: %w", value, err)
+			}
+			options.WorkspaceDir = workspaceDir
+		case "since":
+			age, err := time.ParseDuration(value)
+			if days, found := strings.CutSuffix(value, "d"); found {
+				var n int
+				n, err = strconv.Atoi(days)
+				age = time.Duration(n) * 24 * time.Hour
+			}
+			if err != nil {
+				return options, fmt.Errorf("invalid since %q: use a duration like 12h or a number of days like 7d", value)
+			}
+			options.Since = time.Now().Add(-age)
+		case "sort":
+			options.SortBy = value
+		case "limit":
+			limit, err := strconv.Atoi(value)
+			if err != nil {
+				return options, fmt.Errorf("invalid limit %q", value)
+			}
+			options.Limit = limit
+		case "reverse":
+			options.Reverse = true
+		default:
+			query = append(query, term)
+		}
+	}
+	options.Query = strings.Join(query, " ")
+	return options, nil
+}
+
+// SessionTitle makes the title of a session from its first user message.
+func SessionTitle(history []*types.Content) string {
+	for _, content := range history {
+		if !isTurnStart(content) {
+			continue
+		}
+		var text strings.Builder
+		for _, part := range content.Parts {
+			text.WriteString(part.Text + " ")
+		}
+		if strings.HasPrefix(text.String(), compressionSummaryPrefix) {
+			continue
+		}
+		title := []rune(strings.Join(strings.Fields(text.String()), " "))
+		if len(title) <= maxSessionTitleLength {
+			return string(title)
+		}
+		cut := string(title[:maxSessionTitleLength])
+		if space := strings.LastIndex(cut, " "); space > maxSessionTitleLength/2 {
+			cut = cut[:space]
+		}
+		return cut + "…"
+	}
+	return ""
 }
 
 // LoadHistory loads the chat history for a given session ID.
@@ -38,7 +271,87 @@ func (s *SessionService) DeleteSession(sessionID string) error {
 	return s.store.Delete(sessionID)
 }
 
-// GenerateSessionID creates a new session ID based on the current timestamp.
+// ForkSession copies the first index messages of a session into a new
+// session and returns its ID. The original session is left as it is, and the
+// metadata of the fork records its parent. A fork cannot separate tool
+// responses from the calls they answer.
+func (s *SessionService) ForkSession(sessionID string, index int) (string, error) {
+	history, err := s.store.Load(sessionID)
+	if err != nil {
+		return "", err
+	}
+	if len(history) == 0 {
+		return "", fmt.Errorf("session %s has no messages to fork", sessionID)
+	}
+	if index < 0 || index > len(history) {
+		return "", fmt.Errorf("message index %d is out of range: session %s has %d messages", index, sessionID, len(history))
+	}
+	if index < len(history) && isToolResponse(history[index]) {
+		return "", fmt.Errorf("message %d answers the tool calls of message %d; fork before or after both", index, index-1)
+	}
+	parent, err := s.GetMetadata(sessionID)
+	if err != nil {
+		return "", err
+	}
+
+	forkID := s.GenerateSessionID()
+	fork := make([]*types.Content, index)
+	copy(fork, history[:index])
+	if err := s.SaveHistory(forkID, fork); err != nil {
+		return "", fmt.Errorf("failed to save fork of session %s: %w", sessionID, err)
+	}
+	err = s.UpdateMetadata(forkID, func(metadata *SessionMetadata) {
+		metadata.Executor = parent.Executor
+		metadata.Model = parent.Model
+		metadata.WorkspaceDir = parent.WorkspaceDir
+		metadata.ParentID = sessionID
+		metadata.ForkIndex = index
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to save the metadata of fork %s: %w", forkID, err)
+	}
+	return forkID, nil
+}
+
+// RewindSession drops the last turns of a session, each a user message with
+// the answers and tool calls that followed it, and saves the rest. It returns
+// the dropped messages.
+func (s *SessionService) RewindSession(sessionID string, turns int) ([]*types.Content, error) {
+	if turns < 1 {
+		return nil, fmt.Errorf("cannot rewind %d turns", turns)
+	}
+	history, err := s.store.Load(sessionID)
+	if err != nil {
+		return nil, err
+	}
+	start, found := len(history), 0
+	for found < turns && start > 0 {
+		start--
+		if isTurnStart(history[start]) {
+			found++
+		}
+	}
+	if found < turns {
+		return nil, fmt.Errorf("session %s has only %d turns", sessionID, found)
+	}
+	if err := s.SaveHistory(sessionID, history[:start]); err != nil {
+		return nil, fmt.Errorf("failed to save rewound session %s: %w", sessionID, err)
+	}
+	return history[start:], nil
+}
+
+// isToolResponse reports whether a message holds tool responses.
+func isToolResponse(content *types.Content) bool {
+	for _, part := range content.Parts {
+		if part.FunctionResponse != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// GenerateSessionID creates a new session ID: a ULID, which sorts by creation
+// time and never repeats, even for sessions created in the same millisecond.
 func (s *SessionService) GenerateSessionID() string {
-	return time.Now().Format("20060102-150405")
+	return newULID(time.Now())
 }
@@ -2,6 +2,8 @@ package services
 
 import (
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
@@ -122,8 +124,225 @@ func TestGenerateSessionID(t *testing.T) {
 	ss, cleanup := setupTestSessionService(t)
 	defer cleanup()
 
+	before := time.Now().Truncate(time.Millisecond)
 	sessionID := ss.GenerateSessionID()
-	// Example: 20240115-150405
-	_, err := time.Parse("20060102-150405", sessionID)
-	assert.NoError(t, err, "session ID should be in the expected time format")
+	// Example: 01J6Z3X8N4Q2V7K9M5R1T0W3YB
+	assert.Len(t, sessionID, 26)
+	created, ok := sessionIDTime(sessionID)
+	assert.True(t, ok, "session ID should encode its creation time")
+	assert.False(t, created.Before(before))
+	assert.False(t, created.After(time.Now()))
+
+	// IDs created in the same millisecond stay unique and sorted.
+	ids := make([]string, 1000)
+	for i := range ids {
+		ids[i] = ss.GenerateSessionID()
+	}
+	for i := 1; i < len(ids); i++ {
+		assert.Less(t, ids[i-1], ids[i])
+	}
+}
+
+func TestSessionMetadata(t *testing.T) {
+	ss, cleanup := setupTestSessionService(t)
+	defer cleanup()
+
+	history := []*types.Content{
+		{Role: "user", Parts: []types.Part{{Text: "Refactor the session store so that saves\nare atomic and listing is fast on large workspaces"}}},
+		{Role: "model", Parts: []types.Part{{Text: "Sure."}}},
+	}
+	assert.NoError(t, ss.SaveHistory("session_meta", history))
+
+	metadata, err := ss.GetMetadata("session_meta")
+	assert.NoError(t, err)
+	assert.Equal(t, "Refactor the session store so that saves are atomic and…", metadata.Title)
+	assert.Equal(t, 2, metadata.MessageCount)
+	assert.False(t, metadata.CreatedAt.IsZero())
+	created := metadata.CreatedAt
+
+	assert.NoError(t, ss.UpdateMetadata("session_meta", func(metadata *SessionMetadata) {
+		metadata.Model = "gemini-2.5-pro"
+		metadata.CostUSD += 0.5
+	}))
+	assert.NoError(t, ss.SaveHistory("session_meta", append(history, &types.Content{Role: "user", Parts: []types.Part{{Text: "Go on"}}})))
+	metadata, err = ss.GetMetadata("session_meta")
+	assert.NoError(t, err)
+	assert.Equal(t, "gemini-2.5-pro", metadata.Model)
+	assert.Equal(t, 0.5, metadata.CostUSD)
+	assert.Equal(t, 3, metadata.MessageCount)
+	assert.Equal(t, "Refactor the session store so that saves are atomic and…", metadata.Title, "the title is kept")
+	assert.True(t, metadata.CreatedAt.Equal(created))
+	assert.False(t, metadata.UpdatedAt.Before(created))
+
+	assert.NoError(t, ss.DeleteSession("session_meta"))
+	metadata, err = ss.Store().LoadMetadata("session_meta")
+	assert.NoError(t, err)
+	assert.Nil(t, metadata, "the metadata is deleted with the session")
+}
+
+func TestSessionMetadata_DerivedForOldSessions(t *testing.T) {
+	ss, cleanup := setupTestSessionService(t)
+	defer cleanup()
+
+	// Sessions saved before metadata existed only have a history.
+	history := []*types.Content{{Role: "user", Parts: []types.Part{{Text: "Fix the tests"}}}}
+	assert.NoError(t, ss.Store().Save("20240115-150405-1a2b3c4d", history))
+
+	metadata, err := ss.GetMetadata("20240115-150405-1a2b3c4d")
+	assert.NoError(t, err)
+	assert.Equal(t, "Fix the tests", metadata.Title)
+	assert.Equal(t, 1, metadata.MessageCount)
+	assert.Equal(t, time.Date(2024, 1, 15, 15, 4, 5, 0, time.Local), metadata.CreatedAt)
+}
+
+func TestListSessionMetadata(t *testing.T) {
+	stores := map[string]func(t *testing.T) SessionStore{
+		"file": func(t *testing.T) SessionStore {
+			store, err := NewFileSessionStore(t.TempDir())
+			assert.NoError(t, err)
+			return store
+		},
+		"sqlite": func(t *testing.T) SessionStore {
+			store, err := NewSQLiteSessionStore(filepath.Join(t.TempDir(), "sessions.db"))
+			assert.NoError(t, err)
+			t.Cleanup(func() { store.Close() })
+			return store
+		},
+	}
+	for name, newStore := range stores {
+		t.Run(name, func(t *testing.T) {
+			ss, err := NewSessionService(newStore(t))
+			assert.NoError(t, err)
+			testListSessionMetadata(t, ss)
+		})
+	}
+}
+
+func testListSessionMetadata(t *testing.T, ss *SessionService) {
+	for _, session := range []struct {
+		id, title, model string
+		cost             float64
+	}{
+		{"session_a", "Write the README", "gpt-4o", 0.2},
+		{"session_b", "Debug the race in the job queue", "gemini-2.5-pro", 1.5},
+		{"session_c", "Add a readme badge", "gpt-4o", 0.1},
+	} {
+		assert.NoError(t, ss.SaveHistory(session.id, []*types.Content{{Role: "user", Parts: []types.Part{{Text: session.title}}}}))
+		assert.NoError(t, ss.UpdateMetadata(session.id, func(metadata *SessionMetadata) {
+			metadata.Model = session.model
+			metadata.CostUSD = session.cost
+		}))
+		time.Sleep(10 * time.Millisecond) // Ensure different update times
+	}
+	ids := func(options SessionListOptions) []string {
+		sessions, err := ss.ListSessionMetadata(options)
+		assert.NoError(t, err)
+		var ids []string
+		for _, session := range sessions {
+			ids = append(ids, session.ID)
+		}
+		return ids
+	}
+
+	assert.Equal(t, []string{"session_c", "session_b", "session_a"}, ids(SessionListOptions{}), "newest first")
+	assert.Equal(t, []string{"session_a", "session_b", "session_c"}, ids(SessionListOptions{Reverse: true}))
+	assert.Equal(t, []string{"session_c", "session_a"}, ids(SessionListOptions{Query: "README"}))
+	assert.Equal(t, []string{"session_a", "session_c"}, ids(SessionListOptions{Model: "gpt-4o", SortBy: SessionSortCost}))
+	assert.Equal(t, []string{"session_c", "session_b", "session_a"}, ids(SessionListOptions{SortBy: SessionSortTitle}))
+	assert.Equal(t, []string{"session_c"}, ids(SessionListOptions{Limit: 1}))
+
+	_, err := ss.ListSessionMetadata(SessionListOptions{SortBy: "size"})
+	assert.Error(t, err)
+}
+
+func TestParseSessionListOptions(t *testing.T) {
+	options, err := ParseSessionListOptions(strings.Fields("model:gpt-4o since:7d sort:cost limit:5 reverse job queue"))
+	assert.NoError(t, err)
+	assert.Equal(t, "gpt-4o", options.Model)
+	assert.Equal(t, SessionSortCost, options.SortBy)
+	assert.Equal(t, 5, options.Limit)
+	assert.True(t, options.Reverse)
+	assert.Equal(t, "job queue", options.Query)
+	assert.WithinDuration(t, time.Now().Add(-7*24*time.Hour), options.Since, time.Minute)
+
+	_, err = ParseSessionListOptions([]string{"since:soon"})
+	assert.Error(t, err)
+}
+
+// toolTurnHistory returns two turns, the first with a tool call.
+func toolTurnHistory() []*types.Content {
+	return []*types.Content{
+		{Role: "user", Parts: []types.Part{{Text: "List the Go files"}}},
+		{Role: "model", Parts: []types.Part{{FunctionCall: &types.FunctionCall{ID: "call_1", Name: "glob", Args: map[string]interface{}{"pattern": "*.go"}}}}},
+		{Role: "user", Parts: []types.Part{{FunctionResponse: &types.FunctionResponse{ID: "call_1", Name: "glob", Response: map[string]interface{}{"output": "main.go"}}}}},
+		{Role: "model", Parts: []types.Part{{Text: "There is main.go."}}},
+		{Role: "user", Parts: []types.Part{{Text: "Add a test"}}},
+		{Role: "model", Parts: []types.Part{{Text: "Done."}}},
+	}
+}
+
+func TestForkSession(t *testing.T) {
+	ss, cleanup := setupTestSessionService(t)
+	defer cleanup()
+
+	history := toolTurnHistory()
+	assert.NoError(t, ss.SaveHistory("parent", history))
+	assert.NoError(t, ss.UpdateMetadata("parent", func(metadata *SessionMetadata) {
+		metadata.Model = "gpt-4o"
+		metadata.CostUSD = 0.5
+	}))
+
+	forkID, err := ss.ForkSession("parent", 4)
+	assert.NoError(t, err)
+	assert.NotEqual(t, "parent", forkID)
+
+	fork, err := ss.LoadHistory(forkID)
+	assert.NoError(t, err)
+	assert.Equal(t, history[:4], fork)
+	parent, err := ss.LoadHistory("parent")
+	assert.NoError(t, err)
+	assert.Equal(t, history, parent, "the parent should be unchanged")
+
+	metadata, err := ss.GetMetadata(forkID)
+	assert.NoError(t, err)
+	assert.Equal(t, "parent", metadata.ParentID)
+	assert.Equal(t, 4, metadata.ForkIndex)
+	assert.Equal(t, "gpt-4o", metadata.Model)
+	assert.Equal(t, "List the Go files", metadata.Title)
+	assert.Zero(t, metadata.CostUSD, "the fork has no cost of its own yet")
+
+	_, err = ss.ForkSession("parent", 2)
+	assert.Error(t, err, "a fork should not separate a tool call from its response")
+	_, err = ss.ForkSession("parent", 7)
+	assert.Error(t, err)
+	_, err = ss.ForkSession("unknown", 0)
+	assert.Error(t, err)
+}
+
+func TestRewindSession(t *testing.T) {
+	ss, cleanup := setupTestSessionService(t)
+	defer cleanup()
+
+	history := toolTurnHistory()
+	assert.NoError(t, ss.SaveHistory("s1", history))
+
+	dropped, err := ss.RewindSession("s1", 1)
+	assert.NoError(t, err)
+	assert.Equal(t, history[4:], dropped)
+	rewound, err := ss.LoadHistory("s1")
+	assert.NoError(t, err)
+	assert.Equal(t, history[:4], rewound)
+
+	// The tool call and its response belong to the turn of their prompt.
+	dropped, err = ss.RewindSession("s1", 1)
+	assert.NoError(t, err)
+	assert.Len(t, dropped, 4)
+	rewound, err = ss.LoadHistory("s1")
+	assert.NoError(t, err)
+	assert.Empty(t, rewound)
+
+	_, err = ss.RewindSession("s1", 1)
+	assert.Error(t, err)
+	_, err = ss.RewindSession("s1", 0)
+	assert.Error(t, err)
 }
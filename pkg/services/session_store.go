@@ -1,6 +1,10 @@
 package services
 
-import "go-ai-agent-v2/go-cli/pkg/types"
+import (
+	"time"
+
+	"go-ai-agent-v2/go-cli/pkg/types"
+)
 
 // SessionStore is the interface for session persistence.
 type SessionStore interface {
@@ -8,4 +12,38 @@ type SessionStore interface {
 	Load(sessionID string) ([]*types.Content, error)
 	List() ([]string, error)
 	Delete(sessionID string) error
+	// SaveMetadata and LoadMetadata keep the metadata of a session beside its
+	// history. LoadMetadata returns nil when the session has none.
+	SaveMetadata(metadata *SessionMetadata) error
+	LoadMetadata(sessionID string) (*SessionMetadata, error)
+}
+
+// SessionLister is implemented by stores that filter and sort sessions
+// themselves, such as SQLiteSessionStore with its indexes.
+type SessionLister interface {
+	ListMetadata(options SessionListOptions) ([]*SessionMetadata, error)
+}
+
+// SessionMetadataUpdater is implemented by stores that read, change and save
+// the metadata of a session as one atomic step, such as FileSessionStore
+// under its lock.
+type SessionMetadataUpdater interface {
+	UpdateMetadata(sessionID string, update func(metadata *SessionMetadata)) error
+}
+
+// SessionMetadata describes a saved session.
+type SessionMetadata struct {
+	ID           string    `json:"id"`
+	Title        string    `json:"title,omitempty"` // From the first user message
+	CreatedAt    time.Time `json:"createdAt"`
+	UpdatedAt    time.Time `json:"updatedAt"`
+	Executor     string    `json:"executor,omitempty"`
+	Model        string    `json:"model,omitempty"`
+	WorkspaceDir string    `json:"workspaceDir,omitempty"`
+	MessageCount int       `json:"messageCount"`
+	InputTokens  int       `json:"inputTokens"`
+	OutputTokens int       `json:"outputTokens"`
+	CostUSD      float64   `json:"costUSD"`
+	ParentID     string    `json:"parentId,omitempty"`  // The session this one was forked from
+	ForkIndex    int       `json:"forkIndex,omitempty"` // The number of messages taken from the parent
 }
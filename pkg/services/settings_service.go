@@ -36,6 +36,32 @@ type Settings struct {
 	CodebaseInvestigator *types.CodebaseInvestigatorSettings `json:"codebaseInvestigator,omitempty" mapstructure:"codebaseInvestigator"`
 	TestWriter           *types.TestWriterSettings           `json:"testWriter,omitempty" mapstructure:"testWriter"`
 	RunMode              string                              `json:"runMode,omitempty" mapstructure:"runMode"`
+	MaxParallelTools     int                                 `json:"maxParallelTools,omitempty" mapstructure:"maxParallelTools"`
+	// ToolConfirmationTimeout is in seconds; 0 waits for the reply indefinitely.
+	ToolConfirmationTimeout        int    `json:"toolConfirmationTimeout,omitempty" mapstructure:"toolConfirmationTimeout"`
+	ToolConfirmationDefaultOutcome string `json:"toolConfirmationDefaultOutcome,omitempty" mapstructure:"toolConfirmationDefaultOutcome"`
+	// MaxSessions and SessionIdleTimeout (in seconds) bound the sessions the agent server keeps in memory.
+	MaxSessions        int `json:"maxSessions,omitempty" mapstructure:"maxSessions"`
+	SessionIdleTimeout int `json:"sessionIdleTimeout,omitempty" mapstructure:"sessionIdleTimeout"`
+	// TaskWorkers, TaskMaxAttempts and TaskRetryBackoff (in seconds) configure the agent server's task queue.
+	TaskWorkers      int                       `json:"taskWorkers,omitempty" mapstructure:"taskWorkers"`
+	TaskMaxAttempts  int                       `json:"taskMaxAttempts,omitempty" mapstructure:"taskMaxAttempts"`
+	TaskRetryBackoff int                       `json:"taskRetryBackoff,omitempty" mapstructure:"taskRetryBackoff"`
+	ServerAuth       *types.ServerAuthSettings `json:"serverAuth,omitempty" mapstructure:"serverAuth"`
+	OpenAI           *types.OpenAISettings     `json:"openai,omitempty" mapstructure:"openai"`
+	Anthropic        *types.AnthropicSettings  `json:"anthropic,omitempty" mapstructure:"anthropic"`
+	Ollama           *types.OllamaSettings     `json:"ollama,omitempty" mapstructure:"ollama"`
+	// MockScenario is the path of a YAML scenario played by the mock executor.
+	MockScenario  string                       `json:"mockScenario,omitempty" mapstructure:"mockScenario"`
+	ModelFallback *types.ModelFallbackSettings `json:"modelFallback,omitempty" mapstructure:"modelFallback"`
+	Retry         *types.RetrySettings         `json:"retry,omitempty" mapstructure:"retry"`
+	Routing       *types.RoutingSettings       `json:"routing,omitempty" mapstructure:"routing"`
+	Budget        *types.BudgetSettings        `json:"budget,omitempty" mapstructure:"budget"`
+	// ContextWindow is in tokens; 0 uses the built-in size of the model. From CompressionThreshold
+	// of it, the history is compressed, except for the last CompressionPreserveTurns turns.
+	ContextWindow            int     `json:"contextWindow,omitempty" mapstructure:"contextWindow"`
+	CompressionThreshold     float64 `json:"compressionThreshold,omitempty" mapstructure:"compressionThreshold"`
+	CompressionPreserveTurns int     `json:"compressionPreserveTurns,omitempty" mapstructure:"compressionPreserveTurns"`
 }
 
 func newDefaultSettings(workspaceDir string) {
@@ -65,9 +91,28 @@ func newDefaultSettings(workspaceDir string) {
 	viper.SetDefault("tavily", &types.TavilySettings{
 		ApiKey: "API_KEY_GOES_HERE",
 	})
+	viper.SetDefault("openai", &types.OpenAISettings{
+		BaseURL:   types.DefaultOpenAIBaseURL,
+		APIKeyEnv: types.DefaultOpenAIAPIKeyEnv,
+	})
+	viper.SetDefault("anthropic", &types.AnthropicSettings{
+		BaseURL:   types.DefaultAnthropicBaseURL,
+		APIKeyEnv: types.DefaultAnthropicAPIKeyEnv,
+		MaxTokens: types.DefaultAnthropicMaxTokens,
+	})
 	viper.SetDefault("codebaseInvestigator", &types.CodebaseInvestigatorSettings{Enabled: true})
 	viper.SetDefault("testWriter", &types.TestWriterSettings{Enabled: true})
 	viper.SetDefault("runMode", "cli")
+	viper.SetDefault("maxParallelTools", DefaultMaxParallelTools)
+	viper.SetDefault("toolConfirmationTimeout", 0)
+	viper.SetDefault("toolConfirmationDefaultOutcome", string(DefaultToolConfirmationOutcome))
+	viper.SetDefault("maxSessions", 16)
+	viper.SetDefault("sessionIdleTimeout", 1800)
+	viper.SetDefault("taskWorkers", 4)
+	viper.SetDefault("taskMaxAttempts", 3)
+	viper.SetDefault("taskRetryBackoff", 5)
+	viper.SetDefault("compressionThreshold", DefaultCompressionThreshold)
+	viper.SetDefault("compressionPreserveTurns", DefaultCompressionPreserveTurns)
 }
 
 // SettingsService manages application settings.
@@ -203,6 +248,94 @@ func (ss *SettingsService) GetTestWriterSettings() *types.TestWriterSettings {
 	return &testWriterSettings
 }
 
+// GetOpenAISettings returns the settings of the openai executor.
+func (ss *SettingsService) GetOpenAISettings() *types.OpenAISettings {
+	ss.mu.RLock()
+	defer ss.mu.RUnlock()
+	var openAISettings types.OpenAISettings
+	if err := viper.UnmarshalKey("openai", &openAISettings); err != nil {
+		return nil
+	}
+	return &openAISettings
+}
+
+// GetAnthropicSettings returns the settings of the anthropic executor.
+func (ss *SettingsService) GetAnthropicSettings() *types.AnthropicSettings {
+	ss.mu.RLock()
+	defer ss.mu.RUnlock()
+	var anthropicSettings types.AnthropicSettings
+	if err := viper.UnmarshalKey("anthropic", &anthropicSettings); err != nil {
+		return nil
+	}
+	return &anthropicSettings
+}
+
+// GetOllamaSettings returns the settings of the ollama executor.
+func (ss *SettingsService) GetOllamaSettings() *types.OllamaSettings {
+	ss.mu.RLock()
+	defer ss.mu.RUnlock()
+	var ollamaSettings types.OllamaSettings
+	if err := viper.UnmarshalKey("ollama", &ollamaSettings); err != nil {
+		return nil
+	}
+	return &ollamaSettings
+}
+
+// GetModelFallbackSettings returns the fallback chain of the chat service.
+func (ss *SettingsService) GetModelFallbackSettings() *types.ModelFallbackSettings {
+	ss.mu.RLock()
+	defer ss.mu.RUnlock()
+	var fallbackSettings types.ModelFallbackSettings
+	if err := viper.UnmarshalKey("modelFallback", &fallbackSettings); err != nil {
+		return nil
+	}
+	return &fallbackSettings
+}
+
+// GetRetrySettings returns how transient executor errors are retried.
+func (ss *SettingsService) GetRetrySettings() *types.RetrySettings {
+	ss.mu.RLock()
+	defer ss.mu.RUnlock()
+	var retrySettings types.RetrySettings
+	if err := viper.UnmarshalKey("retry", &retrySettings); err != nil {
+		return nil
+	}
+	return &retrySettings
+}
+
+// GetRoutingSettings returns how the model is picked when the model is "auto".
+func (ss *SettingsService) GetRoutingSettings() *types.RoutingSettings {
+	ss.mu.RLock()
+	defer ss.mu.RUnlock()
+	var routingSettings types.RoutingSettings
+	if err := viper.UnmarshalKey("routing", &routingSettings); err != nil {
+		return nil
+	}
+	return &routingSettings
+}
+
+// GetBudgetSettings returns the model pricing and the cost budgets.
+func (ss *SettingsService) GetBudgetSettings() *types.BudgetSettings {
+	ss.mu.RLock()
+	defer ss.mu.RUnlock()
+	var budgetSettings types.BudgetSettings
+	if err := viper.UnmarshalKey("budget", &budgetSettings); err != nil {
+		return nil
+	}
+	return &budgetSettings
+}
+
+// GetServerAuthSettings returns the authentication settings of the agent server.
+func (ss *SettingsService) GetServerAuthSettings() *types.ServerAuthSettings {
+	ss.mu.RLock()
+	defer ss.mu.RUnlock()
+	var serverAuthSettings types.ServerAuthSettings
+	if err := viper.UnmarshalKey("serverAuth", &serverAuthSettings); err != nil {
+		return nil
+	}
+	return &serverAuthSettings
+}
+
 // GetTelemetryLogPath returns the configured telemetry log file path.
 func (ss *SettingsService) GetTelemetryLogPath() string {
 	ss.mu.RLock()
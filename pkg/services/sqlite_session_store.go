@@ -0,0 +1,513 @@
+package services
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"go-ai-agent-v2/go-cli/pkg/types"
+
+	_ "modernc.org/sqlite" // Pure-Go SQLite driver
+)
+
+// sqliteSchema creates the tables of SQLiteSessionStore. Sessions hold the
+// metadata, messages their role and position, parts their text and data, and
+// tool_calls the function calls and responses of parts. messages_fts indexes
+// the text of the messages for search; a later migration replaces it.
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS sessions (
+	id            TEXT PRIMARY KEY,
+	title         TEXT NOT NULL DEFAULT '',
+	created_at    INTEGER NOT NULL DEFAULT 0,
+	updated_at    INTEGER NOT NULL DEFAULT 0,
+	executor      TEXT NOT NULL DEFAULT '',
+	model         TEXT NOT NULL DEFAULT '',
+	workspace_dir TEXT NOT NULL DEFAULT '',
+	message_count INTEGER NOT NULL DEFAULT 0,
+	input_tokens  INTEGER NOT NULL DEFAULT 0,
+	output_tokens INTEGER NOT NULL DEFAULT 0,
+	cost_usd      REAL NOT NULL DEFAULT 0
+);
+CREATE INDEX IF NOT EXISTS sessions_updated_at ON sessions (updated_at);
+CREATE INDEX IF NOT EXISTS sessions_created_at ON sessions (created_at);
+CREATE INDEX IF NOT EXISTS sessions_workspace_dir ON sessions (workspace_dir);
+CREATE INDEX IF NOT EXISTS sessions_model ON sessions (model);
+
+CREATE TABLE IF NOT EXISTS messages (
+	id         INTEGER PRIMARY KEY,
+	session_id TEXT NOT NULL REFERENCES sessions (id) ON DELETE CASCADE,
+	position   INTEGER NOT NULL,
+	role       TEXT NOT NULL,
+	digest     TEXT NOT NULL,
+	UNIQUE (session_id, position)
+);
+
+CREATE TABLE IF NOT EXISTS parts (
+	message_id        INTEGER NOT NULL REFERENCES messages (id) ON DELETE CASCADE,
+	part_index        INTEGER NOT NULL,
+	text              TEXT NOT NULL DEFAULT '',
+	thought           TEXT NOT NULL DEFAULT '',
+	thought_signature TEXT NOT NULL DEFAULT '',
+	mime_type         TEXT NOT NULL DEFAULT '',
+	inline_data       TEXT,
+	file_uri          TEXT,
+	PRIMARY KEY (message_id, part_index)
+);
+
+CREATE TABLE IF NOT EXISTS tool_calls (
+	message_id INTEGER NOT NULL,
+	part_index INTEGER NOT NULL,
+	kind       TEXT NOT NULL CHECK (kind IN ('call', 'response')),
+	call_id    TEXT NOT NULL DEFAULT '',
+	name       TEXT NOT NULL,
+	payload    TEXT NOT NULL,
+	PRIMARY KEY (message_id, part_index),
+	FOREIGN KEY (message_id, part_index) REFERENCES parts (message_id, part_index) ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS tool_calls_name ON tool_calls (name);
+
+CREATE VIRTUAL TABLE IF NOT EXISTS messages_fts USING fts5 (session_id UNINDEXED, position UNINDEXED, text);
+`
+
+// sqliteMigrations are the changes to the schema, in order. The number of
+// those applied to a database is its user_version.
+var sqliteMigrations = []string{
+	sqliteSchema,
+	`ALTER TABLE sessions ADD COLUMN parent_id TEXT NOT NULL DEFAULT '';
+	ALTER TABLE sessions ADD COLUMN fork_index INTEGER NOT NULL DEFAULT 0;
+	CREATE INDEX IF NOT EXISTS sessions_parent_id ON sessions (parent_id);`,
+	// messages_fts becomes contentless and keyed by the rowid of messages, so
+	// that the text of messages is deleted by rowid instead of by scanning
+	// the index for their session.
+	`DROP TABLE messages_fts;
+	CREATE VIRTUAL TABLE messages_fts USING fts5 (text, content = '', contentless_delete = 1);
+	INSERT INTO messages_fts (rowid, text)
+		SELECT message_id, group_concat(text, char(10)) FROM (SELECT message_id, text FROM parts WHERE text != '' ORDER BY message_id, part_index)
+		GROUP BY message_id;`,
+}
+
+// Tool call kinds of the tool_calls table.
+const (
+	toolCallKindCall     = "call"
+	toolCallKindResponse = "response"
+)
+
+// sqliteSortColumns are the ORDER BY clauses of the SessionSort fields, in
+// the default order of ListSessionMetadata.
+var sqliteSortColumns = map[string]string{
+	"":                  "updated_at DESC",
+	SessionSortUpdated:  "updated_at DESC",
+	SessionSortCreated:  "created_at DESC",
+	SessionSortTitle:    "title COLLATE NOCASE ASC",
+	SessionSortMessages: "message_count DESC",
+	SessionSortCost:     "cost_usd DESC",
+}
+
+// SQLiteSessionStore is an implementation of the SessionStore interface on an
+// embedded SQLite database. It keeps all sessions in a single file, lists them
+// with its indexes, and searches the text of their messages.
+type SQLiteSessionStore struct {
+	db *sql.DB
+}
+
+// NewSQLiteSessionStore opens or creates the SQLite database of sessions at
+// dbPath.
+func NewSQLiteSessionStore(dbPath string) (*SQLiteSessionStore, error) {
+	if err := os.MkdirAll(filepath.Dir(dbPath), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create sessions directory: %w", err)
+	}
+	// Transactions take the write lock when they begin, and wait for the
+	// other processes using the database instead of failing.
+	dsn := "file:" + dbPath + "?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)&_txlock=immediate"
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open sqlite database: %w", err)
+	}
+	if err := migrateSQLite(db); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &SQLiteSessionStore{db: db}, nil
+}
+
+// migrateSQLite applies the migrations that a database is missing.
+func migrateSQLite(db *sql.DB) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin sqlite transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var version int
+	if err := tx.QueryRow(`PRAGMA user_version`).Scan(&version); err != nil {
+		return fmt.Errorf("failed to read sqlite schema version: %w", err)
+	}
+	for ; version < len(sqliteMigrations); version++ {
+		if _, err := tx.Exec(sqliteMigrations[version]); err != nil {
+			return fmt.Errorf("failed to migrate sqlite schema to version %d: %w", version+1, err)
+		}
+	}
+	if _, err := tx.Exec(fmt.Sprintf(`PRAGMA user_version = %d`, version)); err != nil {
+		return fmt.Errorf("failed to write sqlite schema version: %w", err)
+	}
+	return tx.Commit()
+}
+
+// Close closes the database.
+func (s *SQLiteSessionStore) Close() error {
+	return s.db.Close()
+}
+
+// Save saves the chat history for a given session ID. Messages are compared
+// by digest, so that only those after the first change are rewritten.
+func (s *SQLiteSessionStore) Save(sessionID string, history []*types.Content) error {
+	digests := make([]string, len(history))
+	for i, content := range history {
+		data, err := json.Marshal(content)
+		if err != nil {
+			return fmt.Errorf("failed to marshal history: %w", err)
+		}
+		sum := sha256.Sum256(data)
+		digests[i] = hex.EncodeToString(sum[:])
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin sqlite transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UnixNano()
+	_, err = tx.Exec(`INSERT INTO sessions (id, created_at, updated_at, message_count) VALUES (?, ?, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET message_count = excluded.message_count`, sessionID, now, now, len(history))
+	if err != nil {
+		return fmt.Errorf("failed to save session: %w", err)
+	}
+
+	saved, err := queryStrings(tx, `SELECT digest FROM messages WHERE session_id = ? ORDER BY position`, sessionID)
+	if err != nil {
+		return fmt.Errorf("failed to load session messages: %w", err)
+	}
+	first := 0
+	for first < len(saved) && first < len(digests) && saved[first] == digests[first] {
+		first++
+	}
+	if first == len(saved) && first == len(digests) {
+		return tx.Commit()
+	}
+
+	if _, err := tx.Exec(`DELETE FROM messages_fts WHERE rowid IN (SELECT id FROM messages WHERE session_id = ? AND position >= ?)`, sessionID, first); err != nil {
+		return fmt.Errorf("failed to delete session messages: %w", err)
+	}
+	if _, err := tx.Exec(`DELETE FROM messages WHERE session_id = ? AND position >= ?`, sessionID, first); err != nil {
+		return fmt.Errorf("failed to delete session messages: %w", err)
+	}
+	for position := first; position < len(history); position++ {
+		if err := insertMessage(tx, sessionID, position, history[position], digests[position]); err != nil {
+			return fmt.Errorf("failed to save message %d: %w", position, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit session: %w", err)
+	}
+	return nil
+}
+
+// insertMessage inserts a message with its parts, tool calls and text index.
+func insertMessage(tx *sql.Tx, sessionID string, position int, content *types.Content, digest string) error {
+	result, err := tx.Exec(`INSERT INTO messages (session_id, position, role, digest) VALUES (?, ?, ?, ?)`, sessionID, position, content.Role, digest)
+	if err != nil {
+		return err
+	}
+	messageID, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+
+	var text []string
+	for i, part := range content.Parts {
+		var mimeType string
+		var inlineData, fileURI *string
+		if part.InlineData != nil {
+			mimeType, inlineData = part.InlineData.MimeType, &part.InlineData.Data
+		}
+		if part.FileData != nil {
+			mimeType, fileURI = part.FileData.MimeType, &part.FileData.FileURL
+		}
+		_, err := tx.Exec(`INSERT INTO parts (message_id, part_index, text, thought, thought_signature, mime_type, inline_data, file_uri) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+			messageID, i, part.Text, part.Thought, part.ThoughtSignature, mimeType, inlineData, fileURI)
+		if err != nil {
+			return err
+		}
+		if part.Text != "" {
+			text = append(text, part.Text)
+		}
+
+		var kind, callID, name string
+		var payload map[string]interface{}
+		switch {
+		case part.FunctionCall != nil:
+			kind, callID, name, payload = toolCallKindCall, part.FunctionCall.ID, part.FunctionCall.Name, part.FunctionCall.Args
+		case part.FunctionResponse != nil:
+			kind, callID, name, payload = toolCallKindResponse, part.FunctionResponse.ID, part.FunctionResponse.Name, part.FunctionResponse.Response
+		default:
+			continue
+		}
+		data, err := json.Marshal(payload)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(`INSERT INTO tool_calls (message_id, part_index, kind, call_id, name, payload) VALUES (?, ?, ?, ?, ?, ?)`, messageID, i, kind, callID, name, string(data))
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(text) > 0 {
+		_, err = tx.Exec(`INSERT INTO messages_fts (rowid, text) VALUES (?, ?)`, messageID, strings.Join(text, "\n"))
+	}
+	return err
+}
+
+// Load loads the chat history for a given session ID.
+func (s *SQLiteSessionStore) Load(sessionID string) ([]*types.Content, error) {
+	rows, err := s.db.Query(`SELECT m.position, m.role, p.part_index, p.text, p.thought, p.thought_signature, p.mime_type, p.inline_data, p.file_uri, t.kind, t.call_id, t.name, t.payload
+		FROM messages m
+		LEFT JOIN parts p ON p.message_id = m.id
+		LEFT JOIN tool_calls t ON t.message_id = p.message_id AND t.part_index = p.part_index
+		WHERE m.session_id = ?
+		ORDER BY m.position, p.part_index`, sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load session: %w", err)
+	}
+	defer rows.Close()
+
+	history := []*types.Content{}
+	position := -1
+	for rows.Next() {
+		var messagePosition int
+		var role string
+		var partIndex sql.NullInt64
+		var text, thought, thoughtSignature, mimeType, inlineData, fileURI, kind, callID, name, payload sql.NullString
+		if err := rows.Scan(&messagePosition, &role, &partIndex, &text, &thought, &thoughtSignature, &mimeType, &inlineData, &fileURI, &kind, &callID, &name, &payload); err != nil {
+			return nil, fmt.Errorf("failed to read session message: %w", err)
+		}
+		if messagePosition != position {
+			history = append(history, &types.Content{Role: role})
+			position = messagePosition
+		}
+		if !partIndex.Valid {
+			continue
+		}
+
+		part := types.Part{Text: text.String, Thought: thought.String, ThoughtSignature: thoughtSignature.String}
+		if inlineData.Valid {
+			part.InlineData = &types.InlineData{MimeType: mimeType.String, Data: inlineData.String}
+		}
+		if fileURI.Valid {
+			part.FileData = &types.FileData{MimeType: mimeType.String, FileURL: fileURI.String}
+		}
+		if kind.Valid {
+			var data map[string]interface{}
+			if err := json.Unmarshal([]byte(payload.String), &data); err != nil {
+				return nil, fmt.Errorf("failed to unmarshal tool call: %w", err)
+			}
+			if kind.String == toolCallKindCall {
+				part.FunctionCall = &types.FunctionCall{ID: callID.String, Name: name.String, Args: data}
+			} else {
+				part.FunctionResponse = &types.FunctionResponse{ID: callID.String, Name: name.String, Response: data}
+			}
+		}
+		content := history[len(history)-1]
+		content.Parts = append(content.Parts, part)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to load session: %w", err)
+	}
+	return history, nil
+}
+
+// List returns all saved session IDs, most recently updated first.
+func (s *SQLiteSessionStore) List() ([]string, error) {
+	sessions, err := queryStrings(s.db, `SELECT id FROM sessions ORDER BY updated_at DESC, id DESC`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list sessions: %w", err)
+	}
+	return sessions, nil
+}
+
+// Delete deletes a session with its messages and metadata.
+func (s *SQLiteSessionStore) Delete(sessionID string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin sqlite transaction: %w", err)
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(`DELETE FROM messages_fts WHERE rowid IN (SELECT id FROM messages WHERE session_id = ?)`, sessionID); err != nil {
+		return fmt.Errorf("failed to delete session: %w", err)
+	}
+	if _, err := tx.Exec(`DELETE FROM sessions WHERE id = ?`, sessionID); err != nil {
+		return fmt.Errorf("failed to delete session: %w", err)
+	}
+	return tx.Commit()
+}
+
+// SaveMetadata saves the metadata of a session.
+func (s *SQLiteSessionStore) SaveMetadata(metadata *SessionMetadata) error {
+	_, err := s.db.Exec(`INSERT INTO sessions (`+sqliteMetadataColumns+`)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET title = excluded.title, created_at = excluded.created_at, updated_at = excluded.updated_at,
+			executor = excluded.executor, model = excluded.model, workspace_dir = excluded.workspace_dir, message_count = excluded.message_count,
+			input_tokens = excluded.input_tokens, output_tokens = excluded.output_tokens, cost_usd = excluded.cost_usd,
+			parent_id = excluded.parent_id, fork_index = excluded.fork_index`,
+		metadata.ID, metadata.Title, unixNanos(metadata.CreatedAt), unixNanos(metadata.UpdatedAt), metadata.Executor, metadata.Model,
+		metadata.WorkspaceDir, metadata.MessageCount, metadata.InputTokens, metadata.OutputTokens, metadata.CostUSD,
+		metadata.ParentID, metadata.ForkIndex)
+	if err != nil {
+		return fmt.Errorf("failed to save session metadata: %w", err)
+	}
+	return nil
+}
+
+// sqliteMetadataColumns are the columns scanned by scanMetadata.
+const sqliteMetadataColumns = `id, title, created_at, updated_at, executor, model, workspace_dir, message_count, input_tokens, output_tokens, cost_usd, parent_id, fork_index`
+
+// LoadMetadata loads the metadata of a session, or nil when it does not exist.
+func (s *SQLiteSessionStore) LoadMetadata(sessionID string) (*SessionMetadata, error) {
+	metadata, err := scanMetadata(s.db.QueryRow(`SELECT `+sqliteMetadataColumns+` FROM sessions WHERE id = ?`, sessionID))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load session metadata: %w", err)
+	}
+	return metadata, nil
+}
+
+// ListMetadata filters and sorts sessions with the indexes of the database.
+// Unlike the other stores, the query also matches the text of the messages.
+func (s *SQLiteSessionStore) ListMetadata(options SessionListOptions) ([]*SessionMetadata, error) {
+	order, ok := sqliteSortColumns[options.SortBy]
+	if !ok {
+		return nil, fmt.Errorf("unknown session sort field %q", options.SortBy)
+	}
+	if options.Reverse {
+		if before, found := strings.CutSuffix(order, " DESC"); found {
+			order = before + " ASC"
+		} else {
+			order = strings.TrimSuffix(order, " ASC") + " DESC"
+		}
+	}
+
+	query := `SELECT ` + sqliteMetadataColumns + ` FROM sessions WHERE 1 = 1`
+	var args []any
+	if options.Query != "" {
+		pattern := "%" + escapeLike(options.Query) + "%"
+		query += ` AND (title LIKE ? ESCAPE '\' OR id LIKE ? ESCAPE '\' OR id IN (SELECT session_id FROM messages WHERE id IN (SELECT rowid FROM messages_fts WHERE messages_fts MATCH ?)))`
+		args = append(args, pattern, pattern, ftsQuery(options.Query))
+	}
+	for column, value := range map[string]string{"workspace_dir": options.WorkspaceDir, "executor": options.Executor, "model": options.Model} {
+		if value != "" {
+			query += ` AND ` + column + ` = ?`
+			args = append(args, value)
+		}
+	}
+	if !options.Since.IsZero() {
+		query += ` AND updated_at >= ?`
+		args = append(args, options.Since.UnixNano())
+	}
+	query += ` ORDER BY ` + order + `, updated_at DESC, id DESC`
+	if options.Limit > 0 {
+		query += ` LIMIT ?`
+		args = append(args, options.Limit)
+	}
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list sessions: %w", err)
+	}
+	defer rows.Close()
+	var sessions []*SessionMetadata
+	for rows.Next() {
+		metadata, err := scanMetadata(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read session metadata: %w", err)
+		}
+		sessions = append(sessions, metadata)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list sessions: %w", err)
+	}
+	return sessions, nil
+}
+
+// scanMetadata reads the sqliteMetadataColumns of a row.
+func scanMetadata(row interface{ Scan(dest ...any) error }) (*SessionMetadata, error) {
+	var metadata SessionMetadata
+	var createdAt, updatedAt int64
+	err := row.Scan(&metadata.ID, &metadata.Title, &createdAt, &updatedAt, &metadata.Executor, &metadata.Model,
+		&metadata.WorkspaceDir, &metadata.MessageCount, &metadata.InputTokens, &metadata.OutputTokens, &metadata.CostUSD,
+		&metadata.ParentID, &metadata.ForkIndex)
+	if err != nil {
+		return nil, err
+	}
+	metadata.CreatedAt, metadata.UpdatedAt = fromUnixNanos(createdAt), fromUnixNanos(updatedAt)
+	return &metadata, nil
+}
+
+// queryStrings returns the first column of the rows of a query.
+func queryStrings(db interface {
+	Query(query string, args ...any) (*sql.Rows, error)
+}, query string, args ...any) ([]string, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var values []string
+	for rows.Next() {
+		var value string
+		if err := rows.Scan(&value); err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+	return values, rows.Err()
+}
+
+// unixNanos stores times as nanoseconds since the epoch, and the zero time as 0.
+func unixNanos(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixNano()
+}
+
+func fromUnixNanos(nanos int64) time.Time {
+	if nanos == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, nanos)
+}
+
+// escapeLike escapes the wildcards of a LIKE pattern.
+func escapeLike(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(value)
+}
+
+// ftsQuery turns the words of a query into FTS5 strings that must all match,
+// so that its operators and punctuation are searched literally.
+func ftsQuery(query string) string {
+	words := strings.Fields(query)
+	for i, word := range words {
+		words[i] = `"` + strings.ReplaceAll(word, `"`, `""`) + `"`
+	}
+	return strings.Join(words, " ")
+}
@@ -0,0 +1,184 @@
+package services
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go-ai-agent-v2/go-cli/pkg/types"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestSQLiteSessionStore(t *testing.T) *SQLiteSessionStore {
+	store, err := NewSQLiteSessionStore(filepath.Join(t.TempDir(), "sessions.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+func TestSQLiteSessionStore_SaveAndLoad(t *testing.T) {
+	store := newTestSQLiteSessionStore(t)
+
+	history := []*types.Content{
+		{Role: "user", Parts: []types.Part{{Text: "List the Go files"}, {InlineData: &types.InlineData{MimeType: "image/png", Data: "iVBORw0KGgo="}}}},
+		{Role: "model", Parts: []types.Part{
+			{Thought: "Use glob", ThoughtSignature: "sig"},
+			{FunctionCall: &types.FunctionCall{ID: "call_1", Name: "glob", Args: map[string]interface{}{"pattern": "**/*.go"}}},
+		}},
+		{Role: "user", Parts: []types.Part{{FunctionResponse: &types.FunctionResponse{ID: "call_1", Name: "glob", Response: map[string]interface{}{"files": []interface{}{"main.go"}}}}}},
+		{Role: "model", Parts: []types.Part{{Text: "There is one file."}, {FileData: &types.FileData{MimeType: "text/plain", FileURL: "gs://bucket/main.go"}}}},
+	}
+	require.NoError(t, store.Save("s1", history))
+
+	loaded, err := store.Load("s1")
+	require.NoError(t, err)
+	assert.Equal(t, history, loaded)
+
+	var calls int
+	require.NoError(t, store.db.QueryRow(`SELECT COUNT(*) FROM tool_calls WHERE name = 'glob'`).Scan(&calls))
+	assert.Equal(t, 2, calls, "the call and its response should be stored as tool calls")
+
+	// An unknown session has an empty history.
+	loaded, err = store.Load("unknown")
+	require.NoError(t, err)
+	assert.Empty(t, loaded)
+}
+
+func TestSQLiteSessionStore_SaveRewritesChangedMessagesOnly(t *testing.T) {
+	store := newTestSQLiteSessionStore(t)
+	messageIDs := func() []string {
+		ids, err := queryStrings(store.db, `SELECT id FROM messages WHERE session_id = 's1' ORDER BY position`)
+		require.NoError(t, err)
+		return ids
+	}
+
+	history := []*types.Content{textContent("user", "Hello"), textContent("model", "Hi")}
+	require.NoError(t, store.Save("s1", history))
+	before := messageIDs()
+
+	history = append(history, textContent("user", "Fix the tests"))
+	require.NoError(t, store.Save("s1", history))
+	after := messageIDs()
+	require.Len(t, after, 3)
+	assert.Equal(t, before, after[:2], "unchanged messages should be kept")
+
+	// A compressed history replaces the earlier messages.
+	compressed := []*types.Content{textContent("user", "Summary"), history[2]}
+	require.NoError(t, store.Save("s1", compressed))
+	loaded, err := store.Load("s1")
+	require.NoError(t, err)
+	assert.Equal(t, compressed, loaded)
+
+	indexed, err := queryStrings(store.db, `SELECT rowid FROM messages_fts ORDER BY rowid`)
+	require.NoError(t, err)
+	assert.Equal(t, messageIDs(), indexed, "the text index should follow the messages")
+}
+
+func TestSQLiteSessionStore_Metadata(t *testing.T) {
+	store := newTestSQLiteSessionStore(t)
+	ss, err := NewSessionService(store)
+	require.NoError(t, err)
+
+	metadata, err := store.LoadMetadata("s1")
+	require.NoError(t, err)
+	assert.Nil(t, metadata)
+
+	require.NoError(t, ss.SaveHistory("s1", []*types.Content{textContent("user", "Write the README")}))
+	require.NoError(t, ss.UpdateMetadata("s1", func(metadata *SessionMetadata) {
+		metadata.Model = "gpt-4o"
+		metadata.InputTokens = 1200
+		metadata.CostUSD = 0.25
+	}))
+
+	metadata, err = ss.GetMetadata("s1")
+	require.NoError(t, err)
+	assert.Equal(t, "Write the README", metadata.Title)
+	assert.Equal(t, "gpt-4o", metadata.Model)
+	assert.Equal(t, 1, metadata.MessageCount)
+	assert.Equal(t, 1200, metadata.InputTokens)
+	assert.Equal(t, 0.25, metadata.CostUSD)
+	assert.WithinDuration(t, time.Now(), metadata.UpdatedAt, time.Minute)
+	assert.False(t, metadata.CreatedAt.After(metadata.UpdatedAt))
+
+	require.NoError(t, ss.DeleteSession("s1"))
+	metadata, err = store.LoadMetadata("s1")
+	require.NoError(t, err)
+	assert.Nil(t, metadata)
+	for _, table := range []string{"messages", "parts", "messages_fts"} {
+		var rows int
+		require.NoError(t, store.db.QueryRow(`SELECT COUNT(*) FROM `+table).Scan(&rows))
+		assert.Zero(t, rows, "%s should be empty after deleting the session", table)
+	}
+}
+
+func TestSQLiteSessionStore_SearchesMessages(t *testing.T) {
+	store := newTestSQLiteSessionStore(t)
+	ss, err := NewSessionService(store)
+	require.NoError(t, err)
+
+	require.NoError(t, ss.SaveHistory("s1", []*types.Content{
+		textContent("user", "Debug the job queue"),
+		textContent("model", "The worker deadlocks when the callback URL times out."),
+	}))
+	require.NoError(t, ss.SaveHistory("s2", []*types.Content{textContent("user", "Write the README")}))
+
+	sessions, err := ss.ListSessionMetadata(SessionListOptions{Query: "callback deadlocks"})
+	require.NoError(t, err)
+	require.Len(t, sessions, 1)
+	assert.Equal(t, "s1", sessions[0].ID)
+
+	// FTS operators and punctuation are searched literally.
+	sessions, err = ss.ListSessionMetadata(SessionListOptions{Query: `URL" OR "README`})
+	require.NoError(t, err)
+	assert.Empty(t, sessions)
+}
+
+func TestSQLiteSessionStore_MigratesSchema(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "sessions.db")
+	store, err := NewSQLiteSessionStore(dbPath)
+	require.NoError(t, err)
+	// A database created before sessions had parents.
+	_, err = store.db.Exec(`DROP INDEX sessions_parent_id; ALTER TABLE sessions DROP COLUMN parent_id; ALTER TABLE sessions DROP COLUMN fork_index; PRAGMA user_version = 1`)
+	require.NoError(t, err)
+	require.NoError(t, store.Close())
+
+	store, err = NewSQLiteSessionStore(dbPath)
+	require.NoError(t, err)
+	defer store.Close()
+	require.NoError(t, store.SaveMetadata(&SessionMetadata{ID: "fork", ParentID: "parent", ForkIndex: 4}))
+	metadata, err := store.LoadMetadata("fork")
+	require.NoError(t, err)
+	assert.Equal(t, "parent", metadata.ParentID)
+	assert.Equal(t, 4, metadata.ForkIndex)
+}
+
+func TestSQLiteSessionStore_MigratesTextIndex(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "sessions.db")
+	store, err := NewSQLiteSessionStore(dbPath)
+	require.NoError(t, err)
+	require.NoError(t, store.Save("s1", []*types.Content{
+		{Role: "user", Parts: []types.Part{{Text: "Debug the job queue"}, {Text: "It deadlocks"}}},
+		textContent("model", "The callback URL times out."),
+	}))
+	// A database whose text index was keyed by session and position.
+	_, err = store.db.Exec(`DROP TABLE messages_fts;
+		CREATE VIRTUAL TABLE messages_fts USING fts5 (session_id UNINDEXED, position UNINDEXED, text);
+		PRAGMA user_version = 2`)
+	require.NoError(t, err)
+	require.NoError(t, store.Close())
+
+	store, err = NewSQLiteSessionStore(dbPath)
+	require.NoError(t, err)
+	defer store.Close()
+	sessions, err := store.ListMetadata(SessionListOptions{Query: "queue deadlocks"})
+	require.NoError(t, err)
+	require.Len(t, sessions, 1, "the text of existing messages should be indexed again")
+	assert.Equal(t, "s1", sessions[0].ID)
+
+	require.NoError(t, store.Delete("s1"))
+	var indexed int
+	require.NoError(t, store.db.QueryRow(`SELECT COUNT(*) FROM messages_fts`).Scan(&indexed))
+	assert.Zero(t, indexed)
+}
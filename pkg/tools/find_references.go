@@ -24,7 +24,7 @@ func NewFindReferencesTool(workspaceService types.WorkspaceServiceIface) *FindRe
 		BaseDeclarativeTool: types.NewBaseDeclarativeTool(
 			FIND_REFERENCES_TOOL_NAME,
 			"Find References",
-			"Finds all usages of a specific symbol (function, variable, etc.) in the codebase.",
+			"Finds all usages of a specific Go symbol (function, variable, type, field, etc.) across the module, marking each as definition, read, write or call.",
 			types.KindSearch,
 			(&types.JsonSchemaObject{
 				Type: "object",
@@ -104,7 +104,15 @@ func (t *FindReferencesTool) Execute(ctx context.Context, args map[string]any) (
 		}, nil
 	}
 
-	output := fmt.Sprintf("Found references for symbol at %s:%d:%d:\n%s", absolutePath, line, column, strings.Join(references, "\n"))
+	lines := make([]string, 0, len(references))
+	for _, ref := range references {
+		if relPath, err := filepath.Rel(projectRoot, ref.FilePath); err == nil && !strings.HasPrefix(relPath, "..") {
+			ref.FilePath = relPath
+		}
+		lines = append(lines, ref.String())
+	}
+
+	output := fmt.Sprintf("Found references for symbol at %s:%d:%d:\n%s", absolutePath, line, column, strings.Join(lines, "\n"))
 	return types.ToolResult{
 		LLMContent:    output,
 		ReturnDisplay: output,
@@ -60,7 +60,7 @@ func TestFindReferencesTool_Execute(t *testing.T) {
 			name: "FindSymbolReferences returns error",
 			args: map[string]any{"file_path": "/path/to/file.go", "line": float64(10), "column": float64(5)},
 			setupMock: func() {
-				analysis.FindSymbolReferencesFunc = func(filePath string, line, column int) ([]string, error) {
+				analysis.FindSymbolReferencesFunc = func(filePath string, line, column int) ([]analysis.SymbolReference, error) {
 					return nil, fmt.Errorf("analysis error")
 				}
 			},
@@ -70,11 +70,11 @@ func TestFindReferencesTool_Execute(t *testing.T) {
 			name: "no references found",
 			args: map[string]any{"file_path": "/path/to/file.go", "line": float64(10), "column": float64(5)},
 			setupMock: func() {
-				analysis.FindSymbolReferencesFunc = func(filePath string, line, column int) ([]string, error) {
+				analysis.FindSymbolReferencesFunc = func(filePath string, line, column int) ([]analysis.SymbolReference, error) {
 					assert.Equal(t, "/path/to/file.go", filePath)
 					assert.Equal(t, 10, line)
 					assert.Equal(t, 5, column)
-					return []string{}, nil
+					return []analysis.SymbolReference{}, nil
 				}
 			},
 			expectedLLM: "No references found for symbol at /path/to/file.go:10:5",
@@ -83,11 +83,14 @@ func TestFindReferencesTool_Execute(t *testing.T) {
 			name: "references found",
 			args: map[string]any{"file_path": "/path/to/file.go", "line": float64(10), "column": float64(5)},
 			setupMock: func() {
-				analysis.FindSymbolReferencesFunc = func(filePath string, line, column int) ([]string, error) {
-					return []string{"/path/to/other.go:20:3", "/path/to/another.go:5:1"}, nil
+				analysis.FindSymbolReferencesFunc = func(filePath string, line, column int) ([]analysis.SymbolReference, error) {
+					return []analysis.SymbolReference{
+						{FilePath: "/path/to/other.go", Line: 20, Column: 3, Kind: analysis.ReferenceKindCall, Snippet: "Foo()"},
+						{FilePath: "/path/to/another.go", Line: 5, Column: 1, Kind: analysis.ReferenceKindWrite, Snippet: "Foo = bar"},
+					}, nil
 				}
 			},
-			expectedLLM: "Found references for symbol at /path/to/file.go:10:5:\n/path/to/other.go:20:3\n/path/to/another.go:5:1",
+			expectedLLM: "Found references for symbol at /path/to/file.go:10:5:\n/path/to/other.go:20:3 [call] Foo()\n/path/to/another.go:5:1 [write] Foo = bar",
 		},
 	}
 
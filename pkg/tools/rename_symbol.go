@@ -23,7 +23,7 @@ func NewRenameSymbolTool(workspaceService types.WorkspaceServiceIface) *RenameSy
 		BaseDeclarativeTool: types.NewBaseDeclarativeTool(
 			RENAME_SYMBOL_TOOL_NAME,
 			"Rename Symbol",
-			"Safely renames a symbol (variable, function, struct, etc.) across all its usages in the codebase.",
+			"Safely renames a Go symbol (variable, function, type, field, method, etc.) across all its usages in the module, including interface methods it satisfies. Refuses renames that would cause collisions or shadowing. Returns a unified diff without writing any file unless 'apply' is true.",
 			types.KindEdit,
 			(&types.JsonSchemaObject{
 				Type: "object",
@@ -44,6 +44,14 @@ func NewRenameSymbolTool(workspaceService types.WorkspaceServiceIface) *RenameSy
 					Type:        "string",
 					Description: "The new name for the symbol.",
 				},
+				"apply": {
+					Type:        "boolean",
+					Description: "Optional: If true, write the renamed files. Otherwise only the diff of the rename is returned. Defaults to false.",
+				},
+				"update_tags": {
+					Type:        "boolean",
+					Description: "Optional: If true, also rename matching struct tag values (e.g. `json:\"oldName\"`) of a renamed field. Defaults to false.",
+				},
 			}).SetRequired([]string{"file_path", "line", "column", "new_name"}),
 			false, // isOutputMarkdown
 			true,  // canUpdateOutput - This tool modifies files
@@ -97,10 +105,15 @@ func (t *RenameSymbolTool) Execute(ctx context.Context, args map[string]any) (ty
 		}, fmt.Errorf("missing or invalid 'new_name' argument")
 	}
 
+	// Renames are previewed unless the caller explicitly applies them.
+	apply, _ := args["apply"].(bool)
+	opts := analysis.RenameOptions{DryRun: !apply}
+	opts.UpdateTags, _ = args["update_tags"].(bool)
+
 	projectRoot := t.workspaceService.GetProjectRoot()
 	absolutePath := filepath.Join(projectRoot, filePath)
 
-	err := analysis.RenameSymbol(absolutePath, line, column, newName)
+	result, err := analysis.RenameSymbol(absolutePath, line, column, newName, opts)
 	if err != nil {
 		return types.ToolResult{
 			Error: &types.ToolError{
@@ -110,7 +123,15 @@ func (t *RenameSymbolTool) Execute(ctx context.Context, args map[string]any) (ty
 		}, fmt.Errorf("failed to rename symbol: %w", err)
 	}
 
-	output := fmt.Sprintf("Successfully renamed symbol at %s:%d:%d to '%s'", absolutePath, line, column, newName)
+	var output string
+	if result.Applied {
+		output = fmt.Sprintf("Successfully renamed '%s' to '%s' at %s:%d:%d (%d edits in %d files)", result.OldName, result.NewName, absolutePath, line, column, result.Edits, len(result.ChangedFiles))
+	} else {
+		output = fmt.Sprintf("Preview of renaming '%s' to '%s' at %s:%d:%d (%d edits in %d files). No files were written", result.OldName, result.NewName, absolutePath, line, column, result.Edits, len(result.ChangedFiles))
+	}
+	if result.Diff != "" {
+		output += ":\n" + result.Diff
+	}
 	return types.ToolResult{
 		LLMContent:    output,
 		ReturnDisplay: output,
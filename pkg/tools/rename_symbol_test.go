@@ -69,25 +69,37 @@ func TestRenameSymbolTool_Execute(t *testing.T) {
 			name: "RenameSymbol returns error",
 			args: map[string]any{"file_path": "/path/to/file.go", "line": float64(10), "column": float64(5), "new_name": "NewFunc"},
 			setupMock: func() {
-				analysis.RenameSymbolFunc = func(filePath string, line, column int, newName string) error {
-					return fmt.Errorf("rename error")
+				analysis.RenameSymbolFunc = func(filePath string, line, column int, newName string, opts analysis.RenameOptions) (*analysis.RenameResult, error) {
+					return nil, fmt.Errorf("rename error")
 				}
 			},
 			expectedError: "failed to rename symbol: rename error",
 		},
 		{
 			name: "successful rename",
-			args: map[string]any{"file_path": "/path/to/file.go", "line": float64(10), "column": float64(5), "new_name": "NewFunc"},
+			args: map[string]any{"file_path": "/path/to/file.go", "line": float64(10), "column": float64(5), "new_name": "NewFunc", "apply": true},
 			setupMock: func() {
-				analysis.RenameSymbolFunc = func(filePath string, line, column int, newName string) error {
+				analysis.RenameSymbolFunc = func(filePath string, line, column int, newName string, opts analysis.RenameOptions) (*analysis.RenameResult, error) {
 					assert.Equal(t, "/path/to/file.go", filePath)
 					assert.Equal(t, 10, line)
 					assert.Equal(t, 5, column)
 					assert.Equal(t, "NewFunc", newName)
-					return nil
+					assert.Equal(t, analysis.RenameOptions{}, opts)
+					return &analysis.RenameResult{OldName: "OldFunc", NewName: "NewFunc", ChangedFiles: []string{"file.go"}, Edits: 2, Diff: "--- a/file.go\n+++ b/file.go\n", Applied: true}, nil
+				}
+			},
+			expectedLLM: "Successfully renamed 'OldFunc' to 'NewFunc' at /path/to/file.go:10:5 (2 edits in 1 files):\n--- a/file.go\n+++ b/file.go\n",
+		},
+		{
+			name: "preview rename by default",
+			args: map[string]any{"file_path": "/path/to/file.go", "line": float64(10), "column": float64(5), "new_name": "NewFunc", "update_tags": true},
+			setupMock: func() {
+				analysis.RenameSymbolFunc = func(filePath string, line, column int, newName string, opts analysis.RenameOptions) (*analysis.RenameResult, error) {
+					assert.Equal(t, analysis.RenameOptions{DryRun: true, UpdateTags: true}, opts)
+					return &analysis.RenameResult{OldName: "OldFunc", NewName: "NewFunc", ChangedFiles: []string{"file.go"}, Edits: 1, Diff: "diff"}, nil
 				}
 			},
-			expectedLLM: "Successfully renamed symbol at /path/to/file.go:10:5 to 'NewFunc'",
+			expectedLLM: "Preview of renaming 'OldFunc' to 'NewFunc' at /path/to/file.go:10:5 (1 edits in 1 files). No files were written:\ndiff",
 		},
 	}
 
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"sync"
+	"time"
 )
 
 // ApprovalMode defines the approval mode for tool calls.
@@ -61,9 +62,45 @@ const (
 
 // Executor Types
 const (
-	ExecutorTypeQwen   = "qwen"
-	ExecutorTypeGemini = "gemini"
-	ExecutorTypeMock   = "mock"
+	ExecutorTypeQwen      = "qwen"
+	ExecutorTypeGemini    = "gemini"
+	ExecutorTypeMock      = "mock"
+	ExecutorTypeOpenAI    = "openai"
+	ExecutorTypeAnthropic = "anthropic"
+	ExecutorTypeOllama    = "ollama"
+)
+
+// AutoModel is the model setting that lets the router pick the model of each turn.
+const AutoModel = "auto"
+
+// Classifiers of the routing settings.
+const (
+	RoutingClassifierHeuristic = "heuristic"
+	RoutingClassifierModel     = "model"
+)
+
+// Defaults of the openai executor.
+const (
+	DefaultOpenAIBaseURL   = "https://api.openai.com/v1"
+	DefaultOpenAIAPIKeyEnv = "OPENAI_API_KEY"
+)
+
+// Defaults of the anthropic executor.
+const (
+	DefaultAnthropicBaseURL   = "https://api.anthropic.com"
+	DefaultAnthropicAPIKeyEnv = "ANTHROPIC_API_KEY"
+	DefaultAnthropicMaxTokens = 8192
+)
+
+// DefaultOllamaBaseURL is the address of a local Ollama server.
+const DefaultOllamaBaseURL = "http://localhost:11434"
+
+// Defaults for retrying transient executor failures.
+const (
+	DefaultRetryMaxAttempts    = 3
+	DefaultRetryInitialBackoff = 1000  // Milliseconds
+	DefaultRetryMaxBackoff     = 30000 // Milliseconds
+	DefaultRetryJitter         = 0.2
 )
 
 // MCPServerStatus represents the connection status of an MCP server.
@@ -177,7 +214,8 @@ type Part struct {
 	FunctionResponse *FunctionResponse `json:"functionResponse,omitempty"`
 	InlineData       *InlineData       `json:"inlineData,omitempty"`
 	FileData         *FileData         `json:"fileData,omitempty"`
-	Thought          string            `json:"thought,omitempty"` // For thought parts
+	Thought          string            `json:"thought,omitempty"`          // For thought parts
+	ThoughtSignature string            `json:"thoughtSignature,omitempty"` // Opaque signature that must accompany a thought sent back to the model
 }
 
 // FunctionResponse represents a function response part.
@@ -221,12 +259,15 @@ type SessionMetrics struct {
 	OutputTokens int                         `json:"outputTokens"`
 	TotalTokens  int                         `json:"totalTokens"`
 	TokenUsage   map[string]*ModelTokenUsage `json:"tokenUsage"`
+	CostUSD      float64                     `json:"costUsd"`      // Cost of the session
+	DailyCostUSD float64                     `json:"dailyCostUsd"` // Cost of all sessions today
 }
 
 // ModelTokenUsage holds the token usage for a specific model.
 type ModelTokenUsage struct {
-	InputTokens  int `json:"inputTokens"`
-	OutputTokens int `json:"outputTokens"`
+	InputTokens  int     `json:"inputTokens"`
+	OutputTokens int     `json:"outputTokens"`
+	CostUSD      float64 `json:"costUsd"`
 }
 
 // JsonStreamEvent represents a single event in the JSON stream.
@@ -303,8 +344,16 @@ const (
 	ToolConfirmationOutcomeProceedAlways    ToolConfirmationOutcome = "PROCEED_ALWAYS"
 	ToolConfirmationOutcomeCancel           ToolConfirmationOutcome = "CANCEL"
 	ToolConfirmationOutcomeModifyWithEditor ToolConfirmationOutcome = "MODIFY_WITH_EDITOR"
+	ToolConfirmationOutcomeModify           ToolConfirmationOutcome = "MODIFY"
 )
 
+// ToolConfirmation is a reply to a ToolConfirmationRequestEvent.
+type ToolConfirmation struct {
+	Outcome ToolConfirmationOutcome `json:"outcome"`
+	// ModifiedArgs replaces the arguments of the tool call when Outcome is MODIFY.
+	ModifiedArgs map[string]interface{} `json:"modifiedArgs,omitempty"`
+}
+
 // AgentTerminateMode defines the reasons an agent might terminate.
 type AgentTerminateMode string
 
@@ -594,6 +643,14 @@ type SettingsServiceIface interface {
 	GetWorkspaceDir() string
 	GetCodebaseInvestigatorSettings() *CodebaseInvestigatorSettings
 	GetTestWriterSettings() *TestWriterSettings
+	GetServerAuthSettings() *ServerAuthSettings
+	GetOpenAISettings() *OpenAISettings
+	GetAnthropicSettings() *AnthropicSettings
+	GetOllamaSettings() *OllamaSettings
+	GetModelFallbackSettings() *ModelFallbackSettings
+	GetRetrySettings() *RetrySettings
+	GetRoutingSettings() *RoutingSettings
+	GetBudgetSettings() *BudgetSettings
 	Set(key string, value interface{}) error
 	AllSettings() map[string]interface{}
 	Reset() error
@@ -830,15 +887,65 @@ type ErrorEvent struct {
 type TokenCountEvent struct {
 	InputTokens  int
 	OutputTokens int
+	CostUSD      float64 // Set by the chat service from the pricing table
 }
 
+// BudgetWarningEvent is sent once when the cost of the session or of the day
+// passes its soft budget.
+type BudgetWarningEvent struct {
+	Scope   string // BudgetScopeSession or BudgetScopeDay
+	CostUSD float64
+	Limit   float64
+}
+
+// Scopes of the budgets.
+const (
+	BudgetScopeSession = "session"
+	BudgetScopeDay     = "day"
+)
+
 // ModelSwitchEvent is sent when the model is switched, e.g., due to fallback.
 type ModelSwitchEvent struct {
 	OldModel string
 	NewModel string
+	Executor string // The executor type of the new model
 	Reason   string
 }
 
+// RetryEvent is sent when a request that failed with a transient error is
+// about to be retried. Output streamed by the failed attempt is discarded.
+type RetryEvent struct {
+	Attempt     int // The attempt that is about to start, from 2
+	MaxAttempts int
+	Delay       time.Duration
+	Reason      string
+	Executor    string        // Name of the executor whose request failed
+	StatusCode  int           // HTTP status of the failure, 0 for network errors and timeouts
+	RetryAfter  time.Duration // Delay the provider asked for, 0 if it did not say
+}
+
+// PromptSizeEvent is sent before each request to the model with the size of
+// its prompt.
+type PromptSizeEvent struct {
+	Tokens        int
+	ContextWindow int // 0 when the context window of the model is unknown
+}
+
+// ContextReducedEvent is sent when the history was compressed or trimmed
+// before a request because its prompt came close to the context window.
+type ContextReducedEvent struct {
+	Method       string // ContextReductionCompressed or ContextReductionTrimmed
+	TokensBefore int
+	TokensAfter  int
+	TokensSaved  int
+}
+
+// Methods of reducing the history.
+const (
+	ContextReductionCompressed = "compressed"
+	ContextReductionTrimmed    = "trimmed"
+)
+
 type UserConfirmationRequestEvent struct {
 	ToolCallID string
 	Message    string
@@ -872,12 +979,104 @@ const (
 	WebSearchProviderTavily             WebSearchProvider = "tavily"
 )
 
+// OpenAISettings configures the openai executor, which works with any server
+// implementing the OpenAI chat-completions API.
+type OpenAISettings struct {
+	BaseURL   string            `json:"baseUrl"`
+	APIKeyEnv string            `json:"apiKeyEnv"` // Environment variable holding the API key
+	Headers   map[string]string `json:"headers,omitempty"`
+	Models    []string          `json:"models,omitempty"` // Models to offer; queried from the server when empty
+}
+
+// AnthropicSettings configures the anthropic executor, which uses the Anthropic Messages API.
+type AnthropicSettings struct {
+	BaseURL        string   `json:"baseUrl"`
+	APIKeyEnv      string   `json:"apiKeyEnv"` // Environment variable holding the API key
+	MaxTokens      int      `json:"maxTokens,omitempty"`
+	ThinkingBudget int      `json:"thinkingBudget,omitempty"` // Tokens of extended thinking; 0 disables it
+	Models         []string `json:"models,omitempty"`         // Models to offer; queried from the server when empty
+}
+
+// OllamaSettings configures the ollama executor, which uses the native API of an Ollama server.
+type OllamaSettings struct {
+	BaseURL   string `json:"baseUrl"`             // Defaults to OLLAMA_HOST, then DefaultOllamaBaseURL
+	Think     bool   `json:"think,omitempty"`     // Ask thinking models for their reasoning
+	KeepAlive string `json:"keepAlive,omitempty"` // How long the server keeps the model loaded, e.g. "30m"
+}
+
+// ModelFallback is an executor and model to switch to when the current model fails.
+type ModelFallback struct {
+	Executor string `json:"executor"`
+	Model    string `json:"model"`
+}
+
+// ModelFallbackSettings configures how a chat switches models on rate limits,
+// server errors, timeouts and context-length errors.
+type ModelFallbackSettings struct {
+	Chain    []ModelFallback `json:"chain,omitempty"`    // Tried in order; when empty, the routing suggester of the current executor is used
+	Cooldown int             `json:"cooldown,omitempty"` // Seconds before the primary model is restored; 0 saves the switch to the settings
+}
+
+// ModelPricing is the price of a model in USD per million tokens.
+type ModelPricing struct {
+	Input  float64 `json:"input"`
+	Output float64 `json:"output"`
+}
+
+// BudgetSettings configures the pricing of models and the budgets of a
+// session and of a day, in USD. Zero limits are not enforced.
+type BudgetSettings struct {
+	Pricing     map[string]ModelPricing `json:"pricing,omitempty"`     // By model name or prefix; added to the built-in prices
+	SessionSoft float64                 `json:"sessionSoft,omitempty"` // Warns once when the session costs more
+	SessionHard float64                 `json:"sessionHard,omitempty"` // Stops the session when it costs more
+	DailySoft   float64                 `json:"dailySoft,omitempty"`   // Warns once when the day costs more
+	DailyHard   float64                 `json:"dailyHard,omitempty"`   // Stops all sessions when the day costs more
+}
+
+// RoutingSettings configures how the model of each turn is picked when the
+// model setting is "auto".
+type RoutingSettings struct {
+	Classifier      string `json:"classifier,omitempty"`      // "heuristic" (default) scores the request locally; "model" asks ClassifierModel
+	ClassifierModel string `json:"classifierModel,omitempty"` // Model of the current executor asked by the "model" classifier; defaults to the fast tier
+	FastModel       string `json:"fastModel,omitempty"`       // Overrides the fast tier of the current executor
+	StrongModel     string `json:"strongModel,omitempty"`     // Overrides the strong tier of the current executor
+}
+
+// RetrySettings configures how executor requests are retried on rate limits,
+// server errors and timeouts. Zero values use the defaults.
+type RetrySettings struct {
+	MaxAttempts    int     `json:"maxAttempts,omitempty"`    // Including the first attempt; 1 disables retries
+	InitialBackoff int     `json:"initialBackoff,omitempty"` // Milliseconds before the first retry, doubled on each retry
+	MaxBackoff     int     `json:"maxBackoff,omitempty"`     // Upper bound of the backoff in milliseconds
+	Jitter         float64 `json:"jitter,omitempty"`         // Fraction of the backoff randomly added or removed
+}
+
 // TavilySettings represents the configuration for Tavily web search.
 type TavilySettings struct {
 	ApiKey string `json:"apiKey"`
 }
 
+// ServerAuthSettings configures authentication of the agent server. With no
+// tokens and no webhook secret, the server accepts unauthenticated requests.
+type ServerAuthSettings struct {
+	Tokens               []ServerToken `json:"tokens,omitempty"`
+	WebhookSecret        string        `json:"webhookSecret,omitempty"`        // Key of the HMAC-SHA256 signature of webhook tasks and callbacks
+	AllowedOrigins       []string      `json:"allowedOrigins,omitempty"`       // Origins allowed to open /ws besides the server's own; "*" allows any
+	CallbackAllowedHosts []string      `json:"callbackAllowedHosts,omitempty"` // Hosts task callbacks may reach although they are loopback, link-local or private
+}
+
+// ServerToken is a bearer token of the agent server and the scopes it grants.
+type ServerToken struct {
+	Name   string   `json:"name,omitempty"`
+	Token  string   `json:"token"`
+	Scopes []string `json:"scopes"`
+}
+
 // WebhookTaskRequest represents the JSON body for a task submitted via webhook.
 type WebhookTaskRequest struct {
 	Prompt string `json:"prompt"`
+	// CallbackURL, if set, receives a POST with the task once it finishes.
+	CallbackURL string `json:"callbackUrl,omitempty"`
+	// Priority orders queued tasks; higher runs first.
+	Priority int `json:"priority,omitempty"`
 }
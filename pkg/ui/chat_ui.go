@@ -14,6 +14,7 @@ import (
 	"go-ai-agent-v2/go-cli/pkg/utils"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
@@ -68,6 +69,7 @@ type ChatModel struct {
 	startTime      time.Time
 	toolCallCount  int
 	toolErrorCount int
+	promptSize     types.PromptSizeEvent // Of the last request
 	contextFile    string
 	sessionID      string
 	todosSummary   string
@@ -192,6 +194,11 @@ func (m *ChatModel) GetStats() (int, int, time.Duration, map[string]*types.Model
 	return m.toolCallCount, m.toolErrorCount, time.Since(m.startTime), m.chatService.GetTokenUsage()
 }
 
+// GetCosts returns the cost in USD of the session and of the day.
+func (m *ChatModel) GetCosts() (float64, float64) {
+	return m.chatService.GetCosts()
+}
+
 // SetChatService updates the ChatModel's chatService and executorType.
 func (m *ChatModel) SetChatService(newSvc *services.ChatService, newExecutorType string) {
 	m.chatService = newSvc
@@ -412,10 +419,25 @@ func (m *ChatModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			m.messages = append(m.messages, errmsg)
 			m.logUIMessage(errmsg) // Log error message
 		case types.ModelSwitchEvent:
-			m.executorType = event.NewModel
+			if event.Executor != "" {
+				m.executorType = event.Executor
+			}
 			botMsg := BotMessage{Content: fmt.Sprintf("Automatically switched from **%s** to **%s** due to: %s", event.OldModel, event.NewModel, event.Reason)}
 			m.messages = append(m.messages, botMsg)
 			m.logUIMessage(botMsg)
+		case types.BudgetWarningEvent:
+			botMsg := BotMessage{Content: fmt.Sprintf("⚠️ The %s cost **$%.4f** passed the soft budget of $%.2f.", event.Scope, event.CostUSD, event.Limit)}
+			m.messages = append(m.messages, botMsg)
+			m.logUIMessage(botMsg)
+		case types.PromptSizeEvent:
+			m.promptSize = event
+		case types.ContextReducedEvent:
+			botMsg := BotMessage{Content: fmt.Sprintf("The conversation was %s to fit the context window, saving **%d tokens** (%d → %d).", event.Method, event.TokensSaved, event.TokensBefore, event.TokensAfter)}
+			m.messages = append(m.messages, botMsg)
+			m.logUIMessage(botMsg)
+		case types.RetryEvent:
+			m.status = fmt.Sprintf("%s, retrying (%d/%d) in %s...", event.Reason, event.Attempt, event.MaxAttempts, event.Delay.Round(100*time.Millisecond))
+			m.logSystemMessage(m.status)
 		}
 		m.updateViewport()
 		return m, waitForEvent(m.streamCh) // Continue waiting for events
@@ -591,6 +613,12 @@ func (m *ChatModel) renderFooter() string {
 		toolsStats = fmt.Sprintf("Tools: %d", m.toolCallCount)
 	}
 	stats := fmt.Sprintf("%s | Time: %02d:%02d:%02d", toolsStats, hours, minutes, seconds)
+	if sessionCost, dailyCost := m.chatService.GetCosts(); sessionCost > 0 || dailyCost > 0 {
+		stats += fmt.Sprintf(" | Cost: $%.4f (today $%.2f)", sessionCost, dailyCost)
+	}
+	if m.promptSize.ContextWindow > 0 {
+		stats += fmt.Sprintf(" | Context: %d%%", m.promptSize.Tokens*100/m.promptSize.ContextWindow)
+	}
 	// Right side: Model name and Session ID
 	right := fmt.Sprintf("%s | Session: %s", m.modelStyle.Render(m.executorType), m.modelStyle.Render(m.sessionID))
 	// Calculate remaining space
@@ -628,7 +656,17 @@ func (m *ChatModel) handleSlashCommand(input string) (*ChatModel, tea.Cmd) {
 		case "compress":
 			m.status = "Compressing history..."
 			m.isStreaming = true // Show spinner
-			return m, compressHistoryCmd(m.chatService)
+			return m, compressHistoryCmd(m.chatService, m.sessionID)
+		case "fork", "rewind":
+			if m.isStreaming {
+				m.messages = append(m.messages, ErrorMessage{Err: fmt.Errorf("/%s is not available while a response is streaming", args[0])})
+				m.updateViewport()
+				return m, nil
+			}
+			if args[0] == "fork" {
+				return m.forkSession(args[1:])
+			}
+			return m.rewindSession(args[1:])
 		case "clear":
 			m.chatService.ClearHistory()
 			m.messages = createInitialMessages()
@@ -640,8 +678,10 @@ func (m *ChatModel) handleSlashCommand(input string) (*ChatModel, tea.Cmd) {
 **Session Management**
 * ` + "`/clear`" + ` - Clears the current chat session history.
 * ` + "`/compress`" + ` - Summarizes the current session to save tokens.
-* ` + "`/sessions list`" + ` - Lists all saved chat sessions.
+* ` + "`/sessions list [filter]`" + ` - Lists saved chat sessions with their titles. Filter and sort them with words of the title and terms like ` + "`model:gpt-4o since:7d sort:cost`" + `.
 * ` + "`/sessions resume <id>`" + ` - Resumes a session by its ID or list number.
+* ` + "`/fork [index]`" + ` - Continues in a copy of the session with its first ` + "`index`" + ` messages, or all of them. The original session is kept.
+* ` + "`/rewind [turns]`" + ` - Drops the last turns of the session, 1 by default, and puts the last dropped prompt back in the input.
 **Application**
 * ` + "`/help`" + ` - Shows this help message.
 * ` + "`/quit` or `/exit`" + ` - Exits the application.
@@ -663,16 +703,30 @@ func (m *ChatModel) handleSlashCommand(input string) (*ChatModel, tea.Cmd) {
 			}
 			switch args[1] {
 			case "list":
-				sessions, err := m.sessionService.ListSessions()
+				options, err := services.ParseSessionListOptions(args[2:])
+				var sessions []*services.SessionMetadata
+				if err == nil {
+					sessions, err = m.sessionService.ListSessionMetadata(options)
+				}
 				if err != nil {
 					m.messages = append(m.messages, ErrorMessage{Err: err})
 				} else if len(sessions) == 0 {
 					m.messages = append(m.messages, BotMessage{Content: "No saved sessions found."})
 				} else {
 					var sessionList strings.Builder
-					sessionList.WriteString("Available sessions (newest first):\n")
-					for i, id := range sessions {
-						sessionList.WriteString(fmt.Sprintf("  %d: %s\n", i+1, id))
+					sessionList.WriteString("Available sessions:\n")
+					for i, session := range sessions {
+						sessionList.WriteString(fmt.Sprintf("  %d: `%s` **%s** (%s, %d messages", i+1, session.ID, session.Title, session.UpdatedAt.Format("2006-01-02 15:04"), session.MessageCount))
+						if session.Model != "" {
+							sessionList.WriteString(", " + session.Model)
+						}
+						if session.CostUSD > 0 {
+							sessionList.WriteString(fmt.Sprintf(", $%.4f", session.CostUSD))
+						}
+						if session.ParentID != "" {
+							sessionList.WriteString(fmt.Sprintf(", fork of `%s`", session.ParentID))
+						}
+						sessionList.WriteString(")\n")
 					}
 					m.messages = append(m.messages, BotMessage{Content: sessionList.String()})
 				}
@@ -727,6 +781,79 @@ func (m *ChatModel) handleSlashCommand(input string) (*ChatModel, tea.Cmd) {
 	m.isStreaming = true
 	return m, executeCommandCmd(m.commandExecutor, args)
 }
+
+// forkSession forks the current session at a message index, the whole
+// history by default, and continues in the fork.
+func (m *ChatModel) forkSession(args []string) (*ChatModel, tea.Cmd) {
+	history, err := m.sessionService.LoadHistory(m.sessionID)
+	index := len(history)
+	if err == nil && len(args) > 0 {
+		index, err = strconv.Atoi(args[0])
+		if err != nil {
+			err = fmt.Errorf("usage: /fork [message index]")
+		}
+	}
+	var forkID string
+	if err == nil {
+		forkID, err = m.sessionService.ForkSession(m.sessionID, index)
+	}
+	if err != nil {
+		m.messages = append(m.messages, ErrorMessage{Err: fmt.Errorf("failed to fork session: %w", err)})
+		m.updateViewport()
+		return m, nil
+	}
+
+	parentID := m.sessionID
+	m.sessionID = forkID
+	m.messages = m.repopulateMessagesFromHistory(history[:index])
+	m.messages = append(m.messages, BotMessage{Content: fmt.Sprintf("Forked session `%s` at message %d into `%s`. The original session is unchanged.", parentID, index, forkID)})
+	m.status = fmt.Sprintf("Forked session %s", forkID)
+	m.updateViewport()
+	return m, nil
+}
+
+// rewindSession drops the last turns of the current session, 1 by default,
+// and puts the prompt of the earliest dropped turn back in the input.
+func (m *ChatModel) rewindSession(args []string) (*ChatModel, tea.Cmd) {
+	turns := 1
+	var err error
+	if len(args) > 0 {
+		if turns, err = strconv.Atoi(args[0]); err != nil {
+			err = fmt.Errorf("usage: /rewind [turns]")
+		}
+	}
+	var dropped []*types.Content
+	if err == nil {
+		dropped, err = m.sessionService.RewindSession(m.sessionID, turns)
+	}
+	if err != nil {
+		m.messages = append(m.messages, ErrorMessage{Err: fmt.Errorf("failed to rewind session: %w", err)})
+		m.updateViewport()
+		return m, nil
+	}
+
+	history, err := m.sessionService.LoadHistory(m.sessionID)
+	if err != nil {
+		m.messages = append(m.messages, ErrorMessage{Err: err})
+		m.updateViewport()
+		return m, nil
+	}
+	m.messages = m.repopulateMessagesFromHistory(history)
+	summary := "Rewound the last turn"
+	if turns > 1 {
+		summary = fmt.Sprintf("Rewound the last %d turns", turns)
+	}
+	m.messages = append(m.messages, BotMessage{Content: fmt.Sprintf("%s (%d messages). Edit the prompt and send it to retry.", summary, len(dropped))})
+	var prompt strings.Builder
+	for _, part := range dropped[0].Parts {
+		prompt.WriteString(part.Text)
+	}
+	m.textarea.SetValue(prompt.String())
+	m.status = fmt.Sprintf("Rewound session %s", m.sessionID)
+	m.updateViewport()
+	return m, nil
+}
+
 func (m *ChatModel) repopulateMessagesFromHistory(history []*types.Content) []Message {
 	newMessages := createInitialMessages()
 	for _, content := range history {
@@ -865,9 +992,9 @@ func ReinitializeChatCmd(oldChatService *services.ChatService, sessionService *s
 		return chatServiceReloadedMsg{newService: newChatService, newExecutorType: executorType}
 	}
 }
-func compressHistoryCmd(cs *services.ChatService) tea.Cmd {
+func compressHistoryCmd(cs *services.ChatService, sessionID string) tea.Cmd {
 	return func() tea.Msg {
-		res, err := cs.CompressHistory()
+		res, err := cs.CompressHistory(sessionID)
 		return compressionResultMsg{result: res, err: err}
 	}
 }